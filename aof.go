@@ -0,0 +1,154 @@
+package raftbuntdb
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errCorruptAOF is returned by aofReader when the file holds something
+// other than a sequence of complete buntdb commands.
+var errCorruptAOF = errors.New("corrupt aof")
+
+// aofReader reads the commands of a buntdb append-only file.
+type aofReader struct {
+	rd *bufio.Reader
+	n  int64 // bytes consumed by complete commands
+}
+
+func newAOFReader(rd io.Reader) *aofReader {
+	return &aofReader{rd: bufio.NewReader(rd)}
+}
+
+// next returns the next command. It returns io.EOF at a clean end of the
+// file and errCorruptAOF for a torn or malformed command.
+func (r *aofReader) next() ([]string, error) {
+	var n int64
+	line, err := r.readLine(&n)
+	if err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, io.EOF
+		}
+		return nil, errCorruptAOF
+	}
+	if len(line) < 2 || line[0] != '*' {
+		return nil, errCorruptAOF
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 1 {
+		return nil, errCorruptAOF
+	}
+	parts := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := r.readLine(&n)
+		if err != nil || len(line) < 2 || line[0] != '$' {
+			return nil, errCorruptAOF
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errCorruptAOF
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r.rd, buf); err != nil {
+			return nil, errCorruptAOF
+		}
+		n += int64(len(buf))
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, errCorruptAOF
+		}
+		parts = append(parts, string(buf[:size]))
+	}
+	switch strings.ToLower(parts[0]) {
+	case "set":
+		if len(parts) < 3 {
+			return nil, errCorruptAOF
+		}
+	case "del":
+		if len(parts) != 2 {
+			return nil, errCorruptAOF
+		}
+	case "flushdb":
+	default:
+		return nil, errCorruptAOF
+	}
+	r.n += n
+	return parts, nil
+}
+
+// readLine reads a CRLF terminated line, without the CRLF.
+func (r *aofReader) readLine(n *int64) (string, error) {
+	line, err := r.rd.ReadString('\n')
+	*n += int64(len(line))
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errCorruptAOF
+	}
+	return line[:len(line)-2], nil
+}
+
+// appendCommand appends a command to buf in the AOF format.
+func appendCommand(buf []byte, parts ...string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(parts)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, part := range parts {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(part)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, part...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// recoverTail truncates the file at path following its last complete
+// command. The original file is first copied to path+".bak". It returns
+// false if the file did not need to be truncated.
+func recoverTail(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	rd := newAOFReader(f)
+	for {
+		if _, err := rd.next(); err != nil {
+			if err == io.EOF {
+				f.Close()
+				return false, nil
+			}
+			break
+		}
+	}
+	valid := rd.n
+
+	// Keep a copy of the original file
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return false, err
+	}
+	bak, err := os.Create(path + ".bak")
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+	_, err = io.Copy(bak, f)
+	f.Close()
+	if err == nil {
+		err = bak.Sync()
+	}
+	if cerr := bak.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := os.Truncate(path, valid); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,94 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestAOFReader(t *testing.T) {
+	var buf []byte
+	buf = appendCommand(buf, "set", "key", "val")
+	buf = appendCommand(buf, "del", "key")
+	valid := int64(len(buf))
+	buf = append(buf, "*3\r\n$3\r\nset\r\n$3\r\nke"...)
+
+	rd := newAOFReader(bytes.NewReader(buf))
+	parts, err := rd.next()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(parts, []string{"set", "key", "val"}) {
+		t.Fatalf("bad: %v", parts)
+	}
+	if _, err := rd.next(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := rd.next(); err != errCorruptAOF {
+		t.Fatalf("expected corrupt error, got: %v", err)
+	}
+	if rd.n != valid {
+		t.Fatalf("expected %d, got %d", valid, rd.n)
+	}
+
+	rd = newAOFReader(bytes.NewReader(buf[:valid]))
+	rd.next()
+	rd.next()
+	if _, err := rd.next(); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+}
+
+func TestBuntStore_RecoverCorruptTail(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+	defer os.Remove(store.path + ".bak")
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	// Simulate a torn write at the end of the file
+	f, err := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f.WriteString("*3\r\n$3\r\nset\r\n$22\r\nl:000")
+	f.Close()
+	fi, _ := os.Stat(store.path)
+
+	// Fails without the option
+	if _, err := NewBuntStore(store.path, Medium); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	store, err = Open(store.path, &Options{RecoverCorruptTail: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	idx, err := store.LastIndex()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx != 2 {
+		t.Fatalf("bad: %d", idx)
+	}
+
+	// The original file was kept
+	bak, err := os.Stat(store.path + ".bak")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if bak.Size() != fi.Size() {
+		t.Fatalf("expected %d, got %d", fi.Size(), bak.Size())
+	}
+}
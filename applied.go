@@ -0,0 +1,53 @@
+package raftbuntdb
+
+import (
+	"github.com/tidwall/buntdb"
+)
+
+// appliedKey holds the index of the last log applied to the FSM.
+const appliedKey = dbMeta + "applied"
+
+// SetAppliedIndex records idx as the index of the last log applied to the
+// FSM.
+func (b *BuntStore) SetAppliedIndex(idx uint64) error {
+	return b.update(func(tx *buntdb.Tx) error {
+		return setAppliedIndex(tx, idx)
+	})
+}
+
+// AppliedIndex returns the index recorded by SetAppliedIndex or
+// ApplyAndStore, or zero if none was.
+func (b *BuntStore) AppliedIndex() (uint64, error) {
+	var idx uint64
+	err := b.view(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(appliedKey)
+		if err != nil {
+			if err == buntdb.ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		idx, err = parseUint64(val)
+		return err
+	})
+	return idx, err
+}
+
+// ApplyAndStore runs fn, which applies the log at idx to an FSM kept in
+// the same file, and records idx as the applied index in the same
+// transaction. Either both are committed or neither is, so after a crash
+// the FSM resumes from exactly the log after AppliedIndex. fn follows the
+// rules of Update.
+func (b *BuntStore) ApplyAndStore(idx uint64, fn func(tx *buntdb.Tx) error) error {
+	return b.update(func(tx *buntdb.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return setAppliedIndex(tx, idx)
+	})
+}
+
+func setAppliedIndex(tx *buntdb.Tx, idx uint64) error {
+	_, _, err := tx.Set(appliedKey, formatUint64(idx), nil)
+	return err
+}
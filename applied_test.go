@@ -0,0 +1,60 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestBuntStore_AppliedIndex(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+
+	if idx, err := store.AppliedIndex(); err != nil || idx != 0 {
+		t.Fatalf("bad: %d %v", idx, err)
+	}
+	if err := store.SetAppliedIndex(5); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err := store.ApplyAndStore(6, func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set("app:x", "6", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A failed apply changes neither the FSM nor the index
+	errApply := errors.New("apply")
+	err = store.ApplyAndStore(7, func(tx *buntdb.Tx) error {
+		tx.Set("app:x", "7", nil)
+		return errApply
+	})
+	if err != errApply {
+		t.Fatalf("err: %v", err)
+	}
+
+	store.Close()
+	store, err = NewBuntStore(store.path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if idx, err := store.AppliedIndex(); err != nil || idx != 6 {
+		t.Fatalf("bad: %d %v", idx, err)
+	}
+	store.View(func(tx *buntdb.Tx) error {
+		if val, _ := tx.Get("app:x"); val != "6" {
+			t.Fatalf("bad: %q", val)
+		}
+		return nil
+	})
+
+	// The marker isn't a stable key, so CopyStore doesn't carry it over
+	// without the FSM state
+	if keys, _ := store.StableKeys(); len(keys) != 0 {
+		t.Fatalf("bad: %q", keys)
+	}
+}
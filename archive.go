@@ -0,0 +1,87 @@
+package raftbuntdb
+
+import (
+	"os"
+	"sync"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// Archiver receives log entries before they are deleted by DeleteRange or
+// compaction. If Archive returns an error the entries are not deleted.
+type Archiver interface {
+	Archive(logs []*raft.Log) error
+}
+
+// archiveRange passes the logs between min and max inclusively to the
+// archiver.
+func (b *BuntStore) archiveRange(tx *buntdb.Tx, min, max uint64) error {
+	var logs []*raft.Log
+	var cerr error
+	err := b.keys.ascendLogs(tx, min,
+		func(key, val string) bool {
+			idx := logIndex(key)
+			if idx > max {
+				return false
+			}
+			if val, cerr = b.readLog(tx, key, val); cerr != nil {
+				cerr = &ErrCorruptEntry{Index: idx, Err: cerr}
+				return false
+			}
+			log := new(raft.Log)
+			if cerr = decodeLog(idx, val, log); cerr != nil {
+				cerr = corruptEntry(idx, val, cerr)
+				return false
+			}
+			logs = append(logs, log)
+			return true
+		})
+	// A failed scan would archive only part of the range
+	if err = firstErr(err, cerr); err != nil || len(logs) == 0 {
+		return err
+	}
+	return b.opts.Archiver.Archive(logs)
+}
+
+// FileArchiver is an Archiver that appends entries to a file in the
+// database file format, so an archive can be opened as a BuntStore.
+type FileArchiver struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileArchiver opens the archive at path, creating it if needed.
+func NewFileArchiver(path string) (*FileArchiver, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &FileArchiver{f: f}, nil
+}
+
+// Archive appends the logs to the archive and syncs it.
+func (a *FileArchiver) Archive(logs []*raft.Log) error {
+	var buf []byte
+	for _, log := range logs {
+		val, err := encodeLog(log)
+		if err != nil {
+			return err
+		}
+		buf = appendCommand(buf, "set",
+			dbLogs+uint64ToString(log.Index), string(val))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.f.Write(buf); err != nil {
+		return err
+	}
+	return a.f.Sync()
+}
+
+// Close closes the archive file.
+func (a *FileArchiver) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.f.Close()
+}
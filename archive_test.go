@@ -0,0 +1,113 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+type testArchiver struct {
+	logs []*raft.Log
+	err  error
+}
+
+func (a *testArchiver) Archive(logs []*raft.Log) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.logs = append(a.logs, logs...)
+	return nil
+}
+
+func TestBuntStore_Archiver(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+	archiver := &testArchiver{}
+	store.opts.Archiver = archiver
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(8, 10); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.CompactTo(2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expect := append(logs[7:10:10], logs[0:2]...)
+	if !reflect.DeepEqual(archiver.logs, expect) {
+		t.Fatalf("bad: %v", archiver.logs)
+	}
+
+	// Entries are kept if archiving fails
+	archiver.err = errors.New("archive failed")
+	if err := store.DeleteRange(3, 3); err != archiver.err {
+		t.Fatalf("expected archive error, got: %v", err)
+	}
+	if err := store.GetLog(3, new(raft.Log)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Nothing is archived if the scan fails
+	archiver.err, archiver.logs = nil, nil
+	tx, err := store.db.Begin(false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tx.Rollback()
+	if err := store.archiveRange(tx, 3, 7); err != buntdb.ErrTxClosed {
+		t.Fatalf("expected tx closed error, got: %v", err)
+	}
+	if archiver.logs != nil {
+		t.Fatalf("bad: %v", archiver.logs)
+	}
+}
+
+func TestFileArchiver(t *testing.T) {
+	fh, err := ioutil.TempFile("", "bunt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fh.Close()
+	os.Remove(fh.Name())
+	defer os.Remove(fh.Name())
+
+	archiver, err := NewFileArchiver(fh.Name())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+	}
+	if err := archiver.Archive(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := archiver.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The archive opens as a store
+	store, err := NewBuntStore(fh.Name(), Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	result := new(raft.Log)
+	if err := store.GetLog(2, result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, logs[1]) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
@@ -0,0 +1,51 @@
+package raftbuntdb
+
+import "github.com/tidwall/raft"
+
+// logFuture is the raft.Future returned by StoreLogsAsync.
+type logFuture struct {
+	req *commitRequest
+}
+
+// Error blocks until the logs are committed and returns the error of the
+// write, if any. It can be called more than once.
+func (f *logFuture) Error() error {
+	<-f.req.done
+	return f.req.err
+}
+
+// StoreLogsAsync queues logs to be stored and returns a future without
+// waiting for the commit, so callers can pipeline appends and only wait for
+// durability where they need it. Queued writes are committed in order,
+// together with any StoreLogs calls when group commit is enabled. Without
+// group commit, a StoreLogs or DeleteRange call may run before writes that
+// are still queued; call Flush first.
+func (b *BuntStore) StoreLogsAsync(logs []*raft.Log) raft.Future {
+	if err := b.calls.enter(); err != nil {
+		req := &commitRequest{err: err, done: make(chan struct{})}
+		close(req.done)
+		return &logFuture{req: req}
+	}
+	defer b.calls.leave()
+	return &logFuture{req: b.submit(logs, true)}
+}
+
+// Flush waits for every write queued by StoreLogsAsync before the call to
+// commit. It returns the first error of those writes since the last
+// Flush.
+func (b *BuntStore) Flush() error {
+	if err := b.calls.enter(); err != nil {
+		return err
+	}
+	defer b.calls.leave()
+	req := b.submit(nil, false)
+	<-req.done
+	b.commits.mu.Lock()
+	err := b.commits.asyncErr
+	b.commits.asyncErr = nil
+	b.commits.mu.Unlock()
+	if err == nil {
+		err = req.err
+	}
+	return err
+}
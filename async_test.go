@@ -0,0 +1,52 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_StoreLogsAsync(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{StrictAppend: true})
+	defer os.Remove(store.path)
+
+	var futures []raft.Future
+	for i := uint64(1); i <= 20; i++ {
+		futures = append(futures,
+			store.StoreLogsAsync([]*raft.Log{testRaftLog(i, "log")}))
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, f := range futures {
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if idx, _ := store.LastIndex(); idx != 20 {
+		t.Fatalf("bad: %d", idx)
+	}
+
+	// Errors surface on the future and on the next Flush
+	f := store.StoreLogsAsync([]*raft.Log{testRaftLog(30, "log")})
+	var nc *ErrNonContiguous
+	if err := f.Error(); !errors.As(err, &nc) {
+		t.Fatalf("expected non-contiguous error, got: %v", err)
+	}
+	if err := store.Flush(); !errors.As(err, &nc) {
+		t.Fatalf("expected non-contiguous error, got: %v", err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	store.Close()
+	if err := store.StoreLogsAsync([]*raft.Log{testRaftLog(21, "log")}).Error(); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if err := store.Flush(); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package raftbuntdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// dbAudit is the prefix of the keys of the audit log.
+const dbAudit = "a:"
+
+// AuditPolicy enables a log of the changes to the stable store, such as to
+// find out when the term or the vote changed after a split brain. Each
+// change made by Set, SetUint64, Delete, NormalizeUint64Keys and
+// BootstrapCluster is recorded in the same transaction. Restores and Reset
+// are not recorded. Entries beyond either limit are deleted as new ones
+// are recorded.
+type AuditPolicy struct {
+	// MaxEntries is the number of entries to keep. Defaults to 10000.
+	MaxEntries int
+
+	// MaxAge is how long to keep entries. Zero keeps them until
+	// MaxEntries is reached.
+	MaxAge time.Duration
+}
+
+func (p *AuditPolicy) maxEntries() uint64 {
+	if p.MaxEntries <= 0 {
+		return 10000
+	}
+	return uint64(p.MaxEntries)
+}
+
+// AuditOp is the kind of change of an AuditEntry.
+type AuditOp string
+
+const (
+	AuditSet    AuditOp = "set"
+	AuditDelete AuditOp = "delete"
+)
+
+// AuditEntry is a change to a stable key. The values are recorded as the
+// hex SHA-256 of their contents, and are empty when the key didn't exist
+// before or after the change.
+type AuditEntry struct {
+	Seq     uint64    `json:"-"`
+	Time    time.Time `json:"time"`
+	Op      AuditOp   `json:"op"`
+	Key     string    `json:"key"`
+	OldHash string    `json:"old,omitempty"`
+	NewHash string    `json:"new,omitempty"`
+}
+
+// valueHash returns the hash of a stable value recorded in the audit log,
+// or "" if the key doesn't exist.
+func valueHash(val string, ok bool) string {
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256(stringToBytes(val))
+	return hex.EncodeToString(sum[:])
+}
+
+// setStable sets the stable key to val under the prefix conf, recording
+// the change in the audit log of the policy.
+func setStable(tx *buntdb.Tx, conf, key, val string, policy *AuditPolicy) error {
+	prev, replaced, err := tx.Set(conf+key, val, nil)
+	if err != nil {
+		return err
+	}
+	return audit(tx, policy, AuditSet, key, valueHash(prev, replaced),
+		valueHash(val, true))
+}
+
+// audit records a change to the stable key in the audit log and trims the
+// entries beyond the policy. It does nothing with a nil policy.
+func audit(tx *buntdb.Tx, policy *AuditPolicy, op AuditOp, key, oldHash,
+	newHash string) error {
+	if policy == nil {
+		return nil
+	}
+	var last uint64
+	err := tx.DescendLessOrEqual("", dbAudit+"~", func(key, val string) bool {
+		if strings.HasPrefix(key, dbAudit) {
+			last = stringToUint64(key[len(dbAudit):])
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	data, err := json.Marshal(AuditEntry{Time: now, Op: op, Key: key,
+		OldHash: oldHash, NewHash: newHash})
+	if err != nil {
+		return err
+	}
+	seq := last + 1
+	if _, _, err := tx.Set(dbAudit+uint64ToString(seq), string(data), nil); err != nil {
+		return err
+	}
+
+	// Trim the oldest entries
+	var stale []string
+	err = tx.AscendGreaterOrEqual("", dbAudit, func(key, val string) bool {
+		if !strings.HasPrefix(key, dbAudit) {
+			return false
+		}
+		idx := stringToUint64(key[len(dbAudit):])
+		if seq-idx+1 <= policy.maxEntries() {
+			if policy.MaxAge <= 0 {
+				return false
+			}
+			var e AuditEntry
+			if json.Unmarshal([]byte(val), &e) == nil &&
+				now.Sub(e.Time) <= policy.MaxAge {
+				return false
+			}
+		}
+		if idx != seq {
+			stale = append(stale, key)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if _, err := tx.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditLog calls iter with the entries of the audit log from seq, oldest
+// first, until it returns false. The log is empty unless the store was
+// opened with Options.Audit.
+func (b *BuntStore) AuditLog(seq uint64, iter func(e AuditEntry) bool) error {
+	var entries []AuditEntry
+	err := b.viewStable(func(tx *buntdb.Tx) error {
+		var err error
+		pivot := dbAudit + uint64ToString(seq)
+		tx.AscendGreaterOrEqual("", pivot, func(key, val string) bool {
+			if !strings.HasPrefix(key, dbAudit) {
+				return false
+			}
+			var e AuditEntry
+			if err = json.Unmarshal([]byte(val), &e); err != nil {
+				return false
+			}
+			e.Seq = stringToUint64(key[len(dbAudit):])
+			entries = append(entries, e)
+			return true
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !iter(e) {
+			break
+		}
+	}
+	return nil
+}
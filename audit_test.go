@@ -0,0 +1,121 @@
+package raftbuntdb
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func auditEntries(t *testing.T, store *BuntStore, seq uint64) []AuditEntry {
+	t.Helper()
+	var entries []AuditEntry
+	err := store.AuditLog(seq, func(e AuditEntry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return entries
+}
+
+func TestBuntStore_Audit(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{Audit: &AuditPolicy{}})
+	defer os.Remove(store.path)
+	defer store.Close()
+	if err := store.SetUint64([]byte("CurrentTerm"), 1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Set([]byte("LastVoteCand"), []byte("node1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Delete([]byte("LastVoteCand")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Delete([]byte("LastVoteCand")); err != ErrKeyNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := store.Get([]byte("LastVoteCand")); err != ErrKeyNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+
+	entries := auditEntries(t, store, 0)
+	if len(entries) != 4 {
+		t.Fatalf("bad: %+v", entries)
+	}
+	one, two := valueHash("1", true), valueHash("2", true)
+	for i, want := range []AuditEntry{
+		{Seq: 1, Op: AuditSet, Key: "CurrentTerm", NewHash: one},
+		{Seq: 2, Op: AuditSet, Key: "LastVoteCand", NewHash: valueHash("node1", true)},
+		{Seq: 3, Op: AuditSet, Key: "CurrentTerm", OldHash: one, NewHash: two},
+		{Seq: 4, Op: AuditDelete, Key: "LastVoteCand", OldHash: valueHash("node1", true)},
+	} {
+		e := entries[i]
+		if e.Time.IsZero() {
+			t.Fatalf("bad: %+v", e)
+		}
+		e.Time = time.Time{}
+		if e != want {
+			t.Fatalf("bad: %+v, want %+v", e, want)
+		}
+	}
+	if entries := auditEntries(t, store, 3); len(entries) != 2 || entries[0].Seq != 3 {
+		t.Fatalf("bad: %+v", entries)
+	}
+
+	// The audit log isn't part of the stable store
+	keys, err := store.StableKeys()
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("bad: %v %q", err, keys)
+	}
+}
+
+func TestBuntStore_AuditRetention(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{Audit: &AuditPolicy{MaxEntries: 3}})
+	defer os.Remove(store.path)
+	defer store.Close()
+	for i := uint64(1); i <= 5; i++ {
+		if err := store.SetUint64([]byte("CurrentTerm"), i); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	entries := auditEntries(t, store, 0)
+	if len(entries) != 3 || entries[0].Seq != 3 || entries[2].Seq != 5 {
+		t.Fatalf("bad: %+v", entries)
+	}
+
+	// Entries past MaxAge are dropped on the next change
+	store.opts.Audit = &AuditPolicy{MaxAge: time.Hour}
+	err := store.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(dbAudit+uint64ToString(3),
+			`{"time":"2000-01-01T00:00:00Z","op":"set","key":"CurrentTerm"}`, nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 6); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	entries = auditEntries(t, store, 0)
+	if len(entries) != 3 || entries[0].Seq != 4 || entries[2].Seq != 6 {
+		t.Fatalf("bad: %+v", entries)
+	}
+}
+
+func TestBuntStore_AuditDisabled(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+	defer store.Close()
+	if err := store.SetUint64([]byte("CurrentTerm"), 1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if entries := auditEntries(t, store, 0); len(entries) != 0 {
+		t.Fatalf("bad: %+v", entries)
+	}
+}
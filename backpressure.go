@@ -0,0 +1,176 @@
+package raftbuntdb
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// Backpressure watches the logs written with Low or Medium durability that
+// haven't been fsynced yet, which the OS holds as dirty pages until the
+// disk catches up, and signals a stall when they pile up, so that raft's
+// pipeline slows down rather than memory ballooning. A background goroutine
+// syncs the file at each interval to measure the backlog, as buntdb does
+// with Medium durability, so with Low durability it adds the syncs that
+// are otherwise left to the OS. With High durability every commit is
+// synced, so the policy is ignored.
+type Backpressure struct {
+	// HighWater is the bytes of logs written but not yet synced at which
+	// the store stalls.
+	HighWater int64
+
+	// LowWater is the backlog below which the stall ends. Defaults to
+	// half of HighWater.
+	LowWater int64
+
+	// Block makes StoreLogs and StoreLogsContext wait while the store is
+	// stalled. StoreLogsAsync doesn't wait, but its writes count toward
+	// the backlog.
+	Block bool
+
+	// Interval is how often the file is synced. A stall syncs it at once.
+	// Defaults to a second, as buntdb does.
+	Interval time.Duration
+
+	// OnStall is called with true when the store stalls and with false
+	// once the stall ends. It's called in order and must not block.
+	// Optional.
+	OnStall func(stalled bool)
+
+	// OnError is called when syncing the file fails. Optional.
+	OnError func(error)
+}
+
+func (p *Backpressure) lowWater() int64 {
+	if p.LowWater <= 0 {
+		return p.HighWater / 2
+	}
+	return p.LowWater
+}
+
+func (p *Backpressure) interval() time.Duration {
+	if p.Interval <= 0 {
+		return time.Second
+	}
+	return p.Interval
+}
+
+// backlog counts the bytes of logs written since the last sync.
+type backlog struct {
+	mu      sync.Mutex
+	pending int64
+	stalled bool
+
+	// drained is closed when a stall ends.
+	drained chan struct{}
+
+	// kick wakes the sync goroutine when the store stalls.
+	kick chan struct{}
+}
+
+// add counts n bytes of logs written, stalling the store if the backlog
+// reaches the high water mark.
+func (l *backlog) add(p *Backpressure, n int) {
+	if p == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending += int64(n)
+	if l.stalled || l.pending < p.HighWater {
+		return
+	}
+	l.stalled, l.drained = true, make(chan struct{})
+	select {
+	case l.kick <- struct{}{}:
+	default:
+	}
+	if p.OnStall != nil {
+		p.OnStall(true)
+	}
+}
+
+// synced subtracts the n bytes that were pending when a sync started,
+// ending the stall if the backlog is below the low water mark. It reports
+// whether the store is still stalled.
+func (l *backlog) synced(p *Backpressure, n int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending -= n
+	if l.stalled && l.pending < p.lowWater() {
+		l.stalled = false
+		close(l.drained)
+		if p.OnStall != nil {
+			p.OnStall(false)
+		}
+	}
+	return l.stalled
+}
+
+// runSyncer syncs the file at each interval, or at once when the store
+// stalls, until the store is closed.
+func (b *BuntStore) runSyncer() {
+	p := b.opts.Backpressure
+	t := time.NewTicker(p.interval())
+	defer t.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-t.C:
+		case <-b.backlog.kick:
+		}
+		for {
+			b.backlog.mu.Lock()
+			n := b.backlog.pending
+			b.backlog.mu.Unlock()
+			if n == 0 {
+				break
+			}
+			if err := syncFile(b.path); err != nil {
+				if p.OnError != nil {
+					p.OnError(err)
+				}
+				break
+			}
+			// A stall is drained without waiting for the next tick
+			if !b.backlog.synced(p, n) {
+				break
+			}
+		}
+	}
+}
+
+// waitBacklog waits while the store is stalled, if Backpressure.Block is
+// set, unless ctx is done or the store starts closing first.
+func (b *BuntStore) waitBacklog(ctx context.Context) error {
+	p := b.opts.Backpressure
+	if p == nil || !p.Block {
+		return nil
+	}
+	b.backlog.mu.Lock()
+	stalled, drained := b.backlog.stalled, b.backlog.drained
+	b.backlog.mu.Unlock()
+	if !stalled {
+		return nil
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.calls.stopping():
+		return ErrClosed
+	}
+}
+
+// syncFile fsyncs the file at path. The file is opened for each sync, as
+// a shrink replaces it.
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return firstErr(f.Sync(), f.Close())
+}
@@ -0,0 +1,74 @@
+package raftbuntdb
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Backpressure(t *testing.T) {
+	var mu sync.Mutex
+	var stalls []bool
+	store := testBuntStoreOpts(t, &Options{
+		Durability: Low,
+		Backpressure: &Backpressure{
+			HighWater: 1000,
+			Block:     true,
+			Interval:  time.Hour,
+			OnStall: func(stalled bool) {
+				mu.Lock()
+				stalls = append(stalls, stalled)
+				mu.Unlock()
+			},
+		},
+	})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// Reaching the high water mark stalls the store until a sync drains
+	// the backlog, with 117 bytes a log
+	for i := uint64(1); i <= 9; i++ {
+		if err := store.StoreLog(testRaftLog(i, string(make([]byte, 100)))); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		got := append([]bool(nil), stalls...)
+		mu.Unlock()
+		if reflect.DeepEqual(got, []bool{true, false}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bad: %v", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if h := store.Health(); h.Stalled || h.Backlog != 0 {
+		t.Fatalf("bad: %+v", h)
+	}
+
+	// Writes wait while stalled
+	store.backlog.mu.Lock()
+	store.backlog.pending, store.backlog.stalled = 2000, true
+	store.backlog.drained = make(chan struct{})
+	store.backlog.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := store.StoreLogsContext(ctx, []*raft.Log{testRaftLog(10, "data")}); err != context.DeadlineExceeded {
+		t.Fatalf("bad: %v", err)
+	}
+	store.backlog.kick <- struct{}{}
+	if err := store.StoreLog(testRaftLog(10, "data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if h := store.Health(); h.Stalled {
+		t.Fatalf("bad: %+v", h)
+	}
+}
@@ -0,0 +1,357 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// ErrInvalidBackup is returned when restoring from data that is not a
+// complete backup in the database file format.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// Backup writes a consistent copy of the entire database to w while the
+// store stays open. Writes wait until the copy is complete. The output is
+// in the same format as the database file, so it can be opened directly.
+//
+// With Options.MaintenanceRate set, the copy is throttled, and writes only
+// wait for a chunk of keys at a time, as they do with MaxViewDuration set.
+// The writes made meanwhile are copied at the end, so the backup holds the
+// contents at the time it completes.
+func (b *BuntStore) Backup(w io.Writer) error {
+	if b.opts.MaintenanceRate > 0 || b.opts.MaxViewDuration > 0 {
+		return b.throttledBackup(w)
+	}
+	return b.do(func(db *buntdb.DB) error {
+		return db.Save(w)
+	})
+}
+
+func (b *BuntStore) throttledBackup(w io.Writer) error {
+	c, err := b.startCopy()
+	if err != nil {
+		return err
+	}
+	var p ShrinkProgress
+	err = b.copyKeys(context.Background(), b.throttle(w), c.total, &p,
+		func(ShrinkProgress) {})
+	if err != nil {
+		return err
+	}
+	return b.do(func(db *buntdb.DB) error {
+		if db != c.db {
+			return errReopened
+		}
+		return db.View(func(tx *buntdb.Tx) error {
+			return b.copyTail(c, w)
+		})
+	})
+}
+
+// Restore replaces the database at path with the backup read from r. The
+// backup is validated and written to a temporary file which then replaces
+// path, so a failed restore leaves the original file untouched. The
+// database must not be open. The logs of a database created with another
+// Options.LogPrefix aren't checked.
+func Restore(path string, r io.Reader) error {
+	lock, err := acquireLock(path, 0)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	tmp, err := writeRestore(path, r)
+	if err != nil {
+		return err
+	}
+	if err := renameFile(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// RestoreFrom replaces the contents of an open store with the backup read
+// from r, and reopens it. As with Restore, the store is unchanged if the
+// backup is invalid.
+func (b *BuntStore) RestoreFrom(r io.Reader) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+	if err := b.checkReadOnly(); err != nil {
+		return err
+	}
+	tmp, err := writeRestore(b.path, r)
+	if err != nil {
+		return err
+	}
+	if err := b.db.Close(); err != nil {
+		os.Remove(tmp)
+		return wrapErr(err)
+	}
+	err = renameFile(tmp, b.path)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	if oerr := b.reopenLocked(); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+// writeRestore validates the backup read from r and writes it to a
+// temporary file next to path, returning the name of the file. The file
+// gets the mode of the database it replaces.
+func writeRestore(path string, r io.Reader) (string, error) {
+	tmp := path + ".restore"
+	mode := dbFileMode
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return "", err
+	}
+	// OpenFile is subject to the umask
+	err = os.Chmod(tmp, mode)
+	if err == nil {
+		err = copyBackup(f, r, dbLogs)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// copyBackup copies the commands read from r to w, checking that every log
+// entry under the prefix logs decodes.
+func copyBackup(w io.Writer, r io.Reader, logs string) error {
+	rd := newAOFReader(r)
+	var buf []byte
+	var log raft.Log
+	for {
+		parts, err := rd.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ErrInvalidBackup
+		}
+		if strings.ToLower(parts[0]) == "set" &&
+			strings.HasPrefix(parts[1], logs) {
+			idx := logIndex(parts[1])
+			if err := decodeLog(idx, parts[2], &log); err != nil {
+				return corruptEntry(idx, parts[2], err)
+			}
+		}
+		buf = appendCommand(buf, parts...)
+		if len(buf) > 1024*1024 {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// incrementalKey holds the first and last index of the log in the output
+// of BackupSince. It isn't stored by ApplyIncremental.
+const incrementalKey = dbMeta + "incremental"
+
+// BackupSince writes the log entries with an index greater than idx, and
+// every stable key, to w. The output is in the same format as Backup and
+// can be applied on top of an earlier backup with ApplyIncremental. It
+// records the range of the log, so that applying it deletes the logs
+// compacted or truncated away since. A truncation that reached back to idx
+// or below isn't covered, as the logs rewritten there aren't written; take
+// a full backup after one.
+func (b *BuntStore) BackupSince(idx uint64, w io.Writer) error {
+	return b.view(func(tx *buntdb.Tx) error {
+		var buf []byte
+		var werr error
+		write := func(key, val string) bool {
+			buf = appendCommand(buf, "set", key, val)
+			if len(buf) > 1024*1024 {
+				if _, werr = w.Write(buf); werr != nil {
+					return false
+				}
+				buf = buf[:0]
+			}
+			return true
+		}
+		first, err := b.keys.firstIndex(tx)
+		if err != nil {
+			return err
+		}
+		last, err := b.keys.lastIndex(tx)
+		if err != nil {
+			return err
+		}
+		write(incrementalKey, fmt.Sprintf("%d %d", first, last))
+		err = b.keys.ascendLogs(tx, idx+1,
+			func(key, val string) bool {
+				return write(key, val) && writeChunks(tx, key, val, write)
+			})
+		if err != nil || werr != nil {
+			return firstErr(err, werr)
+		}
+		conf := b.keys.conf
+		stable := func(tx *buntdb.Tx) error {
+			return tx.AscendGreaterOrEqual("", conf, func(key, val string) bool {
+				return strings.HasPrefix(key, conf) && write(key, val)
+			})
+		}
+		if b.stable != nil {
+			// The store is already locked by view
+			err = b.stable.View(stable)
+		} else {
+			err = stable(tx)
+		}
+		if err != nil || werr != nil {
+			return firstErr(err, werr)
+		}
+		_, err = w.Write(buf)
+		return err
+	})
+}
+
+// ApplyIncremental applies the output of BackupSince to the store in a
+// single transaction. The data is validated before anything is written.
+// With Options.StablePath set, the stable keys are written to the stable
+// file in a transaction of their own, after the logs.
+func (b *BuntStore) ApplyIncremental(r io.Reader) error {
+	var buf bytes.Buffer
+	if err := copyBackup(&buf, r, b.keys.logs); err != nil {
+		return err
+	}
+	var stable [][]string
+	err := b.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+		stable = stable[:0]
+		rd := newAOFReader(bytes.NewReader(buf.Bytes()))
+		for {
+			parts, err := rd.next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return ErrInvalidBackup
+			}
+			switch strings.ToLower(parts[0]) {
+			case "set":
+				switch {
+				case parts[1] == incrementalKey:
+					err = b.trimLogs(tx, parts[2], d)
+				case b.isLogKey(parts[1]):
+					err = setLog(tx, parts[1], parts[2], d)
+				case b.inStableFile(parts[1]):
+					stable = append(stable, parts)
+				default:
+					_, _, err = tx.Set(parts[1], parts[2], nil)
+				}
+			case "del":
+				switch {
+				case b.isLogKey(parts[1]):
+					err = deleteLog(tx, parts[1], d)
+				case b.inStableFile(parts[1]):
+					stable = append(stable, parts)
+				default:
+					_, err = tx.Delete(parts[1])
+				}
+			default:
+				err = ErrInvalidBackup
+			}
+			if err == buntdb.ErrNotFound {
+				err = nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil || len(stable) == 0 {
+		return err
+	}
+	return b.updateStable(func(tx *buntdb.Tx) error {
+		for _, parts := range stable {
+			var err error
+			if strings.ToLower(parts[0]) == "set" {
+				_, _, err = tx.Set(parts[1], parts[2], nil)
+			} else if _, err = tx.Delete(parts[1]); err == buntdb.ErrNotFound {
+				err = nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inStableFile reports whether key is a stable key kept in the stable file.
+func (b *BuntStore) inStableFile(key string) bool {
+	return b.stable != nil && strings.HasPrefix(key, b.keys.conf)
+}
+
+// trimLogs deletes the logs outside of the range rng recorded by
+// BackupSince, which were compacted or truncated away after the backup
+// the incremental one is applied on.
+func (b *BuntStore) trimLogs(tx *buntdb.Tx, rng string, d *logDelta) error {
+	var first, last uint64
+	if _, err := fmt.Sscanf(rng, "%d %d", &first, &last); err != nil {
+		return ErrInvalidBackup
+	}
+	var keys []string
+	err := b.keys.ascendLogs(tx, 0, func(key, val string) bool {
+		if logIndex(key) >= first {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	err = b.keys.descendLogs(tx, 1<<64-1, func(key, val string) bool {
+		if logIndex(key) <= last {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := deleteLog(tx, key, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstErr returns the first non-nil error.
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Backup(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	fh, err := ioutil.TempFile("", "bunt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(fh.Name())
+	if err := store.Backup(fh); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fh.Close()
+
+	// The store is still usable
+	if err := store.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The backup opens as a store with the point-in-time contents
+	backup, err := NewBuntStore(fh.Name(), Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer backup.Close()
+	idx, err := backup.LastIndex()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx != 2 {
+		t.Fatalf("bad: %d", idx)
+	}
+	log := new(raft.Log)
+	if err := backup.GetLog(2, log); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(log, logs[1]) {
+		t.Fatalf("bad: %#v", log)
+	}
+	term, err := backup.GetUint64([]byte("CurrentTerm"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if term != 2 {
+		t.Fatalf("bad: %d", term)
+	}
+}
+
+func TestBuntStore_RestoreFrom(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	if err := store.StoreLogs([]*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := store.Backup(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	backup := buf.Bytes()
+
+	if err := store.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Invalid data is rejected and leaves the store untouched
+	err := store.RestoreFrom(bytes.NewReader(backup[:len(backup)-3]))
+	if err != ErrInvalidBackup {
+		t.Fatalf("expected invalid backup error, got: %v", err)
+	}
+	if idx, _ := store.LastIndex(); idx != 3 {
+		t.Fatalf("bad: %d", idx)
+	}
+
+	if err := store.RestoreFrom(bytes.NewReader(backup)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.LastIndex(); idx != 2 {
+		t.Fatalf("bad: %d", idx)
+	}
+	if err := store.GetLog(3, new(raft.Log)); err != raft.ErrLogNotFound {
+		t.Fatalf("expected raft log not found error, got: %v", err)
+	}
+
+	// The restored contents survive a reopen
+	store.Close()
+	store, err = NewBuntStore(store.path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.LastIndex(); idx != 2 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := store.Backup(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Can't restore over an open store
+	if err := Restore(store.path, &buf); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected locked error, got: %v", err)
+	}
+	store.Close()
+
+	fh, err := ioutil.TempFile("", "bunt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fh.Close()
+	defer os.Remove(fh.Name())
+	if err := Restore(fh.Name(), &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	restored, err := NewBuntStore(fh.Name(), Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer restored.Close()
+	if idx, _ := restored.LastIndex(); idx != 1 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_BackupSince(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 5; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs[:3]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var full bytes.Buffer
+	if err := store.Backup(&full); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLogs(logs[3:]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 7); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var delta bytes.Buffer
+	if err := store.BackupSince(3, &delta); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if bytes.Contains(delta.Bytes(), []byte(store.logKey(3))) {
+		t.Fatalf("delta should only hold logs after 3")
+	}
+
+	// Apply full then delta to a new store
+	other := testBuntStore(t)
+	defer other.Close()
+	defer os.Remove(other.path)
+	if err := other.RestoreFrom(&full); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := other.ApplyIncremental(&delta); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, log := range logs {
+		result := new(raft.Log)
+		if err := other.GetLog(log.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(log, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+	term, err := other.GetUint64([]byte("CurrentTerm"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if term != 7 {
+		t.Fatalf("bad: %d", term)
+	}
+}
+
+func TestBuntStore_BackupSinceTrim(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(filepath.Join(dir, "raft.db"),
+		&Options{StablePath: filepath.Join(dir, "stable.db")})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	for i := uint64(1); i <= 5; i++ {
+		if err := store.StoreLog(testRaftLog(i, "log")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	var full bytes.Buffer
+	if err := store.Backup(&full); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Compact and truncate after the full backup
+	if err := store.CompactTo(2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.TruncateAfter(4); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 7); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var delta bytes.Buffer
+	if err := store.BackupSince(3, &delta); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	other, err := Open(filepath.Join(dir, "other.db"),
+		&Options{StablePath: filepath.Join(dir, "other-stable.db")})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer other.Close()
+	if err := other.RestoreFrom(&full); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := other.ApplyIncremental(&delta); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	first, _ := other.FirstIndex()
+	last, _ := other.LastIndex()
+	if n, _ := other.LogCount(); first != 3 || last != 4 || n != 2 {
+		t.Fatalf("bad: %d-%d %d", first, last, n)
+	}
+	checkCounter(t, other)
+
+	// The stable keys went to the stable file
+	if term, err := other.GetUint64([]byte("CurrentTerm")); err != nil || term != 7 {
+		t.Fatalf("bad: %d %v", term, err)
+	}
+	err = other.db.View(func(tx *buntdb.Tx) error {
+		_, err := tx.Get(other.keys.conf + "CurrentTerm")
+		return err
+	})
+	if err != buntdb.ErrNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Package bench measures a BuntStore under the workloads raft puts on it:
+// appending, a follower catching up by reading the log in order, and the
+// compaction cycle of deleting the head of the log and shrinking the file.
+// The results are meant to be compared across disks and durability levels,
+// such as to size the disks of an environment.
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+// Config configures a run. Zero fields take the defaults of
+// DefaultConfig.
+type Config struct {
+	// Entries is the number of logs appended.
+	Entries int `json:"entries"`
+
+	// EntrySize is the size of the data of each log.
+	EntrySize int `json:"entry_size"`
+
+	// BatchSize is the number of logs per call to StoreLogs.
+	BatchSize int `json:"batch_size"`
+
+	// Durability is the durability level the store is opened with.
+	Durability raftbuntdb.Level `json:"durability"`
+
+	// Cycles is the number of compaction cycles. Each appends Entries
+	// logs, deletes all but the last of them and shrinks the file.
+	Cycles int `json:"cycles"`
+}
+
+// DefaultConfig is the configuration of a run with no fields set.
+var DefaultConfig = Config{
+	Entries:    10000,
+	EntrySize:  256,
+	BatchSize:  64,
+	Durability: raftbuntdb.Medium,
+	Cycles:     3,
+}
+
+func (c Config) withDefaults() Config {
+	if c.Entries <= 0 {
+		c.Entries = DefaultConfig.Entries
+	}
+	if c.EntrySize <= 0 {
+		c.EntrySize = DefaultConfig.EntrySize
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultConfig.BatchSize
+	}
+	if c.Cycles <= 0 {
+		c.Cycles = DefaultConfig.Cycles
+	}
+	return c
+}
+
+// Throughput is the outcome of a workload that moves logs.
+type Throughput struct {
+	Entries        int           `json:"entries"`
+	Bytes          int64         `json:"bytes"`
+	Duration       time.Duration `json:"duration_ns"`
+	EntriesPerSec  float64       `json:"entries_per_sec"`
+	BytesPerSec    float64       `json:"bytes_per_sec"`
+	MaxCallLatency time.Duration `json:"max_call_latency_ns"`
+}
+
+func newThroughput(entries int, bytes int64, d, max time.Duration) Throughput {
+	t := Throughput{Entries: entries, Bytes: bytes, Duration: d,
+		MaxCallLatency: max}
+	if secs := d.Seconds(); secs > 0 {
+		t.EntriesPerSec = float64(entries) / secs
+		t.BytesPerSec = float64(bytes) / secs
+	}
+	return t
+}
+
+// Cycle is the outcome of one compaction cycle.
+type Cycle struct {
+	Append      time.Duration `json:"append_ns"`
+	DeleteRange time.Duration `json:"delete_range_ns"`
+	Shrink      time.Duration `json:"shrink_ns"`
+	SizeBefore  int64         `json:"size_before"`
+	SizeAfter   int64         `json:"size_after"`
+}
+
+// Result holds the outcome of a run.
+type Result struct {
+	Config  Config     `json:"config"`
+	Append  Throughput `json:"append"`
+	CatchUp Throughput `json:"catch_up"`
+	Cycles  []Cycle    `json:"cycles"`
+}
+
+// Run runs every workload against a new store in dir, which is removed
+// afterwards.
+func Run(dir string, cfg Config) (*Result, error) {
+	cfg = cfg.withDefaults()
+	tmp, err := os.MkdirTemp(dir, "raft-buntdb-bench")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	store, err := raftbuntdb.Open(filepath.Join(tmp, "raft.db"),
+		&raftbuntdb.Options{Durability: cfg.Durability})
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	res := &Result{Config: cfg}
+	if res.Append, err = appendLogs(store, cfg, 1); err != nil {
+		return nil, fmt.Errorf("append: %w", err)
+	}
+	if res.CatchUp, err = catchUp(store, cfg); err != nil {
+		return nil, fmt.Errorf("catch up: %w", err)
+	}
+	for i := 0; i < cfg.Cycles; i++ {
+		c, err := cycle(store, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("cycle %d: %w", i+1, err)
+		}
+		res.Cycles = append(res.Cycles, c)
+	}
+	return res, nil
+}
+
+// appendLogs appends cfg.Entries logs from index first.
+func appendLogs(store *raftbuntdb.BuntStore, cfg Config, first uint64) (Throughput, error) {
+	data := make([]byte, cfg.EntrySize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var max time.Duration
+	start := time.Now()
+	for n := 0; n < cfg.Entries; n += cfg.BatchSize {
+		size := cfg.BatchSize
+		if rem := cfg.Entries - n; rem < size {
+			size = rem
+		}
+		logs := make([]*raft.Log, size)
+		for i := range logs {
+			logs[i] = &raft.Log{Index: first + uint64(n+i), Term: 1,
+				Type: raft.LogCommand, Data: data}
+		}
+		t := time.Now()
+		if err := store.StoreLogs(logs); err != nil {
+			return Throughput{}, err
+		}
+		if d := time.Since(t); d > max {
+			max = d
+		}
+	}
+	return newThroughput(cfg.Entries, int64(cfg.Entries)*int64(cfg.EntrySize),
+		time.Since(start), max), nil
+}
+
+// catchUp reads the whole log in order with GetLog, as raft does to
+// replicate to a follower that is behind.
+func catchUp(store *raftbuntdb.BuntStore, cfg Config) (Throughput, error) {
+	first, err := store.FirstIndex()
+	if err != nil {
+		return Throughput{}, err
+	}
+	last, err := store.LastIndex()
+	if err != nil {
+		return Throughput{}, err
+	}
+	var log raft.Log
+	var bytes int64
+	var max time.Duration
+	start := time.Now()
+	for idx := first; idx <= last && first > 0; idx++ {
+		t := time.Now()
+		if err := store.GetLog(idx, &log); err != nil {
+			return Throughput{}, err
+		}
+		if d := time.Since(t); d > max {
+			max = d
+		}
+		bytes += int64(len(log.Data))
+	}
+	var n int
+	if first > 0 {
+		n = int(last - first + 1)
+	}
+	return newThroughput(n, bytes, time.Since(start), max), nil
+}
+
+// cycle appends logs, deletes all but the last one and shrinks the file.
+func cycle(store *raftbuntdb.BuntStore, cfg Config) (Cycle, error) {
+	var c Cycle
+	last, err := store.LastIndex()
+	if err != nil {
+		return c, err
+	}
+	t, err := appendLogs(store, cfg, last+1)
+	if err != nil {
+		return c, err
+	}
+	c.Append = t.Duration
+	first, err := store.FirstIndex()
+	if err != nil {
+		return c, err
+	}
+	if last, err = store.LastIndex(); err != nil {
+		return c, err
+	}
+	start := time.Now()
+	if err := store.DeleteRange(first, last-1); err != nil {
+		return c, err
+	}
+	c.DeleteRange = time.Since(start)
+	if c.SizeBefore, err = store.FileSize(); err != nil {
+		return c, err
+	}
+	start = time.Now()
+	if err := store.Shrink(); err != nil {
+		return c, err
+	}
+	c.Shrink = time.Since(start)
+	c.SizeAfter, err = store.FileSize()
+	return c, err
+}
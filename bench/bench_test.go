@@ -0,0 +1,40 @@
+package bench
+
+import (
+	"encoding/json"
+	"testing"
+
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+func TestRun(t *testing.T) {
+	res, err := Run(t.TempDir(), Config{Entries: 100, EntrySize: 10,
+		BatchSize: 7, Durability: raftbuntdb.Low, Cycles: 2})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.Append.Entries != 100 || res.Append.Bytes != 1000 {
+		t.Fatalf("bad: %+v", res.Append)
+	}
+	if res.CatchUp.Entries != 100 || res.CatchUp.Bytes != 1000 {
+		t.Fatalf("bad: %+v", res.CatchUp)
+	}
+	if len(res.Cycles) != 2 {
+		t.Fatalf("bad: %+v", res.Cycles)
+	}
+	for _, c := range res.Cycles {
+		if c.SizeAfter >= c.SizeBefore {
+			t.Fatalf("bad: %+v", c)
+		}
+	}
+	if _, err := json.Marshal(res); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	if c := (Config{Durability: raftbuntdb.High}).withDefaults(); c.Entries !=
+		DefaultConfig.Entries || c.Durability != raftbuntdb.High {
+		t.Fatalf("bad: %+v", c)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/tidwall/raft"
 	"github.com/tidwall/raft/bench"
 )
 
@@ -86,3 +87,24 @@ func BenchmarkBuntStore_GetUint64(b *testing.B) {
 
 	raftbench.GetUint64(b, store)
 }
+
+func BenchmarkBuntStore_StoreLogsAllocs(b *testing.B) {
+	store := testBuntStore(b)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	logs := make([]*raft.Log, 64)
+	for i := range logs {
+		logs[i] = &raft.Log{Data: make([]byte, 256)}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i, log := range logs {
+			log.Index = uint64(n*len(logs) + i + 1)
+		}
+		if err := store.StoreLogs(logs); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package raftbuntdb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// BlobStore holds the data of oversized logs outside of the database file,
+// so that a rare huge command doesn't bloat the file or slow down shrinks.
+// Names are chosen by the store and never reused.
+type BlobStore interface {
+	// Put durably stores data under name.
+	Put(name string, data []byte) error
+	// Get returns the data stored under name.
+	Get(name string) ([]byte, error)
+	// Delete removes name. Deleting a missing name is not an error.
+	Delete(name string) error
+}
+
+// blobType is set in the type byte of a log value whose data is held in
+// the BlobStore. The lower bits keep the log's type.
+const blobType = 0x40
+
+// defaultBlobThreshold is the size above which log data goes to the
+// BlobStore when Options.BlobThreshold is not set.
+const defaultBlobThreshold = 1024 * 1024
+
+var (
+	// errNoBlobStore is the cause of an ErrCorruptEntry when a log's data
+	// is in a blob but no BlobStore is configured.
+	errNoBlobStore = errors.New("log data is in a blob store")
+
+	// errBlobChecksum is the cause of an ErrCorruptEntry when a blob
+	// doesn't match the checksum recorded in its log.
+	errBlobChecksum = errors.New("blob checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// A log whose data is in a blob is stored as a header with blobType set in
+// its type byte, followed by the CRC-32C of the data, its size as a
+// uvarint, and the name of the blob.
+
+// isBlob reports whether the log value val points to a blob.
+func isBlob(val string) bool {
+	return len(val) >= 17 && val[16]&blobType != 0
+}
+
+// blobPointer decodes the pointer following the header of a blob value.
+func blobPointer(val string) (name string, sum uint32, size int, err error) {
+	s := logPayload(val)
+	if len(s) < 4 {
+		return "", 0, 0, errInvalidBuffer
+	}
+	sum = binary.LittleEndian.Uint32(stringToBytes(s[:4]))
+	n, w := binary.Uvarint(stringToBytes(s[4:]))
+	if w <= 0 || len(s) == 4+w {
+		return "", 0, 0, errInvalidBuffer
+	}
+	return s[4+w:], sum, int(n), nil
+}
+
+// blobSize returns the size of the data of the blob value val, or false if
+// it can't be decoded.
+func blobSize(val string) (int64, bool) {
+	_, _, size, err := blobPointer(val)
+	return int64(size), err == nil
+}
+
+// blobName returns a new name for a blob holding the data of the log at
+// idx.
+func blobName(idx uint64) (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return uint64ToString(idx) + "-" + hex.EncodeToString(buf[:]), nil
+}
+
+// blobThreshold returns the size above which log data goes to the
+// BlobStore, or zero if there is none.
+func (b *BuntStore) blobThreshold() int {
+	switch {
+	case b.opts.Blobs == nil:
+		return 0
+	case b.opts.BlobThreshold > 0:
+		return b.opts.BlobThreshold
+	}
+	return defaultBlobThreshold
+}
+
+// storeBlob puts the data of log in a new blob and writes a pointer to it
+// under key. The blob is deleted again if the transaction fails.
+func (b *BuntStore) storeBlob(tx *buntdb.Tx, key string, log *raft.Log,
+	d *logDelta) error {
+	name, err := blobName(log.Index)
+	if err != nil {
+		return err
+	}
+	if err := b.opts.Blobs.Put(name, log.Data); err != nil {
+		return err
+	}
+	d.puts = append(d.puts, name)
+	val := binary.LittleEndian.AppendUint64(nil, log.Index)
+	val = binary.LittleEndian.AppendUint64(val, log.Term)
+	val = append(val, byte(log.Type)|blobType)
+	val = binary.LittleEndian.AppendUint32(val, crc32.Checksum(log.Data, castagnoli))
+	val = binary.AppendUvarint(val, uint64(len(log.Data)))
+	val = append(val, name...)
+	return setLog(tx, key, string(b.seal(val, log)), d)
+}
+
+// readBlob returns the blob value val with the data read back from its
+// blob.
+func (b *BuntStore) readBlob(val string) (string, error) {
+	name, sum, size, err := blobPointer(val)
+	if err != nil {
+		return "", err
+	}
+	if b.opts.Blobs == nil {
+		return "", errNoBlobStore
+	}
+	data, err := b.opts.Blobs.Get(name)
+	if err != nil {
+		return "", err
+	}
+	if len(data) != size || crc32.Checksum(data, castagnoli) != sum {
+		return "", errBlobChecksum
+	}
+	buf := make([]byte, 17, 17+len(data))
+	copy(buf, val[:17])
+	buf[16] &^= blobType
+	return bytesToString(append(buf, data...)), nil
+}
+
+// readLog returns the log value val of the log with key, with the data of
+// a chunked log or a blob read back in, after checking its MAC.
+func (b *BuntStore) readLog(tx *buntdb.Tx, key, val string) (string, error) {
+	val, mac, err := unseal(val)
+	if err != nil {
+		return "", err
+	}
+	if isBlob(val) {
+		val, err = b.readBlob(val)
+	} else {
+		val, err = readChunks(tx, key, val)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := b.checkMAC(key, val, mac); err != nil {
+		return "", err
+	}
+	return val, nil
+}
+
+// deleteBlobs deletes the named blobs, stopping at the first error. Blobs
+// that can't be deleted are left behind, taking space but nothing else.
+func (b *BuntStore) deleteBlobs(names []string) error {
+	if b.opts.Blobs == nil {
+		return nil
+	}
+	for _, name := range names {
+		if err := b.opts.Blobs.Delete(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DirBlobStore is a BlobStore that keeps each blob in a file of its own in
+// a directory.
+type DirBlobStore struct {
+	dir string
+}
+
+// NewDirBlobStore returns a BlobStore in dir, creating the directory if
+// needed.
+func NewDirBlobStore(dir string) (*DirBlobStore, error) {
+	if err := createDir(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DirBlobStore{dir: dir}, nil
+}
+
+// Put writes data to a temporary file and renames it into place, so that
+// a blob is never seen half-written.
+func (s *DirBlobStore) Put(name string, data []byte) error {
+	path := filepath.Join(s.dir, name)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, dbFileMode)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = renameFile(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Get reads the blob name.
+func (s *DirBlobStore) Get(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, name))
+}
+
+// Delete removes the blob name.
+func (s *DirBlobStore) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// isLarge reports whether the data of log is over the threshold of blobs
+// or chunks, so that it's written by storeLarge.
+func (b *BuntStore) isLarge(log *raft.Log) bool {
+	n := len(log.Data)
+	if t := b.blobThreshold(); t > 0 && n > t {
+		return true
+	}
+	return b.opts.ChunkSize > 0 && n > b.opts.ChunkSize
+}
+
+// storeLarge writes log under key to a blob if its data is over the
+// threshold of blobs, and in chunks otherwise. It's only for logs that
+// isLarge reports.
+func (b *BuntStore) storeLarge(tx *buntdb.Tx, key string, log *raft.Log,
+	d *logDelta) error {
+	if n := b.blobThreshold(); n > 0 && len(log.Data) > n {
+		return b.storeBlob(tx, key, log, d)
+	}
+	return b.storeChunked(tx, key, log, b.opts.ChunkSize, d)
+}
@@ -0,0 +1,166 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+// blobFiles returns the names of the files in the blob directory.
+func blobFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestBuntStore_Blobs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "blobs")
+	blobs, err := NewDirBlobStore(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store := testBuntStoreOpts(t, &Options{Blobs: blobs, BlobThreshold: 10,
+		ChunkSize: 100})
+	defer os.Remove(store.path)
+	defer store.Close()
+
+	big := &raft.Log{Index: 2, Term: 3, Type: raft.LogCommand,
+		Data: []byte(strings.Repeat("x", 50))}
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "small"), big}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if names := blobFiles(t, dir); len(names) != 1 {
+		t.Fatalf("bad: %v", names)
+	}
+	var out raft.Log
+	if err := store.GetLog(2, &out); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if out.Index != 2 || out.Term != 3 || out.Type != raft.LogCommand ||
+		!bytes.Equal(out.Data, big.Data) {
+		t.Fatalf("bad: %+v", out)
+	}
+	checkCounter(t, store)
+	report, err := store.Verify()
+	if err != nil || len(report.Corrupt) != 0 {
+		t.Fatalf("bad: %v %v", err, report)
+	}
+
+	// The database file only holds the pointer
+	raw, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if bytes.Contains(raw, big.Data) {
+		t.Fatalf("data stored in the file")
+	}
+
+	// Replacing the log drops the old blob once the change commits
+	if err := store.StoreLog(&raft.Log{Index: 2, Data: []byte(strings.Repeat("y", 20))}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	names := blobFiles(t, dir)
+	if len(names) != 1 {
+		t.Fatalf("bad: %v", names)
+	}
+	if err := store.DeleteRange(1, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if names := blobFiles(t, dir); len(names) != 0 {
+		t.Fatalf("bad: %v", names)
+	}
+	checkCounter(t, store)
+}
+
+func TestBuntStore_BlobsCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := NewDirBlobStore(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store := testBuntStoreOpts(t, &Options{Blobs: blobs, BlobThreshold: 1})
+	defer os.Remove(store.path)
+	if err := store.StoreLog(testRaftLog(1, "payload")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	name := blobFiles(t, dir)[0]
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("tampered"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var log raft.Log
+	err = store.GetLog(1, &log)
+	if cerr, ok := err.(*ErrCorruptEntry); !ok || cerr.Err != errBlobChecksum {
+		t.Fatalf("bad: %v", err)
+	}
+	store.Close()
+
+	// Without a blob store the data can't be read
+	store, err = Open(store.path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	err = store.GetLog(1, &log)
+	if cerr, ok := err.(*ErrCorruptEntry); !ok || cerr.Err != errNoBlobStore {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+// failingBlobs is a BlobStore whose Put fails once the store has failOn
+// blobs.
+type failingBlobs struct {
+	blobs  map[string][]byte
+	failOn int
+}
+
+func (f *failingBlobs) Put(name string, data []byte) error {
+	if len(f.blobs) == f.failOn {
+		return errors.New("blob store full")
+	}
+	f.blobs[name] = data
+	return nil
+}
+
+func (f *failingBlobs) Get(name string) ([]byte, error) {
+	data, ok := f.blobs[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (f *failingBlobs) Delete(name string) error {
+	delete(f.blobs, name)
+	return nil
+}
+
+func TestBuntStore_BlobsFailedWrite(t *testing.T) {
+	blobs := &failingBlobs{blobs: make(map[string][]byte), failOn: 1}
+	store := testBuntStoreOpts(t, &Options{Blobs: blobs, BlobThreshold: 1})
+	defer os.Remove(store.path)
+	defer store.Close()
+
+	// The blob put before the failure is deleted with the transaction
+	err := store.StoreLogs([]*raft.Log{testRaftLog(1, "one"), testRaftLog(2, "two")})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if len(blobs.blobs) != 0 {
+		t.Fatalf("bad: %v", blobs.blobs)
+	}
+	if n, _ := store.LogCount(); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package raftbuntdb
+
+import (
+	"encoding/json"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// BootstrapCluster seeds a new store with an initial configuration, so a
+// node can start as a member of a cluster without first running raft. It
+// writes the configuration as a LogAddPeer entry at index 1 and term 1,
+// sets the current term to 1, and stores the servers and the voters as
+// the peers. Every server in cfg should be bootstrapped with the same
+// configuration.
+// ErrCantBootstrap is returned if the store already has logs or a term.
+func BootstrapCluster(store *BuntStore, cfg Configuration) error {
+	if err := checkConfiguration(cfg); err != nil {
+		return err
+	}
+	peers := voterAddresses(cfg.Servers)
+	peersData, err := json.Marshal(peers)
+	if err != nil {
+		return err
+	}
+	servers, err := json.Marshal(cfg.Servers)
+	if err != nil {
+		return err
+	}
+	stored, err := json.Marshal(storedConfiguration{Index: 1, Configuration: cfg})
+	if err != nil {
+		return err
+	}
+	val, err := encodeLog(&raft.Log{
+		Index: 1,
+		Term:  1,
+		Type:  raft.LogAddPeer,
+		Data:  EncodePeers(peers),
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := [][2]string{
+		{"CurrentTerm", formatUint64(1)},
+		{"peers", string(peersData)},
+		{string(serversKey), string(servers)},
+		{string(configurationKey), string(stored)},
+	}
+	setKeys := func(tx *buntdb.Tx) error {
+		_, err := tx.Get(store.confKey("CurrentTerm"))
+		if err == nil {
+			return ErrCantBootstrap
+		}
+		if err != buntdb.ErrNotFound {
+			return err
+		}
+		for _, kv := range keys {
+			if err := setStable(tx, store.keys.conf, kv[0], kv[1], store.opts.Audit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	separate := store.stable != nil
+	if separate {
+		// The term is checked first, as the stable keys are written in
+		// their own file once the log is.
+		err := store.viewStable(func(tx *buntdb.Tx) error {
+			_, err := tx.Get(store.confKey("CurrentTerm"))
+			if err == nil {
+				return ErrCantBootstrap
+			}
+			if err == buntdb.ErrNotFound {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Everything is written in one transaction so a failed bootstrap
+	// leaves the store empty, unless the stable store is separate.
+	err = store.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+		last, err := store.keys.lastIndex(tx)
+		if err != nil {
+			return err
+		}
+		if last != 0 {
+			return ErrCantBootstrap
+		}
+		key := store.logKey(1)
+		prev, replaced, err := tx.Set(key, string(val), nil)
+		if err != nil {
+			return err
+		}
+		d.set(key, prev, replaced, string(val))
+		if separate {
+			return nil
+		}
+		return setKeys(tx)
+	})
+	if err != nil || !separate {
+		return err
+	}
+	return store.updateStable(setKeys)
+}
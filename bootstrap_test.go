@@ -0,0 +1,63 @@
+package raftbuntdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBootstrapCluster(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	cfg := Configuration{Servers: []Server{
+		{Suffrage: Voter, ID: "node1", Address: "a:1"},
+		{Suffrage: Voter, ID: "node2", Address: "b:2"},
+		{Suffrage: Nonvoter, ID: "node3", Address: "c:3"},
+	}}
+	if err := BootstrapCluster(store, cfg); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	log := new(raft.Log)
+	if err := store.GetLog(1, log); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if log.Term != 1 || log.Type != raft.LogAddPeer {
+		t.Fatalf("bad: %#v", log)
+	}
+	peers, err := DecodePeers(log.Data)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(peers, []string{"a:1", "b:2"}) {
+		t.Fatalf("bad: %q", peers)
+	}
+	if term, _ := store.GetUint64([]byte("CurrentTerm")); term != 1 {
+		t.Fatalf("bad: %d", term)
+	}
+	if peers, _ := store.Peers(); !reflect.DeepEqual(peers, []string{"a:1", "b:2"}) {
+		t.Fatalf("bad: %q", peers)
+	}
+	stored, index, err := store.Configuration()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(stored, cfg) || index != 1 {
+		t.Fatalf("bad: %#v %d", stored, index)
+	}
+
+	// Only new stores can be bootstrapped
+	if err := BootstrapCluster(store, cfg); err != ErrCantBootstrap {
+		t.Fatalf("expected can't bootstrap error, got: %v", err)
+	}
+
+	// Configurations without voters are refused
+	bad := Configuration{Servers: []Server{{Suffrage: Nonvoter, ID: "a", Address: "a"}}}
+	if err := BootstrapCluster(store, bad); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -0,0 +1,122 @@
+package raftbuntdb
+
+import (
+	"sync"
+
+	"github.com/tidwall/raft"
+)
+
+// NewCachedBuntStore is like NewBuntStore but keeps the last cacheSize
+// logs stored in memory, as raft.NewLogCache does, so that raft reading
+// back the logs it just appended doesn't go to the database. Unlike a
+// cache wrapped around the store, it's invalidated by every write to the
+// log, including DeleteRange, TruncateAfter and compaction.
+func NewCachedBuntStore(path string, durability Level, cacheSize int) (*BuntStore, error) {
+	return Open(path, &Options{Durability: durability, LogCache: cacheSize})
+}
+
+// logCache holds the most recently stored logs in a ring, each in the slot
+// of its index modulo the size.
+type logCache struct {
+	mu   sync.Mutex
+	logs []*raft.Log
+
+	// gen is bumped by every write to the log, so that the logs of a
+	// transaction aren't cached once a later one has committed.
+	gen uint64
+}
+
+func newLogCache(size int) logCache {
+	if size <= 0 {
+		return logCache{}
+	}
+	return logCache{logs: make([]*raft.Log, size)}
+}
+
+// get returns the cached log at idx, if any.
+func (c *logCache) get(idx uint64) (*raft.Log, bool) {
+	if len(c.logs) == 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	log := c.logs[idx%uint64(len(c.logs))]
+	if log == nil || log.Index != idx {
+		return nil, false
+	}
+	return log, true
+}
+
+// invalidate drops the cached logs between lo and hi, where the log is
+// being written, and returns the new generation.
+func (c *logCache) invalidate(lo, hi uint64) uint64 {
+	if len(c.logs) == 0 {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if hi-lo >= uint64(len(c.logs)) {
+		for i := range c.logs {
+			c.logs[i] = nil
+		}
+		return c.gen
+	}
+	for idx := lo; ; idx++ {
+		slot := idx % uint64(len(c.logs))
+		if log := c.logs[slot]; log != nil && log.Index == idx {
+			c.logs[slot] = nil
+		}
+		if idx == hi {
+			return c.gen
+		}
+	}
+}
+
+// put caches logs, which were written by the transaction that returned gen
+// from invalidate, unless another write has been made since.
+func (c *logCache) put(gen uint64, logs []*raft.Log) {
+	if len(c.logs) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	for _, log := range logs {
+		c.logs[log.Index%uint64(len(c.logs))] = log
+	}
+}
+
+// cachedLog copies the cached log at idx into log, into buf if it has the
+// capacity, reporting whether it was cached.
+func (b *BuntStore) cachedLog(idx uint64, log *raft.Log, buf []byte) bool {
+	cached, ok := b.cache.get(idx)
+	if !ok {
+		return false
+	}
+	data := cached.Data
+	switch {
+	case buf != nil:
+		data = append(buf[:0], data...)
+	case !b.opts.ZeroCopy:
+		data = append([]byte(nil), data...)
+	}
+	*log = *cached
+	log.Data = data
+	return true
+}
+
+// keep records copies of logs, stored by the transaction, for the cache,
+// so that the caller can reuse them.
+func (d *logDelta) keep(c *logCache, logs []*raft.Log) {
+	if len(c.logs) == 0 {
+		return
+	}
+	for _, log := range logs {
+		kept := *log
+		kept.Data = append([]byte(nil), log.Data...)
+		d.stored = append(d.stored, &kept)
+	}
+}
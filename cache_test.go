@@ -0,0 +1,93 @@
+package raftbuntdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestNewCachedBuntStore(t *testing.T) {
+	fh, err := ioutil.TempFile("", "bunt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Remove(fh.Name())
+	defer os.Remove(fh.Name())
+	store, err := NewCachedBuntStore(fh.Name(), Medium, 8)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 20; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only the last logs are cached, and reads get a copy of their data
+	if _, ok := store.cache.get(12); ok {
+		t.Fatalf("bad: 12 cached")
+	}
+	if _, ok := store.cache.get(13); !ok {
+		t.Fatalf("bad: 13 not cached")
+	}
+	var log raft.Log
+	if err := store.GetLog(20, &log); err != nil || string(log.Data) != "log" {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+	log.Data[0] = 'x'
+	if err := store.GetLog(20, &log); err != nil || string(log.Data) != "log" {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+	if err := store.GetLog(5, &log); err != nil || log.Index != 5 {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+
+	// Deleting and truncating drop the cached logs
+	if err := store.DeleteRange(18, 20); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.GetLog(19, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := store.TruncateAfter(15); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.GetLog(16, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// A log stored over a cached one replaces it
+	if err := store.StoreLog(&raft.Log{Index: 15, Term: 2, Data: []byte("new")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.GetLog(15, &log); err != nil || log.Term != 2 || string(log.Data) != "new" {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+	if err := store.Reset(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.GetLog(15, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestLogCache_Generation(t *testing.T) {
+	c := newLogCache(4)
+	gen := c.invalidate(1, 1)
+
+	// A write committed since the logs were stored keeps them out
+	c.invalidate(1, 1)
+	c.put(gen, []*raft.Log{{Index: 1}})
+	if _, ok := c.get(1); ok {
+		t.Fatalf("bad: cached")
+	}
+	c.put(c.invalidate(1, 1), []*raft.Log{{Index: 1}})
+	if _, ok := c.get(1); !ok {
+		t.Fatalf("bad: not cached")
+	}
+}
@@ -0,0 +1,235 @@
+package raftbuntdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// dbChunks is the prefix of the keys that hold the data of chunked logs.
+const dbChunks = "k:"
+
+// chunkedType is set in the type byte of a log value whose data is held in
+// chunks. The lower bits keep the log's type; raft's types are all below
+// it.
+const chunkedType = 0x80
+
+// errMissingChunk is the cause of an ErrCorruptEntry when a chunk of a
+// chunked log is missing or has the wrong size.
+var errMissingChunk = errors.New("missing chunk")
+
+// A log whose data is larger than Options.ChunkSize is stored as a header
+// with chunkedType set in its type byte, followed by the chunk map: the
+// number of chunks and the size of each, as uvarints. The data itself is
+// split into chunks under the keys returned by chunkKey, so no single
+// value is larger than the chunk size.
+
+// isChunked reports whether the log value val holds a chunk map rather
+// than the data.
+func isChunked(val string) bool {
+	return len(val) >= 17 && val[16]&chunkedType != 0
+}
+
+// chunkKey returns the key of the nth chunk of the log with key.
+func chunkKey(key string, n int) string {
+	return dbChunks + key[strings.IndexByte(key, ':')+1:] + ":" + strconv.Itoa(n)
+}
+
+// chunkMap returns the chunk sizes of the chunked log value val.
+func chunkMap(val string) ([]int, error) {
+	s := stringToBytes(logPayload(val))
+	count, n := binary.Uvarint(s)
+	if n <= 0 || count > uint64(len(s)) {
+		return nil, errInvalidBuffer
+	}
+	s = s[n:]
+	sizes := make([]int, count)
+	for i := range sizes {
+		size, n := binary.Uvarint(s)
+		if n <= 0 {
+			return nil, errInvalidBuffer
+		}
+		sizes[i] = int(size)
+		s = s[n:]
+	}
+	if len(s) != 0 {
+		return nil, errInvalidBuffer
+	}
+	return sizes, nil
+}
+
+// storedSize returns the encoded size of the log with value val, counting
+// the data of a chunked log or a blob rather than what points to it.
+func storedSize(val string) int64 {
+	if isBlob(val) {
+		if size, ok := blobSize(val); ok {
+			return 17 + size
+		}
+	}
+	if !isChunked(val) {
+		return int64(len(val))
+	}
+	sizes, err := chunkMap(val)
+	if err != nil {
+		return int64(len(val))
+	}
+	size := int64(17)
+	for _, n := range sizes {
+		size += int64(n)
+	}
+	return size
+}
+
+// fileSize returns the bytes the log with value val takes in the database
+// file. It's storedSize, except that a blob counts its pointer, as its
+// data is kept in a file of its own.
+func fileSize(val string) int64 {
+	if isBlob(val) {
+		return int64(len(val))
+	}
+	return storedSize(val)
+}
+
+// readChunks returns the log value val of the log with key, with the data
+// of a chunked log read back from its chunks. Other values are returned as
+// they are.
+func readChunks(tx *buntdb.Tx, key, val string) (string, error) {
+	if !isChunked(val) {
+		return val, nil
+	}
+	sizes, err := chunkMap(val)
+	if err != nil {
+		return "", err
+	}
+	size := 17
+	for _, n := range sizes {
+		size += n
+	}
+	buf := make([]byte, 17, size)
+	copy(buf, val[:17])
+	buf[16] &^= chunkedType
+	for i, n := range sizes {
+		chunk, err := tx.Get(chunkKey(key, i))
+		if err == buntdb.ErrNotFound || (err == nil && len(chunk) != n) {
+			return "", errMissingChunk
+		}
+		if err != nil {
+			return "", err
+		}
+		buf = append(buf, chunk...)
+	}
+	return bytesToString(buf), nil
+}
+
+// storeChunked writes log under key as a chunk map and its chunks of at
+// most size bytes.
+func (b *BuntStore) storeChunked(tx *buntdb.Tx, key string, log *raft.Log,
+	size int, d *logDelta) error {
+	count := (len(log.Data) + size - 1) / size
+	val := binary.LittleEndian.AppendUint64(nil, log.Index)
+	val = binary.LittleEndian.AppendUint64(val, log.Term)
+	val = append(val, byte(log.Type)|chunkedType)
+	val = binary.AppendUvarint(val, uint64(count))
+	for i := 0; i < count; i++ {
+		n := size
+		if rem := len(log.Data) - i*size; rem < n {
+			n = rem
+		}
+		val = binary.AppendUvarint(val, uint64(n))
+	}
+	for i := 0; i < count; i++ {
+		data := log.Data[i*size:]
+		if len(data) > size {
+			data = data[:size]
+		}
+		if _, _, err := tx.Set(chunkKey(key, i), string(data), nil); err != nil {
+			return err
+		}
+	}
+	return setLog(tx, key, string(b.seal(val, log)), d)
+}
+
+// setLog sets the value of the log with key, deleting the chunks of the
+// value it replaces that the new value doesn't reuse, and its blob once
+// the transaction commits.
+func setLog(tx *buntdb.Tx, key, val string, d *logDelta) error {
+	prev, replaced, err := tx.Set(key, val, nil)
+	if err != nil {
+		return err
+	}
+	if replaced {
+		d.dropBlob(prev)
+	}
+	if replaced && isChunked(prev) {
+		keep := 0
+		if isChunked(val) {
+			sizes, err := chunkMap(val)
+			if err != nil {
+				return err
+			}
+			keep = len(sizes)
+		}
+		if err := deleteChunks(tx, key, prev, keep); err != nil {
+			return err
+		}
+	}
+	d.set(key, prev, replaced, val)
+	return nil
+}
+
+// deleteLog deletes the log with key and any chunks it has, and records
+// the deletion in d.
+func deleteLog(tx *buntdb.Tx, key string, d *logDelta) error {
+	prev, err := tx.Delete(key)
+	if err != nil {
+		return err
+	}
+	d.del(key, prev)
+	d.dropBlob(prev)
+	if !isChunked(prev) {
+		return nil
+	}
+	return deleteChunks(tx, key, prev, 0)
+}
+
+// deleteChunks deletes the chunks of the chunked log value val, from the
+// chunk numbered keep.
+func deleteChunks(tx *buntdb.Tx, key, val string, keep int) error {
+	sizes, err := chunkMap(val)
+	if err != nil {
+		// A corrupt map can't say which chunks exist
+		return nil
+	}
+	for i := keep; i < len(sizes); i++ {
+		if _, err := tx.Delete(chunkKey(key, i)); err != nil &&
+			err != buntdb.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChunks passes the chunks of the log with key and value val to write,
+// until it returns false.
+func writeChunks(tx *buntdb.Tx, key, val string,
+	write func(key, val string) bool) bool {
+	if !isChunked(val) {
+		return true
+	}
+	sizes, err := chunkMap(val)
+	if err != nil {
+		return true
+	}
+	for i := range sizes {
+		ckey := chunkKey(key, i)
+		chunk, err := tx.Get(ckey)
+		if err == nil && !write(ckey, chunk) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// chunkKeys returns the number of chunk keys in the store.
+func chunkKeys(t *testing.T, store *BuntStore) int {
+	t.Helper()
+	var n int
+	err := store.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", dbChunks, func(key, val string) bool {
+			if !strings.HasPrefix(key, dbChunks) {
+				return false
+			}
+			n++
+			return true
+		})
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return n
+}
+
+func TestBuntStore_Chunking(t *testing.T) {
+	for _, zeroCopy := range []bool{false, true} {
+		store := testBuntStoreOpts(t, &Options{ChunkSize: 10, ZeroCopy: zeroCopy})
+		big := &raft.Log{Index: 2, Term: 3, Type: raft.LogCommand,
+			Data: []byte(strings.Repeat("0123456789", 2) + "abc")}
+		logs := []*raft.Log{testRaftLog(1, "small"), big, testRaftLog(3, "0123456789")}
+		if err := store.StoreLogs(logs); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if n := chunkKeys(t, store); n != 3 {
+			t.Fatalf("bad: %d chunks", n)
+		}
+		for _, log := range logs {
+			var out raft.Log
+			if err := store.GetLog(log.Index, &out); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if out.Index != log.Index || out.Term != log.Term ||
+				out.Type != log.Type || !bytes.Equal(out.Data, log.Data) {
+				t.Fatalf("bad: %+v", out)
+			}
+		}
+		var out raft.Log
+		if err := store.GetLastLog(&out); err != nil || out.Index != 3 {
+			t.Fatalf("bad: %v %+v", err, out)
+		}
+
+		// The counter holds the size of the data, not of the chunk map
+		_, size := store.counter.get()
+		if want := uint64(3*17 + 5 + 23 + 10); size != want {
+			t.Fatalf("bad: %d, want %d", size, want)
+		}
+		checkCounter(t, store)
+
+		// Iterators, views and verification read the chunks back
+		var data []string
+		err := store.AscendLogsOfType(0, func(log *raft.Log) bool {
+			data = append(data, string(log.Data))
+			return true
+		}, raft.LogCommand)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(data) != 3 || data[1] != string(big.Data) {
+			t.Fatalf("bad: %q", data)
+		}
+		view, err := store.SnapshotView()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := view.GetLog(2, &out); err != nil || !bytes.Equal(out.Data, big.Data) {
+			t.Fatalf("bad: %v %q", err, out.Data)
+		}
+		view.Close()
+		report, err := store.Verify()
+		if err != nil || len(report.Corrupt) != 0 {
+			t.Fatalf("bad: %v %v", err, report)
+		}
+
+		// Replacing with a smaller entry drops the chunks it doesn't reuse
+		if err := store.StoreLog(&raft.Log{Index: 2,
+			Data: []byte("0123456789ab")}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if n := chunkKeys(t, store); n != 2 {
+			t.Fatalf("bad: %d chunks", n)
+		}
+		if err := store.StoreLog(testRaftLog(2, "plain")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if n := chunkKeys(t, store); n != 0 {
+			t.Fatalf("bad: %d chunks", n)
+		}
+		checkCounter(t, store)
+
+		// Deleting the log deletes its chunks
+		if err := store.StoreLog(big); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := store.DeleteRange(2, 2); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if n := chunkKeys(t, store); n != 0 {
+			t.Fatalf("bad: %d chunks", n)
+		}
+		checkCounter(t, store)
+		store.Close()
+		os.Remove(store.path)
+	}
+}
+
+func TestBuntStore_ChunkingCompact(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ChunkSize: 4})
+	defer os.Remove(store.path)
+	defer store.Close()
+	for i := uint64(1); i <= 10; i++ {
+		if err := store.StoreLog(testRaftLog(i, "chunked data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := store.CompactTo(4); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.TruncateAfter(8); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := chunkKeys(t, store); n != 4*3 {
+		t.Fatalf("bad: %d chunks", n)
+	}
+	if err := store.Reset(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := chunkKeys(t, store); n != 0 {
+		t.Fatalf("bad: %d chunks", n)
+	}
+}
+
+func TestBuntStore_ChunkingReopen(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ChunkSize: 4})
+	defer os.Remove(store.path)
+	if err := store.StoreLog(testRaftLog(1, "chunked data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	// Chunked logs are read without the option
+	store, err := Open(store.path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	var log raft.Log
+	if err := store.GetLog(1, &log); err != nil || string(log.Data) != "chunked data" {
+		t.Fatalf("bad: %v %q", err, log.Data)
+	}
+	checkCounter(t, store)
+}
+
+func TestBuntStore_ChunkingMissing(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ChunkSize: 4})
+	defer os.Remove(store.path)
+	defer store.Close()
+	if err := store.StoreLog(testRaftLog(1, "chunked data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err := store.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(chunkKey(store.logKey(1), 1))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var log raft.Log
+	err = store.GetLog(1, &log)
+	if cerr, ok := err.(*ErrCorruptEntry); !ok || cerr.Err != errMissingChunk {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestBuntStore_ChunkingBackupSince(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ChunkSize: 4})
+	defer os.Remove(store.path)
+	defer store.Close()
+	if err := store.StoreLog(testRaftLog(1, "chunked data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := store.BackupSince(0, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	other := testBuntStore(t)
+	defer os.Remove(other.path)
+	defer other.Close()
+	if err := other.ApplyIncremental(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var log raft.Log
+	if err := other.GetLog(1, &log); err != nil || string(log.Data) != "chunked data" {
+		t.Fatalf("bad: %v %q", err, log.Data)
+	}
+	checkCounter(t, other)
+}
@@ -0,0 +1,54 @@
+package raftbuntdb
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/tidwall/buntdb"
+)
+
+// Clone copies the current contents of the store into a new database at
+// dstPath and opens it with the store's options. The copy is made in a
+// single read transaction, so it is consistent while the store stays in
+// use, and is written and synced before it's opened. dstPath must not
+// exist.
+func (b *BuntStore) Clone(dstPath string) (*BuntStore, error) {
+	f, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+		b.opts.fileMode())
+	if err != nil {
+		return nil, err
+	}
+	err = b.view(func(tx *buntdb.Tx) error {
+		var buf []byte
+		var werr error
+		err := tx.Ascend("", func(key, val string) bool {
+			buf = appendCommand(buf, "set", key, val)
+			if len(buf) > 1024*1024 {
+				if _, werr = f.Write(buf); werr != nil {
+					return false
+				}
+				buf = buf[:0]
+			}
+			return true
+		})
+		if err != nil || werr != nil {
+			return firstErr(err, werr)
+		}
+		_, err = f.Write(buf)
+		return err
+	})
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(dstPath))
+	}
+	if err != nil {
+		os.Remove(dstPath)
+		return nil, err
+	}
+	return Open(dstPath, &b.opts)
+}
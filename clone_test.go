@@ -0,0 +1,63 @@
+package raftbuntdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Clone(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{KeyEncoding: BinaryKeys})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.SetUint64([]byte("CurrentTerm"), 3)
+
+	dst := store.path + ".clone"
+	defer os.Remove(dst)
+	clone, err := store.Clone(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer clone.Close()
+
+	// Later writes to either store stay apart
+	store.StoreLog(testRaftLog(11, "log"))
+	clone.DeleteRange(1, 2)
+	if idx, _ := clone.LastIndex(); idx != 10 {
+		t.Fatalf("bad: %d", idx)
+	}
+	if idx, _ := store.FirstIndex(); idx != 1 {
+		t.Fatalf("bad: %d", idx)
+	}
+	var log raft.Log
+	if err := clone.GetLog(5, &log); err != nil || !reflect.DeepEqual(&log, logs[4]) {
+		t.Fatalf("bad: %#v %v", log, err)
+	}
+	if term, _ := clone.GetUint64([]byte("CurrentTerm")); term != 3 {
+		t.Fatalf("bad: %d", term)
+	}
+	if clone.keys.enc != BinaryKeys {
+		t.Fatalf("bad: %v", clone.keys.enc)
+	}
+	checkCounter(t, clone)
+	smd, _ := store.Metadata()
+	cmd, _ := clone.Metadata()
+	if !smd.Created.Equal(cmd.Created) {
+		t.Fatalf("bad: %v %v", smd.Created, cmd.Created)
+	}
+
+	// An existing file is not overwritten
+	if _, err := store.Clone(dst); !os.IsExist(err) {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,407 @@
+// Command raft-buntdb inspects and maintains raft-buntdb database files.
+// The stats, dump, verify, keys and export-bolt commands open the database
+// read-only and can read the file of a running node. The others must not
+// be run while a node has it open.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+	"github.com/tidwall/raft-buntdb/bench"
+	"github.com/tidwall/raft-buntdb/migrate"
+)
+
+const usage = `usage: raft-buntdb <command> [flags] <path>
+
+commands:
+  stats    print store statistics
+  dump     print logs as JSON, one per line, with peer changes decoded
+  verify   check the store for corruption and gaps
+  compact  delete logs up to an index and shrink the file
+  keys     print the stable store keys and values
+  upgrade  upgrade the file format and rewrite unpadded log keys in
+           place, keeping a .bak copy
+  bench    measure append, catch-up and compaction on a scratch store,
+           printing the results as JSON
+
+  migrate-bolt <bolt-path> <path>
+           copy a raft-boltdb store into a new store
+  export-bolt <path> <bolt-path>
+           copy a store into a new raft-boltdb store
+  replay <trace-path> <path>
+           run the calls of a trace recorded with Options.Trace against
+           a store, creating it if needed
+
+stats, dump, verify, compact, keys and export-bolt take -stable <path>
+for a stable store kept in a file of its own, and -hmac-key-file <path>
+for a store whose logs are signed. All but compact open the store
+read-only, and can be run while a node has it open.
+`
+
+// command runs a subcommand with its flags parsed from args.
+type command func(fs *flag.FlagSet, args []string, out io.Writer) error
+
+var commands = map[string]command{
+	"stats":   statsCmd,
+	"dump":    dumpCmd,
+	"verify":  verifyCmd,
+	"compact": compactCmd,
+	"keys":    keysCmd,
+	"upgrade": upgradeCmd,
+	"bench":   benchCmd,
+
+	"migrate-bolt": migrateBoltCmd,
+	"export-bolt":  exportBoltCmd,
+	"replay":       replayCmd,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "raft-buntdb: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	return cmd(fs, args[1:], out)
+}
+
+// storeFlags adds the flags naming the stable file and the HMAC key of a
+// store to fs, and returns a function that makes the options to open the
+// store with once fs is parsed.
+func storeFlags(fs *flag.FlagSet) func() (*raftbuntdb.Options, error) {
+	stable := fs.String("stable", "", "path of the stable store file, if kept apart")
+	keyFile := fs.String("hmac-key-file", "", "file holding the HMAC key of the logs")
+	return func() (*raftbuntdb.Options, error) {
+		opts := &raftbuntdb.Options{
+			Durability: raftbuntdb.High,
+			StablePath: *stable,
+		}
+		if *keyFile != "" {
+			key, err := os.ReadFile(*keyFile)
+			if err != nil {
+				return nil, err
+			}
+			opts.HMACKey = raftbuntdb.StaticKey(key)
+		}
+		return opts, nil
+	}
+}
+
+// openStore parses the flags and opens the store named by the single
+// remaining argument. The file must already exist. It's opened read-only
+// unless the command writes to it.
+func openStore(fs *flag.FlagSet, args []string, readOnly bool) (*raftbuntdb.BuntStore, error) {
+	storeOpts := storeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("%s: expected a database path", fs.Name())
+	}
+	path := fs.Arg(0)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	opts, err := storeOpts()
+	if err != nil {
+		return nil, err
+	}
+	opts.ReadOnly = readOnly
+	return raftbuntdb.Open(path, opts)
+}
+
+func statsCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	store, err := openStore(fs, args, true)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	stats, err := store.Stats()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "first_index  %d\n", stats.FirstIndex)
+	fmt.Fprintf(out, "last_index   %d\n", stats.LastIndex)
+	fmt.Fprintf(out, "logs         %d\n", stats.Logs)
+	fmt.Fprintf(out, "log_bytes    %d\n", stats.LogBytes)
+	fmt.Fprintf(out, "stable_keys  %d\n", stats.StableKeys)
+	fmt.Fprintf(out, "file_size    %d\n", stats.FileSize)
+	return nil
+}
+
+// dumpEntry is the JSON form of a log entry. Peer changes are decoded into
+// the list of peers rather than printed as raw data.
+type dumpEntry struct {
+	Index uint64   `json:"index"`
+	Term  uint64   `json:"term"`
+	Type  string   `json:"type"`
+	Data  []byte   `json:"data,omitempty"`
+	Peers []string `json:"peers,omitempty"`
+}
+
+func newDumpEntry(log *raft.Log) dumpEntry {
+	entry := dumpEntry{
+		Index: log.Index,
+		Term:  log.Term,
+		Type:  logTypeName(log.Type),
+		Data:  log.Data,
+	}
+	if log.Type == raft.LogAddPeer || log.Type == raft.LogRemovePeer {
+		if peers, err := raftbuntdb.DecodePeers(log.Data); err == nil {
+			entry.Data, entry.Peers = nil, peers
+		}
+	}
+	return entry
+}
+
+var logTypes = map[raft.LogType]string{
+	raft.LogCommand:    "LogCommand",
+	raft.LogNoop:       "LogNoop",
+	raft.LogAddPeer:    "LogAddPeer",
+	raft.LogRemovePeer: "LogRemovePeer",
+	raft.LogBarrier:    "LogBarrier",
+}
+
+func logTypeName(t raft.LogType) string {
+	if name, ok := logTypes[t]; ok {
+		return name
+	}
+	return "LogType(" + strconv.Itoa(int(t)) + ")"
+}
+
+func dumpCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	min := fs.Uint64("min", 0, "first index to dump, defaults to the first log")
+	max := fs.Uint64("max", 0, "last index to dump, defaults to the last log")
+	store, err := openStore(fs, args, true)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	last := *max
+	if last == 0 {
+		last = 1<<64 - 1
+	}
+	enc := json.NewEncoder(out)
+	var eerr error
+	err = store.AscendLogRange(*min, last, func(log *raft.Log) bool {
+		eerr = enc.Encode(newDumpEntry(log))
+		return eerr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return eerr
+}
+
+func verifyCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	store, err := openStore(fs, args, true)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	report, err := store.Verify()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, report.String())
+	for _, c := range report.Corrupt {
+		fmt.Fprintf(out, "corrupt: %v\n", c)
+	}
+	for _, gap := range report.Gaps {
+		fmt.Fprintf(out, "gap: %d-%d\n", gap.Min, gap.Max)
+	}
+	for _, key := range report.BadStableKeys {
+		fmt.Fprintf(out, "bad stable key: %q\n", key)
+	}
+	if !report.OK() {
+		return errors.New("verification failed")
+	}
+	return nil
+}
+
+func compactCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	to := fs.Uint64("to", 0, "delete logs up to and including this index")
+	shrink := fs.Bool("shrink", true, "shrink the file after compacting")
+	store, err := openStore(fs, args, false)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if *to == 0 {
+		return errors.New("compact: -to is required")
+	}
+	before, err := store.Stats()
+	if err != nil {
+		return err
+	}
+	if err := store.CompactTo(*to); err != nil {
+		return err
+	}
+	if *shrink {
+		if err := store.Shrink(); err != nil {
+			return err
+		}
+	}
+	after, err := store.Stats()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "deleted %d logs, file size %d -> %d\n",
+		before.Logs-after.Logs, before.FileSize, after.FileSize)
+	return nil
+}
+
+func keysCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	store, err := openStore(fs, args, true)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	keys, err := store.StableKeys()
+	if err != nil {
+		return err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return string(keys[i]) < string(keys[j])
+	})
+	for _, key := range keys {
+		val, err := store.Get(key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\t%s\n", key, strconv.Quote(string(val)))
+	}
+	return nil
+}
+
+func upgradeCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("upgrade: expected a database path")
+	}
+	if err := raftbuntdb.Migrate(fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "format version %d\n", raftbuntdb.FormatVersion)
+	return nil
+}
+
+func migrateBoltCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("migrate-bolt: expected a bolt path and a database path")
+	}
+	res, err := migrate.MigrateFromBolt(fs.Arg(0), fs.Arg(1),
+		&migrate.Options{Durability: raftbuntdb.High})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "migrated %d logs (%d-%d) and %d stable keys\n",
+		res.Logs, res.FirstIndex, res.LastIndex, res.StableKeys)
+	return nil
+}
+
+func exportBoltCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	storeOpts := storeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("export-bolt: expected a database path and a bolt path")
+	}
+	opts, err := storeOpts()
+	if err != nil {
+		return err
+	}
+	res, err := migrate.ExportToBolt(fs.Arg(0), fs.Arg(1), opts, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported %d logs (%d-%d) and %d stable keys\n",
+		res.Logs, res.FirstIndex, res.LastIndex, res.StableKeys)
+	return nil
+}
+
+func replayCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("replay: expected a trace path and a database path")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	store, err := raftbuntdb.Open(fs.Arg(1), &raftbuntdb.Options{Durability: raftbuntdb.High})
+	if err != nil {
+		return err
+	}
+	n, err := raftbuntdb.ReplayTrace(f, store)
+	if cerr := store.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "replayed %d calls\n", n)
+	return nil
+}
+
+var durabilityLevels = map[string]raftbuntdb.Level{
+	"low":    raftbuntdb.Low,
+	"medium": raftbuntdb.Medium,
+	"high":   raftbuntdb.High,
+}
+
+func benchCmd(fs *flag.FlagSet, args []string, out io.Writer) error {
+	def := bench.DefaultConfig
+	entries := fs.Int("entries", def.Entries, "number of logs to append")
+	size := fs.Int("size", def.EntrySize, "size of the data of each log")
+	batch := fs.Int("batch", def.BatchSize, "logs per call to StoreLogs")
+	cycles := fs.Int("cycles", def.Cycles, "number of compaction cycles")
+	durability := fs.String("durability", "medium", "low, medium or high")
+	dir := fs.String("dir", os.TempDir(), "directory of the scratch store")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("bench: unexpected arguments")
+	}
+	level, ok := durabilityLevels[*durability]
+	if !ok {
+		return fmt.Errorf("bench: unknown durability %q", *durability)
+	}
+	res, err := bench.Run(*dir, bench.Config{Entries: *entries,
+		EntrySize: *size, BatchSize: *batch, Durability: level,
+		Cycles: *cycles})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
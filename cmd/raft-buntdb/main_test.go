@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+	"github.com/tidwall/raft-buntdb/bench"
+)
+
+func testStorePath(t *testing.T) string {
+	fh, err := ioutil.TempFile("", "bunt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fh.Close()
+	os.Remove(fh.Name())
+	store, err := raftbuntdb.NewBuntStore(fh.Name(), raftbuntdb.High)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	for i := uint64(1); i <= 5; i++ {
+		log := &raft.Log{Index: i, Term: 1, Data: []byte("log")}
+		if err := store.StoreLog(log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return fh.Name()
+}
+
+func testRun(t *testing.T, args ...string) string {
+	var out bytes.Buffer
+	if err := run(args, &out); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return out.String()
+}
+
+func TestCommands(t *testing.T) {
+	path := testStorePath(t)
+	defer os.Remove(path)
+
+	if out := testRun(t, "stats", path); !strings.Contains(out, "logs         5") {
+		t.Fatalf("bad: %s", out)
+	}
+	out := testRun(t, "dump", "-min", "2", "-max", "3", path)
+	if out != `{"index":2,"term":1,"type":"LogCommand","data":"bG9n"}`+"\n"+
+		`{"index":3,"term":1,"type":"LogCommand","data":"bG9n"}`+"\n" {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := testRun(t, "verify", path); !strings.Contains(out, "entries=5") {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := testRun(t, "keys", path); out != "CurrentTerm\t\"1\"\n" {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := testRun(t, "upgrade", path); out != "format version 1\n" {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := testRun(t, "compact", "-to", "3", path); !strings.Contains(out, "deleted 3 logs") {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := testRun(t, "stats", path); !strings.Contains(out, "first_index  4") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestInspectReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	path, stablePath, keyPath := dir+"/raft.db", dir+"/stable.db", dir+"/key"
+	if err := ioutil.WriteFile(keyPath, []byte("secret"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err := raftbuntdb.Open(path, &raftbuntdb.Options{
+		Durability: raftbuntdb.High,
+		StablePath: stablePath,
+		HMACKey:    raftbuntdb.StaticKey("secret"),
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		log := &raft.Log{Index: i, Term: 1, Data: []byte("log")}
+		if err := store.StoreLog(log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+	before, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	args := func(cmd string) []string {
+		return []string{cmd, "-stable", stablePath, "-hmac-key-file", keyPath, path}
+	}
+	if out := testRun(t, args("verify")...); !strings.Contains(out, "entries=3") {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := testRun(t, args("keys")...); out != "CurrentTerm\t\"1\"\n" {
+		t.Fatalf("bad: %s", out)
+	}
+	testRun(t, args("stats")...)
+	testRun(t, args("dump")...)
+	after, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("file changed")
+	}
+
+	// The logs don't verify with the wrong key
+	if err := ioutil.WriteFile(keyPath, []byte("other"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := run(args("verify"), ioutil.Discard); err == nil {
+		t.Fatalf("expected verification error")
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	if err := run(nil, ioutil.Discard); err == nil {
+		t.Fatalf("expected usage error")
+	}
+	if err := run([]string{"bogus"}, ioutil.Discard); err == nil {
+		t.Fatalf("expected unknown command error")
+	}
+	if err := run([]string{"stats", "/does/not/exist"}, ioutil.Discard); err == nil {
+		t.Fatalf("expected missing file error")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	trace, err := os.Create(dir + "/trace")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err := raftbuntdb.Open(dir+"/raft.db", &raftbuntdb.Options{Trace: trace})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		if err := store.StoreLog(&raft.Log{Index: i, Term: 1, Data: []byte("log")}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	store.Close()
+	trace.Close()
+	if out := testRun(t, "replay", dir+"/trace", dir+"/replay.db"); out != "replayed 3 calls\n" {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := testRun(t, "stats", dir+"/replay.db"); !strings.Contains(out, "logs         3") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestDumpPeers(t *testing.T) {
+	entry := newDumpEntry(&raft.Log{
+		Index: 7,
+		Type:  raft.LogAddPeer,
+		Data:  []byte{0x92, 0xa3, 'a', ':', '1', 0xa3, 'b', ':', '2'},
+	})
+	if entry.Data != nil || len(entry.Peers) != 2 || entry.Peers[1] != "b:2" {
+		t.Fatalf("bad: %#v", entry)
+	}
+
+	// Undecodable peers are left as data
+	entry = newDumpEntry(&raft.Log{Type: raft.LogRemovePeer, Data: []byte("x")})
+	if string(entry.Data) != "x" || entry.Peers != nil {
+		t.Fatalf("bad: %#v", entry)
+	}
+}
+
+func TestBench(t *testing.T) {
+	out := testRun(t, "bench", "-entries", "20", "-cycles", "1",
+		"-durability", "low", "-dir", t.TempDir())
+	var res bench.Result
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.Append.Entries != 20 || res.Config.Durability != raftbuntdb.Low ||
+		len(res.Cycles) != 1 {
+		t.Fatalf("bad: %s", out)
+	}
+	if err := run([]string{"bench", "-durability", "max"}, ioutil.Discard); err == nil {
+		t.Fatalf("expected unknown durability error")
+	}
+}
@@ -0,0 +1,156 @@
+package raftbuntdb
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// CompactTo deletes all logs with an index up to and including idx. The
+// logs are first passed to the Archiver, if one is configured.
+func (b *BuntStore) CompactTo(idx uint64) error {
+	_, err := b.compactTo(idx)
+	return err
+}
+
+// DeleteBelow deletes all logs with an index less than idx, in a single
+// scan from the head of the log that stops at idx. Unlike DeleteRange it
+// doesn't need the first index or probe each index in the range, so it's
+// the cheaper way to compact. The logs are first passed to the Archiver,
+// if one is configured.
+func (b *BuntStore) DeleteBelow(idx uint64) error {
+	if idx == 0 {
+		return nil
+	}
+	_, err := b.compactTo(idx - 1)
+	return err
+}
+
+// compactTo deletes the logs up to idx and returns the number of bytes
+// they occupied in the file.
+func (b *BuntStore) compactTo(idx uint64) (int64, error) {
+	var dead int64
+	err := b.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+		var keys []string
+		err := b.keys.ascendLogs(tx, 0, func(key, val string) bool {
+			if logIndex(key) > idx {
+				return false
+			}
+			keys = append(keys, key)
+			dead += setBytes(key, val)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if b.opts.Archiver != nil && len(keys) > 0 {
+			err := b.archiveRange(tx, 0, idx)
+			if err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			if err := deleteLog(tx, key, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	b.onDeleteRange(0, idx)
+	return dead, nil
+}
+
+// setBytes returns the bytes the set commands of the log with key and
+// value val take in the file, counting those of its chunks.
+func setBytes(key, val string) int64 {
+	size := int64(len(appendCommand(nil, "set", key, val)))
+	if !isChunked(val) {
+		return size
+	}
+	sizes, err := chunkMap(val)
+	if err != nil {
+		return size
+	}
+	for i, n := range sizes {
+		// The chunk data is counted by its length, not copied
+		ckey := chunkKey(key, i)
+		size += int64(len(appendCommand(nil, "set", ckey, ""))) +
+			int64(len(strconv.Itoa(n))-1+n)
+	}
+	return size
+}
+
+// TruncateAfter deletes all logs with an index greater than idx, such as to
+// roll a diverged follower back to a known-good index. The logs are first
+// passed to the Archiver, if one is configured.
+func (b *BuntStore) TruncateAfter(idx uint64) error {
+	var last uint64
+	err := b.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+		var keys []string
+		err := b.keys.descendLogs(tx, 1<<64-1, func(key, val string) bool {
+			if logIndex(key) <= idx {
+				return false
+			}
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+		last = logIndex(keys[0])
+		if b.opts.Archiver != nil {
+			if err := b.archiveRange(tx, idx+1, last); err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			if err := deleteLog(tx, key, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && last > 0 {
+		b.onDeleteRange(idx+1, last)
+	}
+	return err
+}
+
+// OnSnapshot should be called by the application after raft completes a
+// snapshot. It deletes the logs covered by the snapshot and shrinks the
+// file when the deleted logs account for at least half of it. The number
+// of bytes reclaimed by shrinking is returned. Outside of the windows of
+// Options.ShrinkSchedule the shrink is deferred, and nothing is reclaimed
+// yet.
+func (b *BuntStore) OnSnapshot(meta raft.SnapshotMeta) (int64, error) {
+	dead, err := b.compactTo(meta.Index)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(b.path)
+	if err != nil {
+		return 0, err
+	}
+	if dead == 0 || dead < fi.Size()/2 {
+		return 0, nil
+	}
+	if !b.opts.ShrinkSchedule.allows(time.Now()) {
+		b.deferred.set(true)
+		return 0, nil
+	}
+	if err := b.Shrink(); err != nil {
+		return 0, err
+	}
+	b.deferred.set(false)
+	after, err := os.Stat(b.path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size() - after.Size(), nil
+}
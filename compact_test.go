@@ -0,0 +1,173 @@
+package raftbuntdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_CompactTo(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.CompactTo(4); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	idx, err := store.FirstIndex()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx != 5 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_OnSnapshot(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 100; i++ {
+		logs = append(logs, testRaftLog(i, "some log data"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Deleting a few logs is not worth a shrink
+	reclaimed, err := store.OnSnapshot(raft.SnapshotMeta{Index: 10})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if reclaimed != 0 {
+		t.Fatalf("bad: %d", reclaimed)
+	}
+
+	reclaimed, err = store.OnSnapshot(raft.SnapshotMeta{Index: 90})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if reclaimed <= 0 {
+		t.Fatalf("bad: %d", reclaimed)
+	}
+	idx, err := store.FirstIndex()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx != 91 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_CompactToChunked(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ChunkSize: 4})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	before, err := os.Stat(store.path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "some chunked log data"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	after, err := os.Stat(store.path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The dead bytes count the chunks, which take most of the file
+	dead, err := store.compactTo(10)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	written := after.Size() - before.Size()
+	if dead <= written/2 || dead > written {
+		t.Fatalf("bad: %d of %d", dead, written)
+	}
+}
+
+func TestBuntStore_TruncateAfter(t *testing.T) {
+	var r hookRecorder
+	store := testBuntStoreOpts(t, &Options{Hooks: r.hooks()})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(5); i <= 20; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.check(t, "store 5-20")
+	if err := store.TruncateAfter(12); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.check(t, "delete 13-20")
+	first, _ := store.FirstIndex()
+	last, _ := store.LastIndex()
+	if first != 5 || last != 12 {
+		t.Fatalf("bad: %d %d", first, last)
+	}
+	checkCounter(t, store)
+
+	// Nothing to truncate
+	if err := store.TruncateAfter(12); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.check(t)
+
+	// Before the first log, everything goes
+	if err := store.TruncateAfter(0); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n, _ := store.LogCount(); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestBuntStore_DeleteBelow(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(3); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, idx := range []uint64{0, 1, 3} {
+		if err := store.DeleteBelow(idx); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if n, _ := store.LogCount(); n != 8 {
+			t.Fatalf("bad: %d", n)
+		}
+	}
+	if err := store.DeleteBelow(7); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	first, _ := store.FirstIndex()
+	last, _ := store.LastIndex()
+	if first != 7 || last != 10 {
+		t.Fatalf("bad: %d %d", first, last)
+	}
+	checkCounter(t, store)
+}
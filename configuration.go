@@ -0,0 +1,200 @@
+package raftbuntdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// configurationKey is the stable key holding the latest configuration.
+var configurationKey = []byte("configuration")
+
+// ServerSuffrage determines whether a server can vote. It mirrors the
+// suffrage of hashicorp/raft, which github.com/tidwall/raft does not have.
+type ServerSuffrage int
+
+const (
+	// Voter servers take part in elections and count toward quorum.
+	Voter ServerSuffrage = iota
+	// Nonvoter servers receive logs but do not vote.
+	Nonvoter
+	// Staging servers are catching up and will become voters.
+	Staging
+)
+
+var suffrageNames = []string{"Voter", "Nonvoter", "Staging"}
+
+func (s ServerSuffrage) String() string {
+	if s >= 0 && int(s) < len(suffrageNames) {
+		return suffrageNames[s]
+	}
+	return fmt.Sprintf("ServerSuffrage(%d)", int(s))
+}
+
+// MarshalText encodes the suffrage by name.
+func (s ServerSuffrage) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(suffrageNames) {
+		return nil, fmt.Errorf("invalid suffrage %d", int(s))
+	}
+	return []byte(suffrageNames[s]), nil
+}
+
+// UnmarshalText decodes a suffrage name.
+func (s *ServerSuffrage) UnmarshalText(text []byte) error {
+	for i, name := range suffrageNames {
+		if string(text) == name {
+			*s = ServerSuffrage(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid suffrage %q", text)
+}
+
+// Server is a member of a configuration.
+type Server struct {
+	Suffrage ServerSuffrage `json:"suffrage"`
+	ID       string         `json:"id"`
+	Address  string         `json:"address"`
+}
+
+// Configuration is the membership of a cluster, with server IDs and
+// suffrage that the legacy peers list does not carry.
+type Configuration struct {
+	Servers []Server `json:"servers"`
+}
+
+// storedConfiguration is the stable value of configurationKey.
+type storedConfiguration struct {
+	Index uint64 `json:"index"`
+	Configuration
+}
+
+// SetConfiguration stores cfg as the configuration committed at index.
+func (b *BuntStore) SetConfiguration(cfg Configuration, index uint64) error {
+	data, err := json.Marshal(storedConfiguration{Index: index, Configuration: cfg})
+	if err != nil {
+		return err
+	}
+	return b.Set(configurationKey, data)
+}
+
+// Configuration returns the stored configuration and the index it was
+// committed at. When no configuration was stored, the servers returned by
+// Servers are used, at index 0.
+func (b *BuntStore) Configuration() (Configuration, uint64, error) {
+	val, err := b.Get(configurationKey)
+	if err == ErrKeyNotFound {
+		servers, err := b.Servers()
+		if err != nil {
+			return Configuration{}, 0, err
+		}
+		return Configuration{Servers: servers}, 0, nil
+	}
+	if err != nil {
+		return Configuration{}, 0, err
+	}
+	var stored storedConfiguration
+	if err := json.Unmarshal(val, &stored); err != nil {
+		return Configuration{}, 0, err
+	}
+	return stored.Configuration, stored.Index, nil
+}
+
+// peersConfiguration converts a legacy peers list.
+func peersConfiguration(peers []string) Configuration {
+	var cfg Configuration
+	for _, peer := range peers {
+		cfg.Servers = append(cfg.Servers,
+			Server{Suffrage: Voter, ID: peer, Address: peer})
+	}
+	return cfg
+}
+
+// peersJSONServer is an entry of a version 3 peers.json file.
+type peersJSONServer struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	NonVoter bool   `json:"non_voter"`
+}
+
+// ReadPeersJSON reads a peers.json recovery file in the formats documented
+// by hashicorp/raft: either an array of addresses, or an array of objects
+// with "id", "address" and "non_voter" fields.
+func ReadPeersJSON(path string) (Configuration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Configuration{}, err
+	}
+	var cfg Configuration
+	var addrs []string
+	if err := json.Unmarshal(data, &addrs); err == nil {
+		cfg = peersConfiguration(addrs)
+	} else {
+		var servers []peersJSONServer
+		if err := json.Unmarshal(data, &servers); err != nil {
+			return Configuration{}, err
+		}
+		for _, s := range servers {
+			suffrage := Voter
+			if s.NonVoter {
+				suffrage = Nonvoter
+			}
+			cfg.Servers = append(cfg.Servers,
+				Server{Suffrage: suffrage, ID: s.ID, Address: s.Address})
+		}
+	}
+	if err := checkConfiguration(cfg); err != nil {
+		return Configuration{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// checkConfiguration checks that a configuration can elect a leader.
+func checkConfiguration(cfg Configuration) error {
+	ids := make(map[string]bool)
+	addrs := make(map[string]bool)
+	var voters int
+	for _, s := range cfg.Servers {
+		if s.ID == "" || s.Address == "" {
+			return errors.New("server with an empty id or address")
+		}
+		if ids[s.ID] {
+			return fmt.Errorf("duplicate server id %q", s.ID)
+		}
+		if addrs[s.Address] {
+			return fmt.Errorf("duplicate server address %q", s.Address)
+		}
+		ids[s.ID], addrs[s.Address] = true, true
+		if s.Suffrage == Voter {
+			voters++
+		}
+	}
+	if voters == 0 {
+		return errors.New("configuration has no voters")
+	}
+	return nil
+}
+
+// ImportPeersJSON performs manual quorum recovery from a peers.json file,
+// following the hashicorp/raft procedure. The configuration is stored at
+// the last log index, and its servers replace the peers, see SetServers.
+// The node must be stopped, and the file should be removed once every
+// server has imported it.
+func (b *BuntStore) ImportPeersJSON(path string) (Configuration, error) {
+	cfg, err := ReadPeersJSON(path)
+	if err != nil {
+		return Configuration{}, err
+	}
+	index, err := b.LastIndex()
+	if err != nil {
+		return Configuration{}, err
+	}
+	if err := b.SetServers(cfg.Servers); err != nil {
+		return Configuration{}, err
+	}
+	if err := b.SetConfiguration(cfg, index); err != nil {
+		return Configuration{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,128 @@
+package raftbuntdb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuntStore_Configuration(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// Empty without a configuration or peers
+	cfg, index, err := store.Configuration()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(cfg.Servers) != 0 || index != 0 {
+		t.Fatalf("bad: %#v %d", cfg, index)
+	}
+
+	// Converted from the legacy peers
+	if err := store.SetPeers([]string{"a:1", "b:2"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cfg, _, err = store.Configuration()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expect := Configuration{Servers: []Server{
+		{Suffrage: Voter, ID: "a:1", Address: "a:1"},
+		{Suffrage: Voter, ID: "b:2", Address: "b:2"},
+	}}
+	if !reflect.DeepEqual(cfg, expect) {
+		t.Fatalf("bad: %#v", cfg)
+	}
+
+	expect = Configuration{Servers: []Server{
+		{Suffrage: Voter, ID: "node1", Address: "a:1"},
+		{Suffrage: Nonvoter, ID: "node2", Address: "b:2"},
+		{Suffrage: Staging, ID: "node3", Address: "c:3"},
+	}}
+	if err := store.SetConfiguration(expect, 42); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cfg, index, err = store.Configuration()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(cfg, expect) || index != 42 {
+		t.Fatalf("bad: %#v %d", cfg, index)
+	}
+
+	// Invalid suffrage is refused
+	bad := Configuration{Servers: []Server{{Suffrage: 7}}}
+	if err := store.SetConfiguration(bad, 43); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestBuntStore_ImportPeersJSON(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return path
+	}
+	store.StoreLog(testRaftLog(7, "log"))
+
+	// Version 3 format with IDs and suffrage
+	path := write("peers3.json", `[
+		{"id": "node1", "address": "10.0.0.1:8300", "non_voter": false},
+		{"id": "node2", "address": "10.0.0.2:8300", "non_voter": true}
+	]`)
+	cfg, err := store.ImportPeersJSON(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expect := Configuration{Servers: []Server{
+		{Suffrage: Voter, ID: "node1", Address: "10.0.0.1:8300"},
+		{Suffrage: Nonvoter, ID: "node2", Address: "10.0.0.2:8300"},
+	}}
+	if !reflect.DeepEqual(cfg, expect) {
+		t.Fatalf("bad: %#v", cfg)
+	}
+	stored, index, err := store.Configuration()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(stored, expect) || index != 7 {
+		t.Fatalf("bad: %#v %d", stored, index)
+	}
+	peers, err := store.Peers()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(peers, []string{"10.0.0.1:8300"}) {
+		t.Fatalf("bad: %v", peers)
+	}
+
+	// Version 1 format with addresses only
+	path = write("peers1.json", `["10.0.0.1:8300", "10.0.0.3:8300"]`)
+	if cfg, err = store.ImportPeersJSON(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(cfg.Servers) != 2 || cfg.Servers[1].ID != "10.0.0.3:8300" {
+		t.Fatalf("bad: %#v", cfg)
+	}
+
+	// Invalid files are refused
+	for _, data := range []string{
+		`[]`,
+		`[{"id": "a", "address": "x", "non_voter": true}]`,
+		`[{"id": "a", "address": "x"}, {"id": "a", "address": "y"}]`,
+		`{"id": "a"}`,
+	} {
+		if _, err := store.ImportPeersJSON(write("bad.json", data)); err == nil {
+			t.Fatalf("expected an error for %s", data)
+		}
+	}
+}
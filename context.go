@@ -0,0 +1,144 @@
+package raftbuntdb
+
+import (
+	"context"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// deleteChunkSize is the number of logs DeleteRangeContext deletes in each
+// transaction.
+const deleteChunkSize = 1024
+
+// GetLogContext is like GetLog but returns the context's error if it is
+// done before the read starts.
+func (b *BuntStore) GetLogContext(ctx context.Context, idx uint64,
+	log *raft.Log) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.GetLog(idx, log)
+}
+
+// StoreLogsContext is like StoreLogs but returns the context's error,
+// without storing anything, if it is done before the logs are committed.
+// With group commit a batch that has been queued is always written. A
+// batch split by Options.TxnLimit keeps the parts committed before the
+// context is done.
+func (b *BuntStore) StoreLogsContext(ctx context.Context,
+	logs []*raft.Log) error {
+	if err := b.calls.enter(); err != nil {
+		return err
+	}
+	defer b.calls.leave()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := b.waitTurn(ctx, &b.limits.write, logsSize(logs)); err != nil {
+		return err
+	}
+	if err := b.waitBacklog(ctx); err != nil {
+		return err
+	}
+	if b.opts.GroupCommit != nil {
+		return b.groupStoreLogs(logs)
+	}
+	return b.storeLogParts(ctx, logs)
+}
+
+// DeleteRangeContext is like DeleteRange but deletes the logs in chunks,
+// one transaction each, and stops with the context's error once it is
+// done. Chunks are deleted from min upwards, so a cancelled call leaves
+// the log without a hole when min is the first index.
+func (b *BuntStore) DeleteRangeContext(ctx context.Context,
+	min, max uint64) error {
+	if err := b.calls.enter(); err != nil {
+		return err
+	}
+	defer b.calls.leave()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var next uint64
+		err := b.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+			var err error
+			next, err = b.deleteChunk(tx, min, max, d)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if next == 0 {
+			b.onDeleteRange(min, max)
+			return nil
+		}
+		b.onDeleteRange(min, next-1)
+		min = next
+	}
+}
+
+// deleteChunk deletes up to deleteChunkSize logs from min to max and
+// returns the index to continue from, or zero when the range is done.
+func (b *BuntStore) deleteChunk(tx *buntdb.Tx, min, max uint64,
+	d *logDelta) (uint64, error) {
+	var keys []string
+	var next, end uint64
+	err := b.keys.ascendLogs(tx, min,
+		func(key, val string) bool {
+			idx := logIndex(key)
+			if idx > max {
+				return false
+			}
+			if len(keys) == deleteChunkSize {
+				next = idx
+				return false
+			}
+			keys = append(keys, key)
+			end = idx
+			return true
+		})
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	if b.opts.Archiver != nil {
+		if err := b.archiveRange(tx, min, end); err != nil {
+			return 0, err
+		}
+	}
+	for _, key := range keys {
+		if err := deleteLog(tx, key, d); err != nil {
+			return 0, err
+		}
+	}
+	return next, nil
+}
+
+// AscendLogRangeContext is like AscendLogRange but stops with the
+// context's error once it is done.
+func (b *BuntStore) AscendLogRangeContext(ctx context.Context, min, max uint64,
+	iter func(log *raft.Log) bool) error {
+	var cerr error
+	err := b.AscendLogRange(min, max, func(log *raft.Log) bool {
+		if cerr = ctx.Err(); cerr != nil {
+			return false
+		}
+		return iter(log)
+	})
+	return firstErr(err, cerr)
+}
+
+// DescendLogRangeContext is like DescendLogRange but stops with the
+// context's error once it is done.
+func (b *BuntStore) DescendLogRangeContext(ctx context.Context, max, min uint64,
+	iter func(log *raft.Log) bool) error {
+	var cerr error
+	err := b.DescendLogRange(max, min, func(log *raft.Log) bool {
+		if cerr = ctx.Err(); cerr != nil {
+			return false
+		}
+		return iter(log)
+	})
+	return firstErr(err, cerr)
+}
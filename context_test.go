@@ -0,0 +1,131 @@
+package raftbuntdb
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Context(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	ctx := context.Background()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogsContext(ctx, logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var log raft.Log
+	if err := store.GetLogContext(ctx, 3, &log); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if log.Index != 3 {
+		t.Fatalf("bad: %#v", log)
+	}
+
+	// Stop part way through an iteration
+	cctx, cancel := context.WithCancel(ctx)
+	var n int
+	err := store.AscendLogRangeContext(cctx, 1, 10, func(log *raft.Log) bool {
+		if n++; n == 4 {
+			cancel()
+		}
+		return true
+	})
+	if err != context.Canceled || n != 4 {
+		t.Fatalf("err: %v n: %d", err, n)
+	}
+	err = store.DescendLogRangeContext(cctx, 10, 1, func(*raft.Log) bool {
+		t.Fatalf("should not be called")
+		return true
+	})
+	if err != context.Canceled {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Nothing is done with a cancelled context
+	if err := store.GetLogContext(cctx, 3, &log); err != context.Canceled {
+		t.Fatalf("err: %v", err)
+	}
+	err = store.StoreLogsContext(cctx, []*raft.Log{testRaftLog(11, "log")})
+	if err != context.Canceled {
+		t.Fatalf("err: %v", err)
+	}
+	if err := store.DeleteRangeContext(cctx, 1, 5); err != context.Canceled {
+		t.Fatalf("err: %v", err)
+	}
+	if idx, _ := store.LastIndex(); idx != 10 {
+		t.Fatalf("bad: %d", idx)
+	}
+	if idx, _ := store.FirstIndex(); idx != 1 {
+		t.Fatalf("bad: %d", idx)
+	}
+
+	if err := store.DeleteRangeContext(ctx, 1, 5); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.FirstIndex(); idx != 6 {
+		t.Fatalf("bad: %d", idx)
+	}
+	checkCounter(t, store)
+}
+
+func TestBuntStore_DeleteRangeContextChunks(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 3*deleteChunkSize; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The deadline passes after the first chunk
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	arch := &cancelArchiver{cancel: cancel}
+	store.opts.Archiver = arch
+	err := store.DeleteRangeContext(ctx, 1, 2*deleteChunkSize+10)
+	if err != context.Canceled {
+		t.Fatalf("err: %v", err)
+	}
+	if arch.logs != deleteChunkSize {
+		t.Fatalf("bad: %d", arch.logs)
+	}
+	if idx, _ := store.FirstIndex(); idx != deleteChunkSize+1 {
+		t.Fatalf("bad: %d", idx)
+	}
+
+	err = store.DeleteRangeContext(context.Background(), 1, 2*deleteChunkSize+10)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.FirstIndex(); idx != 2*deleteChunkSize+11 {
+		t.Fatalf("bad: %d", idx)
+	}
+	if arch.logs != 2*deleteChunkSize+10 {
+		t.Fatalf("bad: %d", arch.logs)
+	}
+	checkCounter(t, store)
+}
+
+// cancelArchiver counts the logs it archives and cancels a context.
+type cancelArchiver struct {
+	logs   int
+	cancel func()
+}
+
+func (a *cancelArchiver) Archive(logs []*raft.Log) error {
+	a.logs += len(logs)
+	a.cancel()
+	return nil
+}
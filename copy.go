@@ -0,0 +1,159 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tidwall/raft"
+)
+
+// Store is implemented by raft stores that hold both the log and the
+// stable state, such as BuntStore.
+type Store interface {
+	raft.LogStore
+	raft.StableStore
+}
+
+// CopyOptions are used to configure CopyStore.
+type CopyOptions struct {
+	// Keys are the stable keys to copy when src cannot list its keys.
+	// Defaults to the keys used by raft.
+	Keys [][]byte
+
+	// Uint64Keys are the stable keys holding uint64 values, which are
+	// copied with GetUint64 and SetUint64 because stores encode them
+	// differently. Defaults to the uint64 keys used by raft.
+	Uint64Keys [][]byte
+
+	// BatchSize is the number of logs written per StoreLogs call.
+	// Defaults to 1024.
+	BatchSize int
+}
+
+// CopyResult describes a completed copy.
+type CopyResult struct {
+	Logs       uint64
+	StableKeys uint64
+	FirstIndex uint64
+	LastIndex  uint64
+}
+
+// CopyStore copies all logs and stable keys from src to dst, which should
+// be empty. When src has a StableKeys method, like BuntStore, all of its
+// stable keys are copied; otherwise only opts.Keys. After copying, dst is
+// checked to have the same first and last index as src.
+func CopyStore(dst, src Store, opts *CopyOptions) (*CopyResult, error) {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1024
+	}
+	res := new(CopyResult)
+	first, err := src.FirstIndex()
+	if err != nil {
+		return nil, err
+	}
+	last, err := src.LastIndex()
+	if err != nil {
+		return nil, err
+	}
+	var batch []*raft.Log
+	for idx := first; idx != 0 && idx <= last; idx++ {
+		log := new(raft.Log)
+		if err := src.GetLog(idx, log); err != nil {
+			if err == raft.ErrLogNotFound {
+				continue
+			}
+			return nil, err
+		}
+		if res.Logs == 0 {
+			res.FirstIndex = idx
+		}
+		res.LastIndex = idx
+		res.Logs++
+		batch = append(batch, log)
+		if len(batch) == batchSize {
+			if err := dst.StoreLogs(batch); err != nil {
+				return nil, err
+			}
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		if err := dst.StoreLogs(batch); err != nil {
+			return nil, err
+		}
+	}
+
+	uint64Keys := opts.Uint64Keys
+	if uint64Keys == nil {
+		for _, key := range stableUint64Keys {
+			uint64Keys = append(uint64Keys, []byte(key))
+		}
+	}
+	keys := opts.Keys
+	listed := false
+	if lister, ok := src.(interface{ StableKeys() ([][]byte, error) }); ok {
+		if keys, err = lister.StableKeys(); err != nil {
+			return nil, err
+		}
+		listed = true
+	} else if keys == nil {
+		keys = append(append(keys, uint64Keys...), stableByteKeys...)
+	}
+	for _, key := range keys {
+		if containsKey(uint64Keys, key) {
+			var val uint64
+			if val, err = src.GetUint64(key); err == nil {
+				err = dst.SetUint64(key, val)
+			}
+		} else {
+			var val []byte
+			if val, err = src.Get(key); err == nil {
+				err = dst.Set(key, val)
+			}
+		}
+		if err != nil {
+			if !listed && isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("stable key %q: %w", key, err)
+		}
+		res.StableKeys++
+	}
+
+	// Check the copy
+	dfirst, err := dst.FirstIndex()
+	if err != nil {
+		return nil, err
+	}
+	dlast, err := dst.LastIndex()
+	if err != nil {
+		return nil, err
+	}
+	if dfirst != res.FirstIndex || dlast != res.LastIndex {
+		return nil, fmt.Errorf("copied logs %d-%d but destination has %d-%d",
+			res.FirstIndex, res.LastIndex, dfirst, dlast)
+	}
+	return res, nil
+}
+
+// stableByteKeys are the stable keys that raft reads with Get.
+var stableByteKeys = [][]byte{[]byte("LastVoteCand"), []byte("peers")}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if string(k) == string(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound reports whether err is a missing key error. Other raft
+// stores, like raft-boltdb, define their own "not found" errors.
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrKeyNotFound) || err.Error() == "not found"
+}
@@ -0,0 +1,73 @@
+package raftbuntdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+// keysOnly hides the StableKeys method of a store.
+type keysOnly struct {
+	Store
+}
+
+func TestCopyStore(t *testing.T) {
+	src := testBuntStore(t)
+	defer src.Close()
+	defer os.Remove(src.path)
+
+	var logs []*raft.Log
+	for i := uint64(5); i <= 12; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := src.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	src.SetUint64([]byte("CurrentTerm"), 4)
+	src.Set([]byte("LastVoteCand"), []byte("node1"))
+	src.Set([]byte("custom"), []byte("value"))
+
+	dst := testBuntStore(t)
+	defer dst.Close()
+	defer os.Remove(dst.path)
+	res, err := CopyStore(dst, src, &CopyOptions{BatchSize: 3})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.Logs != 8 || res.FirstIndex != 5 || res.LastIndex != 12 ||
+		res.StableKeys != 3 {
+		t.Fatalf("bad: %#v", res)
+	}
+	for _, log := range logs {
+		result := new(raft.Log)
+		if err := dst.GetLog(log.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(log, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+	if val, _ := dst.Get([]byte("custom")); string(val) != "value" {
+		t.Fatalf("bad: %q", val)
+	}
+
+	// Without a key listing only the raft keys are copied
+	dst2 := testBuntStore(t)
+	defer dst2.Close()
+	defer os.Remove(dst2.path)
+	res, err = CopyStore(dst2, keysOnly{src}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.StableKeys != 2 {
+		t.Fatalf("bad: %#v", res)
+	}
+	if term, _ := dst2.GetUint64([]byte("CurrentTerm")); term != 4 {
+		t.Fatalf("bad: %d", term)
+	}
+	if _, err := dst2.Get([]byte("custom")); err != ErrKeyNotFound {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package raftbuntdb
+
+import (
+	"sync"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// logCounter tracks the number of logs and their encoded size, so that
+// LogCount and LogBytes don't scan the log. It also tracks the size the
+// logs take in the database file, which leaves out the data of blobs.
+type logCounter struct {
+	mu    sync.Mutex
+	count uint64
+	bytes uint64
+	file  uint64
+}
+
+// logDelta is the change to the counter made by a transaction. It is only
+// applied once the transaction commits. It also holds the blobs put by the
+// transaction, deleted if it fails, and those it no longer points to,
+// deleted once it commits, and the range of indexes it wrote.
+type logDelta struct {
+	count int64
+	bytes int64
+	file  int64
+	puts  []string
+	drops []string
+
+	touched bool
+	lo, hi  uint64
+
+	// stored are the logs stored, kept by the log cache once the
+	// transaction commits.
+	stored []*raft.Log
+}
+
+// set records the log value written to key over prev, if replaced.
+func (d *logDelta) set(key, prev string, replaced bool, val string) {
+	if replaced {
+		d.del(key, prev)
+	}
+	d.count++
+	d.bytes += storedSize(val)
+	d.file += fileSize(val)
+	d.touch(key)
+}
+
+// del records the removal of the log value of key.
+func (d *logDelta) del(key, prev string) {
+	d.count--
+	d.bytes -= storedSize(prev)
+	d.file -= fileSize(prev)
+	d.touch(key)
+}
+
+// touch adds the index of the log key to the range written. It's taken
+// from the key rather than the value, which may be corrupt.
+func (d *logDelta) touch(key string) {
+	idx := logIndex(key)
+	if !d.touched || idx < d.lo {
+		d.lo = idx
+	}
+	if !d.touched || idx > d.hi {
+		d.hi = idx
+	}
+	d.touched = true
+}
+
+// dropBlob records that the blob of the log value prev, if it has one, is
+// no longer pointed to.
+func (d *logDelta) dropBlob(prev string) {
+	if !isBlob(prev) {
+		return
+	}
+	if name, _, _, err := blobPointer(prev); err == nil {
+		d.drops = append(d.drops, name)
+	}
+}
+
+func (c *logCounter) apply(d logDelta) {
+	c.mu.Lock()
+	c.count = uint64(int64(c.count) + d.count)
+	c.bytes = uint64(int64(c.bytes) + d.bytes)
+	c.file = uint64(int64(c.file) + d.file)
+	c.mu.Unlock()
+}
+
+func (c *logCounter) reset(count, bytes, file uint64) {
+	c.mu.Lock()
+	c.count, c.bytes, c.file = count, bytes, file
+	c.mu.Unlock()
+}
+
+func (c *logCounter) get() (count, bytes uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count, c.bytes
+}
+
+// inFile returns the number of logs and the bytes they take in the
+// database file.
+func (c *logCounter) inFile() (count, file uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count, c.file
+}
+
+// updateLogs runs fn in a writable transaction and applies the changes it
+// records to the log counter. Every write to log keys goes through it. The
+// changes are applied before the commit, while readers are still locked
+// out, and reverted if the commit fails. Subscriptions are woken after a
+// successful commit.
+//
+// Blobs are written before the commit and deleted after it, so a crash in
+// between leaves an unreferenced blob behind, but never a log without its
+// blob.
+func (b *BuntStore) updateLogs(fn func(tx *buntdb.Tx, d *logDelta) error) error {
+	err := b.recovering(func() (bool, error) {
+		var d logDelta
+		var applied bool
+		var gen uint64
+		commit, err := b.commit(func(tx *buntdb.Tx) error {
+			if err := fn(tx, &d); err != nil {
+				return err
+			}
+			b.counter.apply(d)
+			if d.touched {
+				b.ahead.invalidate(d.lo, d.hi)
+				gen = b.cache.invalidate(d.lo, d.hi)
+			}
+			applied = true
+			return nil
+		})
+		if err != nil && applied {
+			b.counter.apply(logDelta{count: -d.count, bytes: -d.bytes, file: -d.file})
+		}
+		if err != nil {
+			b.deleteBlobs(d.puts)
+		} else {
+			b.deleteBlobs(d.drops)
+			if d.touched {
+				b.scrub.release(d.lo, d.hi)
+				b.cache.put(gen, d.stored)
+			}
+		}
+		return commit, err
+	})
+	if err == nil {
+		b.notifier.notify()
+	}
+	return err
+}
+
+// recount sets the log counter from a scan of the log.
+func (b *BuntStore) recount() error {
+	return b.view(b.resetCounter)
+}
+
+// resetCounter sets the log counter from a scan of the log in tx.
+func (b *BuntStore) resetCounter(tx *buntdb.Tx) error {
+	var count, bytes, file uint64
+	err := b.keys.ascendLogs(tx, 0, func(key, val string) bool {
+		count++
+		bytes += uint64(storedSize(val))
+		file += uint64(fileSize(val))
+		return true
+	})
+	if err == nil {
+		b.counter.reset(count, bytes, file)
+	}
+	return err
+}
+
+// LogCount returns the number of logs in the store.
+func (b *BuntStore) LogCount() (uint64, error) {
+	var count uint64
+	err := b.view(func(tx *buntdb.Tx) error {
+		count, _ = b.counter.get()
+		return nil
+	})
+	return count, err
+}
+
+// LogBytes returns the encoded size of the logs between min and max
+// inclusively. A range that covers the whole log is answered from the
+// counter; a smaller range scans only the logs within it.
+func (b *BuntStore) LogBytes(min, max uint64) (uint64, error) {
+	var bytes uint64
+	err := b.view(func(tx *buntdb.Tx) error {
+		first, err := b.keys.firstIndex(tx)
+		if err != nil {
+			return err
+		}
+		last, err := b.keys.lastIndex(tx)
+		if err != nil {
+			return err
+		}
+		if min <= first && max >= last {
+			_, bytes = b.counter.get()
+			return nil
+		}
+		return b.keys.ascendLogs(tx, min,
+			func(key, val string) bool {
+				idx := logIndex(key)
+				if idx > max {
+					return false
+				}
+				if idx >= min {
+					bytes += uint64(storedSize(val))
+				}
+				return true
+			})
+	})
+	return bytes, err
+}
@@ -0,0 +1,111 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+// checkCounter compares the log counter with a scan of the store.
+func checkCounter(t *testing.T, store *BuntStore) {
+	t.Helper()
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	count, err := store.LogCount()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	size, err := store.LogBytes(0, 1<<64-1)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if count != stats.Logs || size != uint64(stats.LogBytes) {
+		t.Fatalf("bad: count=%d bytes=%d, scan found %d and %d",
+			count, size, stats.Logs, stats.LogBytes)
+	}
+}
+
+func TestBuntStore_LogCount(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkCounter(t, store)
+	if count, _ := store.LogCount(); count != 10 {
+		t.Fatalf("bad: %d", count)
+	}
+
+	// Overwrites replace the size of the old value
+	store.StoreLog(testRaftLog(10, "a longer log"))
+	checkCounter(t, store)
+
+	// Partial ranges scan only what they cover
+	size, err := store.LogBytes(2, 3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if size != 2*(17+3) {
+		t.Fatalf("bad: %d", size)
+	}
+
+	var backup bytes.Buffer
+	if err := store.Backup(&backup); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.DeleteRange(1, 3)
+	checkCounter(t, store)
+	store.CompactTo(5)
+	checkCounter(t, store)
+	var delta bytes.Buffer
+	store.BackupSince(0, &delta)
+	store.DeleteRange(6, 10)
+	if err := store.ApplyIncremental(&delta); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkCounter(t, store)
+	if err := store.RestoreFrom(&backup); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkCounter(t, store)
+
+	if count, _ := store.LogCount(); count != 10 {
+		t.Fatalf("bad: %d", count)
+	}
+
+	// Counted again when reopened
+	store.Close()
+	store, err = NewBuntStore(store.path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	checkCounter(t, store)
+	if count, _ := store.LogCount(); count != 10 {
+		t.Fatalf("bad: %d", count)
+	}
+}
+
+func TestBuntStore_LogCountFailedWrite(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{StrictAppend: true})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	store.StoreLog(testRaftLog(1, "log"))
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(2, "log"), testRaftLog(4, "log")}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	checkCounter(t, store)
+	if count, _ := store.LogCount(); count != 1 {
+		t.Fatalf("bad: %d", count)
+	}
+}
@@ -0,0 +1,206 @@
+package raftbuntdb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+const (
+	// debugDefaultLogs is the number of logs returned by the debug
+	// handler when the request doesn't say.
+	debugDefaultLogs = 20
+
+	// debugMaxLogs bounds the logs returned by one request.
+	debugMaxLogs = 1000
+)
+
+// DebugHandler returns a handler for inspecting a live store, which
+// answers GET requests with JSON:
+//
+//	/stats    the Stats
+//	/health   the Health
+//	/metrics  the Metrics
+//	/index    the first and last index
+//	/logs     the headers of the last logs, newest first; n sets how many
+//	/dump     the logs from min with their data; n sets how many
+//
+// At most 1000 logs are returned. The paths are relative, so the handler
+// is mounted with http.StripPrefix, such as:
+//
+//	mux.Handle("/debug/raft/", http.StripPrefix("/debug/raft", store.DebugHandler()))
+func (b *BuntStore) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", b.debugStats)
+	mux.HandleFunc("/health", b.debugHealth)
+	mux.HandleFunc("/metrics", b.debugMetrics)
+	mux.HandleFunc("/index", b.debugIndex)
+	mux.HandleFunc("/logs", b.debugLogs)
+	mux.HandleFunc("/dump", b.debugDump)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			debugError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func debugJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func debugError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// debugFail reports an error from the store.
+func debugFail(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, ErrClosed) {
+		code = http.StatusServiceUnavailable
+	}
+	debugError(w, code, err.Error())
+}
+
+func (b *BuntStore) debugStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := b.Stats()
+	if err != nil {
+		debugFail(w, err)
+		return
+	}
+	debugJSON(w, stats)
+}
+
+func (b *BuntStore) debugHealth(w http.ResponseWriter, r *http.Request) {
+	h := b.Health()
+	out := struct {
+		OK            bool
+		Closed        bool
+		Failed        bool
+		Degraded      bool
+		Stalled       bool
+		Backlog       int64
+		LastError     string    `json:",omitempty"`
+		LastErrorTime time.Time `json:",omitempty"`
+		LastSync      time.Time `json:",omitempty"`
+	}{
+		OK:            h.OK(),
+		Closed:        h.Closed,
+		Failed:        h.Failed,
+		Degraded:      h.Degraded,
+		Stalled:       h.Stalled,
+		Backlog:       h.Backlog,
+		LastErrorTime: h.LastErrorTime,
+		LastSync:      h.LastSync,
+	}
+	if h.LastError != nil {
+		out.LastError = h.LastError.Error()
+	}
+	debugJSON(w, out)
+}
+
+func (b *BuntStore) debugMetrics(w http.ResponseWriter, r *http.Request) {
+	debugJSON(w, b.Metrics())
+}
+
+func (b *BuntStore) debugIndex(w http.ResponseWriter, r *http.Request) {
+	var out struct{ FirstIndex, LastIndex uint64 }
+	var first, last raft.Log
+	err := b.GetFirstLog(&first)
+	if err == nil {
+		err = b.GetLastLog(&last)
+	}
+	if err != nil && err != raft.ErrLogNotFound {
+		debugFail(w, err)
+		return
+	}
+	out.FirstIndex, out.LastIndex = first.Index, last.Index
+	debugJSON(w, out)
+}
+
+// debugLog is the JSON form of a log. Data is left out of a header.
+type debugLog struct {
+	Index uint64
+	Term  uint64
+	Type  raft.LogType
+	Size  int
+	Data  []byte `json:",omitempty"`
+}
+
+// debugCount parses the n parameter.
+func debugCount(w http.ResponseWriter, r *http.Request) (int, bool) {
+	n := debugDefaultLogs
+	if s := r.FormValue("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			debugError(w, http.StatusBadRequest, "invalid n")
+			return 0, false
+		}
+		n = v
+	}
+	if n > debugMaxLogs {
+		n = debugMaxLogs
+	}
+	return n, true
+}
+
+func (b *BuntStore) debugLogs(w http.ResponseWriter, r *http.Request) {
+	n, ok := debugCount(w, r)
+	if !ok {
+		return
+	}
+	logs := []debugLog{}
+	err := b.DescendLogLessOrEqual(1<<64-1, func(log *raft.Log) bool {
+		if len(logs) == n {
+			return false
+		}
+		logs = append(logs, debugLog{Index: log.Index, Term: log.Term,
+			Type: log.Type, Size: len(log.Data)})
+		return true
+	})
+	if err != nil {
+		debugFail(w, err)
+		return
+	}
+	debugJSON(w, logs)
+}
+
+func (b *BuntStore) debugDump(w http.ResponseWriter, r *http.Request) {
+	n, ok := debugCount(w, r)
+	if !ok {
+		return
+	}
+	var min uint64
+	if s := r.FormValue("min"); s != "" {
+		var err error
+		if min, err = strconv.ParseUint(s, 10, 64); err != nil {
+			debugError(w, http.StatusBadRequest, "invalid min")
+			return
+		}
+	}
+	logs := []debugLog{}
+	err := b.AscendLogGreaterOrEqual(min, func(log *raft.Log) bool {
+		if len(logs) == n {
+			return false
+		}
+		logs = append(logs, debugLog{Index: log.Index, Term: log.Term,
+			Type: log.Type, Size: len(log.Data),
+			Data: append([]byte(nil), log.Data...)})
+		return true
+	})
+	if err != nil {
+		debugFail(w, err)
+		return
+	}
+	debugJSON(w, logs)
+}
@@ -0,0 +1,92 @@
+package raftbuntdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func debugGet(t *testing.T, h http.Handler, method, url string, v interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, url, nil))
+	if v != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("err: %s: %s", err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+func TestBuntStore_DebugHandler(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 30; i++ {
+		logs = append(logs, testRaftLog(i, "data"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/raft/", http.StripPrefix("/debug/raft", store.DebugHandler()))
+
+	var stats Stats
+	if code := debugGet(t, mux, "GET", "/debug/raft/stats", &stats); code != 200 || stats.Logs != 30 {
+		t.Fatalf("bad: %d %+v", code, stats)
+	}
+	var index struct{ FirstIndex, LastIndex uint64 }
+	if code := debugGet(t, mux, "GET", "/debug/raft/index", &index); code != 200 ||
+		index.FirstIndex != 1 || index.LastIndex != 30 {
+		t.Fatalf("bad: %d %+v", code, index)
+	}
+	var health struct{ OK bool }
+	if code := debugGet(t, mux, "GET", "/debug/raft/health", &health); code != 200 || !health.OK {
+		t.Fatalf("bad: %d %+v", code, health)
+	}
+	var metrics Metrics
+	if code := debugGet(t, mux, "GET", "/debug/raft/metrics", &metrics); code != 200 ||
+		metrics.StoreLogs.Calls != 1 {
+		t.Fatalf("bad: %d %+v", code, metrics)
+	}
+
+	// Recent headers, newest first
+	var headers []debugLog
+	if code := debugGet(t, mux, "GET", "/debug/raft/logs", &headers); code != 200 ||
+		len(headers) != debugDefaultLogs || headers[0].Index != 30 ||
+		headers[0].Size != 4 || headers[0].Data != nil {
+		t.Fatalf("bad: %d %+v", code, headers)
+	}
+
+	// A bounded dump
+	var dump []debugLog
+	if code := debugGet(t, mux, "GET", "/debug/raft/dump?min=28&n=2", &dump); code != 200 ||
+		len(dump) != 2 || dump[0].Index != 28 || string(dump[1].Data) != "data" {
+		t.Fatalf("bad: %d %+v", code, dump)
+	}
+	if code := debugGet(t, mux, "GET", "/debug/raft/dump?n=5000", &dump); code != 200 || len(dump) != 30 {
+		t.Fatalf("bad: %d %d", code, len(dump))
+	}
+
+	for _, tt := range []struct {
+		method, url string
+		code        int
+	}{
+		{"GET", "/debug/raft/logs?n=x", http.StatusBadRequest},
+		{"GET", "/debug/raft/dump?min=-1", http.StatusBadRequest},
+		{"POST", "/debug/raft/stats", http.StatusMethodNotAllowed},
+		{"GET", "/debug/raft/nope", http.StatusNotFound},
+	} {
+		if code := debugGet(t, mux, tt.method, tt.url, nil); code != tt.code {
+			t.Fatalf("%s %s: %d", tt.method, tt.url, code)
+		}
+	}
+
+	store.Close()
+	if code := debugGet(t, mux, "GET", "/debug/raft/stats", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("bad: %d", code)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package raftbuntdb
+
+// Directories can't be synced on this platform. On Windows, NTFS journals
+// metadata changes such as renames.
+func syncDir(dir string) error {
+	return nil
+}
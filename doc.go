@@ -0,0 +1,7 @@
+// Package raftbuntdb provides a raft log, stable and snapshot store backed
+// by BuntDB.
+//
+// The package has a single implementation, BuntStore, which targets the
+// interfaces of github.com/tidwall/raft. Helpers that only need those
+// interfaces, such as CopyStore and MirrorStore, accept any Store.
+package raftbuntdb
@@ -0,0 +1,192 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// errClosing is the type of ErrClosing, which matches ErrClosed.
+type errClosing struct{}
+
+func (errClosing) Error() string { return "store is closing" }
+
+func (errClosing) Is(target error) bool { return target == ErrClosed }
+
+var (
+	// ErrClosing is returned by the calls made while Close waits for those
+	// in flight. errors.Is matches it with ErrClosed.
+	ErrClosing error = errClosing{}
+
+	// ErrCloseTimeout is returned by Close when the calls in flight don't
+	// return within Options.CloseTimeout. The store is closed once they
+	// do.
+	ErrCloseTimeout = errors.New("timed out waiting for calls in flight")
+)
+
+// drainState counts the calls of the raft interfaces in flight, so that
+// Close can wait for them.
+type drainState struct {
+	mu      sync.Mutex
+	closing bool
+	closed  bool
+	active  int
+
+	// idle is closed once closing and no call is active, and stop as soon
+	// as closing starts, for the calls waiting their turn
+	idle chan struct{}
+	stop chan struct{}
+
+	// once starts the close, which closes done with err set
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// enter starts a call, or returns ErrClosing while the store is closing.
+// Once it's closed, calls enter to fail with ErrClosed. Each call that
+// enters must leave.
+func (s *drainState) enter() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing && !s.closed {
+		return ErrClosing
+	}
+	s.active++
+	return nil
+}
+
+func (s *drainState) leave() {
+	s.mu.Lock()
+	s.active--
+	if s.closing && !s.closed && s.active == 0 {
+		close(s.idle)
+	}
+	s.mu.Unlock()
+}
+
+// drain rejects the calls that enter from now on, and returns a channel
+// closed once the active ones have left.
+func (s *drainState) drain() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closing {
+		s.closing = true
+		s.idle = make(chan struct{})
+		if s.active == 0 {
+			close(s.idle)
+		}
+		if s.stop == nil {
+			s.stop = make(chan struct{})
+		}
+		close(s.stop)
+	}
+	return s.idle
+}
+
+// stopping returns a channel closed once the store starts closing. A call
+// that waits, such as for a RateLimit, gives up with ErrClosed rather than
+// hold up the close.
+func (s *drainState) stopping() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	return s.stop
+}
+
+// CloseOptions configure CloseWithOptions.
+type CloseOptions struct {
+	// FinalShrink shrinks the file once the calls in flight have
+	// returned, before it's closed, if the dead space is at least
+	// MinDeadRatio of the file, so that the next Open loads a compact
+	// file.
+	FinalShrink bool
+
+	// MinDeadRatio is the fraction of the file, as estimated by
+	// DeadBytesEstimate, that must be dead for the final shrink. Defaults
+	// to a half.
+	MinDeadRatio float64
+
+	// Timeout is how long to wait for the close, including the final
+	// shrink, before returning ErrCloseTimeout. Defaults to
+	// Options.CloseTimeout.
+	Timeout time.Duration
+}
+
+func (o *CloseOptions) minDeadRatio() float64 {
+	if o.MinDeadRatio <= 0 {
+		return 0.5
+	}
+	return o.MinDeadRatio
+}
+
+// Close closes the store. New calls fail with ErrClosing, while those in
+// flight on other goroutines, such as raft's during its shutdown, are
+// waited for. Then the background goroutines are stopped, the file is
+// synced and closed. With Options.CloseTimeout set, Close returns
+// ErrCloseTimeout if the calls in flight take longer, and the store is
+// closed once they return. It is safe to call Close more than once, and
+// from more than one goroutine; each call waits for the store to close
+// and returns the same error.
+func (b *BuntStore) Close() error {
+	return b.CloseWithOptions(CloseOptions{})
+}
+
+// CloseWithOptions is like Close, with a final shrink and a timeout of its
+// own. A failed shrink doesn't stop the close, but its error is returned.
+// If the store is already closing, opts only sets the timeout of the wait.
+func (b *BuntStore) CloseWithOptions(opts CloseOptions) error {
+	b.calls.once.Do(func() {
+		b.calls.done = make(chan struct{})
+		idle := b.calls.drain()
+		go func() {
+			<-idle
+			var err error
+			if opts.FinalShrink {
+				err = b.finalShrink(opts.minDeadRatio())
+			}
+			b.calls.err = firstErr(b.shutdown(), err)
+			b.calls.mu.Lock()
+			b.calls.closed = true
+			b.calls.mu.Unlock()
+			close(b.calls.done)
+		}()
+	})
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = b.opts.CloseTimeout
+	}
+	if timeout <= 0 {
+		<-b.calls.done
+		return b.calls.err
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-b.calls.done:
+		return b.calls.err
+	case <-t.C:
+		return ErrCloseTimeout
+	}
+}
+
+// finalShrink shrinks the file if at least ratio of it is dead. A shrink
+// already in progress is left to finish.
+func (b *BuntStore) finalShrink(ratio float64) error {
+	dead, err := b.DeadBytesEstimate()
+	if err != nil {
+		return err
+	}
+	size, err := b.FileSize()
+	if err != nil || size == 0 || float64(dead) < ratio*float64(size) {
+		return err
+	}
+	if err := b.Shrink(); err != nil && err != buntdb.ErrShrinkInProcess {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+// blockingStore returns a store whose OnStoreLogs hook signals started and
+// waits for release, to hold a StoreLogs call in flight.
+func blockingStore(t *testing.T, timeout time.Duration) (*BuntStore, chan struct{}, chan struct{}) {
+	started, release := make(chan struct{}), make(chan struct{})
+	store := testBuntStoreOpts(t, &Options{
+		CloseTimeout: timeout,
+		Hooks: &Hooks{OnStoreLogs: func(logs []*raft.Log) {
+			close(started)
+			<-release
+		}},
+	})
+	return store, started, release
+}
+
+func TestBuntStore_CloseDrain(t *testing.T) {
+	store, started, release := blockingStore(t, 0)
+	defer os.Remove(store.path)
+	stored := make(chan error, 1)
+	go func() { stored <- store.StoreLog(testRaftLog(1, "data")) }()
+	<-started
+
+	// Close waits for the call in flight, and rejects new ones
+	closed := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { closed <- store.Close() }()
+	}
+	var err error
+	for err == nil {
+		_, err = store.LastIndex()
+	}
+	if err != ErrClosing || !errors.Is(err, ErrClosed) {
+		t.Fatalf("bad: %v", err)
+	}
+	select {
+	case err := <-closed:
+		t.Fatalf("closed early: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-stored; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-closed; err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Once closed, calls fail as before
+	if _, err := store.LastIndex(); err != ErrClosed {
+		t.Fatalf("bad: %v", err)
+	}
+	store, err = Open(store.path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if idx, _ := store.LastIndex(); idx != 1 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_CloseTimeout(t *testing.T) {
+	store, started, release := blockingStore(t, 20*time.Millisecond)
+	defer os.Remove(store.path)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		store.StoreLog(testRaftLog(1, "data"))
+	}()
+	<-started
+	if err := store.Close(); err != ErrCloseTimeout {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// The store closes once the call returns
+	close(release)
+	wg.Wait()
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err := Open(store.path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+}
+
+func TestBuntStore_CloseWithOptions(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+	for i := uint64(1); i <= 100; i++ {
+		if err := store.StoreLog(testRaftLog(i, "data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Without enough dead space the file is left as is
+	if err := store.DeleteRange(1, 10); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	before, _ := store.FileSize()
+	if err := store.CloseWithOptions(CloseOptions{FinalShrink: true}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fi, err := os.Stat(store.path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Size() != before {
+		t.Fatalf("bad: %d, was %d", fi.Size(), before)
+	}
+
+	// Once most of it is dead, the file is shrunk before it's closed
+	store, err = Open(store.path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(11, 90); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	before, _ = store.FileSize()
+	if err := store.CloseWithOptions(CloseOptions{FinalShrink: true}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi, err = os.Stat(store.path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Size() >= before/2 {
+		t.Fatalf("bad: %d, was %d", fi.Size(), before)
+	}
+	store, err = Open(store.path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	first, _ := store.FirstIndex()
+	last, _ := store.LastIndex()
+	if first != 91 || last != 100 {
+		t.Fatalf("bad: %d %d", first, last)
+	}
+}
@@ -0,0 +1,178 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tidwall/buntdb"
+)
+
+var (
+	// An error indicating a given key does not exist
+	ErrKeyNotFound = errors.New("not found")
+
+	// ErrClosed is returned when the store is used after it was closed.
+	ErrClosed = errors.New("store closed")
+
+	// ErrReadOnly is returned when a write is attempted on a store that
+	// does not accept writes.
+	ErrReadOnly = errors.New("store is read-only")
+
+	// ErrUnsupportedVersion is returned when a database was written by a
+	// newer version of this package.
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+
+	// ErrCantBootstrap is returned by BootstrapCluster when the store
+	// already holds state.
+	ErrCantBootstrap = errors.New("bootstrap only works on new clusters")
+
+	// ErrIncompatibleRaft is returned when a database was written for a
+	// different raft library, whose logs this package can't decode.
+	ErrIncompatibleRaft = errors.New("database written for another raft library")
+
+	// ErrKeyStyle is returned by Open when the log keys of a database
+	// hold unpadded decimal indexes, as written by builds of this package
+	// for other raft libraries, which sort out of index order here.
+	// Migrate rewrites them.
+	ErrKeyStyle = errors.New("log keys in another style")
+
+	// ErrInvalidIndex is returned by Open when an index in Options.Indexes
+	// can't be created.
+	ErrInvalidIndex = errors.New("invalid index")
+
+	// errBadLogKey is the cause of an ErrCorruptValue when a log key is
+	// neither length of the key encodings.
+	errBadLogKey = errors.New("bad log key length")
+
+	// errInvalidBuffer is the cause of an ErrCorruptEntry when an encoded
+	// log is too short to hold its header.
+	errInvalidBuffer = errors.New("invalid buffer")
+
+	// errUnknownType is the cause of an ErrCorruptEntry when the type of
+	// an encoded log isn't one of the raft.LogType values.
+	errUnknownType = errors.New("unknown log type")
+)
+
+// ErrCorruptEntry is returned when a stored log entry cannot be decoded.
+// It wraps the underlying decode error.
+type ErrCorruptEntry struct {
+	Index uint64
+	Err   error
+
+	// Length is the length of the encoded log, if it was read, and Stored
+	// the index in its header, which differs from Index when the value of
+	// another log was written over it.
+	Length int
+	Stored uint64
+}
+
+// corruptEntry returns the ErrCorruptEntry of the log at idx, whose
+// encoded value val failed to decode with err.
+func corruptEntry(idx uint64, val string, err error) *ErrCorruptEntry {
+	e := &ErrCorruptEntry{Index: idx, Err: err, Length: len(val)}
+	if len(val) >= 8 {
+		e.Stored = leUint64(val)
+	}
+	return e
+}
+
+func (e *ErrCorruptEntry) Error() string {
+	switch {
+	case e.Err == errIndexMismatch:
+		return fmt.Sprintf("corrupt log entry at index %d (%d bytes): %v: "+
+			"holds index %d", e.Index, e.Length, e.Err, e.Stored)
+	case e.Length > 0:
+		return fmt.Sprintf("corrupt log entry at index %d (%d bytes): %v",
+			e.Index, e.Length, e.Err)
+	}
+	return fmt.Sprintf("corrupt log entry at index %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying cause.
+func (e *ErrCorruptEntry) Unwrap() error {
+	return e.Err
+}
+
+// ErrCorruptValue is returned when a stored value or key that should hold a
+// number doesn't parse, such as a term or a vote corrupted on disk, rather
+// than reading it as zero. It wraps the parse error.
+type ErrCorruptValue struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *ErrCorruptValue) Error() string {
+	return fmt.Sprintf("corrupt value %q of key %q: %v", e.Value, e.Key, e.Err)
+}
+
+// Unwrap returns the underlying cause.
+func (e *ErrCorruptValue) Unwrap() error {
+	return e.Err
+}
+
+// ErrNonContiguous is returned by StoreLogs when StrictAppend is enabled
+// and a batch would leave a hole in the log.
+type ErrNonContiguous struct {
+	Index    uint64
+	Expected uint64
+}
+
+func (e *ErrNonContiguous) Error() string {
+	return fmt.Sprintf("non-contiguous log index %d, expected %d",
+		e.Index, e.Expected)
+}
+
+// ErrLoadMemory is returned by Open when loading the database would take
+// more memory than Options.MaxLoadMemory.
+type ErrLoadMemory struct {
+	Estimate int64
+	Limit    int64
+}
+
+func (e *ErrLoadMemory) Error() string {
+	return fmt.Sprintf("loading the database would take about %d bytes of "+
+		"memory, over the limit of %d; compact the log and shrink the file",
+		e.Estimate, e.Limit)
+}
+
+// wrapErr converts buntdb errors into the package errors, keeping the
+// original error in the chain.
+func wrapErr(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case buntdb.ErrDatabaseClosed:
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+	case buntdb.ErrTxNotWritable:
+		return fmt.Errorf("%w: %w", ErrReadOnly, err)
+	}
+	return err
+}
+
+// ErrTraceDiverged is returned by ReplayTrace when a call fails and it
+// succeeded in the trace, or the other way around.
+type ErrTraceDiverged struct {
+	// Record is the number of the record in the trace, from one.
+	Record int
+	Op     string
+
+	// Traced is the error of the call in the trace, or empty, and Err
+	// that of the replay.
+	Traced string
+	Err    error
+}
+
+func (e *ErrTraceDiverged) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("trace record %d: %s succeeded, but failed in the trace: %s",
+			e.Record, e.Op, e.Traced)
+	}
+	return fmt.Sprintf("trace record %d: %s failed, but succeeded in the trace: %v",
+		e.Record, e.Op, e.Err)
+}
+
+// Unwrap returns the error of the replay.
+func (e *ErrTraceDiverged) Unwrap() error {
+	return e.Err
+}
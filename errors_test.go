@@ -0,0 +1,91 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_ErrCorruptEntry(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// Write a value that is too short to be a log entry
+	err := store.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(store.logKey(5), "bad", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = store.GetLog(5, new(raft.Log))
+	var cerr *ErrCorruptEntry
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected corrupt entry error, got: %v", err)
+	}
+	if cerr.Index != 5 {
+		t.Fatalf("bad: %d", cerr.Index)
+	}
+	if !errors.Is(err, errInvalidBuffer) {
+		t.Fatalf("expected cause to be wrapped, got: %v", err)
+	}
+}
+
+func TestBuntStore_ErrCorruptEntry_Decode(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+	for i := uint64(1); i <= 7; i++ {
+		if err := store.StoreLog(testRaftLog(i, "data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The value of log 7 under the key of log 5, and a log of an unknown
+	// type under the key of log 6
+	moved, _ := encodeLog(testRaftLog(7, "data"))
+	unknown, _ := encodeLog(&raft.Log{Index: 6, Type: raft.LogBarrier + 1})
+	err := store.db.Update(func(tx *buntdb.Tx) error {
+		if _, _, err := tx.Set(store.logKey(5), string(moved), nil); err != nil {
+			return err
+		}
+		_, _, err := tx.Set(store.logKey(6), string(unknown), nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = store.GetLog(5, new(raft.Log))
+	var cerr *ErrCorruptEntry
+	if !errors.As(err, &cerr) || cerr.Err != errIndexMismatch ||
+		cerr.Index != 5 || cerr.Stored != 7 || cerr.Length != len(moved) {
+		t.Fatalf("bad: %v", err)
+	}
+	if msg := "corrupt log entry at index 5 (21 bytes): index does not " +
+		"match key: holds index 7"; err.Error() != msg {
+		t.Fatalf("bad: %s", err)
+	}
+	if err := store.GetLog(6, new(raft.Log)); !errors.Is(err, errUnknownType) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestWrapErr(t *testing.T) {
+	err := wrapErr(buntdb.ErrDatabaseClosed)
+	if !errors.Is(err, ErrClosed) || !errors.Is(err, buntdb.ErrDatabaseClosed) {
+		t.Fatalf("bad: %v", err)
+	}
+	err = wrapErr(buntdb.ErrTxNotWritable)
+	if !errors.Is(err, ErrReadOnly) || !errors.Is(err, buntdb.ErrTxNotWritable) {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := wrapErr(buntdb.ErrNotFound); err != buntdb.ErrNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package raftbuntdb
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// dbFileMode is the mode a new database file is created with when
+// Options.FileMode is not set.
+const dbFileMode os.FileMode = 0600
+
+// createFile creates an empty database file at path with mode if it
+// doesn't exist, syncing the file and its directory so that the file
+// survives a power loss once Open returns.
+func createFile(path string, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, mode)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// OpenFile is subject to the umask
+	err = os.Chmod(path, mode)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// renameFile renames oldpath to newpath and syncs the directory, so the
+// rename is durable when it returns.
+func renameFile(oldpath, newpath string) error {
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(newpath))
+}
+
+// createDir creates dir and any missing parents with mode. The parent of
+// every directory created is synced.
+func createDir(dir string, mode os.FileMode) error {
+	if fi, err := os.Stat(dir); err == nil {
+		if !fi.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := createDir(parent, mode); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, mode); err != nil && !os.IsExist(err) {
+		return err
+	}
+	// Mkdir is subject to the umask
+	if err := os.Chmod(dir, mode); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(dir))
+}
@@ -0,0 +1,108 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func checkMode(t *testing.T, path string, mode os.FileMode) {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != mode {
+		t.Fatalf("bad: %v", fi.Mode())
+	}
+}
+
+func TestBuntStore_FileMode(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+	checkMode(t, store.path, dbFileMode)
+	store.Close()
+
+	store = testBuntStoreOpts(t, &Options{FileMode: 0640})
+	defer store.Close()
+	defer os.Remove(store.path)
+	checkMode(t, store.path, 0640)
+
+	// Shrinking and restoring replace the file but keep the mode
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Shrink(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkMode(t, store.path, 0640)
+	var buf bytes.Buffer
+	if err := store.Backup(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.RestoreFrom(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkMode(t, store.path, 0640)
+	if idx, _ := store.LastIndex(); idx != 1 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/raft.db"
+	if err := createFile(path, 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// An existing file is left alone
+	if err := createFile(path, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkMode(t, path, 0600)
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Fatalf("bad: %q", data)
+	}
+	if err := renameFile(path, dir+"/other.db"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(dir + "/other.db"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestBuntStore_DirMode(t *testing.T) {
+	base := t.TempDir()
+	path := base + "/a/b/raft.db"
+	if _, err := Open(path, &Options{}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	store, err := Open(path, &Options{DirMode: 0750, FileMode: 0640})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	checkMode(t, base+"/a", 0750)
+	checkMode(t, base+"/a/b", 0750)
+	checkMode(t, path, 0640)
+
+	// The mode of existing directories is left alone
+	if err := os.Chmod(base+"/a/b", 0700); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+	store, err = Open(path, &Options{DirMode: 0750})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+	checkMode(t, base+"/a/b", 0700)
+
+	if err := createDir(path, 0750); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -0,0 +1,41 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package raftbuntdb
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+func TestBuntStore_ModeUmask(t *testing.T) {
+	defer syscall.Umask(syscall.Umask(077))
+
+	base := t.TempDir()
+	path := base + "/a/raft.db"
+	if err := createFile(base+"/file.db", 0640); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkMode(t, base+"/file.db", 0640)
+
+	store, err := Open(path, &Options{DirMode: 0750, FileMode: 0640})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	checkMode(t, base+"/a", 0750)
+	checkMode(t, path, 0640)
+
+	// A restore keeps the mode of the file it replaces
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := store.Backup(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.RestoreFrom(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkMode(t, path, 0640)
+}
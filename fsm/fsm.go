@@ -0,0 +1,241 @@
+// Package fsm provides BuntFSM, a raft.FSM that keeps its state in the
+// same BuntDB file as the raft log, under the raftbuntdb.FSMPrefix key
+// prefix. Each log is applied in the same transaction that records it as
+// applied, so the state is never ahead of or behind the applied index.
+package fsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+// ErrNotFound is returned by Tx.Get for a missing key.
+var ErrNotFound = buntdb.ErrNotFound
+
+// errInvalidSnapshot is returned by Restore for data that isn't a
+// snapshot written by Persist.
+var errInvalidSnapshot = errors.New("invalid fsm snapshot")
+
+// snapshotMagic starts every snapshot.
+const snapshotMagic = "bfsm1"
+
+// ApplyFunc applies a committed log to the state in tx and returns the
+// response for raft. If it returns an error, the changes made to tx are
+// discarded, the log still counts as applied, and the error is the
+// response.
+type ApplyFunc func(tx *Tx, log *raft.Log) (interface{}, error)
+
+// BuntFSM is a raft.FSM that keeps its state in a BuntStore.
+type BuntFSM struct {
+	store *raftbuntdb.BuntStore
+	apply ApplyFunc
+}
+
+// New returns an FSM that keeps its state in store and applies logs with
+// apply.
+func New(store *raftbuntdb.BuntStore, apply ApplyFunc) *BuntFSM {
+	return &BuntFSM{store: store, apply: apply}
+}
+
+// Tx is a transaction on the state of a BuntFSM. Keys are relative to the
+// FSM's prefix.
+type Tx struct {
+	tx *buntdb.Tx
+}
+
+// Get returns the value of key, or ErrNotFound.
+func (t *Tx) Get(key string) (string, error) {
+	return t.tx.Get(raftbuntdb.FSMPrefix + key)
+}
+
+// Set sets the value of key.
+func (t *Tx) Set(key, val string) error {
+	_, _, err := t.tx.Set(raftbuntdb.FSMPrefix+key, val, nil)
+	return err
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (t *Tx) Delete(key string) error {
+	_, err := t.tx.Delete(raftbuntdb.FSMPrefix + key)
+	if err == buntdb.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Ascend calls iter with each key from pivot in order, until iter returns
+// false.
+func (t *Tx) Ascend(pivot string, iter func(key, val string) bool) error {
+	return ascend(t.tx, pivot, iter)
+}
+
+func ascend(tx *buntdb.Tx, pivot string, iter func(key, val string) bool) error {
+	return tx.AscendGreaterOrEqual("", raftbuntdb.FSMPrefix+pivot,
+		func(key, val string) bool {
+			if !strings.HasPrefix(key, raftbuntdb.FSMPrefix) {
+				return false
+			}
+			return iter(key[len(raftbuntdb.FSMPrefix):], val)
+		})
+}
+
+// View runs fn in a read-only transaction on the state.
+func (f *BuntFSM) View(fn func(tx *Tx) error) error {
+	return f.store.View(func(tx *buntdb.Tx) error {
+		return fn(&Tx{tx})
+	})
+}
+
+// Apply applies a log to the state, implementing raft.FSM. Logs at or
+// before the applied index are already part of the state and are skipped,
+// such as when raft replays the log after a restart.
+func (f *BuntFSM) Apply(log *raft.Log) interface{} {
+	applied, err := f.store.AppliedIndex()
+	if err != nil {
+		return err
+	}
+	if log.Index <= applied {
+		return nil
+	}
+	var resp interface{}
+	var aerr error
+	err = f.store.ApplyAndStore(log.Index, func(tx *buntdb.Tx) error {
+		resp, aerr = f.apply(&Tx{tx}, log)
+		return aerr
+	})
+	if aerr != nil {
+		if err := f.store.SetAppliedIndex(log.Index); err != nil {
+			return err
+		}
+		return aerr
+	}
+	if err != nil {
+		return err
+	}
+	return resp
+}
+
+// Snapshot copies the state for a snapshot, implementing raft.FSM. raft
+// may apply logs while the snapshot is persisted, so the state is copied
+// into memory.
+func (f *BuntFSM) Snapshot() (raft.FSMSnapshot, error) {
+	snap := &fsmSnapshot{}
+	err := f.store.View(func(tx *buntdb.Tx) error {
+		return ascend(tx, "", func(key, val string) bool {
+			snap.kvs = append(snap.kvs, key, val)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if snap.applied, err = f.store.AppliedIndex(); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Restore replaces the state with a snapshot written by Persist,
+// implementing raft.FSM. The state and the applied index are replaced in
+// one transaction.
+func (f *BuntFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	r := bufio.NewReader(rc)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != snapshotMagic {
+		return errInvalidSnapshot
+	}
+	applied, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errInvalidSnapshot
+	}
+	return f.store.ApplyAndStore(applied, func(tx *buntdb.Tx) error {
+		var keys []string
+		err := ascend(tx, "", func(key, val string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		t := &Tx{tx}
+		for _, key := range keys {
+			if err := t.Delete(key); err != nil {
+				return err
+			}
+		}
+		for {
+			key, err := readString(r)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			val, err := readString(r)
+			if err != nil {
+				return errInvalidSnapshot
+			}
+			if err := t.Set(key, val); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// readString reads a length prefixed string. It returns io.EOF only at
+// the end of the data.
+func readString(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF {
+			return "", io.EOF
+		}
+		return "", errInvalidSnapshot
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", errInvalidSnapshot
+	}
+	return string(buf), nil
+}
+
+// fsmSnapshot is a copy of the state.
+type fsmSnapshot struct {
+	applied uint64
+	kvs     []string // alternating keys and values
+}
+
+// Persist writes the snapshot to sink.
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.write(sink); err != nil {
+		sink.Cancel()
+		return fmt.Errorf("persist fsm snapshot: %w", err)
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	var buf [binary.MaxVarintLen64]byte
+	bw.Write(buf[:binary.PutUvarint(buf[:], s.applied)])
+	for _, str := range s.kvs {
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(str)))])
+		bw.WriteString(str)
+	}
+	return bw.Flush()
+}
+
+// Release releases the copy of the state.
+func (s *fsmSnapshot) Release() {
+	s.kvs = nil
+}
@@ -0,0 +1,210 @@
+package fsm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+var errBadCommand = errors.New("bad command")
+
+// applySet applies logs of the form "key=val", and fails any other log.
+func applySet(tx *Tx, log *raft.Log) (interface{}, error) {
+	kv := strings.SplitN(string(log.Data), "=", 2)
+	if len(kv) != 2 {
+		tx.Set("partial", "1")
+		return nil, errBadCommand
+	}
+	if err := tx.Set(kv[0], kv[1]); err != nil {
+		return nil, err
+	}
+	return kv[0], nil
+}
+
+func testFSM(t *testing.T) (*BuntFSM, *raftbuntdb.BuntStore, string) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+	store, err := raftbuntdb.Open(path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return New(store, applySet), store, path
+}
+
+func state(t *testing.T, f *BuntFSM) map[string]string {
+	kvs := make(map[string]string)
+	err := f.View(func(tx *Tx) error {
+		return tx.Ascend("", func(key, val string) bool {
+			kvs[key] = val
+			return true
+		})
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return kvs
+}
+
+func checkApplied(t *testing.T, store *raftbuntdb.BuntStore, want uint64) {
+	t.Helper()
+	idx, err := store.AppliedIndex()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx != want {
+		t.Fatalf("bad applied index: %d, want %d", idx, want)
+	}
+}
+
+func TestBuntFSM_Apply(t *testing.T) {
+	f, store, _ := testFSM(t)
+	if resp := f.Apply(&raft.Log{Index: 1, Data: []byte("a=1")}); resp != "a" {
+		t.Fatalf("bad: %v", resp)
+	}
+	f.Apply(&raft.Log{Index: 2, Data: []byte("b=2")})
+	checkApplied(t, store, 2)
+
+	// A failed command is discarded but still applied
+	if resp := f.Apply(&raft.Log{Index: 3, Data: []byte("bad")}); resp != errBadCommand {
+		t.Fatalf("bad: %v", resp)
+	}
+	checkApplied(t, store, 3)
+
+	// Replayed logs are skipped
+	if resp := f.Apply(&raft.Log{Index: 2, Data: []byte("b=old")}); resp != nil {
+		t.Fatalf("bad: %v", resp)
+	}
+	kvs := state(t, f)
+	if len(kvs) != 2 || kvs["a"] != "1" || kvs["b"] != "2" {
+		t.Fatalf("bad: %v", kvs)
+	}
+
+	// The state is kept apart from the stable store
+	keys, err := store.StableKeys()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("bad: %q", keys)
+	}
+}
+
+func TestBuntFSM_Reopen(t *testing.T) {
+	f, store, path := testFSM(t)
+	f.Apply(&raft.Log{Index: 1, Data: []byte("a=1")})
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err := raftbuntdb.Open(path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	f = New(store, applySet)
+	checkApplied(t, store, 1)
+	if kvs := state(t, f); kvs["a"] != "1" {
+		t.Fatalf("bad: %v", kvs)
+	}
+}
+
+func TestTx(t *testing.T) {
+	f, _, _ := testFSM(t)
+	f.Apply(&raft.Log{Index: 1, Data: []byte("x=1")})
+	err := f.View(func(tx *Tx) error {
+		if val, err := tx.Get("x"); err != nil || val != "1" {
+			t.Fatalf("bad: %q %v", val, err)
+		}
+		if _, err := tx.Get("missing"); err != ErrNotFound {
+			t.Fatalf("bad: %v", err)
+		}
+		if err := tx.Set("y", "2"); err == nil {
+			t.Fatalf("expected a read-only transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// sink is a raft.SnapshotSink that writes to a buffer.
+type sink struct {
+	bytes.Buffer
+	closed, canceled bool
+}
+
+func (s *sink) ID() string    { return "test" }
+func (s *sink) Cancel() error { s.canceled = true; return nil }
+func (s *sink) Close() error  { s.closed = true; return nil }
+
+func TestBuntFSM_SnapshotRestore(t *testing.T) {
+	f, _, _ := testFSM(t)
+	for i, cmd := range []string{"a=1", "b=2", "c=3"} {
+		f.Apply(&raft.Log{Index: uint64(i + 1), Data: []byte(cmd)})
+	}
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Logs applied after the snapshot is taken aren't part of it
+	f.Apply(&raft.Log{Index: 4, Data: []byte("d=4")})
+	var s sink
+	if err := snap.Persist(&s); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	snap.Release()
+	if !s.closed || s.canceled {
+		t.Fatalf("bad: %+v", s)
+	}
+
+	// Restore into a store with other state
+	other, store, _ := testFSM(t)
+	other.Apply(&raft.Log{Index: 9, Data: []byte("z=9")})
+	if err := other.Restore(io.NopCloser(&s)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkApplied(t, store, 3)
+	kvs := state(t, other)
+	if len(kvs) != 3 || kvs["a"] != "1" || kvs["b"] != "2" || kvs["c"] != "3" {
+		t.Fatalf("bad: %v", kvs)
+	}
+	if resp := other.Apply(&raft.Log{Index: 4, Data: []byte("e=5")}); resp != "e" {
+		t.Fatalf("bad: %v", resp)
+	}
+}
+
+func TestBuntFSM_RestoreInvalid(t *testing.T) {
+	f, store, _ := testFSM(t)
+	f.Apply(&raft.Log{Index: 1, Data: []byte("a=1")})
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var s sink
+	if err := snap.Persist(&s); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, data := range [][]byte{
+		[]byte("nope"),
+		s.Bytes()[:s.Len()-1],
+	} {
+		f.Apply(&raft.Log{Index: 2, Data: []byte("b=2")})
+		err := f.Restore(io.NopCloser(bytes.NewReader(data)))
+		if err != errInvalidSnapshot {
+			t.Fatalf("bad: %v", err)
+		}
+	}
+
+	// The state is left as it was
+	checkApplied(t, store, 2)
+	if kvs := state(t, f); len(kvs) != 2 {
+		t.Fatalf("bad: %v", kvs)
+	}
+}
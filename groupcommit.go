@@ -0,0 +1,167 @@
+package raftbuntdb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// GroupCommit configures the coalescing of StoreLogs calls. With High
+// durability every transaction is fsynced, so commits are capped by the
+// rate the disk can sync; writing calls that arrive together in one
+// transaction shares a single fsync between them.
+type GroupCommit struct {
+	// Window is how long a batch waits for more calls after the first
+	// arrives. Defaults to 1ms.
+	Window time.Duration
+
+	// MaxEntries commits a batch early once it holds this many logs.
+	// Defaults to 1024.
+	MaxEntries int
+}
+
+// commitRequest is a write waiting for its batch to commit. The err field
+// is set before done is closed.
+type commitRequest struct {
+	logs  []*raft.Log
+	async bool
+	err   error
+	done  chan struct{}
+}
+
+// commitQueue holds the state shared with the commit goroutine.
+type commitQueue struct {
+	// requests receives writes for the commit goroutine.
+	requests chan *commitRequest
+
+	// mu guards asyncErr, the first error of an asynchronous write since
+	// the last Flush.
+	mu       sync.Mutex
+	asyncErr error
+}
+
+// submit hands a write to the commit goroutine. It blocks while the
+// goroutine is busy committing the previous batch.
+func (b *BuntStore) submit(logs []*raft.Log, async bool) *commitRequest {
+	req := &commitRequest{logs: logs, async: async, done: make(chan struct{})}
+	select {
+	case b.commits.requests <- req:
+	case <-b.done:
+		req.err = ErrClosed
+		close(req.done)
+	}
+	return req
+}
+
+// groupStoreLogs hands logs to the commit goroutine and waits for the
+// batch they're in to commit.
+func (b *BuntStore) groupStoreLogs(logs []*raft.Log) error {
+	req := b.submit(logs, false)
+	<-req.done
+	return req.err
+}
+
+// runCommits collects writes into batches until the store is closed. A
+// batch in progress when the store closes is still committed. Without
+// group commit a batch is only the writes already waiting.
+func (b *BuntStore) runCommits() {
+	var window time.Duration
+	maxEntries := 1024
+	if gc := b.opts.GroupCommit; gc != nil {
+		window = gc.Window
+		if window <= 0 {
+			window = time.Millisecond
+		}
+		if gc.MaxEntries > 0 {
+			maxEntries = gc.MaxEntries
+		}
+	}
+	for {
+		var batch []*commitRequest
+		select {
+		case req := <-b.commits.requests:
+			batch = append(batch, req)
+		case <-b.done:
+			return
+		}
+		n := len(batch[0].logs)
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if window > 0 {
+			timer = time.NewTimer(window)
+			timeout = timer.C
+		}
+	collect:
+		for n < maxEntries {
+			if timeout == nil {
+				select {
+				case req := <-b.commits.requests:
+					batch = append(batch, req)
+					n += len(req.logs)
+				default:
+					break collect
+				}
+				continue
+			}
+			select {
+			case req := <-b.commits.requests:
+				batch = append(batch, req)
+				n += len(req.logs)
+			case <-timeout:
+				break collect
+			case <-b.done:
+				break collect
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		b.commitBatch(batch)
+	}
+}
+
+// commitBatch writes a batch in one transaction. A call rejected by
+// StrictAppend fails on its own, but a failure to write fails every call
+// in the batch.
+func (b *BuntStore) commitBatch(batch []*commitRequest) {
+	now := time.Now()
+	vals := make([][]string, len(batch))
+	for i, req := range batch {
+		vals[i] = b.encodeLogs(req.logs)
+	}
+	err := b.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+		for i, req := range batch {
+			if len(req.logs) == 0 {
+				continue
+			}
+			if b.opts.StrictAppend {
+				if req.err = b.checkContiguous(tx, req.logs); req.err != nil {
+					continue
+				}
+			}
+			if err := b.storeLogs(tx, req.logs, vals[i], now, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for _, req := range batch {
+		if req.err == nil {
+			req.err = err
+		}
+		if req.err == nil && len(req.logs) > 0 {
+			b.backlog.add(b.opts.Backpressure, logsSize(req.logs))
+			b.onStoreLogs(req.logs)
+		}
+		if req.async && req.err != nil {
+			b.commits.mu.Lock()
+			if b.commits.asyncErr == nil {
+				b.commits.asyncErr = req.err
+			}
+			b.commits.mu.Unlock()
+		}
+		close(req.done)
+	}
+}
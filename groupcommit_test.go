@@ -0,0 +1,84 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_GroupCommit(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{
+		Durability:  High,
+		GroupCommit: &GroupCommit{Window: 5 * time.Millisecond},
+	})
+	defer os.Remove(store.path)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			base := uint64(i*10 + 1)
+			var logs []*raft.Log
+			for j := uint64(0); j < 10; j++ {
+				logs = append(logs, testRaftLog(base+j, "log"))
+			}
+			errs[i] = store.StoreLogs(logs)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	for idx := uint64(1); idx <= 100; idx++ {
+		if err := store.GetLog(idx, new(raft.Log)); err != nil {
+			t.Fatalf("err: %d %s", idx, err)
+		}
+	}
+
+	store.Close()
+	if err := store.StoreLog(testRaftLog(101, "log")); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+}
+
+func TestBuntStore_GroupCommitStrictAppend(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{
+		StrictAppend: true,
+		GroupCommit:  &GroupCommit{Window: 20 * time.Millisecond},
+	})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// A call that leaves a hole fails without failing its batch
+	var wg sync.WaitGroup
+	var good, bad error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		good = store.StoreLog(testRaftLog(1, "log"))
+	}()
+	time.Sleep(5 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		bad = store.StoreLog(testRaftLog(5, "log"))
+	}()
+	wg.Wait()
+	if good != nil {
+		t.Fatalf("err: %s", good)
+	}
+	var nc *ErrNonContiguous
+	if !errors.As(bad, &nc) {
+		t.Fatalf("expected non-contiguous error, got: %v", bad)
+	}
+	if idx, _ := store.LastIndex(); idx != 1 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
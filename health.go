@@ -0,0 +1,115 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// HealthStatus describes the state of the storage layer, for use by
+// readiness probes.
+type HealthStatus struct {
+	// Closed is true once the store has been closed.
+	Closed bool
+
+	// Failed is true once a write has failed to commit. Raft keeps
+	// calling StoreLogs after a disk error, so the state is kept until the
+	// store is reopened even if later writes succeed, or until CheckSpace
+	// re-enables writes.
+	Failed bool
+
+	// Degraded is true while writes are refused because the disk filled
+	// up. See NoSpacePolicy.
+	Degraded bool
+
+	// LastError is the last error from committing a write, and
+	// LastErrorTime when it happened. Errors returned before anything is
+	// written, such as an ErrNonContiguous, are not counted.
+	LastError     error
+	LastErrorTime time.Time
+
+	// Stalled is true while the logs not yet synced are over the high
+	// water mark of Options.Backpressure, and Backlog is their size.
+	Stalled bool
+	Backlog int64
+
+	// LastSync is the time of the last write that was fsynced. It is only
+	// tracked with High durability, where every commit is fsynced.
+	LastSync time.Time
+}
+
+// OK returns true if the store is open and no write has failed.
+func (h *HealthStatus) OK() bool {
+	return !h.Closed && !h.Failed && !h.Degraded
+}
+
+// healthTracker records the outcome of the store's writes.
+type healthTracker struct {
+	mu          sync.Mutex
+	failed      bool
+	degraded    bool
+	lastErr     error
+	lastErrTime time.Time
+	lastSync    time.Time
+}
+
+// record records the outcome of a write, where commit reports whether the
+// error came from writing to the file.
+func (h *healthTracker) record(err error, commit, synced bool) {
+	if err != nil && (!commit || errors.Is(err, ErrClosed)) {
+		return
+	}
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.failed = true
+		h.lastErr, h.lastErrTime = err, now
+	} else if synced {
+		h.lastSync = now
+	}
+}
+
+func (h *healthTracker) isDegraded() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.degraded
+}
+
+// setDegraded sets the degraded mode and returns whether it changed.
+// Leaving it also clears the failed state, since the database has been
+// verified.
+func (h *healthTracker) setDegraded(degraded bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.degraded == degraded {
+		return false
+	}
+	h.degraded = degraded
+	if !degraded {
+		h.failed = false
+	}
+	return true
+}
+
+// Health returns the health of the store.
+func (b *BuntStore) Health() HealthStatus {
+	b.mu.RLock()
+	closed := b.closed || b.broken != nil
+	b.mu.RUnlock()
+	b.backlog.mu.Lock()
+	stalled, pending := b.backlog.stalled, b.backlog.pending
+	b.backlog.mu.Unlock()
+	b.health.mu.Lock()
+	defer b.health.mu.Unlock()
+	return HealthStatus{
+		Stalled:       stalled,
+		Backlog:       pending,
+		Closed:        closed,
+		Failed:        b.health.failed,
+		Degraded:      b.health.degraded,
+		LastError:     b.health.lastErr,
+		LastErrorTime: b.health.lastErrTime,
+		LastSync:      b.health.lastSync,
+	}
+}
@@ -0,0 +1,70 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Health(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{Durability: High, StrictAppend: true})
+	defer os.Remove(store.path)
+
+	h := store.Health()
+	if !h.OK() || !h.LastSync.IsZero() {
+		t.Fatalf("bad: %#v", h)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	h = store.Health()
+	if !h.OK() || h.LastSync.IsZero() {
+		t.Fatalf("bad: %#v", h)
+	}
+
+	// Rejected batches don't make the store unhealthy
+	if err := store.StoreLog(testRaftLog(5, "log")); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if h = store.Health(); !h.OK() || h.LastError != nil {
+		t.Fatalf("bad: %#v", h)
+	}
+
+	// A commit failure is kept after later writes succeed
+	errDisk := errors.New("disk error")
+	store.health.record(errDisk, true, true)
+	if err := store.StoreLog(testRaftLog(2, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	h = store.Health()
+	if h.OK() || !h.Failed || h.LastError != errDisk || h.LastErrorTime.IsZero() {
+		t.Fatalf("bad: %#v", h)
+	}
+	if h.LastSync.Before(h.LastErrorTime) {
+		t.Fatalf("bad: %#v", h)
+	}
+
+	store.Close()
+	if err := store.StoreLog(testRaftLog(3, "log")); err == nil {
+		t.Fatalf("expected an error")
+	}
+	h = store.Health()
+	if !h.Closed || h.LastError != errDisk {
+		t.Fatalf("bad: %#v", h)
+	}
+}
+
+func TestBuntStore_HealthMediumDurability(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if h := store.Health(); !h.OK() || !h.LastSync.IsZero() {
+		t.Fatalf("bad: %#v", h)
+	}
+}
@@ -0,0 +1,134 @@
+package raftbuntdb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/tidwall/raft"
+)
+
+// KeyProvider supplies the secret key the store authenticates its logs
+// with, such as from a key management service.
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+// StaticKey is a KeyProvider that always returns the same key.
+type StaticKey []byte
+
+// Key returns the key.
+func (k StaticKey) Key() ([]byte, error) {
+	return k, nil
+}
+
+var (
+	// ErrTampered is the cause of an ErrCorruptEntry when a log fails
+	// authentication with the key of Options.HMACKey.
+	ErrTampered = errors.New("log entry failed authentication")
+
+	// errNoMAC is the cause of an ErrCorruptEntry when a log has no MAC
+	// but the store has an HMAC key.
+	errNoMAC = errors.New("log entry is not authenticated")
+
+	// errNoKey is returned by Open when the KeyProvider returns no key.
+	errNoKey = errors.New("empty hmac key")
+)
+
+// macType is set in the type byte of a log value that ends with a MAC.
+// The lower bits keep the log's type.
+const macType = 0x20
+
+// macSize is the size of the HMAC-SHA256 at the end of a log value.
+const macSize = sha256.Size
+
+// With Options.HMACKey set, every log value ends with an HMAC-SHA256 of
+// the log's plain encoding: the header and the data, wherever the data is
+// stored. The MAC follows the chunk map of a chunked log and the pointer
+// of a blob, and covers the data they point to. The header holds the
+// index, which must match the key, so a value moved to another key fails
+// too.
+
+// hasMAC reports whether the log value val ends with a MAC.
+func hasMAC(val string) bool {
+	return len(val) >= 17 && val[16]&macType != 0
+}
+
+// logPayload returns what follows the header of the log value val,
+// without its MAC.
+func logPayload(val string) string {
+	if hasMAC(val) && len(val) >= 17+macSize {
+		return val[17 : len(val)-macSize]
+	}
+	return val[17:]
+}
+
+// loadMACKey returns the key of opts.HMACKey, or nil if it isn't set.
+func loadMACKey(opts *Options) ([]byte, error) {
+	if opts.HMACKey == nil {
+		return nil, nil
+	}
+	key, err := opts.HMACKey.Key()
+	if err == nil && len(key) == 0 {
+		err = errNoKey
+	}
+	return key, err
+}
+
+// logMAC returns the MAC of a log, given its header and data.
+func (b *BuntStore) logMAC(header []byte, data string) []byte {
+	h := hmac.New(sha256.New, b.macKey)
+	h.Write(header[:16])
+	h.Write([]byte{header[16] &^ (chunkedType | blobType | macType)})
+	h.Write(stringToBytes(data))
+	return h.Sum(nil)
+}
+
+// seal appends the MAC of log to its value val, if the store has an HMAC
+// key.
+func (b *BuntStore) seal(val []byte, log *raft.Log) []byte {
+	if b.macKey == nil {
+		return val
+	}
+	val[16] |= macType
+	return append(val, b.logMAC(val, bytesToString(log.Data))...)
+}
+
+// unseal splits the MAC from the end of the log value val. The value of a
+// chunked log or a blob is copied, so that it can be read without the
+// MAC.
+func unseal(val string) (string, string, error) {
+	if !hasMAC(val) {
+		return val, "", nil
+	}
+	if len(val) < 17+macSize {
+		return "", "", errInvalidBuffer
+	}
+	mac := val[len(val)-macSize:]
+	val = val[:len(val)-macSize]
+	if val[16]&(chunkedType|blobType) != 0 {
+		buf := []byte(val)
+		buf[16] &^= macType
+		val = string(buf)
+	}
+	return val, mac, nil
+}
+
+// checkMAC checks mac against the plain log value val of the log with key.
+// A store without an HMAC key accepts every log.
+func (b *BuntStore) checkMAC(key, val, mac string) error {
+	if b.macKey == nil {
+		return nil
+	}
+	if mac == "" {
+		return errNoMAC
+	}
+	if leUint64(val) != logIndex(key) {
+		return ErrTampered
+	}
+	want := b.logMAC(stringToBytes(val), val[17:])
+	if !hmac.Equal(want, stringToBytes(mac)) {
+		return ErrTampered
+	}
+	return nil
+}
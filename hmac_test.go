@@ -0,0 +1,150 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_HMAC(t *testing.T) {
+	blobs, err := NewDirBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	opts := &Options{HMACKey: StaticKey("secret"), ChunkSize: 8,
+		Blobs: blobs, BlobThreshold: 16}
+	store := testBuntStoreOpts(t, opts)
+	defer os.Remove(store.path)
+	logs := []*raft.Log{
+		{Index: 1, Term: 1, Type: raft.LogNoop, Data: []byte("plain")},
+		{Index: 2, Term: 1, Data: []byte("chunked data")},
+		{Index: 3, Term: 2, Data: []byte(strings.Repeat("blob", 5))},
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	check := func(store *BuntStore) {
+		t.Helper()
+		for _, want := range logs {
+			var log raft.Log
+			if err := store.GetLog(want.Index, &log); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if log.Term != want.Term || log.Type != want.Type ||
+				string(log.Data) != string(want.Data) {
+				t.Fatalf("bad: %+v", log)
+			}
+		}
+	}
+	check(store)
+	var types int
+	err = store.AscendLogsOfType(0, func(log *raft.Log) bool {
+		types++
+		return true
+	}, raft.LogNoop)
+	if err != nil || types != 1 {
+		t.Fatalf("bad: %v %d", err, types)
+	}
+	checkCounter(t, store)
+	report, err := store.Verify()
+	if err != nil || !report.OK() {
+		t.Fatalf("bad: %v %v", err, report)
+	}
+	store.Close()
+
+	// The logs read without a key, but not with the wrong one
+	opts.HMACKey = nil
+	store, err = Open(store.path, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	check(store)
+	store.Close()
+	opts.HMACKey = StaticKey("other")
+	store, err = Open(store.path, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	for i := uint64(1); i <= 3; i++ {
+		var log raft.Log
+		if err := store.GetLog(i, &log); !errors.Is(err, ErrTampered) {
+			t.Fatalf("bad: %d %v", i, err)
+		}
+	}
+}
+
+func TestBuntStore_HMACTampered(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{HMACKey: StaticKey("secret")})
+	defer os.Remove(store.path)
+	defer store.Close()
+	for i := uint64(1); i <= 3; i++ {
+		if err := store.StoreLog(testRaftLog(i, "data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	tamper := func(fn func(tx *buntdb.Tx, val string) error) {
+		err := store.db.Update(func(tx *buntdb.Tx) error {
+			val, err := tx.Get(store.logKey(1))
+			if err != nil {
+				return err
+			}
+			return fn(tx, val)
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	get := func(idx uint64) error {
+		var log raft.Log
+		return store.GetLog(idx, &log)
+	}
+
+	// An altered payload
+	tamper(func(tx *buntdb.Tx, val string) error {
+		_, _, err := tx.Set(store.logKey(1), val[:17]+"DATA"+val[21:], nil)
+		return err
+	})
+	if err := get(1); !errors.Is(err, ErrTampered) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// A log moved to another index
+	tamper(func(tx *buntdb.Tx, val string) error {
+		val, err := tx.Get(store.logKey(3))
+		if err != nil {
+			return err
+		}
+		_, _, err = tx.Set(store.logKey(2), val, nil)
+		return err
+	})
+	if err := get(2); !errors.Is(err, ErrTampered) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// A log with its MAC stripped
+	tamper(func(tx *buntdb.Tx, val string) error {
+		plain := val[:16] + string(val[16]&^macType) + "data"
+		_, _, err := tx.Set(store.logKey(3), plain, nil)
+		return err
+	})
+	if err := get(3); !errors.Is(err, errNoMAC) {
+		t.Fatalf("bad: %v", err)
+	}
+	report, err := store.Verify()
+	if err != nil || len(report.Corrupt) != 3 {
+		t.Fatalf("bad: %v %v", err, report)
+	}
+}
+
+func TestOpen_EmptyHMACKey(t *testing.T) {
+	path := testBuntStore(t).path
+	defer os.Remove(path)
+	if _, err := Open(path, &Options{HMACKey: StaticKey(nil)}); err != errNoKey {
+		t.Fatalf("bad: %v", err)
+	}
+}
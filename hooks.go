@@ -0,0 +1,48 @@
+package raftbuntdb
+
+import "github.com/tidwall/raft"
+
+// Hooks are called after writes commit, such as for an audit trail or to
+// invalidate a cache. They run before the write returns, on the goroutine
+// that committed it, and must not modify their arguments or call back
+// into the store for writes. Any of them may be nil.
+type Hooks struct {
+	// OnStoreLogs is called with the logs of each StoreLogs,
+	// StoreLogsAsync and StoreLogsContext call.
+	OnStoreLogs func(logs []*raft.Log)
+
+	// OnDeleteRange is called with the range of each DeleteRange call,
+	// each chunk of DeleteRangeContext, and each compaction, which
+	// deletes from zero.
+	OnDeleteRange func(min, max uint64)
+
+	// OnSet is called with each value written by Set and SetUint64.
+	OnSet func(k, v []byte)
+
+	// OnDelete is called with each key removed by Delete.
+	OnDelete func(k []byte)
+}
+
+func (b *BuntStore) onStoreLogs(logs []*raft.Log) {
+	if h := b.opts.Hooks; h != nil && h.OnStoreLogs != nil {
+		h.OnStoreLogs(logs)
+	}
+}
+
+func (b *BuntStore) onDeleteRange(min, max uint64) {
+	if h := b.opts.Hooks; h != nil && h.OnDeleteRange != nil {
+		h.OnDeleteRange(min, max)
+	}
+}
+
+func (b *BuntStore) onSet(k, v []byte) {
+	if h := b.opts.Hooks; h != nil && h.OnSet != nil {
+		h.OnSet(k, v)
+	}
+}
+
+func (b *BuntStore) onDelete(k []byte) {
+	if h := b.opts.Hooks; h != nil && h.OnDelete != nil {
+		h.OnDelete(k)
+	}
+}
@@ -0,0 +1,88 @@
+package raftbuntdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+// hookRecorder records the calls to Hooks.
+type hookRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *hookRecorder) add(format string, args ...interface{}) {
+	r.mu.Lock()
+	r.calls = append(r.calls, fmt.Sprintf(format, args...))
+	r.mu.Unlock()
+}
+
+func (r *hookRecorder) hooks() *Hooks {
+	return &Hooks{
+		OnStoreLogs: func(logs []*raft.Log) {
+			r.add("store %d-%d", logs[0].Index, logs[len(logs)-1].Index)
+		},
+		OnDeleteRange: func(min, max uint64) { r.add("delete %d-%d", min, max) },
+		OnSet:         func(k, v []byte) { r.add("set %s=%s", k, v) },
+		OnDelete:      func(k []byte) { r.add("del %s", k) },
+	}
+}
+
+func (r *hookRecorder) check(t *testing.T, want ...string) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Fatalf("got %q, want %q", r.calls, want)
+	}
+	r.calls = nil
+}
+
+func TestBuntStore_Hooks(t *testing.T) {
+	var r hookRecorder
+	store := testBuntStoreOpts(t, &Options{Hooks: r.hooks(), StrictAppend: true})
+	defer store.Close()
+
+	store.StoreLogs([]*raft.Log{testRaftLog(1, "a"), testRaftLog(2, "b")})
+	store.StoreLogsContext(context.Background(), []*raft.Log{testRaftLog(3, "c")})
+	if err := store.StoreLogsAsync([]*raft.Log{testRaftLog(4, "d")}).Error(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.check(t, "store 1-2", "store 3-3", "store 4-4")
+
+	// Failed writes aren't passed on
+	if err := store.StoreLog(testRaftLog(9, "gap")); err == nil {
+		t.Fatalf("expected an error")
+	}
+	r.check(t)
+
+	store.DeleteRange(4, 4)
+	store.DeleteRangeContext(context.Background(), 3, 3)
+	store.CompactTo(1)
+	r.check(t, "delete 4-4", "delete 3-3", "delete 0-1")
+
+	store.Set([]byte("k"), []byte("v"))
+	store.SetUint64([]byte("CurrentTerm"), 3)
+	r.check(t, "set k=v", "set CurrentTerm=3")
+
+	store.Delete([]byte("k"))
+	store.Delete([]byte("missing"))
+	r.check(t, "del k")
+	if m := store.Metrics().Delete; m.Calls != 2 || m.Errors != 0 {
+		t.Fatalf("bad: %+v", m)
+	}
+}
+
+func TestBuntStore_HooksGroupCommit(t *testing.T) {
+	var r hookRecorder
+	store := testBuntStoreOpts(t, &Options{Hooks: r.hooks(),
+		GroupCommit: &GroupCommit{}})
+	defer store.Close()
+	store.StoreLogs([]*raft.Log{testRaftLog(1, "a")})
+	r.check(t, "store 1-1")
+}
@@ -0,0 +1,42 @@
+package raftbuntdb
+
+import (
+	"fmt"
+)
+
+// Index is a buntdb index over application keys, see Options.Indexes.
+type Index struct {
+	// Name is the name passed to the transaction's iterators, such as
+	// tx.Ascend(name, ...).
+	Name string
+
+	// Pattern matches the keys in the index, such as "app:user:*". It
+	// should not match keys reserved by the store, see IsReservedKey.
+	Pattern string
+
+	// Less orders the values, falling back to the next function for equal
+	// values, such as buntdb.IndexString.
+	Less []func(a, b string) bool
+}
+
+// checkIndexes returns an ErrInvalidIndex for indexes that can't be
+// created alongside the store's own.
+func checkIndexes(indexes []Index) error {
+	names := map[string]bool{termsIndex: true}
+	for _, idx := range indexes {
+		switch {
+		case idx.Name == "":
+			return fmt.Errorf("%w: missing name", ErrInvalidIndex)
+		case names[idx.Name]:
+			return fmt.Errorf("%w: duplicate or reserved name %q",
+				ErrInvalidIndex, idx.Name)
+		case idx.Pattern == "":
+			return fmt.Errorf("%w: %q has no pattern", ErrInvalidIndex, idx.Name)
+		case len(idx.Less) == 0:
+			return fmt.Errorf("%w: %q has no less function",
+				ErrInvalidIndex, idx.Name)
+		}
+		names[idx.Name] = true
+	}
+	return nil
+}
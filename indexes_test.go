@@ -0,0 +1,90 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+func indexedKeys(t *testing.T, store *BuntStore) string {
+	var keys []string
+	err := store.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("users", func(key, val string) bool {
+			keys = append(keys, key)
+			return true
+		})
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestBuntStore_Indexes(t *testing.T) {
+	opts := &Options{Indexes: []Index{{
+		Name:    "users",
+		Pattern: "app:user:*",
+		Less:    []func(a, b string) bool{buntdb.IndexInt},
+	}}}
+	store := testBuntStoreOpts(t, opts)
+	defer store.Close()
+	err := store.Update(func(tx *buntdb.Tx) error {
+		for _, kv := range [][2]string{
+			{"app:user:a", "30"}, {"app:user:b", "4"}, {"app:other", "1"},
+		} {
+			if _, _, err := tx.Set(kv[0], kv[1], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	const want = "app:user:b,app:user:a"
+	if keys := indexedKeys(t, store); keys != want {
+		t.Fatalf("bad: %s", keys)
+	}
+
+	// The index is recreated when the store reopens the file
+	if err := store.reopen(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if keys := indexedKeys(t, store); keys != want {
+		t.Fatalf("bad: %s", keys)
+	}
+
+	// And when it is opened again
+	store.Close()
+	store, err = Open(store.path, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if keys := indexedKeys(t, store); keys != want {
+		t.Fatalf("bad: %s", keys)
+	}
+}
+
+func TestOpen_InvalidIndex(t *testing.T) {
+	less := []func(a, b string) bool{buntdb.IndexString}
+	for _, indexes := range [][]Index{
+		{{Pattern: "app:*", Less: less}},
+		{{Name: termsIndex, Pattern: "app:*", Less: less}},
+		{{Name: "a", Pattern: "app:*", Less: less}, {Name: "a", Pattern: "x:*", Less: less}},
+		{{Name: "a", Less: less}},
+		{{Name: "a", Pattern: "app:*"}},
+	} {
+		path := filepath.Join(t.TempDir(), "raft.db")
+		_, err := Open(path, &Options{Indexes: indexes})
+		if !errors.Is(err, ErrInvalidIndex) {
+			t.Fatalf("bad: %v", err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package raftbuntdb
+
+import (
+	"context"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// AscendLogGreaterOrEqual calls iter with each log from pivot to the last
+// log in index order, until iter returns false.
+func (b *BuntStore) AscendLogGreaterOrEqual(pivot uint64,
+	iter func(log *raft.Log) bool) error {
+	return b.ascendLogs(pivot, 1<<64-1, nil, iter)
+}
+
+// DescendLogLessOrEqual calls iter with each log from pivot back to the
+// first log, newest first, until iter returns false. It is used to walk
+// back from the tip, such as to find the last peer change.
+func (b *BuntStore) DescendLogLessOrEqual(pivot uint64,
+	iter func(log *raft.Log) bool) error {
+	return b.descendLogs(pivot, 0, nil, iter)
+}
+
+// AscendLogRange calls iter with each log from min to max inclusively in
+// index order, until iter returns false.
+func (b *BuntStore) AscendLogRange(min, max uint64,
+	iter func(log *raft.Log) bool) error {
+	return b.ascendLogs(min, max, nil, iter)
+}
+
+// DescendLogRange calls iter with each log from max back to min
+// inclusively, newest first, until iter returns false.
+func (b *BuntStore) DescendLogRange(max, min uint64,
+	iter func(log *raft.Log) bool) error {
+	return b.descendLogs(max, min, nil, iter)
+}
+
+// AscendLogsOfType is like AscendLogGreaterOrEqual but only passes the
+// logs of the given types to iter. Other logs are skipped after reading
+// their header, without copying their data.
+func (b *BuntStore) AscendLogsOfType(pivot uint64,
+	iter func(log *raft.Log) bool, types ...raft.LogType) error {
+	return b.ascendLogs(pivot, 1<<64-1, func(val string) bool {
+		return hasLogType(val, types)
+	}, iter)
+}
+
+// DescendLogsOfType is like DescendLogLessOrEqual but only passes the logs
+// of the given types to iter, such as to find the last peer change.
+func (b *BuntStore) DescendLogsOfType(pivot uint64,
+	iter func(log *raft.Log) bool, types ...raft.LogType) error {
+	return b.descendLogs(pivot, 0, func(val string) bool {
+		return hasLogType(val, types)
+	}, iter)
+}
+
+// hasLogType reports whether the encoded log val has one of types. Values
+// too short to hold a header match, so that decoding reports them.
+func hasLogType(val string, types []raft.LogType) bool {
+	if len(val) < 17 {
+		return true
+	}
+	for _, t := range types {
+		if raft.LogType(val[16]&^(chunkedType|blobType|macType)) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ascendLogs passes the logs from pivot to max that match, or all of them
+// when match is nil, to iter in index order.
+func (b *BuntStore) ascendLogs(pivot, max uint64, match func(val string) bool,
+	iter func(log *raft.Log) bool) error {
+	iter, charge := b.chargeReads(iter)
+	return charge(b.view(func(tx *buntdb.Tx) error {
+		visit, finish := b.visitLogs(tx, func(idx uint64, val string) bool {
+			return idx >= pivot && (match == nil || match(val))
+		}, iter)
+		err := b.keys.ascendLogs(tx, pivot,
+			func(key, val string) bool {
+				return logIndex(key) <= max && visit(key, val)
+			})
+		return firstErr(err, finish())
+	}))
+}
+
+// descendLogs passes the logs from pivot back to min that match, or all of
+// them when match is nil, to iter, newest first.
+func (b *BuntStore) descendLogs(pivot, min uint64, match func(val string) bool,
+	iter func(log *raft.Log) bool) error {
+	iter, charge := b.chargeReads(iter)
+	return charge(b.view(func(tx *buntdb.Tx) error {
+		visit, finish := b.visitLogs(tx, func(idx uint64, val string) bool {
+			return idx <= pivot && (match == nil || match(val))
+		}, iter)
+		err := b.keys.descendLogs(tx, pivot, func(key, val string) bool {
+			return logIndex(key) >= min && visit(key, val)
+		})
+		return firstErr(err, finish())
+	}))
+}
+
+// chargeReads returns iter counting the logs it's passed, and a function
+// that waits for the turn of those reads under the RateLimit once the
+// iteration with the error err is over.
+func (b *BuntStore) chargeReads(iter func(log *raft.Log) bool) (func(log *raft.Log) bool,
+	func(err error) error) {
+	if !b.limits.read.limited.Load() {
+		return iter, func(err error) error { return err }
+	}
+	var n int
+	counted := func(log *raft.Log) bool {
+		n++
+		return iter(log)
+	}
+	return counted, func(err error) error {
+		return firstErr(err, b.waitTurn(context.Background(), &b.limits.read, n))
+	}
+}
+
+// visitLogs returns a buntdb iterator that decodes the logs accepted by
+// match and passes them to iter, and a function that returns the first
+// decode error once the iteration is over. A decode error stops the
+// iteration. With Options.DecodeWorkers set, the logs are decoded in
+// parallel.
+func (b *BuntStore) visitLogs(tx *buntdb.Tx, match func(idx uint64, val string) bool,
+	iter func(log *raft.Log) bool) (func(key, val string) bool, func() error) {
+	if b.opts.DecodeWorkers > 1 {
+		return b.visitLogsParallel(tx, match, iter)
+	}
+	var err error
+	return func(key, val string) bool {
+		idx := logIndex(key)
+		if !match(idx, val) {
+			return true
+		}
+		if val, err = b.readLog(tx, key, val); err != nil {
+			err = &ErrCorruptEntry{Index: idx, Err: err}
+			return false
+		}
+		log := new(raft.Log)
+		if err = decodeLog(idx, val, log); err != nil {
+			err = corruptEntry(idx, val, err)
+			return false
+		}
+		return iter(log)
+	}, func() error { return err }
+}
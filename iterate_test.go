@@ -0,0 +1,128 @@
+package raftbuntdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_IterateLogs(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	collect := func(limit int) (func(log *raft.Log) bool, *[]uint64) {
+		var got []uint64
+		return func(log *raft.Log) bool {
+			got = append(got, log.Index)
+			return len(got) < limit
+		}, &got
+	}
+
+	iter, got := collect(100)
+	if err := store.DescendLogLessOrEqual(4, iter); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(*got, []uint64{4, 3, 2, 1}) {
+		t.Fatalf("bad: %v", *got)
+	}
+	iter, got = collect(2)
+	if err := store.DescendLogLessOrEqual(1<<64-1, iter); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(*got, []uint64{10, 9}) {
+		t.Fatalf("bad: %v", *got)
+	}
+	iter, got = collect(3)
+	if err := store.AscendLogGreaterOrEqual(8, iter); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(*got, []uint64{8, 9, 10}) {
+		t.Fatalf("bad: %v", *got)
+	}
+	iter, got = collect(100)
+	if err := store.DescendLogLessOrEqual(0, iter); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(*got) != 0 {
+		t.Fatalf("bad: %v", *got)
+	}
+
+	iter, got = collect(100)
+	if err := store.AscendLogRange(3, 5, iter); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(*got, []uint64{3, 4, 5}) {
+		t.Fatalf("bad: %v", *got)
+	}
+	iter, got = collect(100)
+	if err := store.DescendLogRange(7, 6, iter); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(*got, []uint64{7, 6}) {
+		t.Fatalf("bad: %v", *got)
+	}
+}
+
+func TestBuntStore_LogsOfType(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		log := testRaftLog(i, "log")
+		if i%3 == 0 {
+			log.Type = raft.LogAddPeer
+			log.Data = EncodePeers([]string{"a:1"})
+		}
+		logs = append(logs, log)
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var got []uint64
+	err := store.AscendLogsOfType(4, func(log *raft.Log) bool {
+		got = append(got, log.Index)
+		return true
+	}, raft.LogAddPeer, raft.LogRemovePeer)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(got, []uint64{6, 9}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Find the last peer change
+	var last *raft.Log
+	err = store.DescendLogsOfType(1<<64-1, func(log *raft.Log) bool {
+		last = log
+		return false
+	}, raft.LogAddPeer)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if last == nil || last.Index != 9 {
+		t.Fatalf("bad: %#v", last)
+	}
+	got = nil
+	err = store.DescendLogsOfType(8, func(log *raft.Log) bool {
+		got = append(got, log.Index)
+		return true
+	}, raft.LogCommand)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(got, []uint64{8, 7, 5, 4, 2, 1}) {
+		t.Fatalf("bad: %v", got)
+	}
+}
@@ -0,0 +1,343 @@
+package raftbuntdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// KeyEncoding selects how log indexes are encoded in keys. It is chosen
+// when a database is created and recorded in it, so existing databases
+// keep their encoding.
+type KeyEncoding int
+
+const (
+	// DecimalKeys encodes indexes as 20 zero-padded decimal digits, for
+	// 22-byte keys. It's the original encoding.
+	DecimalKeys KeyEncoding = iota
+
+	// BinaryKeys encodes indexes as 8 big-endian bytes, for 10-byte keys
+	// that shrink both the in-memory btree and the file.
+	BinaryKeys
+)
+
+// keyEncodingKey records the key encoding of the database. Databases
+// without it use DecimalKeys.
+const keyEncodingKey = dbMeta + "keys"
+
+var keyEncodingNames = []string{"decimal", "binary"}
+
+func (e KeyEncoding) String() string {
+	if e >= 0 && int(e) < len(keyEncodingNames) {
+		return keyEncodingNames[e]
+	}
+	return fmt.Sprintf("KeyEncoding(%d)", int(e))
+}
+
+// readKeyEncoding returns the key encoding recorded in the database.
+func readKeyEncoding(tx *buntdb.Tx) (KeyEncoding, error) {
+	val, err := tx.Get(keyEncodingKey)
+	if err != nil {
+		if err == buntdb.ErrNotFound {
+			return DecimalKeys, nil
+		}
+		return 0, err
+	}
+	for i, name := range keyEncodingNames {
+		if val == name {
+			return KeyEncoding(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%s: unknown key encoding %q", keyEncodingKey, val)
+}
+
+// keyLayout is how the keys of a database are laid out: the encoding of
+// log indexes and the prefixes of the logs and the stable store. It's
+// chosen when the database is created and recorded in it.
+type keyLayout struct {
+	enc  KeyEncoding
+	logs string
+	conf string
+}
+
+const (
+	// logPrefixKey and stablePrefixKey record the prefixes of a database
+	// created with Options.LogPrefix or Options.StablePrefix. Databases
+	// without them use dbLogs and dbConf.
+	logPrefixKey    = dbMeta + "logprefix"
+	stablePrefixKey = dbMeta + "stableprefix"
+)
+
+// newKeyLayout returns the layout of a new database created with opts.
+func newKeyLayout(opts *Options) (keyLayout, error) {
+	keys := keyLayout{enc: opts.KeyEncoding, logs: dbLogs, conf: dbConf}
+	if keys.enc < 0 || int(keys.enc) >= len(keyEncodingNames) {
+		return keys, fmt.Errorf("unknown key encoding %d", int(keys.enc))
+	}
+	if opts.LogPrefix != "" {
+		keys.logs = opts.LogPrefix
+	}
+	if opts.StablePrefix != "" {
+		keys.conf = opts.StablePrefix
+	}
+	return keys, checkPrefixes(keys.logs, keys.conf)
+}
+
+// checkPrefixes returns an error unless the prefixes of the logs and the
+// stable store each end in their only ':' and are distinct from each
+// other and from the other reserved prefixes, so that none of them can be
+// the start of another and logIndex can find where the index starts.
+func checkPrefixes(logs, conf string) error {
+	for _, prefix := range []string{logs, conf} {
+		if len(prefix) < 2 || strings.IndexByte(prefix, ':') != len(prefix)-1 {
+			return fmt.Errorf("invalid key prefix %q", prefix)
+		}
+		for _, other := range reservedPrefixes {
+			if other != dbLogs && other != dbConf && prefix == other {
+				return fmt.Errorf("key prefix %q is reserved", prefix)
+			}
+		}
+	}
+	if logs == conf {
+		return fmt.Errorf("key prefix %q used twice", logs)
+	}
+	return nil
+}
+
+// writeKeyLayout records the layout of a new database.
+func writeKeyLayout(tx *buntdb.Tx, keys keyLayout) error {
+	if _, _, err := tx.Set(keyEncodingKey, keys.enc.String(), nil); err != nil {
+		return err
+	}
+	for _, kv := range [][3]string{
+		{logPrefixKey, keys.logs, dbLogs},
+		{stablePrefixKey, keys.conf, dbConf},
+	} {
+		if kv[1] == kv[2] {
+			continue
+		}
+		if _, _, err := tx.Set(kv[0], kv[1], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readKeyLayout returns the layout recorded in the database.
+func readKeyLayout(tx *buntdb.Tx) (keyLayout, error) {
+	keys := keyLayout{logs: dbLogs, conf: dbConf}
+	var err error
+	if keys.enc, err = readKeyEncoding(tx); err != nil {
+		return keys, err
+	}
+	for _, kv := range []struct {
+		key    string
+		prefix *string
+	}{
+		{logPrefixKey, &keys.logs},
+		{stablePrefixKey, &keys.conf},
+	} {
+		val, err := tx.Get(kv.key)
+		if err == buntdb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return keys, err
+		}
+		*kv.prefix = val
+	}
+	if err := checkPrefixes(keys.logs, keys.conf); err != nil {
+		return keys, fmt.Errorf("%s: %w", logPrefixKey, err)
+	}
+	return keys, nil
+}
+
+// logKey returns the key of the log at idx in the store's key layout. It's
+// kept small enough to inline, so that a key that doesn't escape the
+// caller isn't allocated.
+func (b *BuntStore) logKey(idx uint64) string {
+	var buf [32]byte
+	return string(b.keys.appendLogKey(buf[:0], idx))
+}
+
+// appendLogKey appends the key of the log at idx to dst. Inlining it would
+// push logKey over the inlining budget.
+//
+//go:noinline
+func (k *keyLayout) appendLogKey(dst []byte, idx uint64) []byte {
+	dst = append(dst, k.logs...)
+	if k.enc == BinaryKeys {
+		return binary.BigEndian.AppendUint64(dst, idx)
+	}
+	return appendUint64(dst, idx)
+}
+
+// confKey returns the key of the stable key k.
+func (b *BuntStore) confKey(k string) string {
+	return b.keys.conf + k
+}
+
+// isLogKey reports whether key is the key of a log.
+func (b *BuntStore) isLogKey(key string) bool {
+	return strings.HasPrefix(key, b.keys.logs)
+}
+
+// logIndex returns the index of a log key in either encoding and with any
+// prefix, which ends in its only ':'. Decimal keys always have 20 digits,
+// so the length tells them apart.
+func logIndex(key string) uint64 {
+	key = key[strings.IndexByte(key, ':')+1:]
+	if len(key) == 8 {
+		return binary.BigEndian.Uint64(stringToBytes(key))
+	}
+	return stringToUint64(key)
+}
+
+// parseLogIndex is like logIndex but returns an ErrCorruptValue for a key
+// whose index doesn't parse, rather than reading it as zero.
+func parseLogIndex(key string) (uint64, error) {
+	s := key[strings.IndexByte(key, ':')+1:]
+	if len(s) == 8 {
+		return binary.BigEndian.Uint64(stringToBytes(s)), nil
+	}
+	if len(s) != 20 {
+		return 0, &ErrCorruptValue{Key: key, Err: errBadLogKey}
+	}
+	idx, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, &ErrCorruptValue{Key: key, Err: err}
+	}
+	return idx, nil
+}
+
+// isPlainKey reports whether the log key, with the prefix of keys, holds
+// an unpadded decimal index rather than one in the encoding of keys. An
+// 8-digit index can't be told from a binary one and is taken as binary.
+func (k *keyLayout) isPlainKey(key string) bool {
+	s := key[len(k.logs):]
+	if s == "" || len(s) >= 20 || (k.enc == BinaryKeys && len(s) == 8) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// findPlainKey returns the first or last log key if it holds an unpadded
+// decimal index, or "". Plain keys sort by their first digit, so a
+// database that holds any has one at either end of the log.
+func findPlainKey(tx *buntdb.Tx, keys keyLayout) (string, error) {
+	var plain string
+	visit := func(key, val string) bool {
+		if strings.HasPrefix(key, keys.logs) && keys.isPlainKey(key) {
+			plain = key
+		}
+		return false
+	}
+	if err := tx.AscendGreaterOrEqual("", keys.logs, visit); err != nil || plain != "" {
+		return plain, err
+	}
+	end := keys.logs[:len(keys.logs)-1] + ";"
+	err := tx.DescendLessOrEqual("", end, func(key, val string) bool {
+		return key == end || visit(key, val)
+	})
+	return plain, err
+}
+
+// checkKeyStyle refuses a database whose log keys hold unpadded decimal
+// indexes, which would be read in the wrong order.
+func checkKeyStyle(tx *buntdb.Tx, keys keyLayout) error {
+	key, err := findPlainKey(tx, keys)
+	if err != nil || key == "" {
+		return err
+	}
+	return fmt.Errorf("%w: log key %q has an unpadded decimal index, as written "+
+		"for another raft library; rewrite the keys in the %s encoding with "+
+		"Migrate or \"raft-buntdb upgrade\", which keep a backup", ErrKeyStyle, key, keys.enc)
+}
+
+// rekeyLogs rewrites the log keys that hold unpadded decimal indexes in the
+// encoding of keys.
+func rekeyLogs(tx *buntdb.Tx, keys keyLayout) error {
+	var plain []string
+	err := tx.AscendGreaterOrEqual("", keys.logs, func(key, val string) bool {
+		if !strings.HasPrefix(key, keys.logs) {
+			return false
+		}
+		if keys.isPlainKey(key) {
+			plain = append(plain, key)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range plain {
+		idx, err := strconv.ParseUint(key[len(keys.logs):], 10, 64)
+		if err != nil {
+			return &ErrCorruptValue{Key: key, Err: err}
+		}
+		newKey := string(keys.appendLogKey(nil, idx))
+		if _, err := tx.Get(newKey); err != buntdb.ErrNotFound {
+			if err == nil {
+				err = fmt.Errorf("log %d is stored under both %q and %q", idx, key, newKey)
+			}
+			return err
+		}
+		val, err := tx.Delete(key)
+		if err != nil {
+			return err
+		}
+		if _, _, err := tx.Set(newKey, val, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ascendLogs passes the logs from idx on to iter, in the order of their
+// keys, which is the order of their indexes in either encoding. It scans
+// the keys rather than an index over the values, so a log whose value is
+// corrupt or holds another index is still visited in its place, and it
+// stops at the first key past the log prefix, so scans of the log don't
+// visit the other keys in the database.
+func (k *keyLayout) ascendLogs(tx *buntdb.Tx, idx uint64, iter func(key, val string) bool) error {
+	return tx.AscendGreaterOrEqual("", string(k.appendLogKey(nil, idx)),
+		func(key, val string) bool {
+			return strings.HasPrefix(key, k.logs) && iter(key, val)
+		})
+}
+
+// descendLogs is like ascendLogs but passes the logs from idx back.
+func (k *keyLayout) descendLogs(tx *buntdb.Tx, idx uint64, iter func(key, val string) bool) error {
+	return tx.DescendLessOrEqual("", string(k.appendLogKey(nil, idx)),
+		func(key, val string) bool {
+			return strings.HasPrefix(key, k.logs) && iter(key, val)
+		})
+}
+
+// firstIndex returns the first index of the log, or zero if it's empty.
+func (k *keyLayout) firstIndex(tx *buntdb.Tx) (uint64, error) {
+	var idx uint64
+	err := k.ascendLogs(tx, 0, func(key, val string) bool {
+		idx = logIndex(key)
+		return false
+	})
+	return idx, err
+}
+
+// lastIndex returns the last index of the log, or zero if it's empty.
+func (k *keyLayout) lastIndex(tx *buntdb.Tx) (uint64, error) {
+	var idx uint64
+	err := k.descendLogs(tx, 1<<64-1, func(key, val string) bool {
+		idx = logIndex(key)
+		return false
+	})
+	return idx, err
+}
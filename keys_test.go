@@ -0,0 +1,359 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_BinaryKeys(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{KeyEncoding: BinaryKeys})
+	defer os.Remove(store.path)
+
+	// Cross the byte boundaries of the big-endian encoding
+	var logs []*raft.Log
+	for i := uint64(1); i <= 600; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(1, 250); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.FirstIndex(); idx != 251 {
+		t.Fatalf("bad: %d", idx)
+	}
+	if idx, _ := store.LastIndex(); idx != 600 {
+		t.Fatalf("bad: %d", idx)
+	}
+	log := new(raft.Log)
+	if err := store.GetLog(256, log); err != nil || log.Index != 256 {
+		t.Fatalf("bad: %#v %v", log, err)
+	}
+	report, err := store.Verify()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !report.OK() || report.Entries != 350 {
+		t.Fatalf("bad: %s", report.String())
+	}
+	store.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(dbLogs+"*", func(key, val string) bool {
+			if len(key) != len(dbLogs)+8 {
+				t.Fatalf("bad: %q", key)
+			}
+			return true
+		})
+	})
+	store.Close()
+
+	// The encoding is detected when reopened
+	store, err = Open(store.path, &Options{KeyEncoding: DecimalKeys})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if store.keys.enc != BinaryKeys {
+		t.Fatalf("bad: %s", store.keys.enc)
+	}
+	if idx, _ := store.LastIndex(); idx != 600 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestLogIndex(t *testing.T) {
+	decimal := &BuntStore{keys: keyLayout{enc: DecimalKeys, logs: dbLogs}}
+	binary := &BuntStore{keys: keyLayout{enc: BinaryKeys, logs: dbLogs}}
+	prefixed := &BuntStore{keys: keyLayout{enc: BinaryKeys, logs: "raftlog:"}}
+	for _, idx := range []uint64{0, 1, 255, 256, 0x3a3a, 1<<64 - 1} {
+		if got := logIndex(decimal.logKey(idx)); got != idx {
+			t.Fatalf("bad: %d != %d", got, idx)
+		}
+		if got := logIndex(binary.logKey(idx)); got != idx {
+			t.Fatalf("bad: %d != %d", got, idx)
+		}
+		if got := logIndex(prefixed.logKey(idx)); got != idx {
+			t.Fatalf("bad: %d != %d", got, idx)
+		}
+	}
+}
+
+func TestParseLogIndex(t *testing.T) {
+	store := &BuntStore{keys: keyLayout{logs: dbLogs}}
+	if idx, err := parseLogIndex(store.logKey(42)); err != nil || idx != 42 {
+		t.Fatalf("bad: %v %d", err, idx)
+	}
+	for _, key := range []string{"l:42", "l:0000000000000000004x"} {
+		var cerr *ErrCorruptValue
+		if _, err := parseLogIndex(key); !errors.As(err, &cerr) || cerr.Key != key {
+			t.Fatalf("bad: %s: %v", key, err)
+		}
+	}
+}
+
+func TestBuntStore_LogKeyRange(t *testing.T) {
+	for _, enc := range []KeyEncoding{DecimalKeys, BinaryKeys} {
+		store := testBuntStoreOpts(t, &Options{KeyEncoding: enc})
+
+		// Auxiliary keys on both sides of the log keys are not visited
+		store.db.Update(func(tx *buntdb.Tx) error {
+			tx.Set("a:aux", "x", nil)
+			tx.Set("z:aux", "x", nil)
+			return nil
+		})
+		if idx, _ := store.LastIndex(); idx != 0 {
+			t.Fatalf("bad: %d", idx)
+		}
+		for _, idx := range []uint64{300, 5, 42} {
+			if err := store.StoreLog(testRaftLog(idx, "log")); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+		if idx, _ := store.FirstIndex(); idx != 5 {
+			t.Fatalf("bad: %d", idx)
+		}
+		if idx, _ := store.LastIndex(); idx != 300 {
+			t.Fatalf("bad: %d", idx)
+		}
+		var seen []uint64
+		store.db.View(func(tx *buntdb.Tx) error {
+			return store.keys.ascendLogs(tx, 6, func(key, val string) bool {
+				seen = append(seen, logIndex(key))
+				return true
+			})
+		})
+		if len(seen) != 2 || seen[0] != 42 || seen[1] != 300 {
+			t.Fatalf("bad: %v", seen)
+		}
+		seen = nil
+		store.db.View(func(tx *buntdb.Tx) error {
+			return store.keys.descendLogs(tx, 299, func(key, val string) bool {
+				seen = append(seen, logIndex(key))
+				return true
+			})
+		})
+		if len(seen) != 2 || seen[0] != 42 || seen[1] != 5 {
+			t.Fatalf("bad: %v", seen)
+		}
+		gaps, err := store.CheckConsistency()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(gaps) != 2 {
+			t.Fatalf("bad: %v", gaps)
+		}
+		store.Close()
+		os.Remove(store.path)
+	}
+}
+
+func TestBuntStore_LogsCorruptValue(t *testing.T) {
+	for _, corrupt := range []func(store *BuntStore) string{
+		// A truncated value
+		func(store *BuntStore) string { return "x" },
+
+		// The value of another log
+		func(store *BuntStore) string {
+			var val string
+			store.db.View(func(tx *buntdb.Tx) error {
+				val, _ = tx.Get(store.logKey(2))
+				return nil
+			})
+			return val
+		},
+	} {
+		store := testBuntStore(t)
+		for i := uint64(1); i <= 10; i++ {
+			if err := store.StoreLog(testRaftLog(i, "log")); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+		val := corrupt(store)
+		store.db.Update(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set(store.logKey(7), val, nil)
+			return err
+		})
+
+		// The log is still scanned in the order of its keys
+		if idx, _ := store.FirstIndex(); idx != 1 {
+			t.Fatalf("bad: %d", idx)
+		}
+		if idx, _ := store.LastIndex(); idx != 10 {
+			t.Fatalf("bad: %d", idx)
+		}
+		gaps, err := store.CheckConsistency()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(gaps) != 0 {
+			t.Fatalf("bad: %v", gaps)
+		}
+		report, err := store.Verify()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(report.Corrupt) != 1 || len(report.Gaps) != 0 || report.LastIndex != 10 {
+			t.Fatalf("bad: %s", report.String())
+		}
+		if size, err := store.LogBytes(8, 10); err != nil || size == 0 {
+			t.Fatalf("bad: %d %v", size, err)
+		}
+		if err := store.TruncateAfter(5); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if idx, _ := store.LastIndex(); idx != 5 {
+			t.Fatalf("bad: %d", idx)
+		}
+		if count, _ := store.LogCount(); count != 5 {
+			t.Fatalf("bad: %d", count)
+		}
+		store.Close()
+		os.Remove(store.path)
+	}
+}
+
+func TestBuntStore_KeyPrefixes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "raft.db")
+	store, err := Open(path, &Options{LogPrefix: "raftlog:", StablePrefix: "raftconf:"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		if err := store.StoreLog(testRaftLog(i, "log")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The default prefixes are left to the application
+	if store.IsReservedKey("l:app") || store.IsReservedKey("c:app") ||
+		!store.IsReservedKey("raftlog:x") || !store.IsReservedKey("m:x") {
+		t.Fatalf("bad: reserved keys")
+	}
+	err = store.Update(func(tx *buntdb.Tx) error {
+		if _, _, err := tx.Set("l:app", "1", nil); err != nil {
+			return err
+		}
+		_, _, err := tx.Set("c:app", "2", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	// Reopening keeps the prefixes the database was created with
+	store, err = Open(path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	stats, err := store.Stats()
+	if err != nil || stats.Logs != 3 || stats.StableKeys != 1 {
+		t.Fatalf("bad: %v %+v", err, stats)
+	}
+	if term, err := store.GetUint64([]byte("CurrentTerm")); err != nil || term != 2 {
+		t.Fatalf("bad: %v %d", err, term)
+	}
+	var log raft.Log
+	if err := store.GetLog(3, &log); err != nil || log.Index != 3 {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+	if _, err := store.Get([]byte("app")); err != ErrKeyNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+	report, err := store.Verify()
+	if err != nil || report.Entries != 3 || len(report.Corrupt) != 0 {
+		t.Fatalf("bad: %v %+v", err, report)
+	}
+	md, err := store.Metadata()
+	if err != nil || md.LogPrefix != "raftlog:" || md.StablePrefix != "raftconf:" {
+		t.Fatalf("bad: %v %+v", err, md)
+	}
+
+	// Reset clears the store's own prefixes, not the defaults
+	if err := store.Reset(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n, _ := store.LogCount(); n != 0 {
+		t.Fatalf("bad: %d logs", n)
+	}
+	err = store.View(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get("l:app"); err != nil {
+			return err
+		}
+		_, err := tx.Get("c:app")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, opts := range []*Options{
+		{LogPrefix: "raft"},
+		{LogPrefix: "raft:log:"},
+		{StablePrefix: "m:"},
+		{LogPrefix: "x:", StablePrefix: "x:"},
+	} {
+		if _, err := Open(filepath.Join(dir, "bad.db"), opts); err == nil {
+			t.Fatalf("bad: %+v opened", opts)
+		}
+		os.Remove(filepath.Join(dir, "bad.db"))
+	}
+}
+
+func TestBuntStore_PlainKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+
+	// Unpadded keys, which sort 1, 10, 11, 12, 2, ...
+	db, err := buntdb.Open(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err = db.Update(func(tx *buntdb.Tx) error {
+		for i := uint64(1); i <= 12; i++ {
+			val, _ := encodeLog(testRaftLog(i, "log"))
+			key := dbLogs + strconv.FormatUint(i, 10)
+			if _, _, err := tx.Set(key, string(val), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	_, err = NewBuntStore(path, Medium)
+	if !errors.Is(err, ErrKeyStyle) || !strings.Contains(err.Error(), "Migrate") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	if err := Migrate(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err := NewBuntStore(path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	first, _ := store.FirstIndex()
+	last, _ := store.LastIndex()
+	if first != 1 || last != 12 {
+		t.Fatalf("bad: %d %d", first, last)
+	}
+	var log raft.Log
+	if err := store.GetLog(10, &log); err != nil || log.Index != 10 {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+}
@@ -0,0 +1,87 @@
+package raftbuntdb
+
+import (
+	"hash/maphash"
+	"io"
+	"os"
+	"strings"
+)
+
+// loadItemOverhead is a rough estimate of the memory buntdb takes for each
+// key on top of the key and value, for its item and the btree nodes of the
+// key and log indexes.
+const loadItemOverhead = 160
+
+// minSetCommand is the length of the shortest set command in a file, of an
+// empty key and value.
+const minSetCommand = len("*3\r\n$3\r\nset\r\n$0\r\n\r\n$0\r\n\r\n")
+
+// checkLoadMemory returns an ErrLoadMemory if loading the file at path is
+// estimated to take more than limit bytes. Each live key takes at most its
+// set command plus the overhead, so the file is only read to add up its
+// live keys and values if it's large enough to go over the limit.
+func checkLoadMemory(path string, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && loadMemoryBound(fi.Size()) <= limit) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	estimate, err := estimateLoadMemory(path)
+	if err != nil {
+		return err
+	}
+	if estimate > limit {
+		return &ErrLoadMemory{Estimate: estimate, Limit: limit}
+	}
+	return nil
+}
+
+// loadMemoryBound returns the most memory a file of size bytes can take
+// once loaded, if it's all set commands of the shortest kind.
+func loadMemoryBound(size int64) int64 {
+	return size + size/minSetCommand*(loadItemOverhead-minSetCommand)
+}
+
+// estimateLoadMemory replays the commands of the file at path and returns
+// the memory the live keys are estimated to take once loaded. Only a hash
+// of each live key is kept, with its size, rather than the key itself. A
+// torn tail is left for the load to report.
+func estimateLoadMemory(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	seed := maphash.MakeSeed()
+	sizes := make(map[uint64]int64)
+	var total int64
+	rd := newAOFReader(f)
+	for {
+		parts, err := rd.next()
+		if err != nil {
+			if err != io.EOF && err != errCorruptAOF {
+				return 0, err
+			}
+			return total, nil
+		}
+		switch strings.ToLower(parts[0]) {
+		case "set":
+			key := maphash.String(seed, parts[1])
+			size := int64(len(parts[1])+len(parts[2])) + loadItemOverhead
+			total += size - sizes[key]
+			sizes[key] = size
+		case "del":
+			key := maphash.String(seed, parts[1])
+			total -= sizes[key]
+			delete(sizes, key)
+		case "flushdb":
+			total = 0
+			sizes = make(map[uint64]int64)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package raftbuntdb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpen_MaxLoadMemory(t *testing.T) {
+	store := testBuntStore(t)
+	path := store.path
+	defer os.Remove(path)
+	data := strings.Repeat("x", 1000)
+	for i := 0; i < 20; i++ {
+		if err := store.Set([]byte("key"), []byte(data)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	store.Close()
+
+	// The file is over the limit, but most of it is dead
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	estimate, err := estimateLoadMemory(path)
+	if err != nil || estimate >= fi.Size()/5 || estimate < int64(len(data)) {
+		t.Fatalf("bad: %v %d %d", err, estimate, fi.Size())
+	}
+	store, err = Open(path, &Options{MaxLoadMemory: fi.Size() / 2})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	_, err = Open(path, &Options{MaxLoadMemory: int64(len(data))})
+	var merr *ErrLoadMemory
+	if !errors.As(err, &merr) || merr.Estimate != estimate || merr.Limit != int64(len(data)) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// The lock isn't held after the failure
+	store, err = Open(path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+}
+
+func TestOpen_MaxLoadMemorySmallKeys(t *testing.T) {
+	store := testBuntStore(t)
+	path := store.path
+	defer os.Remove(path)
+	for i := 0; i < 200; i++ {
+		if err := store.Set([]byte("k"+strconv.Itoa(i)), []byte("v")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	store.Close()
+
+	// The file is under the limit, but its keys take more once loaded
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if loadMemoryBound(fi.Size()) <= fi.Size() {
+		t.Fatalf("bad bound: %d", loadMemoryBound(fi.Size()))
+	}
+	_, err = Open(path, &Options{MaxLoadMemory: fi.Size()})
+	var merr *ErrLoadMemory
+	if !errors.As(err, &merr) || merr.Estimate < 200*loadItemOverhead {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestOpen_Timeout(t *testing.T) {
+	store := testBuntStore(t)
+	store.Close()
+	path := store.path
+	defer os.Remove(path)
+	_, err := Open(path, &Options{OpenTimeout: time.Nanosecond})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("bad: %v", err)
+	}
+	store, err = Open(path, &Options{LockTimeout: 5 * time.Second,
+		OpenTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+}
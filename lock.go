@@ -0,0 +1,101 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned by Open when the database file is held by another
+// process, or by another BuntStore in this process.
+var ErrLocked = errors.New("database is locked")
+
+// errWouldBlock is returned by lockFile when the lock is already held.
+var errWouldBlock = errors.New("lock would block")
+
+// lockRetryInterval is how often a contended lock is retried.
+const lockRetryInterval = 50 * time.Millisecond
+
+// fileLock is an exclusive advisory lock on the sidecar "<path>.lock" file.
+// The lock file holds the PID of the owning process.
+type fileLock struct {
+	path string
+	f    *os.File
+}
+
+// acquireLock locks the database at path, retrying until timeout elapses.
+func acquireLock(path string, timeout time.Duration) (*fileLock, error) {
+	lpath := path + ".lock"
+	deadline := time.Now().Add(timeout)
+	for {
+		l, err := tryLock(lpath)
+		if err == nil {
+			return l, nil
+		}
+		if err != errWouldBlock {
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			if pid := lockHolder(lpath); pid != 0 {
+				return nil, fmt.Errorf("%w: %s is held by pid %d",
+					ErrLocked, path, pid)
+			}
+			return nil, fmt.Errorf("%w: %s is held by another process",
+				ErrLocked, path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func tryLock(lpath string) (*fileLock, error) {
+	f, err := os.OpenFile(lpath, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// The previous holder removes the lock file before unlocking it, so
+	// make sure the file we locked is still the one at lpath.
+	fi1, err1 := f.Stat()
+	fi2, err2 := os.Stat(lpath)
+	if err1 != nil || err2 != nil || !os.SameFile(fi1, fi2) {
+		f.Close()
+		return nil, errWouldBlock
+	}
+	pid := []byte(strconv.Itoa(os.Getpid()) + "\n")
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt(pid, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{path: lpath, f: f}, nil
+}
+
+// lockHolder returns the PID recorded in the lock file, or zero.
+func lockHolder(lpath string) int {
+	data, err := os.ReadFile(lpath)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// release removes the lock file and unlocks it. The nil lock of a
+// read-only store does nothing.
+func (l *fileLock) release() error {
+	if l == nil {
+		return nil
+	}
+	os.Remove(l.path)
+	unlockFile(l.f)
+	return l.f.Close()
+}
@@ -0,0 +1,52 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuntStore_Lock(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// A second open of the same file fails fast
+	_, err := NewBuntStore(store.path, Medium)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected locked error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+		t.Fatalf("expected holder pid in error, got: %v", err)
+	}
+
+	// The lock is released on close
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store2, err := NewBuntStore(store.path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store2.Close()
+}
+
+func TestBuntStore_LockTimeout(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		store.Close()
+	}()
+
+	// Waits for the holder to release the lock
+	store2, err := Open(store.path, &Options{LockTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store2.Close()
+}
@@ -0,0 +1,50 @@
+//go:build windows
+
+package raftbuntdb
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errLockViolation syscall.Errno = 33
+)
+
+// lockOverlapped locks a single byte far past the end of the file, which
+// leaves the PID at the start of the file readable by other processes.
+func lockOverlapped() *syscall.Overlapped {
+	return &syscall.Overlapped{OffsetHigh: 0x7fffffff}
+}
+
+func lockFile(f *os.File) error {
+	r1, _, err := procLockFileEx.Call(f.Fd(),
+		lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0,
+		uintptr(unsafe.Pointer(lockOverlapped())))
+	if r1 == 0 {
+		if err == errLockViolation || err == syscall.ERROR_IO_PENDING {
+			return errWouldBlock
+		}
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	r1, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0,
+		uintptr(unsafe.Pointer(lockOverlapped())))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
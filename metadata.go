@@ -0,0 +1,146 @@
+package raftbuntdb
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const (
+	// createdKey holds the time the database was created.
+	createdKey = dbMeta + "created"
+
+	// libraryKey holds the package and version that created the database.
+	libraryKey = dbMeta + "library"
+
+	// raftKey holds the raft library whose logs the database stores.
+	raftKey = dbMeta + "raft"
+)
+
+// raftLibrary is the raft library this package stores logs for. Forks of
+// this package built for other raft libraries encode logs differently.
+const raftLibrary = "github.com/tidwall/raft"
+
+// packagePath is the import path of this package.
+const packagePath = "github.com/tidwall/raft-buntdb"
+
+// Metadata describes how a database was created. Databases created before
+// the metadata was recorded only have the format fields.
+type Metadata struct {
+	// Created is the time the database was created.
+	Created time.Time
+
+	// Library is the package and version that created the database.
+	Library string
+
+	// Raft is the raft library the database stores logs for.
+	Raft string
+
+	// FormatVersion, KeyEncoding and the prefixes describe the current
+	// format.
+	FormatVersion int
+	KeyEncoding   KeyEncoding
+	LogPrefix     string
+	StablePrefix  string
+}
+
+// Metadata returns the metadata of the database.
+func (b *BuntStore) Metadata() (Metadata, error) {
+	var md Metadata
+	err := b.view(func(tx *buntdb.Tx) error {
+		var err error
+		md, err = readMetadata(tx)
+		return err
+	})
+	return md, err
+}
+
+func readMetadata(tx *buntdb.Tx) (Metadata, error) {
+	var md Metadata
+	var err error
+	if md.FormatVersion, err = readVersion(tx); err != nil {
+		return md, err
+	}
+	keys, err := readKeyLayout(tx)
+	if err != nil {
+		return md, err
+	}
+	md.KeyEncoding, md.LogPrefix, md.StablePrefix = keys.enc, keys.logs, keys.conf
+	vals := []*string{&md.Library, &md.Raft}
+	for i, key := range []string{libraryKey, raftKey} {
+		val, err := tx.Get(key)
+		if err != nil && err != buntdb.ErrNotFound {
+			return md, err
+		}
+		*vals[i] = val
+	}
+	created, err := tx.Get(createdKey)
+	if err == nil {
+		md.Created, err = time.Parse(time.RFC3339Nano, created)
+		if err != nil {
+			return md, fmt.Errorf("%s: %w", createdKey, err)
+		}
+	} else if err != buntdb.ErrNotFound {
+		return md, err
+	}
+	return md, nil
+}
+
+// writeMetadata records the creation of a database.
+func writeMetadata(tx *buntdb.Tx, now time.Time) error {
+	vals := map[string]string{
+		createdKey: now.UTC().Format(time.RFC3339Nano),
+		libraryKey: packagePath + "@" + packageVersion(),
+		raftKey:    raftLibrary,
+	}
+	for key, val := range vals {
+		if _, _, err := tx.Set(key, val, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packageVersion returns the module version of this package from the build
+// information, or "devel" when it isn't known.
+func packageVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == packagePath {
+				return dep.Version
+			}
+		}
+	}
+	return "devel"
+}
+
+// checkRaftLibrary refuses a database created for a different raft
+// library. Databases that don't record one are checked by decoding the
+// first log, whose index must match its key.
+func checkRaftLibrary(tx *buntdb.Tx, logs string) error {
+	lib, err := tx.Get(raftKey)
+	if err == nil {
+		if lib != raftLibrary {
+			return fmt.Errorf("%w: %s", ErrIncompatibleRaft, lib)
+		}
+		return nil
+	}
+	if err != buntdb.ErrNotFound {
+		return err
+	}
+	var ierr error
+	err = tx.AscendGreaterOrEqual("", logs, func(key, val string) bool {
+		if !strings.HasPrefix(key, logs) {
+			return false
+		}
+		if idx := logIndex(key); len(val) < 8 || leUint64(val) != idx {
+			ierr = fmt.Errorf("%w: log %d does not decode",
+				ErrIncompatibleRaft, idx)
+		}
+		return false
+	})
+	return firstErr(err, ierr)
+}
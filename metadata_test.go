@@ -0,0 +1,99 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestBuntStore_Metadata(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{KeyEncoding: BinaryKeys})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	md, err := store.Metadata()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if time.Since(md.Created) > time.Minute || md.Raft != raftLibrary ||
+		!strings.HasPrefix(md.Library, packagePath+"@") ||
+		md.FormatVersion != FormatVersion || md.KeyEncoding != BinaryKeys {
+		t.Fatalf("bad: %#v", md)
+	}
+
+	// The metadata is only written on creation
+	store.Close()
+	store, err = Open(store.path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if md2, _ := store.Metadata(); !md2.Created.Equal(md.Created) {
+		t.Fatalf("bad: %#v", md2)
+	}
+}
+
+// testLegacyDB writes a database without metadata holding one log with
+// the given value.
+func testLegacyDB(t *testing.T, val string) string {
+	store := testBuntStore(t)
+	path := store.path
+	store.Close()
+	os.Remove(path)
+	db, err := buntdb.Open(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(dbLogs+uint64ToString(1), val, nil)
+		return err
+	})
+	db.Close()
+	return path
+}
+
+func TestBuntStore_MetadataLegacy(t *testing.T) {
+	val, _ := encodeLog(testRaftLog(1, "log"))
+	path := testLegacyDB(t, string(val))
+	defer os.Remove(path)
+
+	store, err := NewBuntStore(path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	md, err := store.Metadata()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !md.Created.IsZero() || md.Raft != "" || md.KeyEncoding != DecimalKeys {
+		t.Fatalf("bad: %#v", md)
+	}
+}
+
+func TestBuntStore_IncompatibleRaft(t *testing.T) {
+	// A msgpack encoded log from another raft library
+	path := testLegacyDB(t, "\x84\xa5Index\x01\xa4Term\x01\xa4Type\x00\xa4Data\xc4\x00")
+	defer os.Remove(path)
+	if _, err := NewBuntStore(path, Medium); !errors.Is(err, ErrIncompatibleRaft) {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A recorded library is checked without looking at the logs
+	db, err := buntdb.Open(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(raftKey, "github.com/hashicorp/raft", nil)
+		return err
+	})
+	db.Close()
+	_, err = NewBuntStore(path, Medium)
+	if !errors.Is(err, ErrIncompatibleRaft) || !strings.Contains(err.Error(), "hashicorp") {
+		t.Fatalf("err: %v", err)
+	}
+}
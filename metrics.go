@@ -0,0 +1,133 @@
+package raftbuntdb
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tidwall/raft"
+)
+
+// OpMetrics counts the calls to an operation. Errors doesn't count a
+// missing log or key.
+type OpMetrics struct {
+	Calls        uint64
+	Errors       uint64
+	BytesRead    uint64
+	BytesWritten uint64
+}
+
+// Metrics counts the calls to the raft interfaces, and to Delete, since the
+// store was opened. Bytes are counted as stored, so StoreLogs includes the
+// header of each log. SetUint64 and GetUint64 count as Set and Get.
+type Metrics struct {
+	FirstIndex  OpMetrics
+	LastIndex   OpMetrics
+	GetLog      OpMetrics
+	StoreLogs   OpMetrics
+	DeleteRange OpMetrics
+	Set         OpMetrics
+	Delete      OpMetrics
+	Get         OpMetrics
+}
+
+type opKind int
+
+const (
+	opFirstIndex opKind = iota
+	opLastIndex
+	opGetLog
+	opStoreLogs
+	opDeleteRange
+	opSet
+	opDelete
+	opGet
+	numOps
+)
+
+type opCounters struct {
+	calls, errors, read, written atomic.Uint64
+}
+
+// metrics holds the counters of Metrics.
+type metrics struct {
+	ops [numOps]opCounters
+}
+
+// record counts a call to op.
+func (m *metrics) record(op opKind, err error, read, written int) {
+	c := &m.ops[op]
+	c.calls.Add(1)
+	if err != nil && err != raft.ErrLogNotFound && err != ErrKeyNotFound {
+		c.errors.Add(1)
+	}
+	c.read.Add(uint64(read))
+	c.written.Add(uint64(written))
+}
+
+func (c *opCounters) get() OpMetrics {
+	return OpMetrics{
+		Calls:        c.calls.Load(),
+		Errors:       c.errors.Load(),
+		BytesRead:    c.read.Load(),
+		BytesWritten: c.written.Load(),
+	}
+}
+
+// Metrics returns the operation counters of the store.
+func (b *BuntStore) Metrics() Metrics {
+	m := &b.metrics
+	return Metrics{
+		FirstIndex:  m.ops[opFirstIndex].get(),
+		LastIndex:   m.ops[opLastIndex].get(),
+		GetLog:      m.ops[opGetLog].get(),
+		StoreLogs:   m.ops[opStoreLogs].get(),
+		DeleteRange: m.ops[opDeleteRange].get(),
+		Set:         m.ops[opSet].get(),
+		Delete:      m.ops[opDelete].get(),
+		Get:         m.ops[opGet].get(),
+	}
+}
+
+// published maps the names published with expvar to the open store whose
+// metrics they show. expvar can't unpublish, so a name stays published
+// after its store is closed, showing null, and is reused by the next
+// store opened with it.
+var published struct {
+	mu     sync.Mutex
+	stores map[string]*BuntStore
+}
+
+// publishMetrics publishes the metrics of b under name, unless the name is
+// taken by another expvar.
+func publishMetrics(name string, b *BuntStore) {
+	published.mu.Lock()
+	defer published.mu.Unlock()
+	if published.stores == nil {
+		published.stores = make(map[string]*BuntStore)
+	}
+	if _, ok := published.stores[name]; !ok {
+		if expvar.Get(name) != nil {
+			return
+		}
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			published.mu.Lock()
+			b := published.stores[name]
+			published.mu.Unlock()
+			if b == nil {
+				return nil
+			}
+			return b.Metrics()
+		}))
+	}
+	published.stores[name] = b
+}
+
+// unpublishMetrics stops showing the metrics of b under name.
+func unpublishMetrics(name string, b *BuntStore) {
+	published.mu.Lock()
+	defer published.mu.Unlock()
+	if published.stores[name] == b {
+		published.stores[name] = nil
+	}
+}
@@ -0,0 +1,82 @@
+package raftbuntdb
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Metrics(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	store.StoreLogs([]*raft.Log{testRaftLog(1, "abc"), testRaftLog(2, "de")})
+	var log raft.Log
+	store.GetLog(1, &log)
+	store.GetLog(5, &log)
+	store.FirstIndex()
+	store.LastIndex()
+	store.DeleteRange(1, 1)
+	store.SetUint64([]byte("CurrentTerm"), 12)
+	store.GetUint64([]byte("CurrentTerm"))
+	store.Get([]byte("missing"))
+
+	m := store.Metrics()
+	if m.StoreLogs != (OpMetrics{Calls: 1, BytesWritten: 17*2 + 5}) {
+		t.Fatalf("bad: %+v", m.StoreLogs)
+	}
+	if m.GetLog != (OpMetrics{Calls: 2, BytesRead: 17 + 3}) {
+		t.Fatalf("bad: %+v", m.GetLog)
+	}
+	if m.FirstIndex.Calls != 1 || m.LastIndex.Calls != 1 || m.DeleteRange.Calls != 1 {
+		t.Fatalf("bad: %+v", m)
+	}
+	if m.Set != (OpMetrics{Calls: 1, BytesWritten: 2}) {
+		t.Fatalf("bad: %+v", m.Set)
+	}
+	if m.Get != (OpMetrics{Calls: 2, BytesRead: 2}) {
+		t.Fatalf("bad: %+v", m.Get)
+	}
+
+	// Errors are counted
+	store.Close()
+	store.StoreLogs([]*raft.Log{testRaftLog(3, "abc")})
+	if m := store.Metrics(); m.StoreLogs != (OpMetrics{Calls: 2, Errors: 1, BytesWritten: 39}) {
+		t.Fatalf("bad: %+v", m.StoreLogs)
+	}
+}
+
+func TestBuntStore_Expvar(t *testing.T) {
+	read := func() *Metrics {
+		v := expvar.Get("raftbuntdb_test")
+		if v == nil {
+			t.Fatalf("not published")
+		}
+		var m *Metrics
+		if err := json.Unmarshal([]byte(v.String()), &m); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return m
+	}
+	opts := &Options{ExpvarName: "raftbuntdb_test"}
+	store := testBuntStoreOpts(t, opts)
+	store.StoreLog(testRaftLog(1, "abc"))
+	if m := read(); m == nil || m.StoreLogs.Calls != 1 {
+		t.Fatalf("bad: %+v", m)
+	}
+	store.Close()
+	if m := read(); m != nil {
+		t.Fatalf("bad: %+v", m)
+	}
+
+	// The name is reused by the next store
+	store, err := Open(store.path, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if m := read(); m == nil || m.StoreLogs.Calls != 0 {
+		t.Fatalf("bad: %+v", m)
+	}
+}
@@ -0,0 +1,217 @@
+// Package migrate moves raft logs and stable keys between raft-buntdb and
+// other raft store formats.
+package migrate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/go-msgpack/codec"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+var (
+	// Bucket names used by raft-boltdb
+	boltLogs = []byte("logs")
+	boltConf = []byte("conf")
+)
+
+// Options are used to configure a migration.
+type Options struct {
+	// Durability of the new store.
+	Durability raftbuntdb.Level
+
+	// Uint64Keys are the stable keys holding uint64 values, which are
+	// converted rather than copied as stores disagree on how they're
+	// encoded. Defaults to the uint64 keys used by raft, as for
+	// raftbuntdb.CopyStore.
+	Uint64Keys [][]byte
+
+	// BatchSize is the number of logs written per transaction. Defaults
+	// to 1024.
+	BatchSize int
+}
+
+// copyOptions returns the options of the CopyStore a migration runs.
+func (opts *Options) copyOptions() *raftbuntdb.CopyOptions {
+	return &raftbuntdb.CopyOptions{
+		Uint64Keys: opts.Uint64Keys,
+		BatchSize:  opts.BatchSize,
+	}
+}
+
+// Result describes a completed migration.
+type Result struct {
+	Logs       uint64
+	StableKeys uint64
+	FirstIndex uint64
+	LastIndex  uint64
+}
+
+// MigrateFromBolt copies every log and stable key from the raft-boltdb
+// store at boltPath into a new BuntStore at buntPath, then checks that the
+// new store holds the same number of entries and the same first and last
+// index. The new store is removed if the migration fails.
+func MigrateFromBolt(boltPath, buntPath string, opts *Options) (*Result, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if _, err := os.Stat(buntPath); err == nil {
+		return nil, fmt.Errorf("%s already exists", buntPath)
+	}
+	bdb, err := bolt.Open(boltPath, 0600,
+		&bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	defer bdb.Close()
+	store, err := raftbuntdb.Open(buntPath,
+		&raftbuntdb.Options{Durability: opts.Durability})
+	if err != nil {
+		return nil, err
+	}
+	var res *Result
+	cres, err := raftbuntdb.CopyStore(store, &boltStore{bdb}, opts.copyOptions())
+	if err == nil {
+		res = (*Result)(cres)
+		err = verifyResult(store, res)
+	}
+	if cerr := store.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(buntPath)
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExportToBolt copies every log and stable key from the BuntStore at
+// buntPath into a new raft-boltdb store at boltPath, then checks that the
+// new store holds the same number of entries and the same first and last
+// index. The new store is removed if the export fails. Durability is
+// ignored.
+//
+// The BuntStore is opened read-only with storeOpts, which give its
+// HMACKey and StablePath if it has them, and may be nil. It isn't
+// written or locked, so a store in use by a running node is exported as
+// it was when it was opened.
+func ExportToBolt(buntPath, boltPath string, storeOpts *raftbuntdb.Options,
+	opts *Options) (*Result, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if _, err := os.Stat(buntPath); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(boltPath); err == nil {
+		return nil, fmt.Errorf("%s already exists", boltPath)
+	}
+	var ropts raftbuntdb.Options
+	if storeOpts != nil {
+		ropts = *storeOpts
+	}
+	ropts.ReadOnly = true
+	store, err := raftbuntdb.Open(buntPath, &ropts)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	bdb, err := bolt.Open(boltPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	var res *Result
+	var cres *raftbuntdb.CopyResult
+	err = createBuckets(bdb)
+	if err == nil {
+		cres, err = raftbuntdb.CopyStore(&boltStore{bdb}, store, opts.copyOptions())
+	}
+	if err == nil {
+		res = (*Result)(cres)
+		err = verifyBolt(bdb, res)
+	}
+	if cerr := bdb.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(boltPath)
+		return nil, err
+	}
+	return res, nil
+}
+
+// verifyBolt checks that the bolt store holds what was copied into it.
+func verifyBolt(bdb *bolt.DB, res *Result) error {
+	got := new(Result)
+	err := bdb.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltLogs).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			idx := binary.BigEndian.Uint64(k)
+			if got.Logs == 0 {
+				got.FirstIndex = idx
+			}
+			got.LastIndex = idx
+			got.Logs++
+		}
+		c = tx.Bucket(boltConf).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			got.StableKeys++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *got != *res {
+		return fmt.Errorf("exported store does not match: copied %d logs "+
+			"(%d-%d) and %d keys, found %d logs (%d-%d) and %d keys",
+			res.Logs, res.FirstIndex, res.LastIndex, res.StableKeys,
+			got.Logs, got.FirstIndex, got.LastIndex, got.StableKeys)
+	}
+	return nil
+}
+
+// uint64ToBytes encodes a key or uint64 value the way raft-boltdb does.
+func uint64ToBytes(u uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, u)
+	return buf
+}
+
+// verifyResult checks that the store holds what was copied into it.
+func verifyResult(store *raftbuntdb.BuntStore, res *Result) error {
+	stats, err := store.Stats()
+	if err != nil {
+		return err
+	}
+	if stats.Logs != res.Logs || stats.FirstIndex != res.FirstIndex ||
+		stats.LastIndex != res.LastIndex || stats.StableKeys != res.StableKeys {
+		return fmt.Errorf("migrated store does not match: copied %d logs "+
+			"(%d-%d) and %d keys, found %d logs (%d-%d) and %d keys",
+			res.Logs, res.FirstIndex, res.LastIndex, res.StableKeys,
+			stats.Logs, stats.FirstIndex, stats.LastIndex, stats.StableKeys)
+	}
+	return nil
+}
+
+// decodeMsgPack decodes a value the way raft-boltdb encodes it.
+func decodeMsgPack(buf []byte, out interface{}) error {
+	r := bytes.NewBuffer(buf)
+	hd := codec.MsgpackHandle{}
+	dec := codec.NewDecoder(r, &hd)
+	return dec.Decode(out)
+}
+
+// encodeMsgPack encodes a value the way raft-boltdb encodes it.
+func encodeMsgPack(in interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	hd := codec.MsgpackHandle{}
+	enc := codec.NewEncoder(buf, &hd)
+	err := enc.Encode(in)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,209 @@
+package migrate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+func tempPath(t *testing.T) string {
+	fh, err := ioutil.TempFile("", "migrate")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fh.Close()
+	os.Remove(fh.Name())
+	return fh.Name()
+}
+
+func testBoltStore(t *testing.T, logs []*raft.Log) string {
+	path := tempPath(t)
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists(boltLogs)
+		for _, log := range logs {
+			val, err := encodeMsgPack(log)
+			if err != nil {
+				return err
+			}
+			b.Put(uint64ToBytes(log.Index), val)
+		}
+		b, _ = tx.CreateBucketIfNotExists(boltConf)
+		b.Put([]byte("CurrentTerm"), uint64ToBytes(5))
+		b.Put([]byte("LastVoteCand"), []byte("node1"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return path
+}
+
+func TestMigrateFromBolt(t *testing.T) {
+	var logs []*raft.Log
+	for i := uint64(3); i <= 10; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 2, Data: []byte("log")})
+	}
+	boltPath := testBoltStore(t, logs)
+	defer os.Remove(boltPath)
+	buntPath := tempPath(t)
+	defer os.Remove(buntPath)
+
+	res, err := MigrateFromBolt(boltPath, buntPath, &Options{BatchSize: 3})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.Logs != 8 || res.FirstIndex != 3 || res.LastIndex != 10 ||
+		res.StableKeys != 2 {
+		t.Fatalf("bad: %#v", res)
+	}
+
+	// Refuses to overwrite an existing store
+	if _, err := MigrateFromBolt(boltPath, buntPath, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	store, err := raftbuntdb.NewBuntStore(buntPath, raftbuntdb.Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	for _, log := range logs {
+		result := new(raft.Log)
+		if err := store.GetLog(log.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(log, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+	term, err := store.GetUint64([]byte("CurrentTerm"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if term != 5 {
+		t.Fatalf("bad: %d", term)
+	}
+	cand, err := store.Get([]byte("LastVoteCand"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(cand) != "node1" {
+		t.Fatalf("bad: %q", cand)
+	}
+}
+
+func TestExportToBolt(t *testing.T) {
+	buntPath := tempPath(t)
+	defer os.Remove(buntPath)
+	store, err := raftbuntdb.NewBuntStore(buntPath, raftbuntdb.Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var logs []*raft.Log
+	for i := uint64(3); i <= 10; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 2, Data: []byte("log")})
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.SetUint64([]byte("CurrentTerm"), 5)
+	store.Set([]byte("LastVoteCand"), []byte("node1"))
+	store.Close()
+
+	boltPath := tempPath(t)
+	defer os.Remove(boltPath)
+	res, err := ExportToBolt(buntPath, boltPath, nil, &Options{BatchSize: 3})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.Logs != 8 || res.FirstIndex != 3 || res.LastIndex != 10 ||
+		res.StableKeys != 2 {
+		t.Fatalf("bad: %#v", res)
+	}
+
+	// Refuses to overwrite an existing store
+	if _, err := ExportToBolt(buntPath, boltPath, nil, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	// Round trip back into a new BuntStore
+	buntPath2 := tempPath(t)
+	defer os.Remove(buntPath2)
+	if _, err := MigrateFromBolt(boltPath, buntPath2, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err = raftbuntdb.NewBuntStore(buntPath2, raftbuntdb.Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	for _, log := range logs {
+		result := new(raft.Log)
+		if err := store.GetLog(log.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(log, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+	if term, _ := store.GetUint64([]byte("CurrentTerm")); term != 5 {
+		t.Fatalf("bad: %d", term)
+	}
+}
+
+func TestExportToBolt_StoreOptions(t *testing.T) {
+	dir := t.TempDir()
+	buntPath := filepath.Join(dir, "raft.db")
+	storeOpts := &raftbuntdb.Options{
+		StablePath: filepath.Join(dir, "stable.db"),
+		HMACKey:    raftbuntdb.StaticKey("secret"),
+	}
+	store, err := raftbuntdb.Open(buntPath, storeOpts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		log := &raft.Log{Index: i, Term: 1, Data: []byte("log")}
+		if err := store.StoreLog(log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	store.SetUint64([]byte("CurrentTerm"), 5)
+	store.Close()
+	before, err := ioutil.ReadFile(buntPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	res, err := ExportToBolt(buntPath, filepath.Join(dir, "raft.bolt"), storeOpts, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.Logs != 3 || res.StableKeys != 1 {
+		t.Fatalf("bad: %#v", res)
+	}
+
+	// The source is left as it was, without a lock file
+	after, err := ioutil.ReadFile(buntPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("source changed")
+	}
+	if _, err := os.Stat(buntPath + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package migrate
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/boltdb/bolt"
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+// errNotUint64 is returned by GetUint64 for a value that isn't 8 bytes.
+var errNotUint64 = errors.New("value is not a uint64")
+
+// boltStore is a raftbuntdb.Store over a database in the raft-boltdb
+// format, so that stores are copied to and from it by CopyStore.
+type boltStore struct {
+	db *bolt.DB
+}
+
+var _ raftbuntdb.Store = (*boltStore)(nil)
+
+// createBuckets creates the buckets of a new raft-boltdb store, which
+// raft-boltdb expects to find whether or not they hold anything.
+func createBuckets(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltLogs, boltConf} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) FirstIndex() (uint64, error) {
+	var idx uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(boltLogs); b != nil {
+			if k, _ := b.Cursor().First(); k != nil {
+				idx = binary.BigEndian.Uint64(k)
+			}
+		}
+		return nil
+	})
+	return idx, err
+}
+
+func (s *boltStore) LastIndex() (uint64, error) {
+	var idx uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(boltLogs); b != nil {
+			if k, _ := b.Cursor().Last(); k != nil {
+				idx = binary.BigEndian.Uint64(k)
+			}
+		}
+		return nil
+	})
+	return idx, err
+}
+
+func (s *boltStore) GetLog(idx uint64, log *raft.Log) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		var val []byte
+		if b := tx.Bucket(boltLogs); b != nil {
+			val = b.Get(uint64ToBytes(idx))
+		}
+		if val == nil {
+			return raft.ErrLogNotFound
+		}
+		return decodeMsgPack(val, log)
+	})
+}
+
+func (s *boltStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+func (s *boltStore) StoreLogs(logs []*raft.Log) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(boltLogs)
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			val, err := encodeMsgPack(log)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(uint64ToBytes(log.Index), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) DeleteRange(min, max uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltLogs)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, _ := c.Seek(uint64ToBytes(min)); k != nil; k, _ = c.Next() {
+			if binary.BigEndian.Uint64(k) > max {
+				break
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Set(key, val []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(boltConf)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, val)
+	})
+}
+
+func (s *boltStore) Get(key []byte) ([]byte, error) {
+	var val []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(boltConf); b != nil {
+			if v := b.Get(key); v != nil {
+				val = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	if err == nil && val == nil {
+		err = raftbuntdb.ErrKeyNotFound
+	}
+	return val, err
+}
+
+func (s *boltStore) SetUint64(key []byte, val uint64) error {
+	return s.Set(key, uint64ToBytes(val))
+}
+
+func (s *boltStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(val) != 8 {
+		return 0, errNotUint64
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+// StableKeys returns every stable key, so that CopyStore copies them all.
+func (s *boltStore) StableKeys() ([][]byte, error) {
+	var keys [][]byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltConf)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		})
+	})
+	return keys, err
+}
@@ -0,0 +1,218 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/tidwall/raft"
+)
+
+// MirrorStore writes to two stores and reads from the primary. It is used
+// to migrate a live raft node between storage backends: run with the new
+// backend as the secondary until Verify reports no differences, then
+// switch over.
+type MirrorStore struct {
+	primary   *BuntStore
+	secondary Store
+}
+
+// NewMirrorStore returns a store that mirrors every write to primary into
+// secondary. The secondary should start out as a copy of the primary, see
+// CopyStore.
+func NewMirrorStore(primary *BuntStore, secondary Store) *MirrorStore {
+	return &MirrorStore{primary: primary, secondary: secondary}
+}
+
+// mirror runs a write against the primary and then the secondary. The
+// secondary is only written when the primary succeeds.
+func (m *MirrorStore) mirror(fn func(s Store) error) error {
+	if err := fn(m.primary); err != nil {
+		return err
+	}
+	if err := fn(m.secondary); err != nil {
+		return fmt.Errorf("secondary: %w", err)
+	}
+	return nil
+}
+
+// FirstIndex returns the first known index from the primary.
+func (m *MirrorStore) FirstIndex() (uint64, error) {
+	return m.primary.FirstIndex()
+}
+
+// LastIndex returns the last known index from the primary.
+func (m *MirrorStore) LastIndex() (uint64, error) {
+	return m.primary.LastIndex()
+}
+
+// GetLog is used to retrieve a log from the primary at a given index.
+func (m *MirrorStore) GetLog(idx uint64, log *raft.Log) error {
+	return m.primary.GetLog(idx, log)
+}
+
+// StoreLog is used to store a single raft log in both stores.
+func (m *MirrorStore) StoreLog(log *raft.Log) error {
+	return m.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs is used to store a set of raft logs in both stores.
+func (m *MirrorStore) StoreLogs(logs []*raft.Log) error {
+	return m.mirror(func(s Store) error { return s.StoreLogs(logs) })
+}
+
+// DeleteRange is used to delete logs within a given range inclusively
+// from both stores.
+func (m *MirrorStore) DeleteRange(min, max uint64) error {
+	return m.mirror(func(s Store) error { return s.DeleteRange(min, max) })
+}
+
+// Set is used to set a key/value in both stores.
+func (m *MirrorStore) Set(k, v []byte) error {
+	return m.mirror(func(s Store) error { return s.Set(k, v) })
+}
+
+// Get is used to retrieve a value from the primary.
+func (m *MirrorStore) Get(k []byte) ([]byte, error) {
+	return m.primary.Get(k)
+}
+
+// SetUint64 is like Set, but handles uint64 values
+func (m *MirrorStore) SetUint64(key []byte, val uint64) error {
+	return m.mirror(func(s Store) error { return s.SetUint64(key, val) })
+}
+
+// GetUint64 is like Get, but handles uint64 values
+func (m *MirrorStore) GetUint64(key []byte) (uint64, error) {
+	return m.primary.GetUint64(key)
+}
+
+// Peers returns raft peers from the primary.
+func (m *MirrorStore) Peers() ([]string, error) {
+	return m.primary.Peers()
+}
+
+// SetPeers sets raft peers in both stores, with SetPeers if the secondary
+// has it.
+func (m *MirrorStore) SetPeers(peers []string) error {
+	data, err := json.Marshal(peers)
+	if err != nil {
+		return err
+	}
+	return m.mirror(func(s Store) error {
+		if ps, ok := s.(interface{ SetPeers([]string) error }); ok {
+			return ps.SetPeers(peers)
+		}
+		return s.Set([]byte("peers"), data)
+	})
+}
+
+// MirrorReport is the result of comparing the two stores of a MirrorStore.
+type MirrorReport struct {
+	// FirstIndex and LastIndex hold the primary's and secondary's index.
+	FirstIndex [2]uint64
+	LastIndex  [2]uint64
+
+	// Logs holds the indexes of logs that are missing from or differ in
+	// the secondary.
+	Logs []uint64
+
+	// StableKeys holds the stable keys that are missing from or differ in
+	// the secondary.
+	StableKeys []string
+}
+
+// OK returns true if the stores hold the same data.
+func (r *MirrorReport) OK() bool {
+	return r.FirstIndex[0] == r.FirstIndex[1] &&
+		r.LastIndex[0] == r.LastIndex[1] &&
+		len(r.Logs) == 0 && len(r.StableKeys) == 0
+}
+
+func (r *MirrorReport) String() string {
+	return fmt.Sprintf("first=%d/%d last=%d/%d logs=%d stable_keys=%d",
+		r.FirstIndex[0], r.FirstIndex[1], r.LastIndex[0], r.LastIndex[1],
+		len(r.Logs), len(r.StableKeys))
+}
+
+// Verify compares every log and stable key in the primary with the
+// secondary. Differences are recorded in the report; the error is only
+// for failures to read either store. Writes made while Verify runs may be
+// reported as differences.
+func (m *MirrorStore) Verify() (MirrorReport, error) {
+	var report MirrorReport
+	var err error
+	stores := [2]Store{m.primary, m.secondary}
+	for i, s := range stores {
+		if report.FirstIndex[i], err = s.FirstIndex(); err != nil {
+			return report, err
+		}
+		if report.LastIndex[i], err = s.LastIndex(); err != nil {
+			return report, err
+		}
+	}
+	var serr error
+	err = m.primary.AscendLogGreaterOrEqual(0, func(plog *raft.Log) bool {
+		var slog raft.Log
+		if serr = m.secondary.GetLog(plog.Index, &slog); serr != nil {
+			if serr != raft.ErrLogNotFound {
+				return false
+			}
+			serr = nil
+			report.Logs = append(report.Logs, plog.Index)
+		} else if !reflect.DeepEqual(*plog, slog) {
+			report.Logs = append(report.Logs, plog.Index)
+		}
+		return true
+	})
+	if err = firstErr(err, serr); err != nil {
+		return report, err
+	}
+	keys, err := m.primary.StableKeys()
+	if err != nil {
+		return report, err
+	}
+	for _, key := range keys {
+		same, err := m.sameStable(key)
+		if err != nil {
+			return report, err
+		}
+		if !same {
+			report.StableKeys = append(report.StableKeys, string(key))
+		}
+	}
+	return report, nil
+}
+
+// sameStable reports whether a stable key has the same value in both
+// stores. Uint64 keys are compared by value because stores encode them
+// differently.
+func (m *MirrorStore) sameStable(key []byte) (bool, error) {
+	if isStableUint64Key(key) {
+		pval, err := m.primary.GetUint64(key)
+		if err != nil {
+			return false, err
+		}
+		sval, err := m.secondary.GetUint64(key)
+		if err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return pval == sval, nil
+	}
+	pval, err := m.primary.Get(key)
+	if err != nil {
+		return false, err
+	}
+	sval, err := m.secondary.Get(key)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(pval, sval), nil
+}
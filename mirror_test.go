@@ -0,0 +1,74 @@
+package raftbuntdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestMirrorStore(t *testing.T) {
+	primary := testBuntStore(t)
+	defer primary.Close()
+	defer os.Remove(primary.path)
+	secondary := testBuntStore(t)
+	defer secondary.Close()
+	defer os.Remove(secondary.path)
+
+	var _ raft.LogStore = &MirrorStore{}
+	var _ raft.StableStore = &MirrorStore{}
+	var _ raft.PeerStore = &MirrorStore{}
+
+	m := NewMirrorStore(primary, secondary)
+	var logs []*raft.Log
+	for i := uint64(1); i <= 5; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := m.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := m.SetUint64([]byte("CurrentTerm"), 3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := m.SetPeers([]string{"a", "b"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := m.DeleteRange(1, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	report, err := m.Verify()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("bad: %s", report.String())
+	}
+	if idx, _ := secondary.FirstIndex(); idx != 3 {
+		t.Fatalf("bad: %d", idx)
+	}
+	if peers, _ := secondary.Peers(); len(peers) != 2 {
+		t.Fatalf("bad: %v", peers)
+	}
+
+	// Differences in the secondary are reported
+	secondary.DeleteRange(5, 5)
+	secondary.StoreLog(testRaftLog(4, "changed"))
+	secondary.SetUint64([]byte("CurrentTerm"), 4)
+	report, err = m.Verify()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if report.OK() || report.LastIndex[1] != 4 || len(report.Logs) != 2 ||
+		len(report.StableKeys) != 1 || report.StableKeys[0] != "CurrentTerm" {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	// Failed writes to the secondary are returned
+	secondary.Close()
+	if err := m.Set([]byte("foo"), []byte("bar")); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if val, err := m.Get([]byte("foo")); err != nil || string(val) != "bar" {
+		t.Fatalf("bad: %q %v", val, err)
+	}
+}
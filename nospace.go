@@ -0,0 +1,135 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrNoSpace is returned by writes while the store is degraded after the
+// disk filled up.
+var ErrNoSpace = errors.New("no space left on device")
+
+// NoSpacePolicy makes the store stop writing when a write fails because
+// the disk is full, rather than keep appending to the file while raft
+// retries. Writes fail with ErrNoSpace until a probe finds that space has
+// been freed and the database verifies, and reads keep working.
+type NoSpacePolicy struct {
+	// ProbeInterval is how often a degraded store checks for free space.
+	// Defaults to 10 seconds.
+	ProbeInterval time.Duration
+
+	// ProbeSize is the number of bytes that must be writable next to the
+	// database to re-enable writes. Defaults to 1MB.
+	ProbeSize int64
+
+	// OnChange is called when the store enters or leaves the degraded
+	// mode. Optional.
+	OnChange func(degraded bool)
+}
+
+func (p *NoSpacePolicy) probeInterval() time.Duration {
+	if p.ProbeInterval <= 0 {
+		return 10 * time.Second
+	}
+	return p.ProbeInterval
+}
+
+func (p *NoSpacePolicy) probeSize() int64 {
+	if p.ProbeSize <= 0 {
+		return 1024 * 1024
+	}
+	return p.ProbeSize
+}
+
+// isNoSpace reports whether err is caused by a full disk.
+func isNoSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// checkNoSpace returns ErrNoSpace if the store is degraded.
+func (b *BuntStore) checkNoSpace() error {
+	if b.opts.NoSpace != nil && b.health.isDegraded() {
+		return ErrNoSpace
+	}
+	return nil
+}
+
+// noSpace puts the store into the degraded mode after err, returning the
+// error for the caller.
+func (b *BuntStore) noSpace(err error) error {
+	if b.health.setDegraded(true) && b.opts.NoSpace.OnChange != nil {
+		b.opts.NoSpace.OnChange(true)
+	}
+	return fmt.Errorf("%w: %w", ErrNoSpace, err)
+}
+
+// runNoSpaceProbe periodically checks a degraded store for free space
+// until the store is closed.
+func (b *BuntStore) runNoSpaceProbe() {
+	t := time.NewTicker(b.opts.NoSpace.probeInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-t.C:
+		}
+		if b.health.isDegraded() {
+			b.CheckSpace()
+		}
+	}
+}
+
+// CheckSpace re-enables writes on a store degraded by a full disk, if
+// there is space again. The database is reopened, which truncates a torn
+// write left by the failure, and verified before writes are accepted. It
+// returns nil if the store is not degraded.
+func (b *BuntStore) CheckSpace() error {
+	if b.opts.NoSpace == nil || !b.health.isDegraded() {
+		return nil
+	}
+	if err := probeSpace(b.path+".probe", b.opts.NoSpace.probeSize()); err != nil {
+		return err
+	}
+	if err := b.reopen(); err != nil {
+		return err
+	}
+	report, err := b.Verify()
+	if err != nil {
+		return err
+	}
+	if !report.OK() {
+		return fmt.Errorf("verify: %s", report.String())
+	}
+	if b.health.setDegraded(false) && b.opts.NoSpace.OnChange != nil {
+		b.opts.NoSpace.OnChange(false)
+	}
+	return nil
+}
+
+// probeSpace checks that size bytes can be written and synced to path.
+// The file is removed afterwards.
+func probeSpace(path string, size int64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	buf := make([]byte, 64*1024)
+	for n := int64(0); n < size && err == nil; n += int64(len(buf)) {
+		if size-n < int64(len(buf)) {
+			buf = buf[:size-n]
+		}
+		_, err = f.Write(buf)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
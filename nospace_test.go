@@ -0,0 +1,89 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_NoSpace(t *testing.T) {
+	var changes []bool
+	store := testBuntStoreOpts(t, &Options{
+		NoSpace: &NoSpacePolicy{
+			ProbeInterval: time.Hour,
+			ProbeSize:     100 * 1024,
+			OnChange: func(degraded bool) {
+				changes = append(changes, degraded)
+			},
+		},
+	})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A full disk degrades the store
+	errFull := &os.PathError{Op: "write", Path: store.path, Err: syscall.ENOSPC}
+	err := store.recovering(func() (bool, error) { return true, errFull })
+	if !errors.Is(err, ErrNoSpace) || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("err: %v", err)
+	}
+	if err := store.StoreLog(testRaftLog(2, "log")); err != ErrNoSpace {
+		t.Fatalf("err: %v", err)
+	}
+	if err := store.Set([]byte("key"), []byte("val")); err != ErrNoSpace {
+		t.Fatalf("err: %v", err)
+	}
+	if err := store.Shrink(); err != ErrNoSpace {
+		t.Fatalf("err: %v", err)
+	}
+	h := store.Health()
+	if h.OK() || !h.Degraded || !h.Failed {
+		t.Fatalf("bad: %#v", h)
+	}
+
+	// Reads keep working
+	var log raft.Log
+	if err := store.GetLog(1, &log); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The probe finds space and writes are re-enabled
+	if err := store.CheckSpace(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if h := store.Health(); !h.OK() {
+		t.Fatalf("bad: %#v", h)
+	}
+	if _, err := os.Stat(store.path + ".probe"); !os.IsNotExist(err) {
+		t.Fatalf("err: %v", err)
+	}
+	if err := store.StoreLog(testRaftLog(2, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Fatalf("bad: %v", changes)
+	}
+	checkCounter(t, store)
+}
+
+func TestBuntStore_NoSpaceDisabled(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	errFull := &os.PathError{Op: "write", Path: store.path, Err: syscall.ENOSPC}
+	err := store.recovering(func() (bool, error) { return true, errFull })
+	if err != errFull {
+		t.Fatalf("err: %v", err)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
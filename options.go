@@ -0,0 +1,257 @@
+package raftbuntdb
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Options are used to configure a BuntStore opened with Open.
+type Options struct {
+	// Durability controls how often the underlying file is fsynced.
+	Durability Level
+
+	// StablePath, if set, keeps the stable store in a database file of
+	// its own at this path, synced on every write whatever Durability is
+	// set to, so that the votes raft must not lose don't force the same
+	// fsync policy on the bulk of the log. Stable keys already in the log
+	// file are moved over when the store is opened. Backup and the
+	// restores only cover the log file. BackupSince includes the stable
+	// keys, which ApplyIncremental writes to the stable file.
+	StablePath string
+
+	// FileMode is the mode a new database file is created with. Defaults
+	// to 0600. The mode is set as given regardless of the umask. The file
+	// is created and its directory synced before it is opened.
+	FileMode os.FileMode
+
+	// DirMode, if set, creates the missing parent directories of the
+	// database with the given mode, regardless of the umask. Otherwise
+	// the directory must exist.
+	DirMode os.FileMode
+
+	// ReadOnly opens an existing database for inspection without writing
+	// to it. The file, and the one at StablePath, is loaded into memory
+	// and not kept open. No lock is taken, so the file of a running node
+	// can be read; it's a snapshot of what was written at the time. A
+	// tail cut short by a crash, or by a write in progress, is left out
+	// rather than truncated, and every write fails with ErrReadOnly.
+	ReadOnly bool
+
+	// KeyEncoding selects how log indexes are encoded in keys when a new
+	// database is created. Existing databases keep their encoding.
+	KeyEncoding KeyEncoding
+
+	// LogPrefix and StablePrefix, if set, replace the "l:" and "c:" key
+	// prefixes of the logs and the stable store when a new database is
+	// created, such as to keep them apart from application keys in the
+	// same file. Like KeyEncoding, they're recorded in the database, which
+	// keeps its prefixes when reopened. Each must end in its only ':' and
+	// not be another prefix reserved by the store.
+	LogPrefix    string
+	StablePrefix string
+
+	// LockTimeout is how long Open keeps retrying when the database is
+	// locked by another process. Zero fails immediately.
+	LockTimeout time.Duration
+
+	// CloseTimeout is how long Close waits for the calls in flight on
+	// other goroutines before it returns ErrCloseTimeout. Zero waits for
+	// as long as they take.
+	CloseTimeout time.Duration
+
+	// OpenTimeout, if set, makes Open give up loading the file after this
+	// long, as OpenContext does, returning context.DeadlineExceeded. It
+	// doesn't include the time spent waiting for the lock.
+	OpenTimeout time.Duration
+
+	// MaxLoadMemory, if set, makes Open fail with an ErrLoadMemory rather
+	// than load a file whose keys and values are estimated to take more
+	// memory than this, such as the memory limit of a container, so that
+	// the process isn't killed halfway through.
+	MaxLoadMemory int64
+
+	// OnOpenProgress, if set, is called as Open goes through each
+	// OpenPhase and every OpenProgressInterval while the file loads, so
+	// that a supervisor can tell a store that is loading a large file
+	// from one that is stuck. It's called on the goroutine of Open.
+	OnOpenProgress func(OpenProgress)
+
+	// OpenProgressInterval is how often OnOpenProgress is called while
+	// the file loads. Defaults to a second.
+	OpenProgressInterval time.Duration
+
+	// RecoverCorruptTail truncates a database file that ends with a torn
+	// write, such as after a power loss, instead of failing to open. The
+	// original file is saved to "<path>.bak" before it's truncated.
+	RecoverCorruptTail bool
+
+	// StrictAppend makes StoreLogs reject batches that are not contiguous
+	// or that would leave a hole after the existing log, returning an
+	// ErrNonContiguous.
+	StrictAppend bool
+
+	// Retention enables a background goroutine that deletes old logs
+	// according to the policy.
+	Retention *RetentionPolicy
+
+	// TermIndex maintains an index on the term of each log, so that
+	// LogsByTerm and LastIndexOfTerm don't scan the whole log.
+	TermIndex bool
+
+	// GroupCommit, if set, coalesces concurrent StoreLogs calls into a
+	// single transaction and fsync.
+	GroupCommit *GroupCommit
+
+	// ZeroCopy avoids copying log data between the store and raft.Log.
+	// Logs returned by GetLog share memory with the database and must
+	// not be modified, and logs passed to StoreLogs are encoded into a
+	// buffer that is handed to the database rather than copied again.
+	// GetLogBuffer still copies into its buffer.
+	ZeroCopy bool
+
+	// ReuseLogData makes GetLog decode the data into the capacity of the
+	// Data slice of the log it's passed, as GetLogBuffer does with its
+	// buffer, so that a caller reading many logs into the same raft.Log
+	// doesn't allocate for each of them. The previous data is overwritten,
+	// so it must not be kept. It's ignored with ZeroCopy, whose data must
+	// not be written to.
+	ReuseLogData bool
+
+	// ChunkSize, if set, splits the data of logs larger than it into
+	// chunks of at most this many bytes, each stored under a key of its
+	// own, so that a multi-megabyte entry doesn't become a single huge
+	// value. Reads put the chunks back together. Chunked logs are read
+	// whatever the option is set to, but not by versions of this package
+	// that predate it.
+	ChunkSize int
+
+	// Blobs, if set, holds the data of logs larger than BlobThreshold, so
+	// that the database file only stores a pointer to it and a checksum.
+	// Backups of the store hold the pointers, not the data. See
+	// DirBlobStore.
+	Blobs BlobStore
+
+	// BlobThreshold is the size above which log data goes to Blobs.
+	// Defaults to 1 MiB.
+	BlobThreshold int
+
+	// TxnLimit, if set, splits the batches passed to StoreLogs into
+	// transactions of a bounded size.
+	TxnLimit *TxnLimit
+
+	// LogCache, if set, keeps this many of the logs most recently stored
+	// in memory for GetLog, as raft.NewLogCache does. See
+	// NewCachedBuntStore.
+	LogCache int
+
+	// LenientUint64 makes GetUint64 read a value that doesn't parse as
+	// zero rather than return an ErrCorruptValue. A term or vote read as
+	// zero can break raft's safety, so it's only for getting a damaged
+	// node to start.
+	LenientUint64 bool
+
+	// ReadAhead, if set, detects a reader calling GetLog for consecutive
+	// indexes, such as raft replicating to a follower that is catching
+	// up, and prefetches this many of the following logs in the same
+	// transaction.
+	ReadAhead int
+
+	// DecodeWorkers, if more than one, decodes the logs passed to the
+	// iteration methods such as AscendLogRange on this many goroutines,
+	// in batches, while the transaction reads the next ones, so that a
+	// scan of a large range isn't bound to one core. The logs are still
+	// passed to the iterator in order.
+	DecodeWorkers int
+
+	// HMACKey, if set, authenticates every log with an HMAC-SHA256 keyed
+	// by the provider's key, so that a log altered on disk fails to read
+	// with ErrTampered. Logs without a MAC fail to read too, so it should
+	// be set on a new store.
+	HMACKey KeyProvider
+
+	// Scrub, if set, enables a background goroutine that checks a sample
+	// of the logs at each interval and quarantines the corrupt ones.
+	Scrub *ScrubPolicy
+
+	// Recovery, if set, retries writes that fail with a transient error,
+	// reopening the database if needed.
+	Recovery *RecoveryPolicy
+
+	// NoSpace, if set, stops writes when the disk is full until space is
+	// freed.
+	NoSpace *NoSpacePolicy
+
+	// AutoShrink, if set, keeps buntdb's own automatic shrink enabled
+	// with the given thresholds. It is disabled otherwise, as shrinking
+	// is better done after compaction, such as by OnSnapshot.
+	AutoShrink *AutoShrink
+
+	// MaintenanceRate, if set, limits the bytes per second written by
+	// Shrink, ShrinkAsync and Backup, so that they don't starve the
+	// writes to the log on the same disk. Shrink and Backup then copy the
+	// keys a chunk at a time, as ShrinkAsync does.
+	MaintenanceRate int64
+
+	// MaxViewDuration, if set, bounds how long Verify, CheckConsistency
+	// and Backup hold a read transaction, which the appends to the log
+	// wait for. A scan that runs longer ends its transaction and resumes
+	// after its last key in a new one, once the waiting writes are done.
+	// The scan then doesn't see a single point in time: logs written or
+	// deleted while it runs may or may not be seen. Backup copies the
+	// keys a chunk at a time, as with MaintenanceRate.
+	MaxViewDuration time.Duration
+
+	// RateLimit, if set, caps the rate of writes and reads. It can be
+	// changed with SetRateLimit.
+	RateLimit *RateLimit
+
+	// Backpressure, if set, stalls the store when the logs written with
+	// Low or Medium durability aren't synced as fast as they come.
+	Backpressure *Backpressure
+
+	// ShrinkSchedule, if set, defers the shrinks made by OnSnapshot to
+	// maintenance windows.
+	ShrinkSchedule *ShrinkSchedule
+
+	// ExpvarName, if set, publishes the store's Metrics with expvar under
+	// this name, such as "raftbuntdb".
+	ExpvarName string
+
+	// Indexes are created on the database each time it is opened,
+	// including when the store reopens it, so that application keys in
+	// the same file can be queried through View.
+	Indexes []Index
+
+	// Audit, if set, records the changes to the stable store in an audit
+	// log read with AuditLog.
+	Audit *AuditPolicy
+
+	// Hooks, if set, are called after writes commit.
+	Hooks *Hooks
+
+	// Archiver, if set, receives the logs removed by DeleteRange and by
+	// compaction before they are deleted.
+	Archiver Archiver
+
+	// Trace, if set, records each call to StoreLogs, DeleteRange, Set and
+	// Delete, and thus StoreLog and SetUint64, with its outcome, in a
+	// compact binary trace that ReplayTrace runs against another store, so
+	// that a bad state can be reproduced. The recorded calls are serialized. A
+	// failed write stops the trace, and the error is returned by Close.
+	// The writes the store makes on its own, such as for Retention, are
+	// not recorded.
+	Trace io.Writer
+}
+
+// DefaultOptions are the options used when Open is passed nil.
+var DefaultOptions = &Options{
+	Durability: Medium,
+}
+
+func (o *Options) fileMode() os.FileMode {
+	if o.FileMode == 0 {
+		return dbFileMode
+	}
+	return o.FileMode
+}
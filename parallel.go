@@ -0,0 +1,114 @@
+package raftbuntdb
+
+import (
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// decodeBatch is the number of logs a decode worker takes at a time.
+const decodeBatch = 128
+
+// rawLog is a log value read by the transaction, waiting to be decoded.
+type rawLog struct {
+	key, val string
+
+	// read is set when the data of a chunked log was already read back
+	// in, which needs the transaction, and err if that failed.
+	read bool
+	err  error
+}
+
+// decodeJob is a batch of logs decoded by a worker.
+type decodeJob struct {
+	raw  []rawLog
+	logs []*raft.Log
+	err  error
+	done chan struct{}
+}
+
+// run decodes the batch up to the first corrupt log.
+func (j *decodeJob) run(b *BuntStore) {
+	defer close(j.done)
+	for _, raw := range j.raw {
+		idx := logIndex(raw.key)
+		val, err := raw.val, raw.err
+		if !raw.read {
+			// Not chunked, so the transaction isn't needed
+			val, err = b.readLog(nil, raw.key, val)
+		}
+		log := new(raft.Log)
+		if err == nil {
+			err = decodeLog(idx, val, log)
+		}
+		if err != nil {
+			j.err = corruptEntry(idx, val, err)
+			return
+		}
+		j.logs = append(j.logs, log)
+	}
+}
+
+// visitLogsParallel is like visitLogs, but the logs are decoded by up to
+// Options.DecodeWorkers goroutines, a batch each, while the transaction
+// reads the next ones. They are passed to iter in order, on the goroutine
+// of the iteration.
+func (b *BuntStore) visitLogsParallel(tx *buntdb.Tx, match func(idx uint64, val string) bool,
+	iter func(log *raft.Log) bool) (func(key, val string) bool, func() error) {
+	var batch []rawLog
+	var queue []*decodeJob
+	var stopped bool
+	var err error
+
+	// deliver waits for the oldest job and passes its logs to iter
+	deliver := func() {
+		job := queue[0]
+		queue = queue[1:]
+		<-job.done
+		if stopped || err != nil {
+			return
+		}
+		for _, log := range job.logs {
+			if !iter(log) {
+				stopped = true
+				return
+			}
+		}
+		err = job.err
+	}
+	dispatch := func() {
+		job := &decodeJob{raw: batch, done: make(chan struct{})}
+		batch = nil
+		queue = append(queue, job)
+		go job.run(b)
+	}
+	visit := func(key, val string) bool {
+		idx := logIndex(key)
+		if !match(idx, val) {
+			return true
+		}
+		raw := rawLog{key: key, val: val}
+		if isChunked(val) {
+			raw.val, raw.err = b.readLog(tx, key, val)
+			raw.read = true
+		}
+		batch = append(batch, raw)
+		if len(batch) < decodeBatch {
+			return true
+		}
+		dispatch()
+		for len(queue) >= b.opts.DecodeWorkers {
+			deliver()
+		}
+		return !stopped && err == nil
+	}
+	finish := func() error {
+		if len(batch) > 0 && !stopped && err == nil {
+			dispatch()
+		}
+		for len(queue) > 0 {
+			deliver()
+		}
+		return err
+	}
+	return visit, finish
+}
@@ -0,0 +1,85 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_DecodeWorkers(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{DecodeWorkers: 4, ChunkSize: 8})
+	defer os.Remove(store.path)
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 1000; i++ {
+		data := "log" + strconv.Itoa(int(i))
+		if i%7 == 0 {
+			data += " with chunks"
+		}
+		logs = append(logs, testRaftLog(i, data))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	check := func(log *raft.Log) {
+		t.Helper()
+		want := logs[log.Index-1]
+		if string(log.Data) != string(want.Data) {
+			t.Fatalf("bad: %d %q", log.Index, log.Data)
+		}
+	}
+
+	next := uint64(10)
+	err := store.AscendLogRange(10, 900, func(log *raft.Log) bool {
+		if log.Index != next {
+			t.Fatalf("bad: %d, want %d", log.Index, next)
+		}
+		check(log)
+		next++
+		return true
+	})
+	if err != nil || next != 901 {
+		t.Fatalf("bad: %v %d", err, next)
+	}
+	next = 1000
+	err = store.DescendLogLessOrEqual(1000, func(log *raft.Log) bool {
+		if log.Index != next {
+			t.Fatalf("bad: %d, want %d", log.Index, next)
+		}
+		check(log)
+		next--
+		return log.Index > 300
+	})
+	if err != nil || next != 299 {
+		t.Fatalf("bad: %v %d", err, next)
+	}
+
+	// The logs before a corrupt one are passed on first
+	err = store.db.Update(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(store.logKey(500))
+		if err != nil {
+			return err
+		}
+		_, _, err = tx.Set(store.logKey(500), val[:10], nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	next = 1
+	err = store.AscendLogGreaterOrEqual(1, func(log *raft.Log) bool {
+		if log.Index != next {
+			t.Fatalf("bad: %d, want %d", log.Index, next)
+		}
+		next++
+		return true
+	})
+	var cerr *ErrCorruptEntry
+	if !errors.As(err, &cerr) || cerr.Index != 500 || next != 500 {
+		t.Fatalf("bad: %v %d", err, next)
+	}
+}
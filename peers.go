@@ -0,0 +1,239 @@
+package raftbuntdb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/tidwall/buntdb"
+)
+
+// errInvalidPeers is returned when decoding a malformed peer set.
+var errInvalidPeers = errors.New("invalid peer set")
+
+// DecodePeers decodes the peer set carried by LogAddPeer and LogRemovePeer
+// entries. Raft encodes these as a msgpack array of peer addresses.
+func DecodePeers(buf []byte) ([]string, error) {
+	if len(buf) == 0 {
+		return nil, errInvalidPeers
+	}
+	var count int
+	switch b := buf[0]; {
+	case b == 0xc0:
+		return []string{}, nil
+	case b >= 0x90 && b <= 0x9f:
+		count, buf = int(b&0x0f), buf[1:]
+	case b == 0xdc && len(buf) >= 3:
+		count, buf = int(binary.BigEndian.Uint16(buf[1:])), buf[3:]
+	case b == 0xdd && len(buf) >= 5:
+		count, buf = int(binary.BigEndian.Uint32(buf[1:])), buf[5:]
+	default:
+		return nil, errInvalidPeers
+	}
+	peers := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if len(buf) == 0 {
+			return nil, errInvalidPeers
+		}
+		var size, hdr int
+		switch b := buf[0]; {
+		case b >= 0xa0 && b <= 0xbf:
+			size, hdr = int(b&0x1f), 1
+		case (b == 0xd9 || b == 0xc4) && len(buf) >= 2:
+			size, hdr = int(buf[1]), 2
+		case (b == 0xda || b == 0xc5) && len(buf) >= 3:
+			size, hdr = int(binary.BigEndian.Uint16(buf[1:])), 3
+		case (b == 0xdb || b == 0xc6) && len(buf) >= 5:
+			size, hdr = int(binary.BigEndian.Uint32(buf[1:])), 5
+		default:
+			return nil, errInvalidPeers
+		}
+		if len(buf) < hdr+size {
+			return nil, errInvalidPeers
+		}
+		peers = append(peers, string(buf[hdr:hdr+size]))
+		buf = buf[hdr+size:]
+	}
+	if len(buf) != 0 {
+		return nil, errInvalidPeers
+	}
+	return peers, nil
+}
+
+// EncodePeers encodes a peer set the way raft does for LogAddPeer and
+// LogRemovePeer entries. It is the inverse of DecodePeers.
+func EncodePeers(peers []string) []byte {
+	var buf []byte
+	switch n := len(peers); {
+	case n < 16:
+		buf = append(buf, 0x90|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, 0xdc, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xdd)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+	for _, peer := range peers {
+		switch n := len(peer); {
+		case n < 32:
+			buf = append(buf, 0xa0|byte(n))
+		case n <= 0xffff:
+			buf = append(buf, 0xda, byte(n>>8), byte(n))
+		default:
+			buf = append(buf, 0xdb)
+			buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+		}
+		buf = append(buf, peer...)
+	}
+	return buf
+}
+
+// serversKey is the stable key of the peers with their IDs and suffrage.
+// It's the second version of the legacy "peers" key, which raft reads and
+// which only holds the voters' addresses, so the two are written together.
+var serversKey = []byte("servers")
+
+// Servers returns the peers with their IDs and suffrage. A store written
+// before they were recorded only has the legacy peers, which are upgraded
+// on the first read to voters whose ID is their address.
+func (b *BuntStore) Servers() ([]Server, error) {
+	var servers []Server
+	var legacy bool
+	err := b.viewStable(func(tx *buntdb.Tx) error {
+		var err error
+		servers, legacy, err = readServers(tx, b.keys.conf)
+		return err
+	})
+	if err != nil || !legacy {
+		return servers, err
+	}
+	var data []byte
+	err = b.updateStable(func(tx *buntdb.Tx) error {
+		var err error
+		if servers, legacy, err = readServers(tx, b.keys.conf); err != nil || !legacy {
+			return err
+		}
+		if data, err = json.Marshal(servers); err != nil {
+			return err
+		}
+		return setStable(tx, b.keys.conf, string(serversKey), string(data), b.opts.Audit)
+	})
+	if errors.Is(err, ErrReadOnly) {
+		// The upgrade is left to a writable store
+		return servers, nil
+	}
+	if err == nil && data != nil {
+		b.onSet(serversKey, data)
+	}
+	return servers, err
+}
+
+// SetServers sets the peers with their IDs and suffrage, and the voters'
+// addresses as the legacy peers read by raft.
+func (b *BuntStore) SetServers(servers []Server) error {
+	if len(servers) > 0 {
+		if err := checkConfiguration(Configuration{Servers: servers}); err != nil {
+			return err
+		}
+	}
+	peers, err := json.Marshal(voterAddresses(servers))
+	if err != nil {
+		return err
+	}
+	return b.setPeerKeys(peers, func(*buntdb.Tx) ([]Server, error) {
+		return servers, nil
+	})
+}
+
+// setPeerKeys writes the legacy peers and the servers returned by fn in a
+// transaction of the stable store.
+func (b *BuntStore) setPeerKeys(peers []byte, fn func(tx *buntdb.Tx) ([]Server, error)) error {
+	if err := b.waitTurn(context.Background(), &b.limits.write, len(peers)); err != nil {
+		return err
+	}
+	var data []byte
+	err := b.updateStable(func(tx *buntdb.Tx) error {
+		servers, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(servers); err != nil {
+			return err
+		}
+		if err := setStable(tx, b.keys.conf, "peers", string(peers), b.opts.Audit); err != nil {
+			return err
+		}
+		return setStable(tx, b.keys.conf, string(serversKey), string(data), b.opts.Audit)
+	})
+	if err == nil {
+		b.onSet([]byte("peers"), peers)
+		b.onSet(serversKey, data)
+	}
+	b.metrics.record(opSet, err, 0, len(peers)+len(data))
+	return err
+}
+
+// readServers returns the recorded servers, or those converted from the
+// legacy peers, which it reports.
+func readServers(tx *buntdb.Tx, conf string) ([]Server, bool, error) {
+	servers := []Server{}
+	val, err := tx.Get(conf + string(serversKey))
+	if err == nil {
+		err = json.Unmarshal([]byte(val), &servers)
+		return servers, false, err
+	}
+	if err != buntdb.ErrNotFound {
+		return nil, false, err
+	}
+	val, err = tx.Get(conf + "peers")
+	if err == buntdb.ErrNotFound {
+		return servers, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var peers []string
+	if err := json.Unmarshal([]byte(val), &peers); err != nil {
+		return nil, false, err
+	}
+	return append(servers, peersConfiguration(peers).Servers...), true, nil
+}
+
+// mergePeers returns servers with the voters replaced by raft's peers.
+// Servers whose address is still a peer keep their ID, and become voters.
+// Nonvoter and staging servers are kept, as raft's peers don't list them.
+func mergePeers(servers []Server, peers []string) []Server {
+	byAddr := make(map[string]Server, len(servers))
+	for _, s := range servers {
+		byAddr[s.Address] = s
+	}
+	merged := make([]Server, 0, len(peers))
+	for _, addr := range peers {
+		s, ok := byAddr[addr]
+		if !ok {
+			s = Server{ID: addr, Address: addr}
+		}
+		delete(byAddr, addr)
+		s.Suffrage = Voter
+		merged = append(merged, s)
+	}
+	for _, s := range servers {
+		if _, ok := byAddr[s.Address]; ok && s.Suffrage != Voter {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// voterAddresses returns the addresses of the voters, which are raft's
+// peers.
+func voterAddresses(servers []Server) []string {
+	peers := []string{}
+	for _, s := range servers {
+		if s.Suffrage == Voter {
+			peers = append(peers, s.Address)
+		}
+	}
+	return peers
+}
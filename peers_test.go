@@ -0,0 +1,108 @@
+package raftbuntdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDecodePeers(t *testing.T) {
+	// An array of two raw strings, as encoded by raft
+	buf := []byte{0x92,
+		0xae, '1', '2', '7', '.', '0', '.', '0', '.', '1', ':', '1', '0', '0', '0',
+		0xc4, 0x03, 'a', ':', '1',
+	}
+	peers, err := DecodePeers(buf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(peers, []string{"127.0.0.1:1000", "a:1"}) {
+		t.Fatalf("bad: %q", peers)
+	}
+	if peers, err := DecodePeers([]byte{0xc0}); err != nil || len(peers) != 0 {
+		t.Fatalf("bad: %q %v", peers, err)
+	}
+	for _, bad := range [][]byte{nil, {0x91}, {0x91, 0xa3, 'a'}, {0x90, 0x00}, {0x01}} {
+		if _, err := DecodePeers(bad); err == nil {
+			t.Fatalf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestEncodePeers(t *testing.T) {
+	long := string(make([]byte, 300))
+	for _, peers := range [][]string{
+		{},
+		{"127.0.0.1:1000", "a:1"},
+		{long, "b:2"},
+		make([]string, 20),
+	} {
+		out, err := DecodePeers(EncodePeers(peers))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(out, peers) {
+			t.Fatalf("bad: %q", out)
+		}
+	}
+}
+
+func TestBuntStore_Servers(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+
+	// The legacy peers are upgraded on the first read
+	if err := store.Set([]byte("peers"), []byte(`["a:1","b:1"]`)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	servers, err := store.Servers()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	want := []Server{{Voter, "a:1", "a:1"}, {Voter, "b:1", "b:1"}}
+	if !reflect.DeepEqual(servers, want) {
+		t.Fatalf("bad: %+v", servers)
+	}
+	if _, err := store.Get(serversKey); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Raft's peers keep the IDs and nonvoters recorded with SetServers
+	err = store.SetServers([]Server{
+		{Voter, "node1", "a:1"},
+		{Voter, "node2", "b:1"},
+		{Nonvoter, "node3", "c:1"},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if peers, _ := store.Peers(); !reflect.DeepEqual(peers, []string{"a:1", "b:1"}) {
+		t.Fatalf("bad: %q", peers)
+	}
+	if err := store.SetPeers([]string{"b:1", "d:1"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+	store, err = NewBuntStore(store.path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	servers, err = store.Servers()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	want = []Server{{Voter, "node2", "b:1"}, {Voter, "d:1", "d:1"}, {Nonvoter, "node3", "c:1"}}
+	if !reflect.DeepEqual(servers, want) {
+		t.Fatalf("bad: %+v", servers)
+	}
+	if cfg, idx, err := store.Configuration(); err != nil || idx != 0 ||
+		!reflect.DeepEqual(cfg.Servers, want) {
+		t.Fatalf("bad: %v %d %+v", err, idx, cfg)
+	}
+
+	// Servers are checked like a configuration
+	if err := store.SetServers([]Server{{Voter, "x", "a:1"}, {Voter, "x", "b:1"}}); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -0,0 +1,163 @@
+package raftbuntdb
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// OpenPhase is a step of opening a store.
+type OpenPhase int
+
+const (
+	// OpenLoading is buntdb replaying the file into memory, which takes
+	// most of the time to open a large store.
+	OpenLoading OpenPhase = iota
+
+	// OpenIndexing is the building of the indexes over the loaded keys.
+	OpenIndexing
+
+	// OpenCounting is the scan of the log for its size.
+	OpenCounting
+
+	// OpenDone is reported once the store is open.
+	OpenDone
+)
+
+func (p OpenPhase) String() string {
+	switch p {
+	case OpenLoading:
+		return "loading"
+	case OpenIndexing:
+		return "indexing"
+	case OpenCounting:
+		return "counting"
+	case OpenDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// OpenProgress is passed to Options.OnOpenProgress while a store opens.
+type OpenProgress struct {
+	Phase OpenPhase
+
+	// Loaded is the number of bytes of the file replayed so far out of
+	// FileSize. buntdb doesn't report how far it got, so Loaded is read
+	// from the position of its file handle where the platform allows,
+	// which is Linux only. Elsewhere it's zero until the file is loaded.
+	Loaded   int64
+	FileSize int64
+
+	// Elapsed is the time since Open was called.
+	Elapsed time.Duration
+}
+
+// openReporter calls Options.OnOpenProgress. A nil reporter does nothing.
+type openReporter struct {
+	fn       func(OpenProgress)
+	interval time.Duration
+	path     string
+	start    time.Time
+	size     int64
+}
+
+func newOpenReporter(path string, opts *Options) *openReporter {
+	if opts.OnOpenProgress == nil {
+		return nil
+	}
+	r := &openReporter{fn: opts.OnOpenProgress, interval: opts.OpenProgressInterval,
+		path: path, start: time.Now()}
+	if r.interval <= 0 {
+		r.interval = time.Second
+	}
+	if fi, err := os.Stat(path); err == nil {
+		r.size = fi.Size()
+	}
+	return r
+}
+
+// report reports the start of phase, at which point the file is loaded.
+func (r *openReporter) report(phase OpenPhase) {
+	if r == nil {
+		return
+	}
+	p := OpenProgress{Phase: phase, FileSize: r.size, Elapsed: time.Since(r.start)}
+	if phase != OpenLoading {
+		p.Loaded = r.size
+	}
+	r.fn(p)
+}
+
+// loading reports how far the file has been loaded.
+func (r *openReporter) loading() {
+	loaded, _ := loadOffset(r.path)
+	r.fn(OpenProgress{Phase: OpenLoading, Loaded: loaded, FileSize: r.size,
+		Elapsed: time.Since(r.start)})
+}
+
+// ticks returns the channel that paces the reports of the loading phase,
+// and a function to stop it.
+func (r *openReporter) ticks() (<-chan time.Time, func()) {
+	if r == nil {
+		return nil, func() {}
+	}
+	t := time.NewTicker(r.interval)
+	return t.C, t.Stop
+}
+
+// loadDB opens the database at path, recovering a torn tail if allowed.
+// If ctx is done first, it returns the context's error and leaves the
+// database to be closed and the lock released once it's loaded. The lock
+// is also released if it fails.
+func loadDB(ctx context.Context, path string, opts *Options, rep *openReporter,
+	lock *fileLock) (*buntdb.DB, error) {
+	type result struct {
+		db  *buntdb.DB
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		if opts.ReadOnly {
+			db, err := loadReadOnly(path)
+			done <- result{db, err}
+			return
+		}
+		db, err := buntdb.Open(path)
+		if err == buntdb.ErrInvalid && opts.RecoverCorruptTail {
+			var recovered bool
+			if recovered, err = recoverTail(path); err == nil {
+				if recovered {
+					db, err = buntdb.Open(path)
+				} else {
+					err = buntdb.ErrInvalid
+				}
+			}
+		}
+		done <- result{db, err}
+	}()
+	rep.report(OpenLoading)
+	ticks, stop := rep.ticks()
+	defer stop()
+	for {
+		select {
+		case res := <-done:
+			if res.err != nil {
+				lock.release()
+			}
+			return res.db, res.err
+		case <-ticks:
+			rep.loading()
+		case <-ctx.Done():
+			go func() {
+				if res := <-done; res.err == nil {
+					res.db.Close()
+				}
+				lock.release()
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package raftbuntdb
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loadOffset returns the position of a file handle of the process on the
+// file at path, which is how far buntdb has read it while it loads.
+func loadOffset(path string) (int64, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, false
+	}
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	for _, fd := range fds {
+		target, err := os.Readlink("/proc/self/fd/" + fd.Name())
+		if err != nil || target != path {
+			continue
+		}
+		info, err := os.ReadFile("/proc/self/fdinfo/" + fd.Name())
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(info), "\n") {
+			if pos, ok := strings.CutPrefix(line, "pos:"); ok {
+				n, err := strconv.ParseInt(strings.TrimSpace(pos), 10, 64)
+				return n, err == nil
+			}
+		}
+	}
+	return 0, false
+}
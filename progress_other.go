@@ -0,0 +1,8 @@
+//go:build !linux
+
+package raftbuntdb
+
+// The position of buntdb's file handle can't be found on this platform.
+func loadOffset(path string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,80 @@
+package raftbuntdb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpen_Progress(t *testing.T) {
+	store := testBuntStore(t)
+	path := store.path
+	defer os.Remove(path)
+	if err := store.StoreLog(testRaftLog(1, "data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	var reports []OpenProgress
+	store, err := Open(path, &Options{OnOpenProgress: func(p OpenProgress) {
+		reports = append(reports, p)
+	}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+	phases := []OpenPhase{OpenLoading, OpenIndexing, OpenCounting, OpenDone}
+	if len(reports) != len(phases) {
+		t.Fatalf("bad: %+v", reports)
+	}
+	for i, p := range reports {
+		if p.Phase != phases[i] || p.FileSize == 0 {
+			t.Fatalf("bad: %d %+v", i, p)
+		}
+		if i > 0 && (p.Loaded != p.FileSize || p.Elapsed < reports[i-1].Elapsed) {
+			t.Fatalf("bad: %d %+v", i, p)
+		}
+	}
+	if OpenCounting.String() != "counting" {
+		t.Fatalf("bad: %s", OpenCounting)
+	}
+}
+
+func TestOpenContext_Canceled(t *testing.T) {
+	store := testBuntStore(t)
+	store.Close()
+	path := store.path
+	defer os.Remove(path)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := OpenContext(ctx, path, nil); err != context.Canceled {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// The lock is released once the abandoned load is done
+	store, err := Open(path, &Options{LockTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+}
+
+func TestLoadOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, make([]byte, 100), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	if _, err := f.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n, ok := loadOffset(path); ok && n != 10 {
+		t.Fatalf("bad: %d", n)
+	}
+}
@@ -0,0 +1,316 @@
+package raftbuntdbtest
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+// maxCrashFailures is the number of failing crash points reported before a
+// CrashTest gives up.
+const maxCrashFailures = 10
+
+// CrashStep is a write of the workload of a CrashTest. Each field that is
+// set is done in turn, in a call of its own.
+type CrashStep struct {
+	// Logs are stored with StoreLogs.
+	Logs []*raft.Log
+
+	// DeleteMin to DeleteMax are deleted with DeleteRange when DeleteMax
+	// is set.
+	DeleteMin, DeleteMax uint64
+
+	// Key is set to Value with Set when it is set.
+	Key, Value []byte
+
+	// Sync fsyncs the file after the step, as buntdb does each second with
+	// Medium durability, making every write before it durable.
+	Sync bool
+}
+
+// CrashTest runs a workload against a BuntStore, then simulates a power
+// loss at many points of it: the file is cut at an offset between the end
+// of the last synced write and its end, which drops the unsynced writes
+// after the offset and tears the one across it. Each cut file is reopened
+// with RecoverCorruptTail, and must hold the logs and stable keys of the
+// writes that ended before the offset, which includes every synced write,
+// and each key of the torn write either before or after it, without a gap
+// in the log. With High durability every write is synced.
+//
+// Each write of buntdb is appended to the file at once, so a cut file is
+// what the disk holds after a power loss if it loses the unsynced pages
+// from the end. Steps must not rewrite the file, so Shrink and the
+// options that shrink it, such as AutoShrink or Retention, are not
+// supported, nor is StablePath.
+type CrashTest struct {
+	// Options are the options of the store. RecoverCorruptTail is set on
+	// reopen. Defaults to DefaultOptions.
+	Options *raftbuntdb.Options
+
+	// Steps is the workload.
+	Steps []CrashStep
+
+	// Points is the number of crash points picked at random, besides the
+	// end of each unsynced write, which is always one. Defaults to 100.
+	Points int
+
+	// Seed seeds the random choice of the crash points, so a failure can
+	// be repeated.
+	Seed int64
+}
+
+// crashState is the content of the store once the write ending at end is
+// in the file.
+type crashState struct {
+	end    int64
+	logs   map[uint64]raft.Log
+	stable map[string]string
+}
+
+// Run runs the workload in a temporary directory and checks each crash
+// point, failing t with the points whose reopened store is wrong.
+func (c CrashTest) Run(t *testing.T) {
+	t.Helper()
+	opts := raftbuntdb.Options{}
+	if c.Options != nil {
+		opts = *c.Options
+	} else {
+		opts = *raftbuntdb.DefaultOptions
+	}
+	if opts.StablePath != "" {
+		t.Fatalf("crash test: StablePath is not supported")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "raft.db")
+	states, synced := c.run(t, path, &opts)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("crash test: %s", err)
+	}
+
+	// The end of each unsynced write, and random offsets after the last
+	// synced one
+	var points []int64
+	for _, s := range states {
+		if s.end > synced {
+			points = append(points, s.end)
+		}
+	}
+	points = append(points, synced)
+	n := c.Points
+	if n <= 0 {
+		n = 100
+	}
+	r := rand.New(rand.NewSource(c.Seed))
+	size := int64(len(data))
+	for i := 0; i < n && size > synced; i++ {
+		points = append(points, synced+r.Int63n(size-synced+1))
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+
+	opts.RecoverCorruptTail = true
+	var failed int
+	for i, off := range points {
+		if i > 0 && off == points[i-1] {
+			continue
+		}
+		// The last write that ended before the cut, and the one it tore
+		j := sort.Search(len(states), func(j int) bool { return states[j].end > off }) - 1
+		next := &states[j]
+		if j+1 < len(states) && off > states[j].end {
+			next = &states[j+1]
+		}
+		err := checkCrash(filepath.Join(dir, fmt.Sprintf("crash-%d.db", off)), data[:off], &opts,
+			&states[j], next, &states[len(states)-1])
+		if err == nil {
+			continue
+		}
+		t.Errorf("crash at offset %d of %d (synced %d): %s", off, size, synced, err)
+		if failed++; failed == maxCrashFailures {
+			t.Fatalf("crash test: too many failures")
+		}
+	}
+}
+
+// run runs the workload in path, and returns the state after each write,
+// from the empty file, and the offset up to which the file was synced.
+func (c CrashTest) run(t *testing.T, path string, opts *raftbuntdb.Options) ([]crashState, int64) {
+	t.Helper()
+	cur := crashState{logs: map[uint64]raft.Log{}, stable: map[string]string{}}
+	states := []crashState{{}}
+	var synced int64
+
+	// record adds a copy of the state after a write, which must not have
+	// shrunk the file
+	record := func(sync bool) {
+		t.Helper()
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("crash test: %s", err)
+		}
+		next := crashState{end: fi.Size(), logs: map[uint64]raft.Log{}, stable: map[string]string{}}
+		for idx, log := range cur.logs {
+			next.logs[idx] = log
+		}
+		for k, v := range cur.stable {
+			next.stable[k] = v
+		}
+		if last := states[len(states)-1]; next.end < last.end {
+			t.Fatalf("crash test: the file shrank from %d to %d bytes", last.end, next.end)
+		} else if next.end == last.end {
+			states[len(states)-1] = next
+		} else {
+			states = append(states, next)
+		}
+		if sync || opts.Durability == raftbuntdb.High {
+			synced = next.end
+		}
+	}
+
+	store, err := raftbuntdb.Open(path, opts)
+	if err != nil {
+		t.Fatalf("crash test: %s", err)
+	}
+	defer store.Close()
+	record(false)
+	for i, step := range c.Steps {
+		if len(step.Logs) > 0 {
+			if err := store.StoreLogs(step.Logs); err != nil {
+				t.Fatalf("crash test: step %d: StoreLogs: %s", i, err)
+			}
+			for _, log := range step.Logs {
+				cur.logs[log.Index] = raft.Log{Index: log.Index, Term: log.Term,
+					Type: log.Type, Data: append([]byte(nil), log.Data...)}
+			}
+			record(false)
+		}
+		if step.DeleteMax != 0 {
+			if err := store.DeleteRange(step.DeleteMin, step.DeleteMax); err != nil {
+				t.Fatalf("crash test: step %d: DeleteRange: %s", i, err)
+			}
+			for idx := range cur.logs {
+				if idx >= step.DeleteMin && idx <= step.DeleteMax {
+					delete(cur.logs, idx)
+				}
+			}
+			record(false)
+		}
+		if step.Key != nil {
+			if err := store.Set(step.Key, step.Value); err != nil {
+				t.Fatalf("crash test: step %d: Set: %s", i, err)
+			}
+			cur.stable[string(step.Key)] = string(step.Value)
+			record(false)
+		}
+		if step.Sync {
+			if err := syncPath(path); err != nil {
+				t.Fatalf("crash test: step %d: sync: %s", i, err)
+			}
+			record(true)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("crash test: %s", err)
+	}
+	return states, synced
+}
+
+// syncPath fsyncs the file at path.
+func syncPath(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checkCrash writes data to path, reopens it and checks that it holds the
+// state of want. If the cut tore the write of next, each log and stable key
+// may be that of either state, as long as the log has no gaps. The stable
+// keys missing from both, which are in final, must not be found.
+func checkCrash(path string, data []byte, opts *raftbuntdb.Options, want, next, final *crashState) error {
+	defer os.Remove(path)
+	defer os.Remove(path + ".bak")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	store, err := raftbuntdb.Open(path, opts)
+	if err != nil {
+		return fmt.Errorf("reopen: %w", err)
+	}
+	defer store.Close()
+	report, err := store.Verify()
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if !report.OK() {
+		return fmt.Errorf("verify: %s", report.String())
+	}
+
+	// Every index held by either state, and by the store
+	indexes := map[uint64]bool{}
+	for _, s := range []*crashState{want, next} {
+		for idx := range s.logs {
+			indexes[idx] = true
+		}
+	}
+	for idx := report.FirstIndex; idx != 0 && idx <= report.LastIndex; idx++ {
+		indexes[idx] = true
+	}
+	for idx := range indexes {
+		var log raft.Log
+		err := store.GetLog(idx, &log)
+		if err != nil && err != raft.ErrLogNotFound {
+			return fmt.Errorf("GetLog(%d): %w", idx, err)
+		}
+		w, ok := want.logs[idx]
+		if sameLog(&log, err == nil, &w, ok) {
+			continue
+		}
+		n, ok := next.logs[idx]
+		if sameLog(&log, err == nil, &n, ok) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("log %d: not found, want %+v", idx, w)
+		}
+		return fmt.Errorf("log %d: got %+v, want %+v", idx, log, w)
+	}
+	for k := range final.stable {
+		val, err := store.Get([]byte(k))
+		if err != nil && err != raftbuntdb.ErrKeyNotFound {
+			return fmt.Errorf("Get(%q): %w", k, err)
+		}
+		w, ok := want.stable[k]
+		if (err == nil) == ok && string(val) == w {
+			continue
+		}
+		n, ok := next.stable[k]
+		if (err == nil) == ok && string(val) == n {
+			continue
+		}
+		return fmt.Errorf("Get(%q): got %q, %v, want %q", k, val, err, w)
+	}
+	return nil
+}
+
+// sameLog reports whether got, which is found or not, is want, which is
+// expected or not.
+func sameLog(got *raft.Log, found bool, want *raft.Log, expected bool) bool {
+	if !found || !expected {
+		return found == expected
+	}
+	return got.Index == want.Index && got.Term == want.Term && got.Type == want.Type &&
+		bytes.Equal(got.Data, want.Data)
+}
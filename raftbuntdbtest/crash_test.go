@@ -0,0 +1,60 @@
+package raftbuntdbtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+// crashSteps is a workload that appends, replaces the tail as a new leader
+// would, compacts the head and records votes.
+func crashSteps() []CrashStep {
+	var steps []CrashStep
+	for i := uint64(1); i <= 40; i += 4 {
+		var logs []*raft.Log
+		for j := i; j < i+4; j++ {
+			logs = append(logs, testLog(j, 1))
+		}
+		steps = append(steps, CrashStep{Logs: logs, Sync: i == 17})
+	}
+	steps = append(steps,
+		CrashStep{Key: []byte("CurrentTerm"), Value: []byte("2")},
+		CrashStep{DeleteMin: 38, DeleteMax: 40},
+		CrashStep{Logs: []*raft.Log{testLog(38, 2), testLog(39, 2)}},
+		CrashStep{DeleteMin: 1, DeleteMax: 10, Sync: true},
+		CrashStep{Key: []byte("LastVoteTerm"), Value: []byte("2")},
+	)
+	for i := uint64(40); i <= 50; i++ {
+		steps = append(steps, CrashStep{Logs: []*raft.Log{testLog(i, 2)}})
+	}
+	return steps
+}
+
+func TestCrashTest(t *testing.T) {
+	for _, level := range []raftbuntdb.Level{raftbuntdb.Low, raftbuntdb.Medium, raftbuntdb.High} {
+		t.Run(fmt.Sprint(level), func(t *testing.T) {
+			CrashTest{
+				Options: &raftbuntdb.Options{Durability: level},
+				Steps:   crashSteps(),
+				Points:  50,
+				Seed:    int64(level),
+			}.Run(t)
+		})
+	}
+}
+
+func TestCrashTest_Unsynced(t *testing.T) {
+	// With nothing synced every write can be torn, including the delete of
+	// the tail
+	steps := crashSteps()
+	for i := range steps {
+		steps[i].Sync = false
+	}
+	CrashTest{
+		Options: &raftbuntdb.Options{Durability: raftbuntdb.Low},
+		Steps:   steps,
+		Points:  500,
+	}.Run(t)
+}
@@ -0,0 +1,246 @@
+package raftbuntdbtest
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+var (
+	// ErrInjected is the default error returned by an injected failure.
+	ErrInjected = errors.New("injected failure")
+
+	// ErrCrashed is returned by every call to a FaultyStore after a
+	// simulated crash.
+	ErrCrashed = errors.New("store crashed")
+)
+
+// Faults configures the failures a FaultyStore injects. Calls are counted
+// from one, and a zero count disables the fault.
+type Faults struct {
+	// FailStoreLogs fails the Nth call to StoreLogs with Err, without
+	// storing anything.
+	FailStoreLogs int
+
+	// Err is the error of an injected failure. Defaults to ErrInjected.
+	Err error
+
+	// GetLogLatency is added to every call to GetLog.
+	GetLogLatency time.Duration
+
+	// Latency holds the latency distribution of each operation, added to
+	// every call, to model a slow disk. See the profiles, such as
+	// HDDProfile.
+	Latency map[Op]Latency
+
+	// Seed seeds the random source of the latencies, so a simulation can
+	// be repeated.
+	Seed int64
+
+	// Sleep is called with each latency. Defaults to time.Sleep; a
+	// simulation with its own clock can advance it instead.
+	Sleep func(d time.Duration)
+
+	// CrashStoreLogs simulates a crash during the Nth call to StoreLogs,
+	// after the batch is encoded but before it is fsynced: only the first
+	// CrashKeep logs of the batch reach the store, the call fails with
+	// ErrCrashed, and so does every call after it.
+	CrashStoreLogs int
+	CrashKeep      int
+}
+
+// FaultyStore wraps a Store and injects failures into it, for testing how
+// an application handles storage failures. It passes the conformance
+// suite when no faults are configured.
+type FaultyStore struct {
+	store Store
+
+	mu        sync.Mutex
+	faults    Faults
+	rand      *rand.Rand
+	storeLogs int
+	crashed   bool
+}
+
+// NewFaultyStore returns a store that passes calls to store, injecting
+// faults.
+func NewFaultyStore(store Store, faults Faults) *FaultyStore {
+	f := &FaultyStore{store: store}
+	f.SetFaults(faults)
+	return f
+}
+
+// SetFaults replaces the faults and reseeds the latencies. Call counts are
+// kept, so a count is compared with the calls made since the store was
+// created.
+func (f *FaultyStore) SetFaults(faults Faults) {
+	f.mu.Lock()
+	f.faults = faults
+	f.rand = rand.New(rand.NewSource(faults.Seed))
+	f.mu.Unlock()
+}
+
+// Crashed returns true after a simulated crash.
+func (f *FaultyStore) Crashed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.crashed
+}
+
+// check returns ErrCrashed after a crash, and otherwise waits for the
+// latency of op and returns the faults.
+func (f *FaultyStore) check(op Op) (Faults, error) {
+	f.mu.Lock()
+	if f.crashed {
+		f.mu.Unlock()
+		return Faults{}, ErrCrashed
+	}
+	faults := f.faults
+	var d time.Duration
+	if l, ok := faults.Latency[op]; ok {
+		d = l.sample(f.rand)
+	}
+	f.mu.Unlock()
+	faults.sleep(d)
+	return faults, nil
+}
+
+func (faults *Faults) sleep(d time.Duration) {
+	switch {
+	case d <= 0:
+	case faults.Sleep != nil:
+		faults.Sleep(d)
+	default:
+		time.Sleep(d)
+	}
+}
+
+func (f *FaultyStore) injected() error {
+	if f.faults.Err != nil {
+		return f.faults.Err
+	}
+	return ErrInjected
+}
+
+// FirstIndex returns the first index of the wrapped store.
+func (f *FaultyStore) FirstIndex() (uint64, error) {
+	if _, err := f.check(OpFirstIndex); err != nil {
+		return 0, err
+	}
+	return f.store.FirstIndex()
+}
+
+// LastIndex returns the last index of the wrapped store.
+func (f *FaultyStore) LastIndex() (uint64, error) {
+	if _, err := f.check(OpLastIndex); err != nil {
+		return 0, err
+	}
+	return f.store.LastIndex()
+}
+
+// GetLog retrieves a log from the wrapped store after GetLogLatency and
+// the latency of OpGetLog.
+func (f *FaultyStore) GetLog(idx uint64, log *raft.Log) error {
+	faults, err := f.check(OpGetLog)
+	if err != nil {
+		return err
+	}
+	faults.sleep(faults.GetLogLatency)
+	return f.store.GetLog(idx, log)
+}
+
+// StoreLog stores a log, counting as a call to StoreLogs.
+func (f *FaultyStore) StoreLog(log *raft.Log) error {
+	return f.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs stores logs in the wrapped store unless the call is set to
+// fail or crash.
+func (f *FaultyStore) StoreLogs(logs []*raft.Log) error {
+	if _, err := f.check(OpStoreLogs); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	if f.crashed {
+		f.mu.Unlock()
+		return ErrCrashed
+	}
+	f.storeLogs++
+	n := f.storeLogs
+	if n == f.faults.FailStoreLogs {
+		err := f.injected()
+		f.mu.Unlock()
+		return err
+	}
+	if n != f.faults.CrashStoreLogs {
+		f.mu.Unlock()
+		return f.store.StoreLogs(logs)
+	}
+
+	// Later calls fail from here on, while the partial batch is written
+	f.crashed = true
+	keep := f.faults.CrashKeep
+	f.mu.Unlock()
+	if keep > len(logs) {
+		keep = len(logs)
+	}
+	if keep > 0 {
+		if err := f.store.StoreLogs(logs[:keep]); err != nil {
+			return err
+		}
+	}
+	return ErrCrashed
+}
+
+// DeleteRange deletes logs from the wrapped store.
+func (f *FaultyStore) DeleteRange(min, max uint64) error {
+	if _, err := f.check(OpDeleteRange); err != nil {
+		return err
+	}
+	return f.store.DeleteRange(min, max)
+}
+
+// Set sets a key in the wrapped store.
+func (f *FaultyStore) Set(k, v []byte) error {
+	if _, err := f.check(OpSet); err != nil {
+		return err
+	}
+	return f.store.Set(k, v)
+}
+
+// Get retrieves a key from the wrapped store.
+func (f *FaultyStore) Get(k []byte) ([]byte, error) {
+	if _, err := f.check(OpGet); err != nil {
+		return nil, err
+	}
+	return f.store.Get(k)
+}
+
+// SetUint64 sets a uint64 key in the wrapped store.
+func (f *FaultyStore) SetUint64(key []byte, val uint64) error {
+	if _, err := f.check(OpSet); err != nil {
+		return err
+	}
+	return f.store.SetUint64(key, val)
+}
+
+// GetUint64 retrieves a uint64 key from the wrapped store.
+func (f *FaultyStore) GetUint64(key []byte) (uint64, error) {
+	if _, err := f.check(OpGet); err != nil {
+		return 0, err
+	}
+	return f.store.GetUint64(key)
+}
+
+// Close closes the wrapped store if it implements io.Closer, even after a
+// crash, so that it can be reopened.
+func (f *FaultyStore) Close() error {
+	if c, ok := f.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
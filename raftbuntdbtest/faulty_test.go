@@ -0,0 +1,93 @@
+package raftbuntdbtest
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+func TestFaultyStore(t *testing.T) {
+	Suite{
+		Open: func(path string) (Store, error) {
+			store, err := raftbuntdb.Open(path, nil)
+			if err != nil {
+				return nil, err
+			}
+			return NewFaultyStore(store, Faults{}), nil
+		},
+		Durable: true,
+	}.Run(t)
+}
+
+func TestFaultyStore_FailStoreLogs(t *testing.T) {
+	errDisk := errors.New("disk")
+	store := NewFaultyStore(NewMockStore(), Faults{FailStoreLogs: 2, Err: errDisk})
+	for i := uint64(1); i <= 3; i++ {
+		err := store.StoreLog(testLog(i, 1))
+		if i == 2 && err != errDisk || i != 2 && err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	var log raft.Log
+	if err := store.GetLog(2, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("err: %v", err)
+	}
+	store.SetFaults(Faults{FailStoreLogs: 4})
+	if err := store.StoreLog(testLog(2, 1)); err != ErrInjected {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestFaultyStore_GetLogLatency(t *testing.T) {
+	store := NewFaultyStore(NewMockStore(), Faults{GetLogLatency: 20 * time.Millisecond})
+	store.StoreLog(testLog(1, 1))
+	start := time.Now()
+	var log raft.Log
+	if err := store.GetLog(1, &log); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("expected latency")
+	}
+}
+
+func TestFaultyStore_Crash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+	bunt, err := raftbuntdb.Open(path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store := NewFaultyStore(bunt, Faults{CrashStoreLogs: 2, CrashKeep: 2})
+	storeRange(t, store, 1, 5, 1)
+	var logs []*raft.Log
+	for i := uint64(6); i <= 10; i++ {
+		logs = append(logs, testLog(i, 1))
+	}
+	if err := store.StoreLogs(logs); err != ErrCrashed {
+		t.Fatalf("err: %v", err)
+	}
+	if !store.Crashed() {
+		t.Fatalf("expected a crash")
+	}
+	if _, err := store.LastIndex(); err != ErrCrashed {
+		t.Fatalf("err: %v", err)
+	}
+	if err := store.Set([]byte("k"), []byte("v")); err != ErrCrashed {
+		t.Fatalf("err: %v", err)
+	}
+
+	// After a restart only part of the batch is there
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	bunt, err = raftbuntdb.Open(path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer bunt.Close()
+	checkIndexes(t, bunt, 1, 7)
+}
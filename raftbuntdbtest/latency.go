@@ -0,0 +1,101 @@
+package raftbuntdbtest
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Op is an operation of a Store, for configuring its latency.
+type Op int
+
+const (
+	OpFirstIndex Op = iota
+	OpLastIndex
+	OpGetLog
+	OpStoreLogs
+	OpDeleteRange
+	OpSet // Set and SetUint64
+	OpGet // Get and GetUint64
+)
+
+var opNames = []string{"FirstIndex", "LastIndex", "GetLog", "StoreLogs",
+	"DeleteRange", "Set", "Get"}
+
+func (op Op) String() string {
+	if op >= 0 && int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return "unknown"
+}
+
+// Latency is a latency distribution, given by its median and 99th
+// percentile. Latencies follow a log-normal distribution, which has the
+// long tail of real disks, with uniform jitter added on top.
+type Latency struct {
+	P50 time.Duration
+	P99 time.Duration
+
+	// Jitter is the most that is added to or removed from each latency.
+	Jitter time.Duration
+}
+
+// z99 is the standard normal quantile of the 99th percentile.
+const z99 = 2.3263
+
+// sample returns a random latency from the distribution. A P99 that's not
+// above P50 gives a constant P50 before jitter.
+func (l Latency) sample(r *rand.Rand) time.Duration {
+	d := l.P50
+	if l.P50 > 0 && l.P99 > l.P50 {
+		sigma := math.Log(float64(l.P99)/float64(l.P50)) / z99
+		d = time.Duration(float64(l.P50) * math.Exp(sigma*r.NormFloat64()))
+	}
+	if l.Jitter > 0 {
+		d += time.Duration(r.Int63n(int64(2*l.Jitter)+1)) - l.Jitter
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// profile returns a profile with the given latencies for reads and for
+// writes, which are fsynced.
+func profile(read, write Latency) map[Op]Latency {
+	return map[Op]Latency{
+		OpFirstIndex:  read,
+		OpLastIndex:   read,
+		OpGetLog:      read,
+		OpGet:         read,
+		OpStoreLogs:   write,
+		OpDeleteRange: write,
+		OpSet:         write,
+	}
+}
+
+// SSDProfile returns latencies modeled on a local SSD.
+func SSDProfile() map[Op]Latency {
+	return profile(
+		Latency{P50: 20 * time.Microsecond, P99: 100 * time.Microsecond},
+		Latency{P50: 200 * time.Microsecond, P99: 2 * time.Millisecond,
+			Jitter: 50 * time.Microsecond})
+}
+
+// HDDProfile returns latencies modeled on a spinning disk, where every
+// fsync waits for the platter.
+func HDDProfile() map[Op]Latency {
+	return profile(
+		Latency{P50: 50 * time.Microsecond, P99: 8 * time.Millisecond},
+		Latency{P50: 8 * time.Millisecond, P99: 40 * time.Millisecond,
+			Jitter: time.Millisecond})
+}
+
+// NetworkDiskProfile returns latencies modeled on network attached block
+// storage, with occasional stalls.
+func NetworkDiskProfile() map[Op]Latency {
+	return profile(
+		Latency{P50: 500 * time.Microsecond, P99: 5 * time.Millisecond},
+		Latency{P50: 2 * time.Millisecond, P99: 100 * time.Millisecond,
+			Jitter: 500 * time.Microsecond})
+}
@@ -0,0 +1,77 @@
+package raftbuntdbtest
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestLatency_Sample(t *testing.T) {
+	l := Latency{P50: 10 * time.Millisecond, P99: 50 * time.Millisecond}
+	r := rand.New(rand.NewSource(1))
+	samples := make([]time.Duration, 100000)
+	for i := range samples {
+		samples[i] = l.sample(r)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	near := func(got, want time.Duration) bool {
+		return got > want*9/10 && got < want*11/10
+	}
+	if p50 := samples[len(samples)/2]; !near(p50, l.P50) {
+		t.Fatalf("p50: %v", p50)
+	}
+	if p99 := samples[len(samples)*99/100]; !near(p99, l.P99) {
+		t.Fatalf("p99: %v", p99)
+	}
+
+	// Constant latency with jitter
+	l = Latency{P50: 10 * time.Millisecond, Jitter: time.Millisecond}
+	for i := 0; i < 1000; i++ {
+		if d := l.sample(r); d < 9*time.Millisecond || d > 11*time.Millisecond {
+			t.Fatalf("bad: %v", d)
+		}
+	}
+	if d := (Latency{Jitter: time.Millisecond}).sample(r); d < 0 {
+		t.Fatalf("bad: %v", d)
+	}
+}
+
+func TestFaultyStore_Latency(t *testing.T) {
+	run := func() map[Op][]time.Duration {
+		var op Op
+		delays := make(map[Op][]time.Duration)
+		store := NewFaultyStore(NewMockStore(), Faults{
+			Latency: HDDProfile(),
+			Seed:    42,
+			Sleep: func(d time.Duration) {
+				delays[op] = append(delays[op], d)
+			},
+		})
+		for i := uint64(1); i <= 10; i++ {
+			op = OpStoreLogs
+			store.StoreLog(testLog(i, 1))
+			op = OpLastIndex
+			store.LastIndex()
+		}
+		return delays
+	}
+	delays := run()
+	if len(delays[OpStoreLogs]) != 10 || len(delays[OpLastIndex]) != 10 {
+		t.Fatalf("bad: %v", delays)
+	}
+	var writes, reads time.Duration
+	for i := range delays[OpStoreLogs] {
+		writes += delays[OpStoreLogs][i]
+		reads += delays[OpLastIndex][i]
+	}
+	if writes <= reads {
+		t.Fatalf("expected slower writes: %v %v", writes, reads)
+	}
+
+	// The same seed gives the same latencies
+	if again := run(); !reflect.DeepEqual(again, delays) {
+		t.Fatalf("bad: %v", again)
+	}
+}
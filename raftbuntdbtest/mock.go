@@ -0,0 +1,497 @@
+package raftbuntdbtest
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+// logHeaderSize is the size a BuntStore adds to each log's data when it's
+// encoded, which MockStore counts for LogBytes and Stats.
+const logHeaderSize = 17
+
+// MockStore is an in-memory store with the same behavior as a BuntStore,
+// for application tests that don't need a file. It implements the raft
+// interfaces and the BuntStore's log iteration, counting and maintenance
+// APIs. Logs and values are copied in and out, as they are by a BuntStore.
+type MockStore struct {
+	mu      sync.RWMutex
+	closed  bool
+	logs    map[uint64]*raft.Log
+	indexes []uint64 // sorted indexes of logs
+	stable  map[string][]byte
+}
+
+// NewMockStore returns an empty MockStore.
+func NewMockStore() *MockStore {
+	return &MockStore{
+		logs:   make(map[uint64]*raft.Log),
+		stable: make(map[string][]byte),
+	}
+}
+
+func copyLog(dst, src *raft.Log) {
+	*dst = *src
+	dst.Data = append([]byte(nil), src.Data...)
+}
+
+// read runs fn with the store locked for reading.
+func (m *MockStore) read(fn func() error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return raftbuntdb.ErrClosed
+	}
+	return fn()
+}
+
+// write runs fn with the store locked for writing.
+func (m *MockStore) write(fn func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return raftbuntdb.ErrClosed
+	}
+	return fn()
+}
+
+// Close closes the store. It is safe to call Close more than once.
+func (m *MockStore) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	return nil
+}
+
+// Shrink does nothing, as there's no file to shrink.
+func (m *MockStore) Shrink() error {
+	return m.read(func() error { return nil })
+}
+
+// FirstIndex returns the first known index from the log.
+func (m *MockStore) FirstIndex() (uint64, error) {
+	var idx uint64
+	err := m.read(func() error {
+		if len(m.indexes) > 0 {
+			idx = m.indexes[0]
+		}
+		return nil
+	})
+	return idx, err
+}
+
+// LastIndex returns the last known index from the log.
+func (m *MockStore) LastIndex() (uint64, error) {
+	var idx uint64
+	err := m.read(func() error {
+		if len(m.indexes) > 0 {
+			idx = m.indexes[len(m.indexes)-1]
+		}
+		return nil
+	})
+	return idx, err
+}
+
+// GetLog is used to retrieve a log at a given index.
+func (m *MockStore) GetLog(idx uint64, log *raft.Log) error {
+	return m.read(func() error {
+		stored, ok := m.logs[idx]
+		if !ok {
+			return raft.ErrLogNotFound
+		}
+		copyLog(log, stored)
+		return nil
+	})
+}
+
+// GetFirstLog retrieves the first log, or returns raft.ErrLogNotFound when
+// the log is empty.
+func (m *MockStore) GetFirstLog(log *raft.Log) error {
+	return m.read(func() error {
+		if len(m.indexes) == 0 {
+			return raft.ErrLogNotFound
+		}
+		copyLog(log, m.logs[m.indexes[0]])
+		return nil
+	})
+}
+
+// GetLastLog is like GetFirstLog but retrieves the last log.
+func (m *MockStore) GetLastLog(log *raft.Log) error {
+	return m.read(func() error {
+		if len(m.indexes) == 0 {
+			return raft.ErrLogNotFound
+		}
+		copyLog(log, m.logs[m.indexes[len(m.indexes)-1]])
+		return nil
+	})
+}
+
+// StoreLog is used to store a single raft log.
+func (m *MockStore) StoreLog(log *raft.Log) error {
+	return m.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs is used to store a set of raft logs.
+func (m *MockStore) StoreLogs(logs []*raft.Log) error {
+	return m.write(func() error {
+		for _, log := range logs {
+			stored := new(raft.Log)
+			copyLog(stored, log)
+			if _, ok := m.logs[log.Index]; !ok {
+				i := m.search(log.Index)
+				m.indexes = append(m.indexes, 0)
+				copy(m.indexes[i+1:], m.indexes[i:])
+				m.indexes[i] = log.Index
+			}
+			m.logs[log.Index] = stored
+		}
+		return nil
+	})
+}
+
+// DeleteRange is used to delete logs within a given range inclusively.
+func (m *MockStore) DeleteRange(min, max uint64) error {
+	return m.write(func() error {
+		i, j := m.search(min), m.search(max)
+		if j < len(m.indexes) && m.indexes[j] == max {
+			j++
+		}
+		if i >= j {
+			return nil
+		}
+		for _, idx := range m.indexes[i:j] {
+			delete(m.logs, idx)
+		}
+		m.indexes = append(m.indexes[:i], m.indexes[j:]...)
+		return nil
+	})
+}
+
+// CompactTo deletes all logs with an index up to and including idx.
+func (m *MockStore) CompactTo(idx uint64) error {
+	return m.DeleteRange(0, idx)
+}
+
+// TruncateAfter deletes all logs with an index greater than idx.
+func (m *MockStore) TruncateAfter(idx uint64) error {
+	return m.write(func() error {
+		i := m.search(idx + 1)
+		for _, idx := range m.indexes[i:] {
+			delete(m.logs, idx)
+		}
+		m.indexes = m.indexes[:i]
+		return nil
+	})
+}
+
+// search returns the position of the first index >= idx.
+func (m *MockStore) search(idx uint64) int {
+	return sort.Search(len(m.indexes), func(i int) bool {
+		return m.indexes[i] >= idx
+	})
+}
+
+// LogCount returns the number of logs in the store.
+func (m *MockStore) LogCount() (uint64, error) {
+	var count uint64
+	err := m.read(func() error {
+		count = uint64(len(m.indexes))
+		return nil
+	})
+	return count, err
+}
+
+// LogBytes returns the encoded size of the logs between min and max
+// inclusively, as a BuntStore would store them.
+func (m *MockStore) LogBytes(min, max uint64) (uint64, error) {
+	var bytes uint64
+	err := m.read(func() error {
+		for i := m.search(min); i < len(m.indexes) && m.indexes[i] <= max; i++ {
+			bytes += uint64(logHeaderSize + len(m.logs[m.indexes[i]].Data))
+		}
+		return nil
+	})
+	return bytes, err
+}
+
+// AscendLogGreaterOrEqual calls iter with each log from pivot to the last
+// log in index order, until iter returns false.
+func (m *MockStore) AscendLogGreaterOrEqual(pivot uint64,
+	iter func(log *raft.Log) bool) error {
+	return m.ascend(pivot, nil, iter)
+}
+
+// DescendLogLessOrEqual calls iter with each log from pivot back to the
+// first log, newest first, until iter returns false.
+func (m *MockStore) DescendLogLessOrEqual(pivot uint64,
+	iter func(log *raft.Log) bool) error {
+	return m.descend(pivot, nil, iter)
+}
+
+// AscendLogRange calls iter with each log from min to max inclusively in
+// index order, until iter returns false.
+func (m *MockStore) AscendLogRange(min, max uint64,
+	iter func(log *raft.Log) bool) error {
+	return m.AscendLogGreaterOrEqual(min, func(log *raft.Log) bool {
+		return log.Index <= max && iter(log)
+	})
+}
+
+// DescendLogRange calls iter with each log from max back to min
+// inclusively, newest first, until iter returns false.
+func (m *MockStore) DescendLogRange(max, min uint64,
+	iter func(log *raft.Log) bool) error {
+	return m.DescendLogLessOrEqual(max, func(log *raft.Log) bool {
+		return log.Index >= min && iter(log)
+	})
+}
+
+// AscendLogsOfType is like AscendLogGreaterOrEqual but only passes the
+// logs of the given types to iter.
+func (m *MockStore) AscendLogsOfType(pivot uint64,
+	iter func(log *raft.Log) bool, types ...raft.LogType) error {
+	return m.ascend(pivot, types, iter)
+}
+
+// DescendLogsOfType is like DescendLogLessOrEqual but only passes the logs
+// of the given types to iter.
+func (m *MockStore) DescendLogsOfType(pivot uint64,
+	iter func(log *raft.Log) bool, types ...raft.LogType) error {
+	return m.descend(pivot, types, iter)
+}
+
+// snapshot returns copies of the logs in index order, filtered by types
+// when it's not nil, so that iter can call back into the store.
+func (m *MockStore) snapshot(types []raft.LogType) ([]*raft.Log, error) {
+	var logs []*raft.Log
+	err := m.read(func() error {
+		for _, idx := range m.indexes {
+			stored := m.logs[idx]
+			if types != nil && !hasType(stored.Type, types) {
+				continue
+			}
+			log := new(raft.Log)
+			copyLog(log, stored)
+			logs = append(logs, log)
+		}
+		return nil
+	})
+	return logs, err
+}
+
+func hasType(typ raft.LogType, types []raft.LogType) bool {
+	for _, t := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockStore) ascend(pivot uint64, types []raft.LogType,
+	iter func(log *raft.Log) bool) error {
+	logs, err := m.snapshot(types)
+	if err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if log.Index >= pivot && !iter(log) {
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MockStore) descend(pivot uint64, types []raft.LogType,
+	iter func(log *raft.Log) bool) error {
+	logs, err := m.snapshot(types)
+	if err != nil {
+		return err
+	}
+	for i := len(logs) - 1; i >= 0; i-- {
+		if logs[i].Index <= pivot && !iter(logs[i]) {
+			break
+		}
+	}
+	return nil
+}
+
+// Set is used to set a key/value outside of the raft log.
+func (m *MockStore) Set(k, v []byte) error {
+	return m.write(func() error {
+		m.stable[string(k)] = append([]byte{}, v...)
+		return nil
+	})
+}
+
+// Get is used to retrieve a value by key.
+func (m *MockStore) Get(k []byte) ([]byte, error) {
+	var val []byte
+	err := m.read(func() error {
+		v, ok := m.stable[string(k)]
+		if !ok {
+			return raftbuntdb.ErrKeyNotFound
+		}
+		val = append([]byte{}, v...)
+		return nil
+	})
+	return val, err
+}
+
+// SetUint64 is like Set, but handles uint64 values.
+func (m *MockStore) SetUint64(key []byte, val uint64) error {
+	return m.Set(key, []byte(strconv.FormatUint(val, 10)))
+}
+
+// GetUint64 is like Get, but handles uint64 values.
+func (m *MockStore) GetUint64(key []byte) (uint64, error) {
+	val, err := m.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(val), 10, 64)
+}
+
+// StableKeys returns the keys of the stable store in order.
+func (m *MockStore) StableKeys() ([][]byte, error) {
+	var keys [][]byte
+	err := m.read(func() error {
+		for k := range m.stable {
+			keys = append(keys, []byte(k))
+		}
+		return nil
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return string(keys[i]) < string(keys[j])
+	})
+	return keys, err
+}
+
+// Peers returns raft peers.
+func (m *MockStore) Peers() ([]string, error) {
+	val, err := m.Get([]byte("peers"))
+	if err != nil {
+		if err == raftbuntdb.ErrKeyNotFound {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	var peers []string
+	if err := json.Unmarshal(val, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// SetPeers sets raft peers, and updates the servers to match as a
+// BuntStore does.
+func (m *MockStore) SetPeers(peers []string) error {
+	servers, err := m.Servers()
+	if err != nil {
+		return err
+	}
+	byAddr := make(map[string]raftbuntdb.Server)
+	for _, s := range servers {
+		byAddr[s.Address] = s
+	}
+	merged := []raftbuntdb.Server{}
+	for _, addr := range peers {
+		s, ok := byAddr[addr]
+		if !ok {
+			s = raftbuntdb.Server{ID: addr, Address: addr}
+		}
+		delete(byAddr, addr)
+		s.Suffrage = raftbuntdb.Voter
+		merged = append(merged, s)
+	}
+	for _, s := range servers {
+		if _, ok := byAddr[s.Address]; ok && s.Suffrage != raftbuntdb.Voter {
+			merged = append(merged, s)
+		}
+	}
+	return m.setPeerKeys(peers, merged)
+}
+
+// Servers returns the peers with their IDs and suffrage, upgrading the
+// legacy peers as a BuntStore does.
+func (m *MockStore) Servers() ([]raftbuntdb.Server, error) {
+	servers := []raftbuntdb.Server{}
+	val, err := m.Get([]byte("servers"))
+	if err == nil {
+		err = json.Unmarshal(val, &servers)
+		return servers, err
+	}
+	if err != raftbuntdb.ErrKeyNotFound {
+		return nil, err
+	}
+	val, err = m.Get([]byte("peers"))
+	if err == raftbuntdb.ErrKeyNotFound {
+		return servers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var peers []string
+	if err := json.Unmarshal(val, &peers); err != nil {
+		return nil, err
+	}
+	for _, peer := range peers {
+		servers = append(servers, raftbuntdb.Server{ID: peer, Address: peer})
+	}
+	data, err := json.Marshal(servers)
+	if err != nil {
+		return nil, err
+	}
+	return servers, m.Set([]byte("servers"), data)
+}
+
+// SetServers sets the peers with their IDs and suffrage, and the voters'
+// addresses as the legacy peers.
+func (m *MockStore) SetServers(servers []raftbuntdb.Server) error {
+	peers := []string{}
+	for _, s := range servers {
+		if s.Suffrage == raftbuntdb.Voter {
+			peers = append(peers, s.Address)
+		}
+	}
+	return m.setPeerKeys(peers, servers)
+}
+
+func (m *MockStore) setPeerKeys(peers []string, servers []raftbuntdb.Server) error {
+	pdata, err := json.Marshal(peers)
+	if err != nil {
+		return err
+	}
+	sdata, err := json.Marshal(servers)
+	if err != nil {
+		return err
+	}
+	return m.write(func() error {
+		m.stable["peers"] = pdata
+		m.stable["servers"] = sdata
+		return nil
+	})
+}
+
+// Stats returns the statistics of the store. FileSize is always zero.
+func (m *MockStore) Stats() (raftbuntdb.Stats, error) {
+	var stats raftbuntdb.Stats
+	err := m.read(func() error {
+		if len(m.indexes) > 0 {
+			stats.FirstIndex = m.indexes[0]
+			stats.LastIndex = m.indexes[len(m.indexes)-1]
+		}
+		stats.Logs = uint64(len(m.indexes))
+		for _, log := range m.logs {
+			stats.LogBytes += int64(logHeaderSize + len(log.Data))
+		}
+		stats.StableKeys = uint64(len(m.stable))
+		return nil
+	})
+	return stats, err
+}
@@ -0,0 +1,125 @@
+package raftbuntdbtest
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/raft"
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+func TestMockStore(t *testing.T) {
+	Suite{
+		Open: func(path string) (Store, error) {
+			return NewMockStore(), nil
+		},
+	}.Run(t)
+}
+
+// extendedStore is the part of the BuntStore API that MockStore mirrors.
+type extendedStore interface {
+	Store
+	GetFirstLog(log *raft.Log) error
+	GetLastLog(log *raft.Log) error
+	CompactTo(idx uint64) error
+	TruncateAfter(idx uint64) error
+	LogCount() (uint64, error)
+	LogBytes(min, max uint64) (uint64, error)
+	AscendLogRange(min, max uint64, iter func(log *raft.Log) bool) error
+	DescendLogRange(max, min uint64, iter func(log *raft.Log) bool) error
+	DescendLogsOfType(pivot uint64, iter func(log *raft.Log) bool,
+		types ...raft.LogType) error
+	StableKeys() ([][]byte, error)
+	Peers() ([]string, error)
+	SetPeers(peers []string) error
+	Servers() ([]raftbuntdb.Server, error)
+	Stats() (raftbuntdb.Stats, error)
+	Shrink() error
+	Close() error
+}
+
+var (
+	_ extendedStore = (*MockStore)(nil)
+	_ extendedStore = (*raftbuntdb.BuntStore)(nil)
+)
+
+// exercise runs the same operations against a store and returns what it
+// observed.
+func exercise(t *testing.T, store extendedStore) []interface{} {
+	var logs []*raft.Log
+	for i := uint64(1); i <= 20; i++ {
+		typ := raft.LogCommand
+		if i%5 == 0 {
+			typ = raft.LogAddPeer
+		}
+		logs = append(logs, &raft.Log{Index: i, Term: i / 10, Type: typ,
+			Data: make([]byte, i)})
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(18, 20); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.CompactTo(3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.TruncateAfter(16); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.SetUint64([]byte("CurrentTerm"), 2)
+	store.SetPeers([]string{"a", "b"})
+	if err := store.Shrink(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var out []interface{}
+	record := func(vals ...interface{}) {
+		out = append(out, vals...)
+	}
+	var first, last raft.Log
+	record(store.GetFirstLog(&first), first, store.GetLastLog(&last), last)
+	record(store.LogCount())
+	record(store.LogBytes(0, 100))
+	record(store.LogBytes(5, 10))
+	var idxs []uint64
+	iter := func(log *raft.Log) bool {
+		idxs = append(idxs, log.Index)
+		return len(idxs) < 5
+	}
+	record(store.AscendLogRange(2, 9, iter), idxs)
+	idxs = nil
+	record(store.DescendLogRange(100, 8, iter), idxs)
+	idxs = nil
+	record(store.DescendLogsOfType(16, iter, raft.LogAddPeer), idxs)
+	record(store.StableKeys())
+	record(store.Peers())
+	record(store.Servers())
+	stats, err := store.Stats()
+	stats.FileSize = 0
+	record(stats, err)
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	_, err = store.FirstIndex()
+	record(err == raftbuntdb.ErrClosed)
+	return out
+}
+
+func TestMockStore_MatchesBuntStore(t *testing.T) {
+	bunt, err := raftbuntdb.Open(filepath.Join(t.TempDir(), "raft.db"), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	want := exercise(t, bunt)
+	got := exercise(t, NewMockStore())
+	if len(got) != len(want) {
+		t.Fatalf("bad: %v", got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("result %d: got %#v, want %#v", i, got[i], want[i])
+		}
+	}
+}
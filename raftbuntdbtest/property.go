@@ -0,0 +1,327 @@
+package raftbuntdbtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+// maxTrace is the number of operations shown when a Property fails.
+const maxTrace = 20
+
+// Property drives random interleavings of StoreLogs, DeleteRange, GetLog,
+// Set and, for durable stores, reopening the store, and checks the store
+// against an in-memory model after every operation: the first and last
+// index, that the log is contiguous, and that every log and stable value
+// reads back as written. Wrappers that add an encoding or a cache can run
+// it to check they don't change what raft reads back.
+//
+// A sequence of operations is decoded from bytes, so Fuzz can use the
+// fuzzer of go test to explore them, while Run replays random ones.
+type Property struct {
+	// Open opens the store at path, creating it if it does not exist, as
+	// for a Suite. Required.
+	Open func(path string) (Store, error)
+
+	// Durable enables the operation that closes and reopens the store at
+	// the same path, after which the whole log is read back.
+	Durable bool
+
+	// Ops is the maximum number of operations of a sequence. Defaults to
+	// 200.
+	Ops int
+
+	// Runs is the number of sequences Run tries, and Seed seeds the first
+	// of them. Runs defaults to 10.
+	Runs int
+	Seed int64
+}
+
+func (p Property) ops() int {
+	if p.Ops <= 0 {
+		return 200
+	}
+	return p.Ops
+}
+
+// Run checks Runs random sequences of operations, each as a subtest named
+// after its seed.
+func (p Property) Run(t *testing.T) {
+	runs := p.Runs
+	if runs <= 0 {
+		runs = 10
+	}
+	for i := 0; i < runs; i++ {
+		seed := p.Seed + int64(i)
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			data := make([]byte, p.ops()*4)
+			rand.New(rand.NewSource(seed)).Read(data)
+			p.Check(t, data)
+		})
+	}
+}
+
+// Fuzz adds a few sequences to the corpus of f and fuzzes the operations
+// decoded from its inputs, for use as the body of a fuzz target:
+//
+//	func FuzzStore(f *testing.F) {
+//		raftbuntdbtest.Property{Open: open, Durable: true}.Fuzz(f)
+//	}
+func (p Property) Fuzz(f *testing.F) {
+	for seed := int64(0); seed < 4; seed++ {
+		data := make([]byte, 64)
+		rand.New(rand.NewSource(seed)).Read(data)
+		f.Add(data)
+	}
+	f.Add([]byte{0, 7, 0, 3, 2, 5, 1, 2, 4, 0, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p.Check(t, data)
+	})
+}
+
+// Check runs the operations decoded from data against a new store in a
+// temporary directory, failing t at the first broken invariant.
+func (p Property) Check(t *testing.T, data []byte) {
+	t.Helper()
+	m := &propertyModel{
+		p:      p,
+		t:      t,
+		dir:    t.TempDir(),
+		data:   data,
+		logs:   map[uint64]*raft.Log{},
+		stable: map[string][]byte{},
+	}
+	m.store = m.open()
+	defer func() { closeStore(t, m.store) }()
+	for i := 0; i < p.ops() && len(m.data) > 0; i++ {
+		m.step()
+		m.check()
+	}
+}
+
+// propertyModel holds what the store under test must hold.
+type propertyModel struct {
+	p     Property
+	t     *testing.T
+	dir   string
+	store Store
+	data  []byte
+	trace []string
+
+	// first and last are the indexes of the logs, which are contiguous
+	first, last uint64
+	term        uint64
+	logs        map[uint64]*raft.Log
+	stable      map[string][]byte
+}
+
+// next consumes a byte of the input, or returns zero once it's used up.
+func (m *propertyModel) next() byte {
+	if len(m.data) == 0 {
+		return 0
+	}
+	b := m.data[0]
+	m.data = m.data[1:]
+	return b
+}
+
+// pick returns an index between lo and hi, which must not be less than lo.
+func (m *propertyModel) pick(lo, hi uint64) uint64 {
+	return lo + uint64(m.next())%(hi-lo+1)
+}
+
+// fail fails the test with the last operations run.
+func (m *propertyModel) fail(format string, args ...interface{}) {
+	m.t.Helper()
+	trace := m.trace
+	if len(trace) > maxTrace {
+		trace = trace[len(trace)-maxTrace:]
+	}
+	m.t.Fatalf("%s\nafter %d operations, ending with:\n\t%s", fmt.Sprintf(format, args...),
+		len(m.trace), strings.Join(trace, "\n\t"))
+}
+
+func (m *propertyModel) open() Store {
+	m.t.Helper()
+	store, err := m.p.Open(filepath.Join(m.dir, "raft.db"))
+	if err != nil {
+		m.fail("open: %s", err)
+	}
+	return store
+}
+
+// newLogs returns n logs from idx with the current term. The size of the
+// data comes from the input, and is now and then large enough for a
+// store to handle it differently.
+func (m *propertyModel) newLogs(idx uint64, n int) []*raft.Log {
+	logs := make([]*raft.Log, n)
+	for i := range logs {
+		size := int(m.next())
+		if size > 250 {
+			size = (size - 250) * 16 << 10
+		}
+		data := make([]byte, size)
+		for j := range data {
+			data[j] = byte(idx) + byte(j)
+		}
+		logs[i] = &raft.Log{Index: idx, Term: m.term, Type: raft.LogType(m.next() % 5), Data: data}
+		idx++
+	}
+	return logs
+}
+
+// storeLogs stores logs in the store and the model.
+func (m *propertyModel) storeLogs(logs []*raft.Log) {
+	m.t.Helper()
+	if err := m.store.StoreLogs(logs); err != nil {
+		m.fail("StoreLogs: %s", err)
+	}
+	for _, log := range logs {
+		m.logs[log.Index] = log
+		if m.first == 0 || log.Index < m.first {
+			m.first = log.Index
+		}
+		if log.Index > m.last {
+			m.last = log.Index
+		}
+	}
+}
+
+// deleteRange deletes min to max from the store and the model.
+func (m *propertyModel) deleteRange(min, max uint64) {
+	m.t.Helper()
+	if err := m.store.DeleteRange(min, max); err != nil {
+		m.fail("DeleteRange: %s", err)
+	}
+	for idx := min; idx <= max; idx++ {
+		delete(m.logs, idx)
+	}
+	switch {
+	case min <= m.first && max >= m.last:
+		m.first, m.last = 0, 0
+	case min <= m.first && max >= m.first:
+		m.first = max + 1
+	case max >= m.last && min <= m.last:
+		m.last = min - 1
+	}
+}
+
+// step runs the next operation decoded from the input.
+func (m *propertyModel) step() {
+	m.t.Helper()
+	switch op := m.next() % 7; {
+	case op <= 1:
+		// Append, or start the log anywhere, as after a snapshot
+		idx := m.last + 1
+		if m.last == 0 {
+			idx = 1 + uint64(m.next())
+		}
+		n := 1 + int(m.next()%8)
+		m.trace = append(m.trace, fmt.Sprintf("StoreLogs(%d..%d)", idx, idx+uint64(n)-1))
+		m.storeLogs(m.newLogs(idx, n))
+	case op == 2 && m.last != 0:
+		// Replace the tail with the logs of a new leader
+		idx := m.pick(m.first, m.last)
+		n := 1 + int(m.next()%8)
+		m.term++
+		m.trace = append(m.trace, fmt.Sprintf("DeleteRange(%d, %d) StoreLogs(%d..%d)",
+			idx, m.last, idx, idx+uint64(n)-1))
+		m.deleteRange(idx, m.last)
+		m.storeLogs(m.newLogs(idx, n))
+	case op == 3 && m.last != 0:
+		// Compact the head
+		max := m.pick(m.first, m.last)
+		m.trace = append(m.trace, fmt.Sprintf("DeleteRange(%d, %d)", m.first, max))
+		m.deleteRange(m.first, max)
+	case op == 4:
+		idx := uint64(m.next())
+		if m.last != 0 {
+			idx = m.pick(m.first-1, m.last+1)
+		}
+		m.trace = append(m.trace, fmt.Sprintf("GetLog(%d)", idx))
+		m.checkLog(idx)
+	case op == 5:
+		key := fmt.Sprintf("key-%d", m.next()%4)
+		val := bytes.Repeat([]byte{m.next()}, int(m.next()%16))
+		m.trace = append(m.trace, fmt.Sprintf("Set(%q, %d bytes)", key, len(val)))
+		if err := m.store.Set([]byte(key), val); err != nil {
+			m.fail("Set: %s", err)
+		}
+		m.stable[key] = val
+	case op == 6 && m.p.Durable:
+		m.trace = append(m.trace, "Reopen")
+		if c, ok := m.store.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				m.fail("Close: %s", err)
+			}
+		}
+		m.store = m.open()
+		for idx := m.first; idx != 0 && idx <= m.last; idx++ {
+			m.checkLog(idx)
+		}
+	default:
+		m.trace = append(m.trace, "Skip")
+	}
+}
+
+// checkLog checks that the log at idx, which may be missing, reads back
+// as the model holds it.
+func (m *propertyModel) checkLog(idx uint64) {
+	m.t.Helper()
+	var log raft.Log
+	err := m.store.GetLog(idx, &log)
+	want, ok := m.logs[idx]
+	if !ok {
+		if err != raft.ErrLogNotFound {
+			m.fail("GetLog(%d): got %v, want ErrLogNotFound", idx, err)
+		}
+		return
+	}
+	if err != nil {
+		m.fail("GetLog(%d): %s", idx, err)
+	}
+	if log.Index != want.Index || log.Term != want.Term || log.Type != want.Type ||
+		!bytes.Equal(log.Data, want.Data) {
+		m.fail("GetLog(%d): got index %d term %d type %d and %d bytes, want term %d type %d "+
+			"and %d bytes", idx, log.Index, log.Term, log.Type, len(log.Data), want.Term,
+			want.Type, len(want.Data))
+	}
+}
+
+// check checks the invariants that hold after every operation: the first
+// and last index, the logs just outside and at both ends of the log, and
+// the stable values.
+func (m *propertyModel) check() {
+	m.t.Helper()
+	first, err := m.store.FirstIndex()
+	if err != nil {
+		m.fail("FirstIndex: %s", err)
+	}
+	last, err := m.store.LastIndex()
+	if err != nil {
+		m.fail("LastIndex: %s", err)
+	}
+	if first != m.first || last != m.last {
+		m.fail("got logs %d to %d, want %d to %d", first, last, m.first, m.last)
+	}
+	if m.last != 0 {
+		for _, idx := range []uint64{m.first - 1, m.first, m.pick(m.first, m.last), m.last, m.last + 1} {
+			m.checkLog(idx)
+		}
+	}
+	for key, want := range m.stable {
+		val, err := m.store.Get([]byte(key))
+		if err != nil {
+			m.fail("Get(%q): %s", key, err)
+		}
+		if !bytes.Equal(val, want) {
+			m.fail("Get(%q): got %q, want %q", key, val, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package raftbuntdbtest
+
+import (
+	"testing"
+
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+func openBuntStore(path string) (Store, error) {
+	return raftbuntdb.Open(path, nil)
+}
+
+func TestProperty(t *testing.T) {
+	Property{Open: openBuntStore, Durable: true}.Run(t)
+}
+
+func TestProperty_MockStore(t *testing.T) {
+	Property{
+		Open: func(path string) (Store, error) { return NewMockStore(), nil },
+		Runs: 20,
+		Seed: 100,
+	}.Run(t)
+}
+
+func FuzzProperty(f *testing.F) {
+	Property{Open: openBuntStore, Durable: true}.Fuzz(f)
+}
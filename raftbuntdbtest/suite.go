@@ -0,0 +1,371 @@
+// Package raftbuntdbtest provides a conformance suite for raft log and
+// stable stores. It checks the semantics raft relies on, so that wrappers
+// around a BuntStore, or other implementations, can be validated with the
+// same tests the BuntStore passes. It also provides MockStore, an
+// in-memory store for application tests, and Property, which checks a
+// store against random sequences of operations.
+package raftbuntdbtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+// Store is the interface under test.
+type Store interface {
+	raft.LogStore
+	raft.StableStore
+}
+
+// Suite is a conformance suite for a Store implementation.
+type Suite struct {
+	// Open opens the store at path, creating it if it does not exist.
+	// Stores that implement io.Closer are closed at the end of each test.
+	// Required.
+	Open func(path string) (Store, error)
+
+	// Durable enables the tests that close and reopen a store at the same
+	// path and expect its contents to survive. Stores that keep their
+	// contents in memory should leave it unset.
+	Durable bool
+}
+
+// Run runs every test of the suite as a subtest of t.
+func (s Suite) Run(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store Store)
+	}{
+		{"Empty", testEmpty},
+		{"StoreLogs", testStoreLogs},
+		{"Ordering", testOrdering},
+		{"Overwrite", testOverwrite},
+		{"DeleteHead", testDeleteHead},
+		{"DeleteTail", testDeleteTail},
+		{"DeleteMissing", testDeleteMissing},
+		{"LogNotFound", testLogNotFound},
+		{"DataIsCopied", testDataIsCopied},
+		{"Stable", testStable},
+		{"StableNotFound", testStableNotFound},
+		{"Uint64", testUint64},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			store := s.open(t, t.TempDir())
+			defer closeStore(t, store)
+			test.fn(t, store)
+		})
+	}
+	t.Run("Reopen", func(t *testing.T) {
+		if !s.Durable {
+			t.Skip("store is not durable")
+		}
+		s.testReopen(t)
+	})
+}
+
+// open opens the store in dir, failing the test on error.
+func (s Suite) open(t *testing.T, dir string) Store {
+	t.Helper()
+	store, err := s.Open(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	return store
+}
+
+func closeStore(t *testing.T, store Store) {
+	t.Helper()
+	if c, ok := store.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			t.Fatalf("close: %s", err)
+		}
+	}
+}
+
+// testLog returns a command log with data derived from its index.
+func testLog(idx, term uint64) *raft.Log {
+	return &raft.Log{
+		Index: idx,
+		Term:  term,
+		Type:  raft.LogCommand,
+		Data:  []byte(fmt.Sprintf("log-%d", idx)),
+	}
+}
+
+// storeRange stores the logs from min to max with term.
+func storeRange(t *testing.T, store Store, min, max, term uint64) {
+	t.Helper()
+	var logs []*raft.Log
+	for i := min; i <= max; i++ {
+		logs = append(logs, testLog(i, term))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("StoreLogs: %s", err)
+	}
+}
+
+// checkIndexes checks the first and last index of the store.
+func checkIndexes(t *testing.T, store Store, first, last uint64) {
+	t.Helper()
+	idx, err := store.FirstIndex()
+	if err != nil {
+		t.Fatalf("FirstIndex: %s", err)
+	}
+	if idx != first {
+		t.Fatalf("FirstIndex: got %d, want %d", idx, first)
+	}
+	if idx, err = store.LastIndex(); err != nil {
+		t.Fatalf("LastIndex: %s", err)
+	}
+	if idx != last {
+		t.Fatalf("LastIndex: got %d, want %d", idx, last)
+	}
+}
+
+// checkLog checks that the log at idx has the given term and the data of
+// testLog.
+func checkLog(t *testing.T, store Store, idx, term uint64) {
+	t.Helper()
+	var log raft.Log
+	if err := store.GetLog(idx, &log); err != nil {
+		t.Fatalf("GetLog(%d): %s", idx, err)
+	}
+	want := testLog(idx, term)
+	if log.Index != want.Index || log.Term != want.Term ||
+		log.Type != want.Type || !bytes.Equal(log.Data, want.Data) {
+		t.Fatalf("GetLog(%d): got %+v, want %+v", idx, log, *want)
+	}
+}
+
+// checkNotFound checks that the log at idx is missing.
+func checkNotFound(t *testing.T, store Store, idx uint64) {
+	t.Helper()
+	var log raft.Log
+	if err := store.GetLog(idx, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("GetLog(%d): got %v, want %v", idx, err, raft.ErrLogNotFound)
+	}
+}
+
+func testEmpty(t *testing.T, store Store) {
+	checkIndexes(t, store, 0, 0)
+	if err := store.StoreLogs(nil); err != nil {
+		t.Fatalf("StoreLogs: %s", err)
+	}
+	checkIndexes(t, store, 0, 0)
+}
+
+func testStoreLogs(t *testing.T, store Store) {
+	if err := store.StoreLog(testLog(1, 1)); err != nil {
+		t.Fatalf("StoreLog: %s", err)
+	}
+	storeRange(t, store, 2, 10, 1)
+	checkIndexes(t, store, 1, 10)
+	for i := uint64(1); i <= 10; i++ {
+		checkLog(t, store, i, 1)
+	}
+
+	// Every log type round trips
+	types := []raft.LogType{raft.LogCommand, raft.LogNoop, raft.LogAddPeer,
+		raft.LogRemovePeer, raft.LogBarrier}
+	for i, typ := range types {
+		log := &raft.Log{Index: uint64(11 + i), Term: 2, Type: typ}
+		if err := store.StoreLog(log); err != nil {
+			t.Fatalf("StoreLog: %s", err)
+		}
+		var out raft.Log
+		if err := store.GetLog(log.Index, &out); err != nil {
+			t.Fatalf("GetLog: %s", err)
+		}
+		if out.Type != typ || out.Term != 2 || len(out.Data) != 0 {
+			t.Fatalf("GetLog(%d): got %+v", log.Index, out)
+		}
+	}
+}
+
+func testOrdering(t *testing.T, store Store) {
+	// Indexes are ordered numerically, not as strings
+	storeRange(t, store, 9, 12, 1)
+	storeRange(t, store, 98, 101, 1)
+	checkIndexes(t, store, 9, 101)
+
+	// Large indexes don't overflow
+	big := uint64(1<<63 + 5)
+	if err := store.StoreLog(testLog(big, 1)); err != nil {
+		t.Fatalf("StoreLog: %s", err)
+	}
+	checkIndexes(t, store, 9, big)
+	checkLog(t, store, big, 1)
+}
+
+func testOverwrite(t *testing.T, store Store) {
+	// Raft replaces a conflicting tail by storing over it
+	storeRange(t, store, 1, 10, 1)
+	storeRange(t, store, 6, 8, 2)
+	checkIndexes(t, store, 1, 10)
+	checkLog(t, store, 5, 1)
+	checkLog(t, store, 6, 2)
+	checkLog(t, store, 8, 2)
+	checkLog(t, store, 9, 1)
+}
+
+func testDeleteHead(t *testing.T, store Store) {
+	storeRange(t, store, 1, 10, 1)
+	if err := store.DeleteRange(1, 4); err != nil {
+		t.Fatalf("DeleteRange: %s", err)
+	}
+	checkIndexes(t, store, 5, 10)
+	for i := uint64(1); i <= 4; i++ {
+		checkNotFound(t, store, i)
+	}
+	checkLog(t, store, 5, 1)
+
+	// Deleting everything leaves an empty log
+	if err := store.DeleteRange(5, 10); err != nil {
+		t.Fatalf("DeleteRange: %s", err)
+	}
+	checkIndexes(t, store, 0, 0)
+}
+
+func testDeleteTail(t *testing.T, store Store) {
+	storeRange(t, store, 1, 10, 1)
+	if err := store.DeleteRange(7, 10); err != nil {
+		t.Fatalf("DeleteRange: %s", err)
+	}
+	checkIndexes(t, store, 1, 6)
+	checkNotFound(t, store, 7)
+
+	// The log continues from the new tail
+	storeRange(t, store, 7, 8, 2)
+	checkIndexes(t, store, 1, 8)
+	checkLog(t, store, 7, 2)
+}
+
+func testDeleteMissing(t *testing.T, store Store) {
+	if err := store.DeleteRange(1, 10); err != nil {
+		t.Fatalf("DeleteRange on an empty log: %s", err)
+	}
+	storeRange(t, store, 5, 10, 1)
+	if err := store.DeleteRange(1, 6); err != nil {
+		t.Fatalf("DeleteRange: %s", err)
+	}
+	checkIndexes(t, store, 7, 10)
+}
+
+func testLogNotFound(t *testing.T, store Store) {
+	checkNotFound(t, store, 1)
+	storeRange(t, store, 5, 10, 1)
+	checkNotFound(t, store, 4)
+	checkNotFound(t, store, 11)
+}
+
+func testDataIsCopied(t *testing.T, store Store) {
+	log := testLog(1, 1)
+	if err := store.StoreLog(log); err != nil {
+		t.Fatalf("StoreLog: %s", err)
+	}
+
+	// Changing the stored log must not change the store
+	log.Data[0] = 'X'
+	checkLog(t, store, 1, 1)
+}
+
+func testStable(t *testing.T, store Store) {
+	vals := map[string][]byte{
+		"peers":  []byte(`["127.0.0.1:1000"]`),
+		"binary": {0, 1, 2, 0xff},
+		"empty":  {},
+	}
+	for k, v := range vals {
+		if err := store.Set([]byte(k), v); err != nil {
+			t.Fatalf("Set(%q): %s", k, err)
+		}
+	}
+	for k, v := range vals {
+		got, err := store.Get([]byte(k))
+		if err != nil {
+			t.Fatalf("Get(%q): %s", k, err)
+		}
+		if !bytes.Equal(got, v) {
+			t.Fatalf("Get(%q): got %q, want %q", k, got, v)
+		}
+	}
+
+	// Set replaces the value
+	if err := store.Set([]byte("peers"), []byte("[]")); err != nil {
+		t.Fatalf("Set: %s", err)
+	}
+	if got, _ := store.Get([]byte("peers")); string(got) != "[]" {
+		t.Fatalf("Get: got %q", got)
+	}
+
+	// Stable keys don't affect the log
+	checkIndexes(t, store, 0, 0)
+}
+
+func testStableNotFound(t *testing.T, store Store) {
+	// Raft treats a "not found" error as a missing value
+	if _, err := store.Get([]byte("missing")); err == nil ||
+		err.Error() != "not found" {
+		t.Fatalf("Get: got %v, want not found", err)
+	}
+	if _, err := store.GetUint64([]byte("missing")); err == nil ||
+		err.Error() != "not found" {
+		t.Fatalf("GetUint64: got %v, want not found", err)
+	}
+}
+
+func testUint64(t *testing.T, store Store) {
+	for _, v := range []uint64{0, 1, 1 << 32, 1<<64 - 1} {
+		if err := store.SetUint64([]byte("CurrentTerm"), v); err != nil {
+			t.Fatalf("SetUint64: %s", err)
+		}
+		got, err := store.GetUint64([]byte("CurrentTerm"))
+		if err != nil {
+			t.Fatalf("GetUint64: %s", err)
+		}
+		if got != v {
+			t.Fatalf("GetUint64: got %d, want %d", got, v)
+		}
+	}
+}
+
+func (s Suite) testReopen(t *testing.T) {
+	dir := t.TempDir()
+	store := s.open(t, dir)
+	storeRange(t, store, 1, 10, 1)
+	if err := store.DeleteRange(1, 3); err != nil {
+		t.Fatalf("DeleteRange: %s", err)
+	}
+	storeRange(t, store, 9, 10, 2)
+	if err := store.SetUint64([]byte("CurrentTerm"), 2); err != nil {
+		t.Fatalf("SetUint64: %s", err)
+	}
+	if err := store.Set([]byte("LastVoteCand"), []byte("node1")); err != nil {
+		t.Fatalf("Set: %s", err)
+	}
+	closeStore(t, store)
+
+	store = s.open(t, dir)
+	defer closeStore(t, store)
+	checkIndexes(t, store, 4, 10)
+	checkNotFound(t, store, 3)
+	checkLog(t, store, 8, 1)
+	checkLog(t, store, 10, 2)
+	if term, err := store.GetUint64([]byte("CurrentTerm")); err != nil || term != 2 {
+		t.Fatalf("GetUint64: got %d, %v", term, err)
+	}
+	if val, err := store.Get([]byte("LastVoteCand")); err != nil || string(val) != "node1" {
+		t.Fatalf("Get: got %q, %v", val, err)
+	}
+
+	// The reopened store keeps appending
+	storeRange(t, store, 11, 12, 2)
+	checkIndexes(t, store, 4, 12)
+}
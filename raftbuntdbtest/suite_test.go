@@ -0,0 +1,96 @@
+package raftbuntdbtest
+
+import (
+	"testing"
+
+	raftbuntdb "github.com/tidwall/raft-buntdb"
+)
+
+func testSuite(t *testing.T, opts raftbuntdb.Options) {
+	Suite{
+		Open: func(path string) (Store, error) {
+			return raftbuntdb.Open(path, &opts)
+		},
+		Durable: true,
+	}.Run(t)
+}
+
+func TestBuntStore(t *testing.T) {
+	testSuite(t, raftbuntdb.Options{})
+}
+
+func TestBuntStore_BinaryKeys(t *testing.T) {
+	testSuite(t, raftbuntdb.Options{KeyEncoding: raftbuntdb.BinaryKeys})
+}
+
+func TestBuntStore_Options(t *testing.T) {
+	testSuite(t, raftbuntdb.Options{
+		Durability:  raftbuntdb.High,
+		GroupCommit: &raftbuntdb.GroupCommit{},
+		TermIndex:   true,
+		ZeroCopy:    true,
+	})
+}
+
+func TestBuntStore_KeyPrefixes(t *testing.T) {
+	testSuite(t, raftbuntdb.Options{LogPrefix: "raftlog:", StablePrefix: "raftconf:"})
+}
+
+func TestBuntStore_LogCache(t *testing.T) {
+	testSuite(t, raftbuntdb.Options{LogCache: 16})
+}
+
+func TestSegmentStore(t *testing.T) {
+	Suite{
+		Open: func(path string) (Store, error) {
+			return raftbuntdb.OpenSegmentStore(path, &raftbuntdb.SegmentOptions{
+				SegmentSize: 512,
+			})
+		},
+		Durable: true,
+	}.Run(t)
+}
+
+func TestShardedStore(t *testing.T) {
+	Suite{
+		Open: func(path string) (Store, error) {
+			return raftbuntdb.OpenShardedStore(path, &raftbuntdb.ShardOptions{
+				ShardSize: 16,
+			})
+		},
+		Durable: true,
+	}.Run(t)
+}
+
+func TestMirrorStore(t *testing.T) {
+	Suite{
+		Open: func(path string) (Store, error) {
+			primary, err := raftbuntdb.Open(path, nil)
+			if err != nil {
+				return nil, err
+			}
+			secondary, err := raftbuntdb.Open(path+".mirror", nil)
+			if err != nil {
+				primary.Close()
+				return nil, err
+			}
+			return &closingMirror{raftbuntdb.NewMirrorStore(primary, secondary),
+				primary, secondary}, nil
+		},
+		Durable: true,
+	}.Run(t)
+}
+
+// closingMirror closes both stores of a MirrorStore.
+type closingMirror struct {
+	*raftbuntdb.MirrorStore
+	primary, secondary *raftbuntdb.BuntStore
+}
+
+func (m *closingMirror) Close() error {
+	err := m.primary.Close()
+	if serr := m.secondary.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
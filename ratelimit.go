@@ -0,0 +1,107 @@
+package raftbuntdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimit caps the rate of a store's writes and reads, so that a runaway
+// catch-up or an administrative dump can't saturate a disk shared with the
+// FSM. A limited call waits for its turn before its transaction, so that
+// it doesn't hold up other calls while it waits. Each limit allows a burst
+// of a second's worth.
+type RateLimit struct {
+	// WriteBytes is the most bytes written per second by StoreLogs,
+	// StoreLogsContext and the setters of the stable store, counting 17
+	// bytes of header for each log. StoreLogsAsync isn't limited, as it
+	// doesn't block. Zero is no limit.
+	WriteBytes int64
+
+	// ReadOps is the most logs read per second by GetLog and the log
+	// iterations. An iteration is charged for the logs it passed to its
+	// iterator once it returns, so it runs at full speed but the reads
+	// after it wait. Zero is no limit.
+	ReadOps int64
+}
+
+// rateLimits holds the token buckets of a store's RateLimit.
+type rateLimits struct {
+	write, read tokenBucket
+}
+
+// SetRateLimit replaces the rate limits of the store, which start out as
+// Options.RateLimit. The calls already waiting keep their turn.
+func (b *BuntStore) SetRateLimit(limit RateLimit) {
+	b.limits.write.setRate(limit.WriteBytes)
+	b.limits.read.setRate(limit.ReadOps)
+}
+
+// waitTurn takes n tokens from t, waiting for them unless ctx is done or
+// the store starts closing first.
+func (b *BuntStore) waitTurn(ctx context.Context, t *tokenBucket, n int) error {
+	d := t.take(n, time.Now())
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.calls.stopping():
+		return ErrClosed
+	}
+}
+
+// tokenBucket refills at rate tokens per second, up to a burst of a
+// second's worth. A rate of zero is no limit.
+type tokenBucket struct {
+	// limited is set when rate isn't zero, so that the calls of a store
+	// without a limit don't take mu.
+	limited atomic.Bool
+
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func (t *tokenBucket) setRate(rate int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rate < 0 {
+		rate = 0
+	}
+	t.rate, t.tokens, t.last = float64(rate), float64(rate), time.Time{}
+	t.limited.Store(rate > 0)
+}
+
+// take takes n tokens at now and returns how long to wait for them. The
+// bucket goes into debt, so that a take larger than the burst waits for
+// the deficit rather than forever, and the takes after it wait their turn.
+func (t *tokenBucket) take(n int, now time.Time) time.Duration {
+	if !t.limited.Load() {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rate == 0 {
+		return 0
+	}
+	if !t.last.IsZero() {
+		t.tokens += now.Sub(t.last).Seconds() * t.rate
+		if t.tokens > t.rate {
+			t.tokens = t.rate
+		}
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	if t.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-t.tokens / t.rate * float64(time.Second))
+}
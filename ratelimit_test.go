@@ -0,0 +1,90 @@
+package raftbuntdb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+func TestTokenBucket(t *testing.T) {
+	var tb tokenBucket
+	now := time.Now()
+	if d := tb.take(1000, now); d != 0 {
+		t.Fatalf("bad: %s", d)
+	}
+
+	// A second's worth is allowed at once, and then the takes wait
+	tb.setRate(100)
+	if d := tb.take(100, now); d != 0 {
+		t.Fatalf("bad: %s", d)
+	}
+	if d := tb.take(50, now); d != 500*time.Millisecond {
+		t.Fatalf("bad: %s", d)
+	}
+	if d := tb.take(50, now.Add(500*time.Millisecond)); d != 500*time.Millisecond {
+		t.Fatalf("bad: %s", d)
+	}
+
+	// The bucket refills up to the burst
+	if d := tb.take(100, now.Add(10*time.Second)); d != 0 {
+		t.Fatalf("bad: %s", d)
+	}
+	if d := tb.take(1, now.Add(10*time.Second)); d != 10*time.Millisecond {
+		t.Fatalf("bad: %s", d)
+	}
+	tb.setRate(0)
+	if d := tb.take(1000, now); d != 0 {
+		t.Fatalf("bad: %s", d)
+	}
+}
+
+func TestBuntStore_RateLimit(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{RateLimit: &RateLimit{ReadOps: 20}})
+	defer os.Remove(store.path)
+	if err := store.StoreLog(testRaftLog(1, "data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// 30 reads at 20 per second take at least half a second
+	start := time.Now()
+	log := new(raft.Log)
+	for i := 0; i < 30; i++ {
+		if err := store.GetLog(1, log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("bad: %s", d)
+	}
+
+	// Lifting the limit takes effect at once
+	store.SetRateLimit(RateLimit{})
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		if err := store.GetLog(1, log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Fatalf("bad: %s", d)
+	}
+
+	// A write waiting its turn gives up with its context or the store
+	store.SetRateLimit(RateLimit{WriteBytes: 100})
+	big := testRaftLog(2, string(make([]byte, 1000)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := store.StoreLogsContext(ctx, []*raft.Log{big}); err != context.DeadlineExceeded {
+		t.Fatalf("bad: %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		store.Close()
+	}()
+	if err := store.StoreLog(testRaftLog(3, "data")); err != ErrClosed {
+		t.Fatalf("bad: %v", err)
+	}
+}
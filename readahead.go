@@ -0,0 +1,154 @@
+package raftbuntdb
+
+import (
+	"sync"
+
+	"github.com/tidwall/buntdb"
+)
+
+// readAheadRun is the number of GetLog calls for consecutive indexes after
+// which the reader counts as sequential, such as a follower catching up.
+const readAheadRun = 2
+
+// readAhead holds the logs prefetched for a sequential reader of GetLog.
+type readAhead struct {
+	mu sync.Mutex
+
+	// gen is bumped by a write to the logs being prefetched, between
+	// pendLo and pendHi, so that a prefetch that raced with it is dropped.
+	gen            uint64
+	pending        int
+	pendLo, pendHi uint64
+
+	// next is the index after the last one read, and run the number of
+	// consecutive indexes read up to it.
+	next uint64
+	run  int
+
+	// vals are the values of the logs from start.
+	start uint64
+	vals  []string
+}
+
+// get returns the value of the log at idx if it has been prefetched.
+// Otherwise it reports whether the reader is sequential, in which case the
+// caller must prefetch up to n logs from idx and pass them, along with the
+// generation, to put.
+func (r *readAhead) get(idx uint64, n int) (val string, ok, sequential bool, gen uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if idx == r.next {
+		r.run++
+	} else {
+		r.run = 1
+	}
+	r.next = idx + 1
+	if idx >= r.start && idx-r.start < uint64(len(r.vals)) {
+		return r.vals[idx-r.start], true, false, 0
+	}
+	if r.run < readAheadRun {
+		return "", false, false, 0
+	}
+	end := idx + uint64(n)
+	if r.pending == 0 || idx < r.pendLo {
+		r.pendLo = idx
+	}
+	if r.pending == 0 || end > r.pendHi {
+		r.pendHi = end
+	}
+	r.pending++
+	return "", false, true, r.gen
+}
+
+// put replaces the prefetched logs with vals, unless there was a write to
+// them since gen. It must follow every get that asked for a prefetch, with
+// nil vals if it failed.
+func (r *readAhead) put(gen, start uint64, vals []string) {
+	r.mu.Lock()
+	if gen == r.gen && vals != nil {
+		r.start, r.vals = start, vals
+	}
+	r.pending--
+	r.mu.Unlock()
+}
+
+// invalidate drops the prefetched logs if any of them are between lo and
+// hi, where the log was written.
+func (r *readAhead) invalidate(lo, hi uint64) {
+	r.mu.Lock()
+	if len(r.vals) > 0 && lo < r.start+uint64(len(r.vals)) && hi >= r.start {
+		r.start, r.vals = 0, nil
+	}
+	if r.pending > 0 && lo <= r.pendHi && hi >= r.pendLo {
+		r.gen++
+	}
+	r.mu.Unlock()
+}
+
+// getLogValue returns the value of the log at idx, with the data of a
+// chunked log or a blob read back in. With Options.ReadAhead set, a
+// sequential reader is served from logs prefetched in one transaction.
+func (b *BuntStore) getLogValue(idx uint64) (string, error) {
+	if b.opts.ReadAhead > 0 {
+		var val string
+		var ok, sequential bool
+		var gen uint64
+		err := b.do(func(db *buntdb.DB) error {
+			val, ok, sequential, gen = b.ahead.get(idx, b.opts.ReadAhead)
+			return nil
+		})
+		if err != nil || ok {
+			return val, err
+		}
+		if sequential {
+			return b.prefetch(idx, gen)
+		}
+	}
+	var val string
+	err := b.view(func(tx *buntdb.Tx) error {
+		key := b.logKey(idx)
+		v, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+		if val, err = b.readLog(tx, key, v); err != nil {
+			return &ErrCorruptEntry{Index: idx, Err: err}
+		}
+		return nil
+	})
+	return val, err
+}
+
+// prefetch reads the log at idx and up to Options.ReadAhead logs after it
+// in one transaction, and keeps them for the next calls to GetLog.
+func (b *BuntStore) prefetch(idx, gen uint64) (string, error) {
+	var vals []string
+	var cerr error
+	err := b.view(func(tx *buntdb.Tx) error {
+		return b.keys.ascendLogs(tx, idx,
+			func(key, val string) bool {
+				if logIndex(key) != idx+uint64(len(vals)) {
+					return false
+				}
+				val, err := b.readLog(tx, key, val)
+				if err != nil {
+					// Left for GetLog to report, unless it's the first
+					if len(vals) == 0 {
+						cerr = &ErrCorruptEntry{Index: idx, Err: err}
+					}
+					return false
+				}
+				vals = append(vals, val)
+				return len(vals) <= b.opts.ReadAhead
+			})
+	})
+	if err = firstErr(err, cerr); err != nil || len(vals) == 0 {
+		b.ahead.put(gen, idx, nil)
+		if err == nil {
+			err = buntdb.ErrNotFound
+		}
+		return "", err
+	}
+	b.ahead.put(gen, idx, vals)
+	return vals[0], nil
+}
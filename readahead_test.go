@@ -0,0 +1,122 @@
+package raftbuntdb
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_ReadAhead(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ReadAhead: 4})
+	defer os.Remove(store.path)
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 20; i++ {
+		logs = append(logs, testRaftLog(i, "log"+strconv.Itoa(int(i))))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	get := func(idx uint64) string {
+		t.Helper()
+		var log raft.Log
+		if err := store.GetLog(idx, &log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if log.Index != idx {
+			t.Fatalf("bad: %d", log.Index)
+		}
+		return string(log.Data)
+	}
+	get(1)
+	get(2)
+
+	// Logs 2 to 6 are prefetched; removing one behind the store's back
+	// shows it's served from memory
+	err := store.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(store.logKey(4))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if data := get(3); data != "log3" {
+		t.Fatalf("bad: %q", data)
+	}
+	if data := get(4); data != "log4" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	// A write to the prefetched logs drops them
+	if err := store.StoreLog(testRaftLog(5, "new")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if data := get(5); data != "new" {
+		t.Fatalf("bad: %q", data)
+	}
+	if err := store.DeleteRange(6, 6); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var log raft.Log
+	if err := store.GetLog(6, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Reads carry on past the hole to the end of the log
+	for i := uint64(7); i <= 20; i++ {
+		if data := get(i); data != "log"+strconv.Itoa(int(i)) {
+			t.Fatalf("bad: %q", data)
+		}
+	}
+	if err := store.GetLog(21, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+	if m := store.Metrics(); m.GetLog.Calls != 21 || m.GetLog.Errors != 0 {
+		t.Fatalf("bad: %+v", m.GetLog)
+	}
+}
+
+func TestReadAhead_Invalidate(t *testing.T) {
+	var r readAhead
+	r.get(1, 4)
+	_, _, sequential, gen := r.get(2, 4)
+	if !sequential {
+		t.Fatalf("expected a sequential reader")
+	}
+
+	// A write outside of the prefetch leaves it alone
+	r.invalidate(10, 10)
+	r.put(gen, 2, []string{"a", "b"})
+	if val, ok, _, _ := r.get(3, 4); !ok || val != "b" {
+		t.Fatalf("bad: %q %v", val, ok)
+	}
+
+	// One that races with it drops it
+	r.get(4, 4)
+	_, _, _, gen = r.get(5, 4)
+	r.invalidate(7, 7)
+	r.put(gen, 5, []string{"c"})
+	if _, ok, _, _ := r.get(5, 4); ok {
+		t.Fatalf("expected the prefetch to be dropped")
+	}
+}
+
+func TestBuntStore_ReadAheadClosed(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ReadAhead: 4})
+	defer os.Remove(store.path)
+	for i := uint64(1); i <= 3; i++ {
+		if err := store.StoreLog(testRaftLog(i, "log")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	var log raft.Log
+	store.GetLog(1, &log)
+	store.GetLog(2, &log)
+	store.Close()
+	if err := store.GetLog(3, &log); err != ErrClosed {
+		t.Fatalf("bad: %v", err)
+	}
+}
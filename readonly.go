@@ -0,0 +1,37 @@
+package raftbuntdb
+
+import (
+	"io"
+	"os"
+
+	"github.com/tidwall/buntdb"
+)
+
+// loadReadOnly loads the database file at path into an in-memory database,
+// for Options.ReadOnly. A tail cut short by a crash is left out, as buntdb
+// does when it opens the file, but the file isn't truncated.
+func loadReadOnly(path string) (*buntdb.DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Load(f); err != nil && err != io.ErrUnexpectedEOF {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// checkReadOnly returns ErrReadOnly if the store was opened with
+// Options.ReadOnly.
+func (b *BuntStore) checkReadOnly() error {
+	if b.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuntStore_ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "raft.db")
+	stablePath := filepath.Join(dir, "stable.db")
+	store, err := Open(path, &Options{Durability: High})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := uint64(1); i <= 5; i++ {
+		if err := store.StoreLog(testRaftLog(i, "log")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	// Leave a torn record at the tail, as a crash would
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f.WriteString("*3\r\n$3\r\nset")
+	f.Close()
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The stable keys are still in the log file, so the stable file isn't
+	// created
+	store, err = Open(path, &Options{ReadOnly: true, StablePath: stablePath})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n, err := store.LogCount(); err != nil || n != 5 {
+		t.Fatalf("bad: %d %v", n, err)
+	}
+	if val, err := store.GetUint64([]byte("CurrentTerm")); err != nil || val != 2 {
+		t.Fatalf("bad: %d %v", val, err)
+	}
+	if err := store.StoreLog(testRaftLog(6, "log")); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := store.DeleteRange(1, 2); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := store.Shrink(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := store.RestoreFrom(bytes.NewReader(nil)); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("file changed")
+	}
+	for _, p := range []string{stablePath, path + ".lock"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("bad: %s %v", p, err)
+		}
+	}
+
+	// A store held by a running node can be read
+	node, err := Open(path, &Options{Durability: High})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer node.Close()
+	if err := node.StoreLog(testRaftLog(6, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err = Open(path, &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n, err := store.LogCount(); err != nil || n != 6 {
+		t.Fatalf("bad: %d %v", n, err)
+	}
+	store.Close()
+	if _, err := os.Stat(path + ".lock"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A missing file isn't created
+	if _, err := Open(filepath.Join(dir, "missing.db"),
+		&Options{ReadOnly: true}); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package raftbuntdb
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// RecoveryPolicy retries writes that fail to commit with a transient
+// error. Before every retry after the first the database is reopened, in
+// case the handle is left in a bad state by the failure.
+type RecoveryPolicy struct {
+	// MaxRetries is the number of times a write is retried. Defaults to 5.
+	MaxRetries int
+
+	// Backoff is the delay before the first retry, which doubles for each
+	// retry after it up to MaxBackoff. Defaults to 10ms and a second.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Retryable reports whether an error is worth retrying. Defaults to
+	// IsTransientError.
+	Retryable func(err error) bool
+
+	// OnEvent is called with each step of a recovery. Optional.
+	OnEvent func(RecoveryEvent)
+}
+
+// RecoveryEventKind is the kind of a RecoveryEvent.
+type RecoveryEventKind int
+
+const (
+	// RecoveryRetry is sent before a failed write is retried.
+	RecoveryRetry RecoveryEventKind = iota
+
+	// RecoveryReopen is sent after the database has been reopened.
+	RecoveryReopen
+
+	// RecoverySucceeded is sent when a retried write commits.
+	RecoverySucceeded
+
+	// RecoveryFailed is sent when a write is given up on. Err is the
+	// error returned to the caller.
+	RecoveryFailed
+)
+
+func (k RecoveryEventKind) String() string {
+	switch k {
+	case RecoveryRetry:
+		return "retry"
+	case RecoveryReopen:
+		return "reopen"
+	case RecoverySucceeded:
+		return "succeeded"
+	case RecoveryFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// RecoveryEvent describes a step in recovering from a failed write.
+type RecoveryEvent struct {
+	Kind RecoveryEventKind
+
+	// Attempt is the number of the retry, starting at one.
+	Attempt int
+
+	// Err is the error of the last attempt.
+	Err error
+}
+
+// IsTransientError reports whether err is an I/O error that may go away
+// on its own: an interrupted call, a full disk or an unavailable network
+// file system.
+func IsTransientError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EINTR, syscall.EAGAIN,
+		syscall.ENOSPC, syscall.EIO, syscall.ESTALE, syscall.ETIMEDOUT} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RecoveryPolicy) maxRetries() int {
+	if p.MaxRetries <= 0 {
+		return 5
+	}
+	return p.MaxRetries
+}
+
+func (p *RecoveryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransientError(err)
+}
+
+// backoff returns the delay before a retry.
+func (p *RecoveryPolicy) backoff(attempt int) time.Duration {
+	d, max := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = 10 * time.Millisecond
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+func (p *RecoveryPolicy) event(kind RecoveryEventKind, attempt int, err error) {
+	if p.OnEvent != nil {
+		p.OnEvent(RecoveryEvent{Kind: kind, Attempt: attempt, Err: err})
+	}
+}
+
+// recovering runs a write attempt, retrying it according to the recovery
+// policy when it fails to commit, and records the outcome for Health. A
+// full disk degrades the store if it has a NoSpacePolicy. The
+// attempt returns whether its error came from the commit, as opposed to
+// the transaction's function.
+func (b *BuntStore) recovering(attempt func() (bool, error)) error {
+	if err := firstErr(b.checkReadOnly(), b.checkNoSpace()); err != nil {
+		return err
+	}
+	commit, err := attempt()
+	if p := b.opts.Recovery; p != nil && commit && err != nil &&
+		!errors.Is(err, ErrClosed) && p.retryable(err) {
+		commit, err = b.retry(p, attempt, err)
+	}
+	b.health.record(err, commit, b.opts.Durability == High)
+	if commit && b.opts.NoSpace != nil && isNoSpace(err) {
+		return b.noSpace(err)
+	}
+	return err
+}
+
+// retry retries a failed write attempt until it commits, fails with an
+// error that isn't retryable or runs out of retries.
+func (b *BuntStore) retry(p *RecoveryPolicy, attempt func() (bool, error),
+	err error) (bool, error) {
+	commit := true
+	n := 1
+	for ; n <= p.maxRetries(); n++ {
+		p.event(RecoveryRetry, n, err)
+		select {
+		case <-time.After(p.backoff(n)):
+		case <-b.done:
+			p.event(RecoveryFailed, n, err)
+			return commit, err
+		}
+		if n > 1 {
+			if err = b.reopen(); err != nil {
+				p.event(RecoveryFailed, n, err)
+				return commit, err
+			}
+			p.event(RecoveryReopen, n, nil)
+		}
+		if commit, err = attempt(); err == nil {
+			p.event(RecoverySucceeded, n, nil)
+			return commit, nil
+		}
+		if !commit || errors.Is(err, ErrClosed) || !p.retryable(err) {
+			break
+		}
+	}
+	if n > p.maxRetries() {
+		n = p.maxRetries()
+	}
+	p.event(RecoveryFailed, n, err)
+	return commit, err
+}
+
+// reopen closes and reopens the database, truncating a torn write at the
+// end of the file.
+func (b *BuntStore) reopen() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+	b.db.Close()
+	return b.reopenLocked()
+}
+
+// reopenLocked opens the database after it was closed, with b.mu held. If
+// it can't be opened the store is broken, and every call fails until it's
+// closed.
+func (b *BuntStore) reopenLocked() error {
+	opts := b.opts
+	opts.RecoverCorruptTail = true
+	db, keys, err := openDB(context.Background(), b.path, &opts, nil, b.lock)
+	if err != nil {
+		// Nothing left to serve from, and openDB released the lock
+		b.broken, b.lock = err, nil
+		return err
+	}
+	b.db, b.keys = db, keys
+	b.ahead.invalidate(0, 1<<64-1)
+	b.cache.invalidate(0, 1<<64-1)
+	return wrapErr(db.View(b.resetCounter))
+}
+
+// commit runs fn in a read-write transaction. It reports whether the
+// error, if any, came from the commit rather than from fn.
+func (b *BuntStore) commit(fn func(tx *buntdb.Tx) error) (bool, error) {
+	var fnErr error
+	err := b.do(func(db *buntdb.DB) error {
+		return db.Update(func(tx *buntdb.Tx) error {
+			fnErr = fn(tx)
+			return fnErr
+		})
+	})
+	return err != nil && fnErr == nil, err
+}
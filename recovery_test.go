@@ -0,0 +1,190 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestIsTransientError(t *testing.T) {
+	err := &os.PathError{Op: "write", Path: "raft.db", Err: syscall.ENOSPC}
+	if !IsTransientError(err) || !IsTransientError(fmt.Errorf("x: %w", err)) {
+		t.Fatalf("expected transient")
+	}
+	if IsTransientError(errors.New("x")) || IsTransientError(syscall.EBADF) {
+		t.Fatalf("expected not transient")
+	}
+}
+
+func TestRecoveryPolicy_Backoff(t *testing.T) {
+	p := &RecoveryPolicy{Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	var got []time.Duration
+	for i := 1; i <= 5; i++ {
+		got = append(got, p.backoff(i))
+	}
+	want := []time.Duration{1, 2, 4, 5, 5}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+// testRecoveryStore returns a store with a recovery policy that records
+// its events.
+func testRecoveryStore(t *testing.T) (*BuntStore, *[]RecoveryEvent) {
+	var events []RecoveryEvent
+	store := testBuntStoreOpts(t, &Options{
+		Durability: High,
+		Recovery: &RecoveryPolicy{
+			MaxRetries: 3,
+			Backoff:    time.Millisecond,
+			OnEvent: func(e RecoveryEvent) {
+				events = append(events, e)
+			},
+		},
+	})
+	return store, &events
+}
+
+func eventKinds(events []RecoveryEvent) []RecoveryEventKind {
+	var kinds []RecoveryEventKind
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func TestBuntStore_RecoveryRetry(t *testing.T) {
+	store, events := testRecoveryStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Fails twice, so the second retry reopens the database first
+	var calls int
+	err := store.recovering(func() (bool, error) {
+		if calls++; calls < 3 {
+			return true, syscall.EINTR
+		}
+		return store.commit(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set(dbConf+"key", "val", nil)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	want := []RecoveryEventKind{RecoveryRetry, RecoveryRetry, RecoveryReopen,
+		RecoverySucceeded}
+	if kinds := eventKinds(*events); !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("bad: %v", kinds)
+	}
+	if h := store.Health(); !h.OK() {
+		t.Fatalf("bad: %#v", h)
+	}
+
+	// The reopened store still serves the log
+	if err := store.StoreLog(testRaftLog(2, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.LastIndex(); idx != 2 {
+		t.Fatalf("bad: %d", idx)
+	}
+	checkCounter(t, store)
+}
+
+func TestBuntStore_RecoveryGiveUp(t *testing.T) {
+	store, events := testRecoveryStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	err := store.recovering(func() (bool, error) {
+		return true, syscall.EIO
+	})
+	if err != syscall.EIO {
+		t.Fatalf("err: %v", err)
+	}
+	want := []RecoveryEventKind{RecoveryRetry, RecoveryRetry, RecoveryReopen,
+		RecoveryRetry, RecoveryReopen, RecoveryFailed}
+	if kinds := eventKinds(*events); !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("bad: %v", kinds)
+	}
+	if last := (*events)[len(*events)-1]; last.Attempt != 3 || last.Err != syscall.EIO {
+		t.Fatalf("bad: %#v", last)
+	}
+	if h := store.Health(); !h.Failed || h.LastError != syscall.EIO {
+		t.Fatalf("bad: %#v", h)
+	}
+
+	// Errors that aren't transient and errors from the transaction's
+	// function aren't retried
+	*events = nil
+	errBad := errors.New("bad")
+	store.recovering(func() (bool, error) { return true, errBad })
+	store.recovering(func() (bool, error) { return false, syscall.EIO })
+	if len(*events) != 0 {
+		t.Fatalf("bad: %v", eventKinds(*events))
+	}
+}
+
+func TestBuntStore_ReopenFailed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "raft.db")
+	stablePath := filepath.Join(dir, "stable.db")
+	store, err := Open(path, &Options{StablePath: stablePath,
+		ExpvarName: "raftbuntdb_reopen_failed"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A directory in place of the file can't be reopened
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.reopen(); err == nil {
+		t.Fatalf("expected reopen error")
+	}
+	if err := store.StoreLog(testRaftLog(2, "log")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := store.GetUint64([]byte("CurrentTerm")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("bad: %v", err)
+	}
+	if h := store.Health(); !h.Closed {
+		t.Fatalf("bad: %#v", h)
+	}
+
+	// Close still releases the stable file and the metrics
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	published.mu.Lock()
+	held := published.stores["raftbuntdb_reopen_failed"]
+	published.mu.Unlock()
+	if held != nil {
+		t.Fatalf("metrics still published")
+	}
+	other, err := Open(filepath.Join(dir, "other.db"), &Options{StablePath: stablePath})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	other.Close()
+}
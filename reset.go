@@ -0,0 +1,83 @@
+package raftbuntdb
+
+import (
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// resetPrefixes returns the key prefixes cleared by Reset.
+func (b *BuntStore) resetPrefixes() []string {
+	return []string{b.keys.logs, dbChunks, b.keys.conf, dbTimes, FSMPrefix}
+}
+
+// Reset deletes every log and stable key in one transaction, so that a
+// node can be wiped and bootstrapped again without replacing its file,
+// which keeps its mode and any open handles. The state of a BuntFSM and
+// the applied index are cleared too. Snapshot metadata, the file format
+// metadata and application keys are kept. The space is only reclaimed by
+// a shrink; see ResetAndShrink. With Options.StablePath, the stable file
+// is cleared in a transaction of its own.
+func (b *BuntStore) Reset() error {
+	err := b.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+		var keys []string
+		for _, prefix := range b.resetPrefixes() {
+			err := tx.AscendGreaterOrEqual("", prefix, func(key, val string) bool {
+				if !strings.HasPrefix(key, prefix) {
+					return false
+				}
+				keys = append(keys, key)
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+		keys = append(keys, appliedKey)
+		for _, key := range keys {
+			var err error
+			if b.isLogKey(key) {
+				err = deleteLog(tx, key, d)
+			} else {
+				_, err = tx.Delete(key)
+			}
+			if err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && b.stable != nil {
+		err = b.updateStable(func(tx *buntdb.Tx) error {
+			var keys []string
+			err := tx.AscendGreaterOrEqual("", b.keys.conf, func(key, val string) bool {
+				if !strings.HasPrefix(key, b.keys.conf) {
+					return false
+				}
+				keys = append(keys, key)
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if _, err := tx.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		b.onDeleteRange(0, 1<<64-1)
+	}
+	return err
+}
+
+// ResetAndShrink resets the store and shrinks the file.
+func (b *BuntStore) ResetAndShrink() error {
+	if err := b.Reset(); err != nil {
+		return err
+	}
+	return b.Shrink()
+}
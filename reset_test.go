@@ -0,0 +1,83 @@
+package raftbuntdb
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Reset(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{
+		FileMode: 0640,
+		Retention: &RetentionPolicy{MaxAge: time.Hour, Interval: time.Hour,
+			SafeIndex: func() uint64 { return 0 }},
+	})
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 100; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.SetUint64([]byte("CurrentTerm"), 4)
+	store.SetAppliedIndex(100)
+	store.Update(func(tx *buntdb.Tx) error {
+		tx.Set(FSMPrefix+"state", "1", nil)
+		tx.Set("app:key", "kept", nil)
+		return nil
+	})
+	meta, err := store.Metadata()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := store.ResetAndShrink(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.LastIndex(); idx != 0 {
+		t.Fatalf("bad: %d", idx)
+	}
+	checkCounter(t, store)
+	if keys, _ := store.StableKeys(); len(keys) != 0 {
+		t.Fatalf("bad: %q", keys)
+	}
+	if idx, _ := store.AppliedIndex(); idx != 0 {
+		t.Fatalf("bad: %d", idx)
+	}
+	var times, fsm int
+	var app string
+	store.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, val string) bool {
+			switch {
+			case key[:2] == dbTimes:
+				times++
+			case key[:2] == FSMPrefix:
+				fsm++
+			case key == "app:key":
+				app = val
+			}
+			return true
+		})
+	})
+	if times != 0 || fsm != 0 || app != "kept" {
+		t.Fatalf("bad: %d %d %q", times, fsm, app)
+	}
+	if m, err := store.Metadata(); err != nil || m != meta {
+		t.Fatalf("bad: %+v %v", m, err)
+	}
+	if fi, err := os.Stat(store.path); err != nil || fi.Mode().Perm() != 0640 {
+		t.Fatalf("bad: %v %v", fi.Mode(), err)
+	}
+
+	// The store can be bootstrapped again
+	if err := store.StoreLogs(logs[:1]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.LastIndex(); idx != 1 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
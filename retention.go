@@ -0,0 +1,215 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// Bucket name of the append times recorded for MaxAge retention
+const dbTimes = "t:"
+
+// errNoSafeIndex is returned by Open when the RetentionPolicy has no
+// SafeIndex.
+var errNoSafeIndex = errors.New("retention policy has no SafeIndex")
+
+// RetentionPolicy limits the size of the log. Logs beyond any of the
+// limits are deleted from the head of the log by a background goroutine,
+// but never beyond the index returned by SafeIndex.
+type RetentionPolicy struct {
+	// MaxEntries is the number of trailing entries to keep.
+	MaxEntries uint64
+
+	// MaxBytes is the number of bytes of trailing entries to keep.
+	MaxBytes int64
+
+	// MaxAge is how long to keep entries after they are stored. The
+	// raft.Log type has no append time, so the store records the time of
+	// each StoreLogs batch for stores opened with a MaxAge policy.
+	MaxAge time.Duration
+
+	// SafeIndex returns the highest index that may be deleted, typically
+	// the index of the last snapshot. It is required, and Open fails
+	// without it.
+	SafeIndex func() uint64
+
+	// Interval is how often the policy is enforced. Defaults to a minute.
+	Interval time.Duration
+
+	// OnError is called when enforcing the policy fails. Optional.
+	OnError func(error)
+}
+
+// checkRetention returns an error if the retention policy, if any, can't
+// be enforced.
+func checkRetention(policy *RetentionPolicy) error {
+	if policy != nil && policy.SafeIndex == nil {
+		return errNoSafeIndex
+	}
+	return nil
+}
+
+// runRetention enforces the retention policy until the store is closed.
+func (b *BuntStore) runRetention() {
+	interval := b.opts.Retention.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-t.C:
+		}
+		err := b.EnforceRetention()
+		if err != nil && !errors.Is(err, ErrClosed) && b.opts.Retention.OnError != nil {
+			b.opts.Retention.OnError(err)
+		}
+	}
+}
+
+// EnforceRetention applies the store's retention policy immediately. It
+// does nothing if the store was opened without one.
+func (b *BuntStore) EnforceRetention() error {
+	policy := b.opts.Retention
+	if policy == nil || policy.SafeIndex == nil {
+		return nil
+	}
+	safe := policy.SafeIndex()
+	var target uint64
+	err := b.view(func(tx *buntdb.Tx) error {
+		var err error
+		target, err = b.retentionTarget(tx, policy, time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if target > safe {
+		target = safe
+	}
+	if target == 0 {
+		return nil
+	}
+	if _, err := b.compactTo(target); err != nil {
+		return err
+	}
+	return b.update(b.trimTimes)
+}
+
+// retentionTarget returns the index up to which the policy allows logs to
+// be deleted.
+func (b *BuntStore) retentionTarget(tx *buntdb.Tx, policy *RetentionPolicy,
+	now time.Time) (uint64, error) {
+	first, err := b.keys.firstIndex(tx)
+	if err != nil || first == 0 {
+		return 0, err
+	}
+	last, err := b.keys.lastIndex(tx)
+	if err != nil {
+		return 0, err
+	}
+	var target uint64
+	if policy.MaxEntries > 0 && last-first+1 > policy.MaxEntries {
+		target = last - policy.MaxEntries
+	}
+	_, total := b.counter.get()
+	if policy.MaxBytes > 0 && total > uint64(policy.MaxBytes) {
+		// Walk back from the tail until the limit is reached
+		var size int64
+		err := b.keys.descendLogs(tx, 1<<64-1, func(key, val string) bool {
+			size += storedSize(val)
+			if size > policy.MaxBytes {
+				if idx := logIndex(key); idx > target {
+					target = idx
+				}
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if policy.MaxAge > 0 {
+		// Each time marks the start of a batch that ends before the next
+		cutoff := now.Add(-policy.MaxAge).UnixNano()
+		var old uint64
+		var expired bool
+		err := tx.AscendGreaterOrEqual("", dbTimes, func(key, val string) bool {
+			if !strings.HasPrefix(key, dbTimes) {
+				return false
+			}
+			idx := stringToUint64(key[len(dbTimes):])
+			if expired {
+				old = idx - 1
+			}
+			ts, _ := strconv.ParseInt(val, 10, 64)
+			expired = ts < cutoff
+			return expired
+		})
+		if err != nil {
+			return 0, err
+		}
+		if expired {
+			old = last
+		}
+		if old > target {
+			target = old
+		}
+	}
+	return target, nil
+}
+
+// recordTime records the append time of a batch of logs.
+func recordTime(tx *buntdb.Tx, logs []*raft.Log, now time.Time) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	_, _, err := tx.Set(dbTimes+uint64ToString(logs[0].Index),
+		strconv.FormatInt(now.UnixNano(), 10), nil)
+	return err
+}
+
+// trimTimes removes the append times before the first log, keeping the
+// time of the batch that the first log belongs to.
+func (b *BuntStore) trimTimes(tx *buntdb.Tx) error {
+	first, err := b.keys.firstIndex(tx)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	var keep string
+	err = tx.AscendGreaterOrEqual("", dbTimes, func(key, val string) bool {
+		if !strings.HasPrefix(key, dbTimes) ||
+			(first != 0 && stringToUint64(key[len(dbTimes):]) >= first) {
+			return false
+		}
+		keys = append(keys, key)
+		keep = val
+		return true
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := tx.Delete(key); err != nil {
+			return err
+		}
+	}
+	if first == 0 {
+		return nil
+	}
+	key := dbTimes + uint64ToString(first)
+	if _, err := tx.Get(key); err == buntdb.ErrNotFound {
+		_, _, err = tx.Set(key, keep, nil)
+		return err
+	}
+	return nil
+}
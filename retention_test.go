@@ -0,0 +1,144 @@
+package raftbuntdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func testRetentionStore(t *testing.T, policy *RetentionPolicy) *BuntStore {
+	store := testBuntStore(t)
+	store.opts.Retention = policy
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "0123456789"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return store
+}
+
+func TestBuntStore_RetentionMaxEntries(t *testing.T) {
+	safe := uint64(3)
+	store := testRetentionStore(t, &RetentionPolicy{
+		MaxEntries: 4,
+		SafeIndex:  func() uint64 { return safe },
+	})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// Limited by the safe index
+	if err := store.EnforceRetention(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.FirstIndex(); idx != 4 {
+		t.Fatalf("bad: %d", idx)
+	}
+
+	safe = 100
+	if err := store.EnforceRetention(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.FirstIndex(); idx != 7 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_RetentionMaxBytes(t *testing.T) {
+	store := testRetentionStore(t, &RetentionPolicy{
+		MaxBytes:  3 * (17 + 10),
+		SafeIndex: func() uint64 { return 100 },
+	})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	if err := store.EnforceRetention(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.FirstIndex(); idx != 8 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_RetentionMaxAge(t *testing.T) {
+	store := testRetentionStore(t, &RetentionPolicy{
+		MaxAge:    time.Hour,
+		SafeIndex: func() uint64 { return 100 },
+	})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// Backdate the first batch and store a new one
+	err := store.db.Update(func(tx *buntdb.Tx) error {
+		return recordTime(tx, []*raft.Log{{Index: 1}},
+			time.Now().Add(-2*time.Hour))
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(11, "new")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := store.EnforceRetention(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.FirstIndex(); idx != 11 {
+		t.Fatalf("bad: %d", idx)
+	}
+
+	// Nothing else has expired
+	if err := store.EnforceRetention(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx, _ := store.FirstIndex(); idx != 11 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_RetentionBackground(t *testing.T) {
+	fh := testBuntStore(t)
+	path := fh.path
+	fh.Close()
+	defer os.Remove(path)
+
+	store, err := Open(path, &Options{Retention: &RetentionPolicy{
+		MaxEntries: 1,
+		SafeIndex:  func() uint64 { return 100 },
+		Interval:   10 * time.Millisecond,
+	}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if err := store.StoreLogs([]*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if idx, _ := store.FirstIndex(); idx == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("retention was not enforced")
+}
+
+func TestOpen_RetentionNoSafeIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+	_, err := Open(path, &Options{Retention: &RetentionPolicy{MaxEntries: 1}})
+	if err != errNoSafeIndex {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+}
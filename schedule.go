@@ -0,0 +1,91 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// BackupSink is a destination for scheduled backups, such as an object
+// store bucket. Put must read r to completion or return an error.
+type BackupSink interface {
+	Put(name string, r io.Reader) error
+}
+
+// BackupScheduler periodically writes a full backup of a store to a sink.
+type BackupScheduler struct {
+	store    *BuntStore
+	sink     BackupSink
+	interval time.Duration
+	onError  func(error)
+	stop     chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+// ScheduleBackups starts writing a backup of the store to sink every
+// interval. Each backup is named "raft-buntdb-<UTC time>.db". Failed
+// backups are passed to onError, which may be nil. The scheduler stops
+// when Stop is called or the store is closed, and Close waits for a backup
+// in progress to finish.
+func (b *BuntStore) ScheduleBackups(sink BackupSink, interval time.Duration,
+	onError func(error)) *BackupScheduler {
+	s := &BackupScheduler{
+		store:    b,
+		sink:     sink,
+		interval: interval,
+		onError:  onError,
+		stop:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	b.goBackground(s.run)
+	return s
+}
+
+// Stop stops the scheduler, waiting for a backup in progress to finish.
+func (s *BackupScheduler) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	s.wg.Wait()
+}
+
+func (s *BackupScheduler) run() {
+	defer s.wg.Done()
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.store.done:
+			return
+		case <-t.C:
+		}
+		err := s.backup(time.Now())
+		if errors.Is(err, ErrClosed) {
+			return
+		}
+		if err != nil && s.onError != nil {
+			s.onError(err)
+		}
+	}
+}
+
+// backup streams one backup to the sink.
+func (s *BackupScheduler) backup(now time.Time) error {
+	name := "raft-buntdb-" + now.UTC().Format("20060102T150405.000Z") + ".db"
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := s.store.Backup(pw)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+	err := s.sink.Put(name, pr)
+	// Unblock the backup if the sink stopped reading early
+	pr.CloseWithError(io.ErrClosedPipe)
+	if berr := <-errc; berr != nil {
+		return berr
+	}
+	return err
+}
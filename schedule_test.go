@@ -0,0 +1,85 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSink struct {
+	mu      sync.Mutex
+	backups map[string][]byte
+}
+
+func (s *testSink) Put(name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.backups[name] = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *testSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.backups)
+}
+
+func TestBuntStore_ScheduleBackups(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sink := &testSink{backups: make(map[string][]byte)}
+	s := store.ScheduleBackups(sink, 10*time.Millisecond, func(err error) {
+		t.Errorf("err: %s", err)
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Stop()
+	if sink.count() < 2 {
+		t.Fatalf("expected at least 2 backups, got %d", sink.count())
+	}
+
+	// All backups are valid
+	for name, data := range sink.backups {
+		if err := copyBackup(ioutil.Discard, bytes.NewReader(data), dbLogs); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+	}
+}
+
+func TestBuntStore_ScheduleBackupsClose(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+
+	// Closing the store stops the scheduler without waiting for a tick
+	sink := &testSink{backups: make(map[string][]byte)}
+	s := store.ScheduleBackups(sink, time.Hour, nil)
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("scheduler still running")
+	}
+	s.Stop()
+}
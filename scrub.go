@@ -0,0 +1,175 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// ScrubPolicy enables a background goroutine that reads back a random
+// sample of the logs at each interval, as Verify does for the whole store,
+// so that disk rot is found before raft needs the logs to catch up a
+// follower. Corrupt logs are quarantined until they are rewritten or
+// deleted.
+type ScrubPolicy struct {
+	// Interval is how often a sample is checked. Defaults to a minute.
+	Interval time.Duration
+
+	// Sample is the number of logs checked at each interval, which sets
+	// the rate of the scrub. Defaults to 100.
+	Sample int
+
+	// OnCorrupt is called with each log newly quarantined. Optional.
+	OnCorrupt func(err *ErrCorruptEntry)
+
+	// OnError is called when a scrub fails to read the store. Optional.
+	OnError func(error)
+}
+
+func (p *ScrubPolicy) interval() time.Duration {
+	if p.Interval <= 0 {
+		return time.Minute
+	}
+	return p.Interval
+}
+
+func (p *ScrubPolicy) sample() int {
+	if p.Sample <= 0 {
+		return 100
+	}
+	return p.Sample
+}
+
+// scrubState holds the quarantined logs and whether the scrub is paused.
+type scrubState struct {
+	mu         sync.Mutex
+	paused     bool
+	quarantine map[uint64]*ErrCorruptEntry
+}
+
+// add quarantines the corrupt log of err, reporting whether it's new.
+func (s *scrubState) add(err *ErrCorruptEntry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.quarantine[err.Index]; ok {
+		return false
+	}
+	if s.quarantine == nil {
+		s.quarantine = make(map[uint64]*ErrCorruptEntry)
+	}
+	s.quarantine[err.Index] = err
+	return true
+}
+
+// release lifts the quarantine of the logs between lo and hi, which were
+// written.
+func (s *scrubState) release(lo, hi uint64) {
+	s.mu.Lock()
+	for idx := range s.quarantine {
+		if idx >= lo && idx <= hi {
+			delete(s.quarantine, idx)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// runScrub checks a sample of the logs at each interval until the store is
+// closed.
+func (b *BuntStore) runScrub() {
+	policy := b.opts.Scrub
+	t := time.NewTicker(policy.interval())
+	defer t.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-t.C:
+		}
+		b.scrub.mu.Lock()
+		paused := b.scrub.paused
+		b.scrub.mu.Unlock()
+		if paused {
+			continue
+		}
+		_, err := b.Scrub(policy.sample())
+		if err != nil && !errors.Is(err, ErrClosed) && policy.OnError != nil {
+			policy.OnError(err)
+		}
+	}
+}
+
+// Scrub immediately checks n logs picked at random between the first and
+// last index, and returns the corrupt ones, which are quarantined. With
+// Options.Scrub set, OnCorrupt is called with those that weren't already.
+// Indexes missing from the log are skipped; see CheckConsistency.
+func (b *BuntStore) Scrub(n int) ([]*ErrCorruptEntry, error) {
+	var corrupt []*ErrCorruptEntry
+	err := b.view(func(tx *buntdb.Tx) error {
+		first, err := b.keys.firstIndex(tx)
+		if err != nil || first == 0 {
+			return err
+		}
+		last, err := b.keys.lastIndex(tx)
+		if err != nil {
+			return err
+		}
+		var log raft.Log
+		for i := 0; i < n; i++ {
+			idx := first + uint64(rand.Int63n(int64(last-first+1)))
+			key := b.logKey(idx)
+			val, err := tx.Get(key)
+			if err == buntdb.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := b.checkLog(tx, key, val, &log); err != nil {
+				corrupt = append(corrupt, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range corrupt {
+		if b.scrub.add(err) && b.opts.Scrub != nil && b.opts.Scrub.OnCorrupt != nil {
+			b.opts.Scrub.OnCorrupt(err)
+		}
+	}
+	return corrupt, nil
+}
+
+// PauseScrub stops the background scrub, such as during a period of heavy
+// load, until ResumeScrub is called.
+func (b *BuntStore) PauseScrub() {
+	b.scrub.mu.Lock()
+	b.scrub.paused = true
+	b.scrub.mu.Unlock()
+}
+
+// ResumeScrub restarts the background scrub stopped by PauseScrub.
+func (b *BuntStore) ResumeScrub() {
+	b.scrub.mu.Lock()
+	b.scrub.paused = false
+	b.scrub.mu.Unlock()
+}
+
+// Quarantined returns the corrupt logs found by Scrub that have not been
+// rewritten or deleted since, in index order.
+func (b *BuntStore) Quarantined() []*ErrCorruptEntry {
+	b.scrub.mu.Lock()
+	defer b.scrub.mu.Unlock()
+	errs := make([]*ErrCorruptEntry, 0, len(b.scrub.quarantine))
+	for _, err := range b.scrub.quarantine {
+		errs = append(errs, err)
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Index < errs[j].Index })
+	return errs
+}
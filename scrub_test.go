@@ -0,0 +1,104 @@
+package raftbuntdb
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestBuntStore_Scrub(t *testing.T) {
+	var reported []uint64
+	store := testBuntStoreOpts(t, &Options{Scrub: &ScrubPolicy{
+		Interval:  time.Hour,
+		OnCorrupt: func(err *ErrCorruptEntry) { reported = append(reported, err.Index) },
+	}})
+	defer os.Remove(store.path)
+	defer store.Close()
+	for i := uint64(1); i <= 10; i++ {
+		if err := store.StoreLog(testRaftLog(i, "data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if corrupt, err := store.Scrub(100); err != nil || len(corrupt) != 0 {
+		t.Fatalf("bad: %v %v", err, corrupt)
+	}
+
+	// Log 5 is truncated and log 7 holds the value of log 3
+	err := store.db.Update(func(tx *buntdb.Tx) error {
+		if _, _, err := tx.Set(store.logKey(5), "short", nil); err != nil {
+			return err
+		}
+		val, err := tx.Get(store.logKey(3))
+		if err != nil {
+			return err
+		}
+		_, _, err = tx.Set(store.logKey(7), val, nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := store.Scrub(500); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if len(reported) != 2 {
+		t.Fatalf("bad: %v", reported)
+	}
+	q := store.Quarantined()
+	if len(q) != 2 || q[0].Index != 5 || q[1].Index != 7 || q[1].Err != errIndexMismatch {
+		t.Fatalf("bad: %v", q)
+	}
+
+	// Rewriting or deleting a log lifts its quarantine
+	if err := store.StoreLog(testRaftLog(5, "data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if q := store.Quarantined(); len(q) != 1 || q[0].Index != 7 {
+		t.Fatalf("bad: %v", q)
+	}
+	if err := store.DeleteRange(7, 10); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if q := store.Quarantined(); len(q) != 0 {
+		t.Fatalf("bad: %v", q)
+	}
+}
+
+func TestBuntStore_ScrubBackground(t *testing.T) {
+	found := make(chan uint64, 1)
+	store := testBuntStoreOpts(t, &Options{Scrub: &ScrubPolicy{
+		Interval:  10 * time.Millisecond,
+		OnCorrupt: func(err *ErrCorruptEntry) { found <- err.Index },
+	}})
+	defer os.Remove(store.path)
+	defer store.Close()
+	store.PauseScrub()
+	if err := store.StoreLog(testRaftLog(1, "data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err := store.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(store.logKey(1), "short", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	select {
+	case idx := <-found:
+		t.Fatalf("paused scrub found %d", idx)
+	case <-time.After(50 * time.Millisecond):
+	}
+	store.ResumeScrub()
+	select {
+	case idx := <-found:
+		if idx != 1 {
+			t.Fatalf("bad: %d", idx)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out")
+	}
+}
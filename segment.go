@@ -0,0 +1,560 @@
+package raftbuntdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+var (
+	// errCorruptSegment is returned by OpenSegmentStore when a segment
+	// other than the last one holds a torn or corrupt record.
+	errCorruptSegment = errors.New("corrupt segment")
+
+	// errRecordChecksum is the cause of an ErrCorruptEntry when a record
+	// of a segment doesn't match its checksum.
+	errRecordChecksum = errors.New("record checksum mismatch")
+)
+
+const (
+	// defaultSegmentSize is the default of SegmentOptions.SegmentSize.
+	defaultSegmentSize = 64 << 20
+
+	// segmentExt is the extension of the segment files, which are named
+	// after their sequence number.
+	segmentExt = ".seg"
+
+	// segmentStableFile is the name of the BuntStore file of the stable
+	// store in the directory of a SegmentStore.
+	segmentStableFile = "stable.db"
+
+	// A record is a kind byte, the size of the payload and its CRC-32C,
+	// followed by the payload.
+	recordHeaderSize = 9
+	recordLog        = 1
+	recordDelete     = 2
+)
+
+// SegmentOptions configure a SegmentStore opened with OpenSegmentStore.
+type SegmentOptions struct {
+	// SegmentSize is the size past which the segment being written is
+	// closed and a new one started. Defaults to 64 MiB.
+	SegmentSize int64
+
+	// Durability controls how often the segment being written is
+	// fsynced: after every write with High, every second with Medium, and
+	// never with Low.
+	Durability Level
+
+	// Stable are the options of the BuntStore that holds the stable
+	// store. Defaults to High durability, as raft's votes must survive a
+	// crash.
+	Stable *Options
+}
+
+func (o *SegmentOptions) segmentSize() int64 {
+	if o.SegmentSize <= 0 {
+		return defaultSegmentSize
+	}
+	return o.SegmentSize
+}
+
+// SegmentStore is a raft log and stable store for logs with a lot of
+// churn. The logs are appended to segment files of a fixed size, like a
+// write-ahead log, and a segment is deleted whole once compaction has
+// removed every log in it and in the segments before it, so that space is
+// reclaimed without rewriting a file. The stable store stays in a
+// BuntStore in the same directory, returned by Stable. The location of
+// each log is kept in memory and rebuilt from the segments on open.
+//
+// It's a type of its own rather than an engine of BuntStore because every
+// log feature of BuntStore is built on BuntDB transactions over the log
+// keys, which segment files don't have. So it only has the raft
+// interfaces, Segments, Stable and Close. It has no Shrink, which it
+// doesn't need, and none of Backup, RestoreFrom, BackupSince, Verify,
+// Scrub, Subscribe, TruncateAfter, CompactTo or OnSnapshot, nor the
+// Hooks, Metrics, Trace, HMACKey, Retention, Archiver, ChunkSize, Blobs,
+// TermIndex, Indexes and StrictAppend options. The stable store has them
+// all, as it's a BuntStore.
+type SegmentStore struct {
+	dir    string
+	opts   SegmentOptions
+	stable *BuntStore
+
+	// mu guards the segments and the index of the logs.
+	mu     sync.RWMutex
+	closed bool
+	dirty  bool
+	segs   []*segment
+	idxs   []uint64
+	locs   []segmentLoc
+	buf    []byte
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// segment is a segment file. The last segment is the one written to.
+type segment struct {
+	seq  uint64
+	f    *os.File
+	size int64
+
+	// live is the number of logs of the index stored in the segment.
+	live int
+}
+
+// segmentLoc is where the payload of a log record is stored.
+type segmentLoc struct {
+	seg  *segment
+	off  int64
+	size int
+}
+
+// OpenSegmentStore opens the SegmentStore in dir, creating it if needed.
+// A torn record at the end of the last segment, such as after a power
+// loss, is truncated.
+func OpenSegmentStore(dir string, opts *SegmentOptions) (*SegmentStore, error) {
+	if opts == nil {
+		opts = &SegmentOptions{}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	stableOpts := Options{Durability: High}
+	if opts.Stable != nil {
+		stableOpts = *opts.Stable
+	}
+
+	// The lock of the stable store keeps other processes out of dir
+	stable, err := Open(filepath.Join(dir, segmentStableFile), &stableOpts)
+	if err != nil {
+		return nil, err
+	}
+	s := &SegmentStore{dir: dir, opts: *opts, stable: stable,
+		done: make(chan struct{})}
+	if err := s.load(); err != nil {
+		s.closeSegments()
+		stable.Close()
+		return nil, err
+	}
+	if opts.Durability == Medium {
+		s.wg.Add(1)
+		go s.runSync()
+	}
+	return s, nil
+}
+
+// load replays the segments into the index.
+func (s *SegmentStore) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for i, seq := range seqs {
+		f, err := os.OpenFile(s.segmentPath(seq), os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		seg := &segment{seq: seq, f: f}
+		s.segs = append(s.segs, seg)
+		torn, err := s.replay(seg)
+		if err != nil {
+			return err
+		}
+		if torn {
+			if i != len(seqs)-1 {
+				return fmt.Errorf("%w: %s", errCorruptSegment, f.Name())
+			}
+			if err := f.Truncate(seg.size); err != nil {
+				return err
+			}
+		}
+	}
+	if len(s.segs) == 0 {
+		return s.rotate()
+	}
+
+	// In case the store stopped before deleting them
+	return s.dropSegments()
+}
+
+// replay applies the records of seg to the index, up to a torn or corrupt
+// record, if any, for which it reports true. The size of the segment is
+// set to the end of the last good record.
+func (s *SegmentStore) replay(seg *segment) (bool, error) {
+	rd := bufio.NewReader(seg.f)
+	var hdr [recordHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return true, nil
+			}
+			return false, err
+		}
+		size := int(binary.LittleEndian.Uint32(hdr[1:]))
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(rd, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return true, nil
+			}
+			return false, err
+		}
+		if crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(hdr[5:]) {
+			return true, nil
+		}
+		switch {
+		case hdr[0] == recordLog && size >= 17:
+			s.put(binary.LittleEndian.Uint64(payload),
+				segmentLoc{seg: seg, off: seg.size + recordHeaderSize, size: size})
+		case hdr[0] == recordDelete && size == 16:
+			s.remove(binary.LittleEndian.Uint64(payload),
+				binary.LittleEndian.Uint64(payload[8:]))
+		default:
+			return true, nil
+		}
+		seg.size += int64(recordHeaderSize + size)
+	}
+}
+
+func (s *SegmentStore) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+// active returns the segment being written.
+func (s *SegmentStore) active() *segment {
+	return s.segs[len(s.segs)-1]
+}
+
+// rotate syncs the segment being written, if any, and starts a new one.
+func (s *SegmentStore) rotate() error {
+	var seq uint64 = 1
+	if len(s.segs) > 0 {
+		last := s.active()
+		if err := last.f.Sync(); err != nil {
+			return err
+		}
+		seq = last.seq + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		f.Close()
+		return err
+	}
+	s.segs = append(s.segs, &segment{seq: seq, f: f})
+	s.dirty = false
+	return nil
+}
+
+// search returns the position of idx in the index, or where it would be
+// inserted.
+func (s *SegmentStore) search(idx uint64) int {
+	return sort.Search(len(s.idxs), func(i int) bool { return s.idxs[i] >= idx })
+}
+
+// put records the location of the log at idx, replacing any previous one.
+func (s *SegmentStore) put(idx uint64, loc segmentLoc) {
+	loc.seg.live++
+	i := s.search(idx)
+	if i < len(s.idxs) && s.idxs[i] == idx {
+		s.locs[i].seg.live--
+		s.locs[i] = loc
+		return
+	}
+	if i == len(s.idxs) {
+		s.idxs = append(s.idxs, idx)
+		s.locs = append(s.locs, loc)
+		return
+	}
+	s.idxs = append(s.idxs[:i+1], s.idxs[i:]...)
+	s.idxs[i] = idx
+	s.locs = append(s.locs[:i+1], s.locs[i:]...)
+	s.locs[i] = loc
+}
+
+// remove removes the logs from min to max from the index, returning the
+// number removed.
+func (s *SegmentStore) remove(min, max uint64) int {
+	i := s.search(min)
+	j := i
+	for j < len(s.idxs) && s.idxs[j] <= max {
+		s.locs[j].seg.live--
+		j++
+	}
+	if j == i {
+		return 0
+	}
+	s.idxs = append(s.idxs[:i], s.idxs[j:]...)
+	s.locs = append(s.locs[:i], s.locs[j:]...)
+	return j - i
+}
+
+// appendRecord appends a record to buf.
+func appendRecord(buf []byte, kind byte, payload []byte) []byte {
+	buf = append(buf, kind)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(payload, castagnoli))
+	return append(buf, payload...)
+}
+
+// write appends buf to the segment being written, which is truncated back
+// if it fails, and syncs it as the durability requires.
+func (s *SegmentStore) write(buf []byte) error {
+	seg := s.active()
+	if _, err := seg.f.WriteAt(buf, seg.size); err != nil {
+		seg.f.Truncate(seg.size)
+		return err
+	}
+	seg.size += int64(len(buf))
+	switch s.opts.Durability {
+	case High:
+		return seg.f.Sync()
+	case Medium:
+		s.dirty = true
+	}
+	return nil
+}
+
+// FirstIndex returns the first known index from the Raft log.
+func (s *SegmentStore) FirstIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	if len(s.idxs) == 0 {
+		return 0, nil
+	}
+	return s.idxs[0], nil
+}
+
+// LastIndex returns the last known index from the Raft log.
+func (s *SegmentStore) LastIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	if len(s.idxs) == 0 {
+		return 0, nil
+	}
+	return s.idxs[len(s.idxs)-1], nil
+}
+
+// GetLog is used to retrieve a log from the segments at a given index.
+func (s *SegmentStore) GetLog(idx uint64, log *raft.Log) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	i := s.search(idx)
+	if i == len(s.idxs) || s.idxs[i] != idx {
+		return raft.ErrLogNotFound
+	}
+	loc := s.locs[i]
+	rec := make([]byte, recordHeaderSize+loc.size)
+	if _, err := loc.seg.f.ReadAt(rec, loc.off-recordHeaderSize); err != nil {
+		return err
+	}
+	payload := rec[recordHeaderSize:]
+	if crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(rec[5:]) {
+		return &ErrCorruptEntry{Index: idx, Err: errRecordChecksum}
+	}
+	if err := decodeLogHeader(idx, bytesToString(payload), log); err != nil {
+		return corruptEntry(idx, bytesToString(payload), err)
+	}
+	log.Data = payload[17:]
+	return nil
+}
+
+// StoreLog is used to store a single raft log
+func (s *SegmentStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs appends a set of raft logs to the segment being written. Logs
+// stored over existing ones replace them.
+func (s *SegmentStore) StoreLogs(logs []*raft.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if s.active().size >= s.opts.segmentSize() {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	seg := s.active()
+	buf := s.buf[:0]
+	var payload []byte
+	locs := make([]segmentLoc, len(logs))
+	for i, log := range logs {
+		payload = appendLog(payload[:0], log)
+		locs[i] = segmentLoc{seg: seg, off: seg.size + int64(len(buf)) + recordHeaderSize,
+			size: len(payload)}
+		buf = appendRecord(buf, recordLog, payload)
+	}
+	s.buf = buf
+	if err := s.write(buf); err != nil {
+		return err
+	}
+	for i, log := range logs {
+		s.put(log.Index, locs[i])
+	}
+	return nil
+}
+
+// DeleteRange is used to delete logs within a given range inclusively.
+// The segments left without logs are deleted, oldest first.
+func (s *SegmentStore) DeleteRange(min, max uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	i := s.search(min)
+	if i == len(s.idxs) || s.idxs[i] > max {
+		return nil
+	}
+	var payload [16]byte
+	binary.LittleEndian.PutUint64(payload[:], min)
+	binary.LittleEndian.PutUint64(payload[8:], max)
+	if err := s.write(appendRecord(s.buf[:0], recordDelete, payload[:])); err != nil {
+		return err
+	}
+	s.remove(min, max)
+	return s.dropSegments()
+}
+
+// dropSegments deletes the oldest segments while they hold no logs. A
+// segment can't be deleted before the ones before it, as its delete
+// records may be all that hides their logs.
+func (s *SegmentStore) dropSegments() error {
+	var dropped bool
+	for len(s.segs) > 1 && s.segs[0].live == 0 {
+		seg := s.segs[0]
+		seg.f.Close()
+		if err := os.Remove(seg.f.Name()); err != nil {
+			return err
+		}
+		s.segs = s.segs[1:]
+		dropped = true
+	}
+	if dropped {
+		return syncDir(s.dir)
+	}
+	return nil
+}
+
+// Segments returns the number of segment files.
+func (s *SegmentStore) Segments() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.segs)
+}
+
+// runSync fsyncs the segment being written every second if it was
+// written to, for Medium durability.
+func (s *SegmentStore) runSync() {
+	defer s.wg.Done()
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		s.mu.Lock()
+		if !s.closed && s.dirty {
+			if s.active().f.Sync() == nil {
+				s.dirty = false
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Stable returns the BuntStore of the stable store.
+func (s *SegmentStore) Stable() *BuntStore {
+	return s.stable
+}
+
+// Set is used to set a key/value set outside of the raft log
+func (s *SegmentStore) Set(k, v []byte) error {
+	return s.stable.Set(k, v)
+}
+
+// Get is used to retrieve a value from the k/v store by key
+func (s *SegmentStore) Get(k []byte) ([]byte, error) {
+	return s.stable.Get(k)
+}
+
+// SetUint64 is like Set, but handles uint64 values
+func (s *SegmentStore) SetUint64(key []byte, val uint64) error {
+	return s.stable.SetUint64(key, val)
+}
+
+// GetUint64 is like Get, but handles uint64 values
+func (s *SegmentStore) GetUint64(key []byte) (uint64, error) {
+	return s.stable.GetUint64(key)
+}
+
+// Close syncs and closes the segments and the stable store. It is safe to
+// call Close more than once.
+func (s *SegmentStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.active().f.Sync()
+	s.closeSegments()
+	s.mu.Unlock()
+	close(s.done)
+	s.wg.Wait()
+	return firstErr(err, s.stable.Close())
+}
+
+func (s *SegmentStore) closeSegments() {
+	for _, seg := range s.segs {
+		seg.f.Close()
+	}
+}
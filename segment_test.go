@@ -0,0 +1,133 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestSegmentStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenSegmentStore(dir, &SegmentOptions{SegmentSize: 256})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := uint64(1); i <= 100; i++ {
+		if err := store.StoreLog(testRaftLog(i, "data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	n := store.Segments()
+	if n < 10 {
+		t.Fatalf("bad: %d segments", n)
+	}
+
+	// Deleting the head removes the segments it empties
+	if err := store.DeleteRange(1, 50); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if m := store.Segments(); m >= n-3 {
+		t.Fatalf("bad: %d segments, was %d", m, n)
+	}
+	var log raft.Log
+	if err := store.GetLog(50, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := store.GetLog(51, &log); err != nil || log.Index != 51 || string(log.Data) != "data" {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+
+	// A log stored over another replaces it, including after reopening
+	if err := store.StoreLog(&raft.Log{Index: 60, Term: 2, Data: []byte("new")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err = OpenSegmentStore(dir, &SegmentOptions{SegmentSize: 256})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	first, _ := store.FirstIndex()
+	last, _ := store.LastIndex()
+	if first != 51 || last != 100 {
+		t.Fatalf("bad: %d %d", first, last)
+	}
+	if err := store.GetLog(60, &log); err != nil || log.Term != 2 || string(log.Data) != "new" {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+	if term, err := store.GetUint64([]byte("CurrentTerm")); err != nil || term != 2 {
+		t.Fatalf("bad: %v %d", err, term)
+	}
+}
+
+func TestSegmentStore_TornTail(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenSegmentStore(dir, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		if err := store.StoreLog(testRaftLog(i, "data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	path := store.active().f.Name()
+	store.Close()
+
+	// The last record is cut short
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Truncate(path, fi.Size()-3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err = OpenSegmentStore(dir, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if last, _ := store.LastIndex(); last != 2 {
+		t.Fatalf("bad: %d", last)
+	}
+	if err := store.StoreLog(testRaftLog(3, "again")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var log raft.Log
+	if err := store.GetLog(3, &log); err != nil || string(log.Data) != "again" {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+
+	// A corrupt segment that isn't the last one fails to open
+	if err := store.rotate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+	if err := os.WriteFile(path, []byte("garbage!!!"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := OpenSegmentStore(dir, nil); !errors.Is(err, errCorruptSegment) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// The directory is locked while open
+	os.Remove(path)
+	store, err = OpenSegmentStore(dir, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if _, err := OpenSegmentStore(dir, nil); !errors.Is(err, ErrLocked) {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, segmentStableFile)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
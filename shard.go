@@ -0,0 +1,396 @@
+package raftbuntdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/raft"
+)
+
+const (
+	// defaultShardSize is the default of ShardOptions.ShardSize.
+	defaultShardSize = 1 << 20
+
+	// shardPrefix and shardExt surround the first index of the range of
+	// a shard in the name of its file.
+	shardPrefix = "shard-"
+	shardExt    = ".db"
+
+	// shardStableFile is the name of the BuntStore file of the stable
+	// store in the directory of a ShardedStore.
+	shardStableFile = "stable.db"
+)
+
+// ShardOptions configure a ShardedStore opened with OpenShardedStore.
+type ShardOptions struct {
+	// ShardSize is the number of indexes in the range of each shard. It
+	// must not change once the store is created. Defaults to 1048576.
+	ShardSize uint64
+
+	// Logs are the options of the BuntStore of each shard. Defaults to
+	// DefaultOptions.
+	Logs *Options
+
+	// Stable are the options of the BuntStore that holds the stable
+	// store. Defaults to High durability, as raft's votes must survive a
+	// crash.
+	Stable *Options
+}
+
+func (o *ShardOptions) shardSize() uint64 {
+	if o.ShardSize == 0 {
+		return defaultShardSize
+	}
+	return o.ShardSize
+}
+
+// ShardedStore is a raft log and stable store that spreads the log over
+// BuntStore files by index range, a shard for each ShardSize indexes, so
+// that compaction deletes the files of old shards outright and the cost
+// of a shrink is bounded by the size of a shard. The stable store is kept
+// in a BuntStore of its own, returned by Stable.
+//
+// A StoreLogs batch that spans shards is written in a transaction per
+// shard, so a failure can leave the first part of the batch stored.
+type ShardedStore struct {
+	dir    string
+	opts   ShardOptions
+	stable *BuntStore
+
+	// mu guards shards, which is held for writing to add or remove a
+	// shard, and for reading to use one.
+	mu     sync.RWMutex
+	closed bool
+	shards []*shard
+}
+
+// shard is the BuntStore of the logs from start to end.
+type shard struct {
+	start, end uint64
+	store      *BuntStore
+}
+
+// OpenShardedStore opens the ShardedStore in dir, creating it if needed.
+func OpenShardedStore(dir string, opts *ShardOptions) (*ShardedStore, error) {
+	if opts == nil {
+		opts = &ShardOptions{}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	stableOpts := Options{Durability: High}
+	if opts.Stable != nil {
+		stableOpts = *opts.Stable
+	}
+
+	// The lock of the stable store keeps other processes out of dir
+	stable, err := Open(filepath.Join(dir, shardStableFile), &stableOpts)
+	if err != nil {
+		return nil, err
+	}
+	s := &ShardedStore{dir: dir, opts: *opts, stable: stable}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		stable.Close()
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, shardPrefix) || !strings.HasSuffix(name, shardExt) {
+			continue
+		}
+		start, err := strconv.ParseUint(name[len(shardPrefix):len(name)-len(shardExt)], 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, err := s.openShard(start); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// shardStart returns the first index of the range of the shard of idx.
+func (s *ShardedStore) shardStart(idx uint64) uint64 {
+	if idx == 0 {
+		return 0
+	}
+	size := s.opts.shardSize()
+	return (idx-1)/size*size + 1
+}
+
+func (s *ShardedStore) shardPath(start uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", shardPrefix, start, shardExt))
+}
+
+// openShard opens the shard of the range from start, with mu held for
+// writing or during open, and adds it to the shards in order.
+func (s *ShardedStore) openShard(start uint64) (*shard, error) {
+	opts := DefaultOptions
+	if s.opts.Logs != nil {
+		opts = s.opts.Logs
+	}
+	store, err := Open(s.shardPath(start), opts)
+	if err != nil {
+		return nil, err
+	}
+	sh := &shard{start: start, end: start + s.opts.shardSize() - 1, store: store}
+	i := sort.Search(len(s.shards), func(i int) bool { return s.shards[i].start > start })
+	s.shards = append(s.shards[:i], append([]*shard{sh}, s.shards[i:]...)...)
+	return sh, nil
+}
+
+// find returns the shard of idx, or nil, with mu held.
+func (s *ShardedStore) find(idx uint64) *shard {
+	start := s.shardStart(idx)
+	i := sort.Search(len(s.shards), func(i int) bool { return s.shards[i].start >= start })
+	if i < len(s.shards) && s.shards[i].start == start {
+		return s.shards[i]
+	}
+	return nil
+}
+
+// Shards returns the number of shard files.
+func (s *ShardedStore) Shards() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.shards)
+}
+
+// FirstIndex returns the first known index from the Raft log.
+func (s *ShardedStore) FirstIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	for _, sh := range s.shards {
+		idx, err := sh.store.FirstIndex()
+		if err != nil || idx != 0 {
+			return idx, err
+		}
+	}
+	return 0, nil
+}
+
+// LastIndex returns the last known index from the Raft log.
+func (s *ShardedStore) LastIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	for i := len(s.shards) - 1; i >= 0; i-- {
+		idx, err := s.shards[i].store.LastIndex()
+		if err != nil || idx != 0 {
+			return idx, err
+		}
+	}
+	return 0, nil
+}
+
+// GetLog is used to retrieve a log from its shard at a given index.
+func (s *ShardedStore) GetLog(idx uint64, log *raft.Log) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	sh := s.find(idx)
+	if sh == nil {
+		return raft.ErrLogNotFound
+	}
+	return sh.store.GetLog(idx, log)
+}
+
+// StoreLog is used to store a single raft log
+func (s *ShardedStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs is used to store a set of raft logs, each in its shard.
+func (s *ShardedStore) StoreLogs(logs []*raft.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	if err := s.createShards(logs); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	// Each run of logs in the same shard is stored at once
+	for len(logs) > 0 {
+		start := s.shardStart(logs[0].Index)
+		n := 1
+		for n < len(logs) && s.shardStart(logs[n].Index) == start {
+			n++
+		}
+		sh := s.find(logs[0].Index)
+		if sh == nil {
+			// Removed by a concurrent DeleteRange
+			return raft.ErrLogNotFound
+		}
+		if err := sh.store.StoreLogs(logs[:n]); err != nil {
+			return err
+		}
+		logs = logs[n:]
+	}
+	return nil
+}
+
+// createShards opens the missing shards of logs.
+func (s *ShardedStore) createShards(logs []*raft.Log) error {
+	s.mu.RLock()
+	missing := s.closed
+	for _, log := range logs {
+		missing = missing || s.find(log.Index) == nil
+	}
+	s.mu.RUnlock()
+	if !missing {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	var created bool
+	for _, log := range logs {
+		if s.find(log.Index) != nil {
+			continue
+		}
+		if _, err := s.openShard(s.shardStart(log.Index)); err != nil {
+			return err
+		}
+		created = true
+	}
+	if created {
+		return syncDir(s.dir)
+	}
+	return nil
+}
+
+// DeleteRange is used to delete logs within a given range inclusively.
+// The shards left without logs are deleted with their files.
+func (s *ShardedStore) DeleteRange(min, max uint64) error {
+	var empty []*shard
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrClosed
+	}
+	for _, sh := range s.shards {
+		if sh.end < min || sh.start > max {
+			continue
+		}
+		if min > sh.start || max < sh.end {
+			lo, hi := min, max
+			if lo < sh.start {
+				lo = sh.start
+			}
+			if hi > sh.end {
+				hi = sh.end
+			}
+			if err := sh.store.DeleteRange(lo, hi); err != nil {
+				s.mu.RUnlock()
+				return err
+			}
+			if first, err := sh.store.FirstIndex(); err != nil || first != 0 {
+				continue
+			}
+		}
+		empty = append(empty, sh)
+	}
+	s.mu.RUnlock()
+	if len(empty) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeShards(empty)
+}
+
+// removeShards closes and deletes the files of shards, with mu held for
+// writing.
+func (s *ShardedStore) removeShards(shards []*shard) error {
+	for _, sh := range shards {
+		i := sort.Search(len(s.shards), func(i int) bool { return s.shards[i].start >= sh.start })
+		if i == len(s.shards) || s.shards[i] != sh {
+			continue
+		}
+		s.shards = append(s.shards[:i], s.shards[i+1:]...)
+		if err := sh.store.Close(); err != nil {
+			return err
+		}
+		if err := os.Remove(sh.store.path); err != nil {
+			return err
+		}
+	}
+	return syncDir(s.dir)
+}
+
+// Shrink shrinks the file of each shard in turn.
+func (s *ShardedStore) Shrink() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	for _, sh := range s.shards {
+		if err := sh.store.Shrink(); err != nil {
+			return fmt.Errorf("shard %d: %w", sh.start, err)
+		}
+	}
+	return nil
+}
+
+// Stable returns the BuntStore of the stable store.
+func (s *ShardedStore) Stable() *BuntStore {
+	return s.stable
+}
+
+// Set is used to set a key/value set outside of the raft log
+func (s *ShardedStore) Set(k, v []byte) error {
+	return s.stable.Set(k, v)
+}
+
+// Get is used to retrieve a value from the k/v store by key
+func (s *ShardedStore) Get(k []byte) ([]byte, error) {
+	return s.stable.Get(k)
+}
+
+// SetUint64 is like Set, but handles uint64 values
+func (s *ShardedStore) SetUint64(key []byte, val uint64) error {
+	return s.stable.SetUint64(key, val)
+}
+
+// GetUint64 is like Get, but handles uint64 values
+func (s *ShardedStore) GetUint64(key []byte) (uint64, error) {
+	return s.stable.GetUint64(key)
+}
+
+// Close closes the shards and the stable store. It is safe to call Close
+// more than once.
+func (s *ShardedStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var err error
+	for _, sh := range s.shards {
+		err = firstErr(err, sh.store.Close())
+	}
+	return firstErr(err, s.stable.Close())
+}
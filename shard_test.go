@@ -0,0 +1,96 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestShardedStore(t *testing.T) {
+	dir := t.TempDir()
+	opts := &ShardOptions{ShardSize: 10}
+	store, err := OpenShardedStore(dir, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A batch across shards is split between them
+	var logs []*raft.Log
+	for i := uint64(1); i <= 35; i++ {
+		logs = append(logs, testRaftLog(i, "data"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := store.Shards(); n != 4 {
+		t.Fatalf("bad: %d shards", n)
+	}
+	first, _ := store.FirstIndex()
+	last, _ := store.LastIndex()
+	if first != 1 || last != 35 {
+		t.Fatalf("bad: %d %d", first, last)
+	}
+
+	// Compacting the head deletes the files of whole shards
+	if err := store.DeleteRange(1, 25); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := store.Shards(); n != 2 {
+		t.Fatalf("bad: %d shards", n)
+	}
+	for _, start := range []uint64{1, 11} {
+		if _, err := os.Stat(store.shardPath(start)); !os.IsNotExist(err) {
+			t.Fatalf("bad: shard %d: %v", start, err)
+		}
+	}
+	var log raft.Log
+	if err := store.GetLog(25, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := store.GetLog(26, &log); err != nil || log.Index != 26 {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+
+	// Truncating the tail empties the last shard
+	if err := store.DeleteRange(31, 35); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := store.Shards(); n != 1 {
+		t.Fatalf("bad: %d shards", n)
+	}
+	if err := store.Shrink(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The shards and the stable store are found again
+	store, err = OpenShardedStore(dir, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	first, _ = store.FirstIndex()
+	last, _ = store.LastIndex()
+	if first != 26 || last != 30 {
+		t.Fatalf("bad: %d %d", first, last)
+	}
+	if term, err := store.GetUint64([]byte("CurrentTerm")); err != nil || term != 3 {
+		t.Fatalf("bad: %v %d", err, term)
+	}
+	if _, err := os.Stat(filepath.Join(dir, shardStableFile)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The directory is locked while open
+	if _, err := OpenShardedStore(dir, opts); !errors.Is(err, ErrLocked) {
+		t.Fatalf("bad: %v", err)
+	}
+}
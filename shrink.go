@@ -0,0 +1,255 @@
+package raftbuntdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/tidwall/buntdb"
+)
+
+// shrinkChunk is the number of keys ShrinkAsync copies per read
+// transaction.
+const shrinkChunk = 1000
+
+// errReopened is returned by ShrinkAsync and a throttled Backup when the
+// database was reopened or its file replaced during the copy, such as by
+// RestoreFrom or an automatic shrink, so the copy would miss its writes.
+var errReopened = errors.New("database reopened during the copy")
+
+// AutoShrink configures buntdb's automatic shrink, see Options.AutoShrink.
+// It runs in buntdb's background goroutine and isn't throttled by
+// Options.MaintenanceRate.
+type AutoShrink struct {
+	// MinSize is the file size below which the file is never shrunk.
+	// Defaults to 32MB.
+	MinSize int
+
+	// Percentage is how much the file must have grown since the last
+	// shrink, as a percentage of its size then, before it's shrunk.
+	// Defaults to 100.
+	Percentage int
+}
+
+// ShrinkProgress is an update sent by ShrinkAsync.
+type ShrinkProgress struct {
+	// BytesWritten is the size of the new file so far.
+	BytesWritten int64
+
+	// Percent is the share of the keys copied so far, from 0 to 100.
+	Percent float64
+
+	// Done is set on the last update, after which the channel is closed.
+	Done bool
+
+	// Err is the outcome of the shrink, set on the last update. It is the
+	// context's error when the shrink was canceled.
+	Err error
+}
+
+// ShrinkAsync shrinks the file like Shrink, in the background, and sends
+// its progress on the returned channel. The keys are copied to a new file
+// a chunk at a time, so writes only wait for one chunk, and the writes
+// made meanwhile are appended to it before it replaces the file and the
+// store reopens it. Canceling ctx stops the shrink and leaves the file as
+// it was. Updates are dropped while the channel is full, but the last one,
+// with Done set, is always sent.
+func (b *BuntStore) ShrinkAsync(ctx context.Context) <-chan ShrinkProgress {
+	progress := make(chan ShrinkProgress, 1)
+	finish := func(p ShrinkProgress) {
+		p.Done = true
+		select {
+		case <-progress:
+		default:
+		}
+		progress <- p
+		close(progress)
+	}
+	if err := firstErr(b.checkReadOnly(), b.checkNoSpace()); err != nil {
+		finish(ShrinkProgress{Err: err})
+		return progress
+	}
+	if !b.shrinkMu.TryLock() {
+		finish(ShrinkProgress{Err: buntdb.ErrShrinkInProcess})
+		return progress
+	}
+	go func() {
+		defer b.shrinkMu.Unlock()
+		p, err := b.shrinkFile(ctx, func(p ShrinkProgress) {
+			select {
+			case progress <- p:
+			default:
+			}
+		})
+		if ctx.Err() == nil && err != errReopened {
+			b.health.record(err, true, false)
+		}
+		p.Err = err
+		finish(p)
+	}()
+	return progress
+}
+
+// shrinkFile rewrites the file with the current keys and reopens it.
+func (b *BuntStore) shrinkFile(ctx context.Context,
+	report func(p ShrinkProgress)) (ShrinkProgress, error) {
+	var p ShrinkProgress
+	c, err := b.startCopy()
+	if err != nil {
+		return p, err
+	}
+
+	tmp := b.path + ".shrink"
+	os.Remove(tmp)
+	if err := createFile(tmp, c.mode); err != nil {
+		return p, err
+	}
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_APPEND, 0)
+	if err == nil {
+		err = os.Chmod(tmp, c.mode)
+	}
+	if err == nil {
+		err = b.copyKeys(ctx, b.throttle(f), c.total, &p, report)
+	}
+	if err == nil {
+		err = b.swapShrunk(c, f, tmp)
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		os.Remove(tmp)
+		return p, err
+	}
+	if fi, err := os.Stat(b.path); err == nil {
+		p.BytesWritten = fi.Size()
+	}
+	p.Percent = 100
+	return p, nil
+}
+
+// fileCopy is the start of a copy of the file made while it's in use.
+type fileCopy struct {
+	db     *buntdb.DB
+	file   os.FileInfo
+	endpos int64 // size of the file when the copy started
+	mode   os.FileMode
+	total  int // number of keys when the copy started
+}
+
+// startCopy returns the state of the file before copyKeys. The writes
+// made after it are in the file from endpos, and replaying them over the
+// copied keys in order gives the final contents, whichever of their
+// values copyKeys saw.
+func (b *BuntStore) startCopy() (fileCopy, error) {
+	var c fileCopy
+	err := b.do(func(db *buntdb.DB) error {
+		// Writers wait for the read lock, so the file ends on a command
+		c.db = db
+		return db.View(func(tx *buntdb.Tx) error {
+			fi, err := os.Stat(b.path)
+			if err != nil {
+				return err
+			}
+			c.file, c.endpos, c.mode = fi, fi.Size(), fi.Mode().Perm()
+			c.total, err = tx.Len()
+			return err
+		})
+	})
+	return c, err
+}
+
+// copyTail writes the commands appended to the file since c started to w.
+// Writes must be stopped.
+func (b *BuntStore) copyTail(c fileCopy, w io.Writer) error {
+	src, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(fi, c.file) {
+		return errReopened
+	}
+	if _, err := src.Seek(c.endpos, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// copyKeys writes the current keys to w as set commands, shrinkChunk keys
+// per read transaction.
+func (b *BuntStore) copyKeys(ctx context.Context, w io.Writer, total int,
+	p *ShrinkProgress, report func(p ShrinkProgress)) error {
+	var pivot string
+	var copied int
+	for started := false; ; started = true {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var buf []byte
+		var n int
+		err := b.view(func(tx *buntdb.Tx) error {
+			return tx.AscendGreaterOrEqual("", pivot, func(key, val string) bool {
+				if started && key == pivot {
+					return true
+				}
+				buf = appendCommand(buf, "set", key, val)
+				pivot = key
+				n++
+				return n < shrinkChunk
+			})
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		copied += n
+		p.BytesWritten += int64(len(buf))
+		if total > 0 && copied < total {
+			p.Percent = float64(copied) * 100 / float64(total)
+		} else {
+			p.Percent = 100
+		}
+		report(*p)
+		if n < shrinkChunk {
+			return nil
+		}
+	}
+}
+
+// swapShrunk appends the commands written since c started to f, replaces
+// the file with it and reopens the database, with writes stopped.
+func (b *BuntStore) swapShrunk(c fileCopy, f *os.File, tmp string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+	if b.db != c.db {
+		return errReopened
+	}
+	err := b.copyTail(c, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	b.db.Close()
+	err = renameFile(tmp, b.path)
+	if rerr := b.reopenLocked(); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+package raftbuntdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// fillStore stores n logs and deletes all but the last ten, leaving the
+// file mostly garbage.
+func fillStore(t *testing.T, store *BuntStore, n int) {
+	t.Helper()
+	var logs []*raft.Log
+	for i := 1; i <= n; i++ {
+		logs = append(logs, testRaftLog(uint64(i), fmt.Sprintf("log %d", i)))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(1, uint64(n-10)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return fi.Size()
+}
+
+func TestBuntStore_ShrinkAsync(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	for i := 0; i < 2500; i++ {
+		store.Set([]byte(fmt.Sprintf("key%d", i)), []byte("val"))
+	}
+	fillStore(t, store, 5000)
+	before := fileSize(t, store.path)
+
+	var last ShrinkProgress
+	for p := range store.ShrinkAsync(context.Background()) {
+		if p.Percent < last.Percent || p.Percent > 100 {
+			t.Fatalf("bad: %+v after %+v", p, last)
+		}
+		last = p
+	}
+	if !last.Done || last.Err != nil || last.Percent != 100 {
+		t.Fatalf("bad: %+v", last)
+	}
+	after := fileSize(t, store.path)
+	if after >= before || last.BytesWritten != after {
+		t.Fatalf("bad: %d -> %d, %+v", before, after, last)
+	}
+	if _, err := os.Stat(store.path + ".shrink"); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+	checkCounter(t, store)
+	if idx, _ := store.FirstIndex(); idx != 4991 {
+		t.Fatalf("bad: %d", idx)
+	}
+	if val, err := store.Get([]byte("key2499")); err != nil || string(val) != "val" {
+		t.Fatalf("bad: %q %v", val, err)
+	}
+}
+
+func TestBuntStore_ShrinkAsync_ConcurrentWrites(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	fillStore(t, store, 5000)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := uint64(5001); i <= 6000; i++ {
+			if err := store.StoreLog(testRaftLog(i, "new")); err != nil {
+				t.Errorf("err: %s", err)
+				return
+			}
+			if i%100 == 0 {
+				if err := store.DeleteRange(i-150, i-100); err != nil {
+					t.Errorf("err: %s", err)
+					return
+				}
+			}
+		}
+	}()
+	var last ShrinkProgress
+	for p := range store.ShrinkAsync(context.Background()) {
+		last = p
+	}
+	wg.Wait()
+	if last.Err != nil {
+		t.Fatalf("err: %s", last.Err)
+	}
+	want, err := store.LogCount()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkCounter(t, store)
+
+	// Every write made during the shrink is in the new file
+	store.Close()
+	store, err = NewBuntStore(store.path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if n, _ := store.LogCount(); n != want {
+		t.Fatalf("bad: %d, want %d", n, want)
+	}
+	if idx, _ := store.LastIndex(); idx != 6000 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_ShrinkAsync_Cancel(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	fillStore(t, store, 100)
+	before := fileSize(t, store.path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var last ShrinkProgress
+	for p := range store.ShrinkAsync(ctx) {
+		last = p
+	}
+	if !last.Done || last.Err != context.Canceled {
+		t.Fatalf("bad: %+v", last)
+	}
+	if size := fileSize(t, store.path); size != before {
+		t.Fatalf("bad: %d -> %d", before, size)
+	}
+	if _, err := os.Stat(store.path + ".shrink"); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+	if health := store.Health(); !health.OK() {
+		t.Fatalf("bad: %+v", health)
+	}
+	if n, _ := store.LogCount(); n != 10 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestBuntStore_ShrinkInProcess(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	store.shrinkMu.Lock()
+	if err := store.Shrink(); err != buntdb.ErrShrinkInProcess {
+		t.Fatalf("bad: %v", err)
+	}
+	p := <-store.ShrinkAsync(context.Background())
+	if !p.Done || p.Err != buntdb.ErrShrinkInProcess {
+		t.Fatalf("bad: %+v", p)
+	}
+	store.shrinkMu.Unlock()
+	if err := store.Shrink(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestBuntStore_ShrinkAsync_Closed(t *testing.T) {
+	store := testBuntStore(t)
+	store.Close()
+	p := <-store.ShrinkAsync(context.Background())
+	if !p.Done || p.Err != ErrClosed {
+		t.Fatalf("bad: %+v", p)
+	}
+}
+
+func TestOpen_AutoShrink(t *testing.T) {
+	for _, tt := range []struct {
+		auto     *AutoShrink
+		disabled bool
+		min, pct int
+	}{
+		{nil, true, 32 * 1024 * 1024, 100},
+		{&AutoShrink{}, false, 32 * 1024 * 1024, 100},
+		{&AutoShrink{MinSize: 1024, Percentage: 50}, false, 1024, 50},
+	} {
+		store := testBuntStoreOpts(t, &Options{AutoShrink: tt.auto})
+		var config buntdb.Config
+		if err := store.DB().ReadConfig(&config); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		store.Close()
+		if config.AutoShrinkDisabled != tt.disabled ||
+			config.AutoShrinkMinSize != tt.min ||
+			config.AutoShrinkPercentage != tt.pct {
+			t.Fatalf("bad: %+v for %+v", config, tt.auto)
+		}
+	}
+}
+
+func TestBuntStore_CopyFileReplaced(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	fillStore(t, store, 100)
+	c, err := store.startCopy()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Such as by an automatic shrink
+	if err := store.Shrink(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.copyTail(c, io.Discard); err != errReopened {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package raftbuntdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// Bucket name of the snapshot metadata
+const dbSnaps = "s:"
+
+// BuntSnapshotStore implements raft.SnapshotStore. The snapshot metadata
+// is kept in the BuntStore and the snapshot data in files alongside the
+// database, so one store manages all of a node's raft state.
+type BuntSnapshotStore struct {
+	store  *BuntStore
+	dir    string
+	retain int
+}
+
+// NewBuntSnapshotStore returns a snapshot store that keeps the newest
+// retain snapshots. The snapshot files are written to dir, which defaults
+// to a "snapshots" directory next to the database file.
+func NewBuntSnapshotStore(store *BuntStore, dir string,
+	retain int) (*BuntSnapshotStore, error) {
+	if retain < 1 {
+		return nil, fmt.Errorf("must retain at least one snapshot")
+	}
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(store.path), "snapshots")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &BuntSnapshotStore{store: store, dir: dir, retain: retain}, nil
+}
+
+// Create is used to start a new snapshot.
+func (s *BuntSnapshotStore) Create(index, term uint64,
+	peers []byte) (raft.SnapshotSink, error) {
+	now := time.Now()
+	id := fmt.Sprintf("%d-%d-%d", term, index, now.UnixNano()/int64(time.Millisecond))
+	f, err := os.Create(filepath.Join(s.dir, id+".tmp"))
+	if err != nil {
+		return nil, err
+	}
+	return &buntSnapshotSink{
+		store: s,
+		file:  f,
+		meta: raft.SnapshotMeta{
+			ID:    id,
+			Index: index,
+			Term:  term,
+			Peers: peers,
+		},
+	}, nil
+}
+
+// List returns the available snapshots, newest first.
+func (s *BuntSnapshotStore) List() ([]*raft.SnapshotMeta, error) {
+	metas, err := s.metas()
+	if err != nil {
+		return nil, err
+	}
+	if len(metas) > s.retain {
+		metas = metas[:s.retain]
+	}
+	return metas, nil
+}
+
+// Open takes a snapshot ID and returns its metadata and a reader.
+func (s *BuntSnapshotStore) Open(id string) (*raft.SnapshotMeta,
+	io.ReadCloser, error) {
+	var meta raft.SnapshotMeta
+	err := s.store.view(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(dbSnaps + id)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(val), &meta)
+	})
+	if err != nil {
+		if err == buntdb.ErrNotFound {
+			return nil, nil, fmt.Errorf("snapshot %s not found", id)
+		}
+		return nil, nil, err
+	}
+	f, err := os.Open(s.snapPath(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &meta, f, nil
+}
+
+func (s *BuntSnapshotStore) snapPath(id string) string {
+	return filepath.Join(s.dir, id+".snap")
+}
+
+// metas returns all snapshot metadata, newest first.
+func (s *BuntSnapshotStore) metas() ([]*raft.SnapshotMeta, error) {
+	var metas []*raft.SnapshotMeta
+	err := s.store.view(func(tx *buntdb.Tx) error {
+		var err error
+		tx.AscendGreaterOrEqual("", dbSnaps, func(key, val string) bool {
+			if !strings.HasPrefix(key, dbSnaps) {
+				return false
+			}
+			meta := new(raft.SnapshotMeta)
+			if err = json.Unmarshal([]byte(val), meta); err != nil {
+				return false
+			}
+			metas = append(metas, meta)
+			return true
+		})
+		return err
+	})
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].Term != metas[j].Term {
+			return metas[i].Term > metas[j].Term
+		}
+		if metas[i].Index != metas[j].Index {
+			return metas[i].Index > metas[j].Index
+		}
+		return metas[i].ID > metas[j].ID
+	})
+	return metas, err
+}
+
+// reap removes the snapshots beyond the retain count.
+func (s *BuntSnapshotStore) reap() error {
+	metas, err := s.metas()
+	if err != nil || len(metas) <= s.retain {
+		return err
+	}
+	for _, meta := range metas[s.retain:] {
+		err := s.store.update(func(tx *buntdb.Tx) error {
+			_, err := tx.Delete(dbSnaps + meta.ID)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(s.snapPath(meta.ID)); err != nil &&
+			!os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// buntSnapshotSink writes a snapshot file and records its metadata on
+// Close.
+type buntSnapshotSink struct {
+	store  *BuntSnapshotStore
+	file   *os.File
+	meta   raft.SnapshotMeta
+	closed bool
+}
+
+func (s *buntSnapshotSink) ID() string {
+	return s.meta.ID
+}
+
+func (s *buntSnapshotSink) Write(p []byte) (int, error) {
+	n, err := s.file.Write(p)
+	s.meta.Size += int64(n)
+	return n, err
+}
+
+// Close syncs the snapshot file, moves it into place and records the
+// snapshot in the store.
+func (s *buntSnapshotSink) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	tmp := s.file.Name()
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = renameFile(tmp, s.store.snapPath(s.meta.ID))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	data, err := json.Marshal(&s.meta)
+	if err != nil {
+		return err
+	}
+	err = s.store.store.update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(dbSnaps+s.meta.ID, string(data), nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.store.reap()
+}
+
+// Cancel discards the snapshot.
+func (s *buntSnapshotSink) Cancel() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
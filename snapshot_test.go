@@ -0,0 +1,91 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_SnapshotStoreImplements(t *testing.T) {
+	var store interface{} = &BuntSnapshotStore{}
+	if _, ok := store.(raft.SnapshotStore); !ok {
+		t.Fatalf("BuntSnapshotStore does not implement raft.SnapshotStore")
+	}
+}
+
+func TestBuntSnapshotStore(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+	dir, err := ioutil.TempDir("", "bunt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	snaps, err := NewBuntSnapshotStore(store, dir, 2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A cancelled snapshot is not listed
+	sink, err := snaps.Create(10, 1, []byte("peers"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sink.Write([]byte("cancelled"))
+	if err := sink.Cancel(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	metas, err := snaps.List()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(metas) != 0 {
+		t.Fatalf("bad: %v", metas)
+	}
+
+	// Write three snapshots, only two are retained
+	for i := uint64(1); i <= 3; i++ {
+		sink, err := snaps.Create(i*10, 1, []byte("peers"))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := sink.Write([]byte{byte(i), 1, 2, 3}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	metas, err = snaps.List()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(metas) != 2 || metas[0].Index != 30 || metas[1].Index != 20 {
+		t.Fatalf("bad: %v", metas)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 snapshot files, got %d", len(files))
+	}
+
+	meta, rc, err := snaps.Open(metas[0].ID)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer rc.Close()
+	data, _ := ioutil.ReadAll(rc)
+	if !bytes.Equal(data, []byte{3, 1, 2, 3}) {
+		t.Fatalf("bad: %v", data)
+	}
+	if meta.Size != 4 || string(meta.Peers) != "peers" {
+		t.Fatalf("bad: %#v", meta)
+	}
+	if _, _, err := snaps.Open("missing"); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
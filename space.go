@@ -0,0 +1,66 @@
+package raftbuntdb
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// FileSize returns the size of the database file.
+func (b *BuntStore) FileSize() (int64, error) {
+	var size int64
+	err := b.do(func(db *buntdb.DB) error {
+		fi, err := os.Stat(b.path)
+		if err != nil {
+			return err
+		}
+		size = fi.Size()
+		return nil
+	})
+	return size, err
+}
+
+// DeadBytesEstimate estimates the bytes of the file taken by values that
+// were since overwritten or deleted, which a shrink would reclaim. The
+// size of the live logs is worked out from the log counter, assuming
+// values of the average size, so the estimate costs a scan of the other
+// keys only. The data of blobs is kept out of the file and isn't counted.
+func (b *BuntStore) DeadBytesEstimate() (int64, error) {
+	var live int64
+	err := b.view(func(tx *buntdb.Tx) error {
+		count, bytes := b.counter.inFile()
+		if count > 0 {
+			// Log keys have a fixed size
+			overhead := len(appendCommand(nil, "set", b.logKey(0), ""))
+			avg := strconv.FormatUint(bytes/count, 10)
+			live += int64(bytes) + int64(count)*int64(overhead-1+len(avg))
+		}
+		visit := func(key, val string) bool {
+			live += int64(len(appendCommand(nil, "set", key, val)))
+			if strings.HasPrefix(key, dbChunks) {
+				// The counter holds the data of chunked logs
+				live -= int64(len(val))
+			}
+			return true
+		}
+		// Every key but the logs, which sort between "l:" and "l;"
+		logs := b.keys.logs
+		if err := tx.AscendLessThan("", logs, visit); err != nil {
+			return err
+		}
+		return tx.AscendGreaterOrEqual("", logs[:len(logs)-1]+";", visit)
+	})
+	if err != nil {
+		return 0, err
+	}
+	size, err := b.FileSize()
+	if err != nil {
+		return 0, err
+	}
+	if dead := size - live; dead > 0 {
+		return dead, nil
+	}
+	return 0, nil
+}
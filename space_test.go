@@ -0,0 +1,103 @@
+package raftbuntdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_DeadBytesEstimate(t *testing.T) {
+	for _, keys := range []KeyEncoding{DecimalKeys, BinaryKeys} {
+		t.Run(fmt.Sprint(keys), func(t *testing.T) {
+			store := testBuntStoreOpts(t, &Options{KeyEncoding: keys})
+			defer store.Close()
+			var logs []*raft.Log
+			for i := uint64(1); i <= 1000; i++ {
+				logs = append(logs, testRaftLog(i, fmt.Sprintf("log data %d", i)))
+			}
+			if err := store.StoreLogs(logs); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			store.SetUint64([]byte("CurrentTerm"), 3)
+			store.SetUint64([]byte("CurrentTerm"), 4)
+			if err := store.DeleteRange(1, 600); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			before, err := store.FileSize()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			dead, err := store.DeadBytesEstimate()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if err := store.Shrink(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			after, _ := store.FileSize()
+
+			// Within 1% of what the shrink reclaimed
+			reclaimed := before - after
+			if diff := dead - reclaimed; diff > reclaimed/100 || diff < -reclaimed/100 {
+				t.Fatalf("bad: estimated %d, reclaimed %d", dead, reclaimed)
+			}
+			if dead, _ := store.DeadBytesEstimate(); dead > after/100 {
+				t.Fatalf("bad: %d of %d after shrink", dead, after)
+			}
+		})
+	}
+}
+
+func TestBuntStore_DeadBytesEstimateBlobs(t *testing.T) {
+	blobs, err := NewDirBlobStore(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store := testBuntStoreOpts(t, &Options{Blobs: blobs, BlobThreshold: 100})
+	defer os.Remove(store.path)
+	defer store.Close()
+
+	// The data of the blobs is not in the file
+	var logs []*raft.Log
+	for i := uint64(1); i <= 1000; i++ {
+		logs = append(logs, testRaftLog(i, strings.Repeat("x", 1000)))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(1, 600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	before, err := store.FileSize()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	dead, err := store.DeadBytesEstimate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Shrink(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	after, _ := store.FileSize()
+	reclaimed := before - after
+	if diff := dead - reclaimed; diff > reclaimed/100 || diff < -reclaimed/100 {
+		t.Fatalf("bad: estimated %d, reclaimed %d", dead, reclaimed)
+	}
+	if dead, _ := store.DeadBytesEstimate(); dead > after/100 {
+		t.Fatalf("bad: %d of %d after shrink", dead, after)
+	}
+}
+
+func TestBuntStore_FileSizeClosed(t *testing.T) {
+	store := testBuntStore(t)
+	store.Close()
+	if _, err := store.FileSize(); err != ErrClosed {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package raftbuntdb
+
+import (
+	"os"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// openStable opens the database of the stable store at Options.StablePath
+// and moves over the stable keys and audit log left in the log file.
+func (b *BuntStore) openStable() error {
+	path := b.opts.StablePath
+	var lock *fileLock
+	var err error
+	if !b.opts.ReadOnly {
+		if lock, err = acquireLock(path, b.opts.LockTimeout); err != nil {
+			return err
+		}
+	}
+	var db *buntdb.DB
+	if b.opts.ReadOnly {
+		// The stable keys are moved over in memory only
+		db, err = loadReadOnly(path)
+		if os.IsNotExist(err) {
+			db, err = buntdb.Open(":memory:")
+		}
+	} else if err = createFile(path, b.opts.fileMode()); err == nil {
+		db, err = buntdb.Open(path)
+	}
+	if err != nil {
+		lock.release()
+		return wrapErr(err)
+	}
+	var config buntdb.Config
+	err = db.ReadConfig(&config)
+	if err == nil {
+		config.SyncPolicy = buntdb.Always
+		err = db.SetConfig(config)
+	}
+	if err == nil {
+		err = moveStable(b.db, db, b.keys.conf)
+	}
+	if err != nil {
+		db.Close()
+		lock.release()
+		return wrapErr(err)
+	}
+	b.stable, b.stableLock = db, lock
+	return nil
+}
+
+// moveStable moves the stable keys and the audit log from the log file to
+// the stable file. Keys already in the stable file are newer and kept, so
+// a move cut short by a crash is finished by the next one.
+func moveStable(from, to *buntdb.DB, conf string) error {
+	var keys, vals []string
+	err := from.View(func(tx *buntdb.Tx) error {
+		for _, prefix := range []string{conf, dbAudit} {
+			err := tx.AscendGreaterOrEqual("", prefix, func(key, val string) bool {
+				if !strings.HasPrefix(key, prefix) {
+					return false
+				}
+				keys, vals = append(keys, key), append(vals, val)
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	err = to.Update(func(tx *buntdb.Tx) error {
+		for i, key := range keys {
+			_, err := tx.Get(key)
+			if err == nil {
+				continue
+			}
+			if err != buntdb.ErrNotFound {
+				return err
+			}
+			if _, _, err := tx.Set(key, vals[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return from.Update(func(tx *buntdb.Tx) error {
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// viewStable runs a read-only transaction on the database of the stable
+// store.
+func (b *BuntStore) viewStable(fn func(tx *buntdb.Tx) error) error {
+	if b.stable == nil {
+		return b.view(fn)
+	}
+	return b.do(func(*buntdb.DB) error {
+		return b.stable.View(fn)
+	})
+}
+
+// updateStable runs a read-write transaction on the database of the stable
+// store, like update.
+func (b *BuntStore) updateStable(fn func(tx *buntdb.Tx) error) error {
+	if b.stable == nil {
+		return b.update(fn)
+	}
+	return b.recovering(func() (bool, error) {
+		var fnErr error
+		err := b.do(func(*buntdb.DB) error {
+			return b.stable.Update(func(tx *buntdb.Tx) error {
+				fnErr = fn(tx)
+				return fnErr
+			})
+		})
+		return err != nil && fnErr == nil, err
+	})
+}
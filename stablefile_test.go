@@ -0,0 +1,105 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestBuntStore_StablePath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs.db")
+	stablePath := filepath.Join(dir, "stable.db")
+
+	// Stable keys written before the option is set are moved over
+	store, err := Open(path, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 4); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	opts := &Options{StablePath: stablePath, Audit: &AuditPolicy{}}
+	store, err = Open(path, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if term, err := store.GetUint64([]byte("CurrentTerm")); err != nil || term != 4 {
+		t.Fatalf("bad: %v %d", err, term)
+	}
+	if err := store.Set([]byte("LastVoteCand"), []byte("node2")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var inLogs bool
+	err = store.View(func(tx *buntdb.Tx) error {
+		_, err := tx.Get(dbConf + "CurrentTerm")
+		inLogs = err == nil
+		return nil
+	})
+	if err != nil || inLogs {
+		t.Fatalf("bad: %v %v", err, inLogs)
+	}
+	stats, err := store.Stats()
+	if err != nil || stats.Logs != 1 || stats.StableKeys != 2 {
+		t.Fatalf("bad: %v %+v", err, stats)
+	}
+	var audited int
+	store.AuditLog(0, func(e AuditEntry) bool {
+		audited++
+		return true
+	})
+	if audited != 1 {
+		t.Fatalf("bad: %d", audited)
+	}
+
+	// The stable file is locked with the store
+	if _, err := Open(filepath.Join(dir, "other.db"),
+		&Options{StablePath: stablePath}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Reset clears both files
+	if err := store.Reset(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := store.Get([]byte("LastVoteCand")); err != ErrKeyNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestBootstrapCluster_StablePath(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(filepath.Join(dir, "logs.db"),
+		&Options{StablePath: filepath.Join(dir, "stable.db")})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	cfg := Configuration{Servers: []Server{{Suffrage: Voter, ID: "a", Address: "a:1"}}}
+	if err := BootstrapCluster(store, cfg); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if term, err := store.GetUint64([]byte("CurrentTerm")); err != nil || term != 1 {
+		t.Fatalf("bad: %v %d", err, term)
+	}
+	if last, _ := store.LastIndex(); last != 1 {
+		t.Fatalf("bad: %d", last)
+	}
+	if err := BootstrapCluster(store, cfg); err != ErrCantBootstrap {
+		t.Fatalf("bad: %v", err)
+	}
+	report, err := store.Verify()
+	if err != nil || len(report.BadStableKeys) != 0 || report.Entries != 1 {
+		t.Fatalf("bad: %v %+v", err, report)
+	}
+}
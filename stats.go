@@ -0,0 +1,79 @@
+package raftbuntdb
+
+import (
+	"os"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// Stats describes the contents of a store.
+type Stats struct {
+	FirstIndex uint64
+	LastIndex  uint64
+
+	// Logs is the number of log entries and LogBytes their encoded size.
+	Logs     uint64
+	LogBytes int64
+
+	// StableKeys is the number of keys in the stable store.
+	StableKeys uint64
+
+	// FileSize is the size of the database file.
+	FileSize int64
+}
+
+// Stats scans the store and returns its statistics.
+func (b *BuntStore) Stats() (Stats, error) {
+	var stats Stats
+	err := b.view(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, val string) bool {
+			switch {
+			case b.isLogKey(key):
+				idx := logIndex(key)
+				if stats.Logs == 0 {
+					stats.FirstIndex = idx
+				}
+				stats.LastIndex = idx
+				stats.Logs++
+				stats.LogBytes += storedSize(val)
+			case strings.HasPrefix(key, b.keys.conf):
+				stats.StableKeys++
+			}
+			return true
+		})
+	})
+	if err == nil && b.stable != nil {
+		var keys [][]byte
+		keys, err = b.StableKeys()
+		stats.StableKeys = uint64(len(keys))
+	}
+	if err != nil {
+		return stats, err
+	}
+	fi, err := os.Stat(b.path)
+	if err != nil {
+		return stats, err
+	}
+	stats.FileSize = fi.Size()
+	return stats, nil
+}
+
+// StableKeys returns the keys of the stable store.
+func (b *BuntStore) StableKeys() ([][]byte, error) {
+	var keys [][]byte
+	err := b.viewStable(func(tx *buntdb.Tx) error {
+		conf := b.keys.conf
+		return tx.AscendGreaterOrEqual("", conf, func(key, val string) bool {
+			if !strings.HasPrefix(key, conf) {
+				return false
+			}
+			keys = append(keys, []byte(key[len(conf):]))
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,49 @@
+package raftbuntdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Stats(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+		testRaftLog(3, "log3"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Set([]byte("LastVoteCand"), []byte("node1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if stats.FirstIndex != 1 || stats.LastIndex != 3 || stats.Logs != 3 ||
+		stats.LogBytes != 3*(17+4) || stats.StableKeys != 2 ||
+		stats.FileSize == 0 {
+		t.Fatalf("bad: %#v", stats)
+	}
+
+	keys, err := store.StableKeys()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expect := [][]byte{[]byte("CurrentTerm"), []byte("LastVoteCand")}
+	if !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("bad: %q", keys)
+	}
+}
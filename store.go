@@ -1,11 +1,15 @@
 package raftbuntdb
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/tidwall/buntdb"
 	"github.com/tidwall/raft"
@@ -19,13 +23,12 @@ const (
 	High   Level = 1
 )
 
-var (
-	// Bucket names we perform transactions in
+// Bucket names we perform transactions in, unless the database was created
+// with other prefixes. They're constants so that nothing can change the
+// key layout at run time; stores use the prefixes of their keyLayout.
+const (
 	dbLogs = "l:"
 	dbConf = "c:"
-
-	// An error indicating a given key does not exist
-	ErrKeyNotFound = errors.New("not found")
 )
 
 // BuntStore provides access to BuntDB for Raft to store and retrieve
@@ -37,25 +40,256 @@ type BuntStore struct {
 
 	// The path to the Bunt database file
 	path string
+
+	// lock prevents other processes from opening the same file.
+	lock *fileLock
+
+	// stable is the database of the stable store when it's kept in a file
+	// of its own, locked by stableLock, or nil.
+	stable     *buntdb.DB
+	stableLock *fileLock
+
+	// opts are the options the store was opened with.
+	opts Options
+
+	// keys is the key layout of the database.
+	keys keyLayout
+
+	// counter tracks the number and size of the logs.
+	counter logCounter
+
+	// health records the outcome of writes.
+	health healthTracker
+
+	// metrics counts the calls to the raft interfaces.
+	metrics metrics
+
+	// notifier wakes the subscriptions after logs are written.
+	notifier logNotifier
+
+	// ahead holds the logs prefetched for a sequential reader.
+	ahead readAhead
+
+	// cache holds the logs most recently stored.
+	cache logCache
+
+	// scrub holds the logs quarantined by Scrub.
+	scrub scrubState
+
+	// limits holds the token buckets of the RateLimit.
+	limits rateLimits
+
+	// backlog counts the logs not yet synced for Backpressure.
+	backlog backlog
+
+	// macKey is the key logs are authenticated with, if any.
+	macKey []byte
+
+	// shrinkMu is held by Shrink and ShrinkAsync, which fail rather than
+	// wait for it.
+	shrinkMu sync.Mutex
+
+	// deferred records a shrink waiting for a window of the
+	// ShrinkSchedule.
+	deferred deferredShrink
+
+	// mu guards closed and broken. It is held for reading by every
+	// operation so that Close waits for in-flight calls.
+	mu     sync.RWMutex
+	closed bool
+
+	// broken is the error the database failed to reopen with, or nil.
+	// The store then serves nothing, but Close still releases the rest.
+	broken error
+
+	// done is closed to stop the background goroutines, which are
+	// tracked by wg.
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	// commits queues writes for the commit goroutine, which StoreLogs
+	// uses when group commit is enabled and StoreLogsAsync always uses.
+	commits commitQueue
+
+	// tracer records the calls for Options.Trace, if set.
+	tracer *tracer
+
+	// calls counts the calls in flight for Close.
+	calls drainState
 }
 
 // NewBuntStore takes a file path and returns a connected Raft backend.
 func NewBuntStore(path string, durability Level) (*BuntStore, error) {
-	// Try to connect
-	db, err := buntdb.Open(path)
+	return Open(path, &Options{Durability: durability})
+}
+
+// Open takes a file path and returns a connected Raft backend configured
+// with the provided options. A nil opts uses DefaultOptions.
+func Open(path string, opts *Options) (*BuntStore, error) {
+	return OpenContext(context.Background(), path, opts)
+}
+
+// OpenContext is like Open but gives up once ctx is done, such as when
+// loading a large file takes too long. If the file is still loading, the
+// database is closed and unlocked in the background once it's loaded.
+func OpenContext(ctx context.Context, path string, opts *Options) (*BuntStore, error) {
+	if opts == nil {
+		opts = DefaultOptions
+	}
+	if err := checkIndexes(opts.Indexes); err != nil {
+		return nil, err
+	}
+	if err := checkRetention(opts.Retention); err != nil {
+		return nil, err
+	}
+	macKey, err := loadMACKey(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DirMode != 0 && !opts.ReadOnly {
+		if err := createDir(filepath.Dir(path), opts.DirMode); err != nil {
+			return nil, err
+		}
+	}
+
+	// Make sure no other process has the file open. A read-only store
+	// takes no lock, so it can inspect the file of a running node.
+	var lock *fileLock
+	if !opts.ReadOnly {
+		if lock, err = acquireLock(path, opts.LockTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkLoadMemory(path, opts.MaxLoadMemory); err != nil {
+		lock.release()
+		return nil, err
+	}
+	if opts.OpenTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.OpenTimeout)
+		defer cancel()
+	}
+	rep := newOpenReporter(path, opts)
+	db, keys, err := openDB(ctx, path, opts, rep, lock)
 	if err != nil {
 		return nil, err
 	}
 
-	// Disable the AutoShrink. Shrinking should only be manually
-	// handled following a log compaction.
+	// Create the new store
+	store := &BuntStore{
+		db:     db,
+		path:   path,
+		lock:   lock,
+		opts:   *opts,
+		keys:   keys,
+		macKey: macKey,
+		cache:  newLogCache(opts.LogCache),
+		done:   make(chan struct{}),
+	}
+	if opts.RateLimit != nil {
+		store.SetRateLimit(*opts.RateLimit)
+	}
+	if opts.StablePath != "" {
+		if err := store.openStable(); err != nil {
+			db.Close()
+			lock.release()
+			return nil, err
+		}
+	}
+	if opts.Retention != nil {
+		store.goBackground(store.runRetention)
+	}
+	if opts.Scrub != nil {
+		store.goBackground(store.runScrub)
+	}
+	if opts.NoSpace != nil {
+		store.goBackground(store.runNoSpaceProbe)
+	}
+	if opts.ShrinkSchedule != nil {
+		store.goBackground(store.runShrinkSchedule)
+	}
+	if opts.Backpressure != nil && opts.Durability != High {
+		store.backlog.kick = make(chan struct{}, 1)
+		store.goBackground(store.runSyncer)
+	}
+	rep.report(OpenCounting)
+	if err := firstErr(ctx.Err(), store.recount()); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if opts.Trace != nil {
+		if err := store.startTrace(); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	store.commits.requests = make(chan *commitRequest)
+	store.goBackground(store.runCommits)
+	if opts.ExpvarName != "" {
+		publishMetrics(opts.ExpvarName, store)
+	}
+	rep.report(OpenDone)
+	return store, nil
+}
+
+// openDB opens and configures the database at path, reporting the
+// progress to rep. The lock is released if it fails.
+func openDB(ctx context.Context, path string, opts *Options, rep *openReporter,
+	lock *fileLock) (db *buntdb.DB, keys keyLayout, err error) {
+	if !opts.ReadOnly {
+		if err := createFile(path, opts.fileMode()); err != nil {
+			lock.release()
+			return nil, keys, err
+		}
+	}
+	loaded, err := loadDB(ctx, path, opts, rep, lock)
+	if err != nil {
+		return nil, keys, err
+	}
+	defer func() {
+		if err != nil {
+			loaded.Close()
+			lock.release()
+		}
+	}()
+	db = loaded
+	rep.report(OpenIndexing)
+	if keys, err = checkFormat(db, opts); err != nil {
+		return nil, keys, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, keys, err
+	}
+	if opts.TermIndex {
+		if err := db.CreateIndex(termsIndex, keys.logs+"*", lessLogTerm); err != nil {
+			return nil, keys, err
+		}
+	}
+	for _, idx := range opts.Indexes {
+		if err := db.CreateIndex(idx.Name, idx.Pattern, idx.Less...); err != nil {
+			return nil, keys, err
+		}
+	}
+
+	// Disable the AutoShrink unless asked for. Shrinking should otherwise
+	// be handled following a log compaction.
 	var config buntdb.Config
 	if err := db.ReadConfig(&config); err != nil {
-		db.Close()
-		return nil, err
+		return nil, keys, err
 	}
-	config.AutoShrinkDisabled = true
-	switch durability {
+	config.AutoShrinkDisabled = opts.AutoShrink == nil
+	if auto := opts.AutoShrink; auto != nil {
+		if auto.MinSize > 0 {
+			config.AutoShrinkMinSize = auto.MinSize
+		}
+		if auto.Percentage > 0 {
+			config.AutoShrinkPercentage = auto.Percentage
+		}
+	}
+	switch opts.Durability {
 	case Low:
 		config.SyncPolicy = buntdb.Never
 	case Medium:
@@ -64,84 +298,250 @@ func NewBuntStore(path string, durability Level) (*BuntStore, error) {
 		config.SyncPolicy = buntdb.Always
 	}
 	if err := db.SetConfig(config); err != nil {
-		db.Close()
-		return nil, err
+		return nil, keys, err
 	}
+	return db, keys, nil
+}
 
-	// Create the new store
-	store := &BuntStore{
-		db:   db,
-		path: path,
+// shutdown stops the background goroutines and closes the database, once
+// the calls in flight have returned.
+func (b *BuntStore) shutdown() error {
+	b.stopOnce.Do(func() { close(b.done) })
+	b.wg.Wait()
+	traceErr := b.traceErr()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
 	}
-	return store, nil
+	b.closed = true
+	if b.opts.ExpvarName != "" {
+		unpublishMetrics(b.opts.ExpvarName, b)
+	}
+
+	// Flush what wasn't synced by the commits, and report if it fails
+	var err error
+	if b.broken == nil {
+		if b.opts.Durability != High && !b.opts.ReadOnly {
+			err = syncFile(b.path)
+		}
+		err = firstErr(err, b.db.Close())
+	}
+	b.lock.release()
+	if b.stable != nil {
+		err = firstErr(err, b.stable.Close())
+		b.stableLock.release()
+	}
+	return firstErr(wrapErr(err), traceErr)
 }
 
-// Close is used to gracefully close the DB connection.
-func (b *BuntStore) Close() error {
-	return b.db.Close()
+// goBackground runs fn in a goroutine that Close waits for. The function
+// should return once b.done is closed.
+func (b *BuntStore) goBackground(fn func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn()
+	}()
+}
+
+// do calls fn with the underlying database, or returns ErrClosed if the
+// store has been closed.
+func (b *BuntStore) do(fn func(db *buntdb.DB) error) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+	return wrapErr(fn(b.db))
+}
+
+// checkOpen returns ErrClosed if the store has been closed, wrapping the
+// error its database failed to reopen with, if that's why. b.mu must be
+// held.
+func (b *BuntStore) checkOpen() error {
+	if b.closed {
+		return ErrClosed
+	}
+	if b.broken != nil {
+		return fmt.Errorf("%w: reopen: %w", ErrClosed, b.broken)
+	}
+	return nil
+}
+
+// view runs a read-only transaction.
+func (b *BuntStore) view(fn func(tx *buntdb.Tx) error) error {
+	return b.do(func(db *buntdb.DB) error {
+		return db.View(fn)
+	})
+}
+
+// update runs a read-write transaction, retrying it if the store has a
+// recovery policy, and records its outcome for Health.
+func (b *BuntStore) update(fn func(tx *buntdb.Tx) error) error {
+	return b.recovering(func() (bool, error) {
+		return b.commit(fn)
+	})
 }
 
 // Shrink will trigger a shrink operation on the aof file.
-// Useful after a log compaction is completed.
+// Useful after a log compaction is completed. The file keeps its mode,
+// and the directory is synced so the new file survives a power loss. With
+// Options.MaintenanceRate set, the file is rewritten like ShrinkAsync.
 func (b *BuntStore) Shrink() error {
-	return b.db.Shrink()
+	if err := firstErr(b.checkReadOnly(), b.checkNoSpace()); err != nil {
+		return err
+	}
+	if !b.shrinkMu.TryLock() {
+		return buntdb.ErrShrinkInProcess
+	}
+	defer b.shrinkMu.Unlock()
+	if b.opts.MaintenanceRate > 0 {
+		_, err := b.shrinkFile(context.Background(), func(ShrinkProgress) {})
+		if err != errReopened {
+			b.health.record(err, true, false)
+		}
+		return err
+	}
+	err := b.do(func(db *buntdb.DB) error {
+		// The file is replaced by one with the default mode
+		fi, err := os.Stat(b.path)
+		if err != nil {
+			return err
+		}
+		if err := db.Shrink(); err != nil {
+			return err
+		}
+		if err := os.Chmod(b.path, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		return syncDir(filepath.Dir(b.path))
+	})
+	if err != buntdb.ErrShrinkInProcess {
+		b.health.record(err, true, false)
+	}
+	return err
 }
 
 // FirstIndex returns the first known index from the Raft log.
 func (b *BuntStore) FirstIndex() (uint64, error) {
-	var num string
-	err := b.db.View(func(tx *buntdb.Tx) error {
-		return tx.Ascend("",
-			func(key, val string) bool {
-				if strings.HasPrefix(key, dbLogs) {
-					num = key[len(dbLogs):]
-					return false
-				}
-				return true
-			},
-		)
-	})
-	if err != nil || num == "" {
+	if err := b.calls.enter(); err != nil {
 		return 0, err
 	}
-	return stringToUint64(num), nil
+	defer b.calls.leave()
+	var idx uint64
+	err := b.view(func(tx *buntdb.Tx) error {
+		var err error
+		idx, err = b.keys.firstIndex(tx)
+		return err
+	})
+	b.metrics.record(opFirstIndex, err, 0, 0)
+	return idx, err
 }
 
 // LastIndex returns the last known index from the Raft log.
 func (b *BuntStore) LastIndex() (uint64, error) {
-	var num string
-	err := b.db.View(func(tx *buntdb.Tx) error {
-		return tx.Descend("",
-			func(key, val string) bool {
-				if strings.HasPrefix(key, dbLogs) {
-					num = key[len(dbLogs):]
-					return false
-				}
-				return true
-			},
-		)
-	})
-	if err != nil || num == "" {
+	if err := b.calls.enter(); err != nil {
 		return 0, err
 	}
-	return stringToUint64(num), nil
+	defer b.calls.leave()
+	var idx uint64
+	err := b.view(func(tx *buntdb.Tx) error {
+		var err error
+		idx, err = b.keys.lastIndex(tx)
+		return err
+	})
+	b.metrics.record(opLastIndex, err, 0, 0)
+	return idx, err
 }
 
 // GetLog is used to retrieve a log from BuntDB at a given index.
 func (b *BuntStore) GetLog(idx uint64, log *raft.Log) error {
-	var val string
-	var verr error
-	err := b.db.View(func(tx *buntdb.Tx) error {
-		val, verr = tx.Get(dbLogs + uint64ToString(idx))
-		return verr
-	})
+	var buf []byte
+	if b.opts.ReuseLogData && !b.opts.ZeroCopy {
+		buf = log.Data
+	}
+	return b.GetLogBuffer(idx, log, buf)
+}
+
+// GetLogBuffer is like GetLog but decodes the data into buf when it has
+// the capacity, so a caller reading many logs can reuse one buffer. The
+// data is only valid until buf is reused.
+func (b *BuntStore) GetLogBuffer(idx uint64, log *raft.Log, buf []byte) error {
+	if err := b.calls.enter(); err != nil {
+		return err
+	}
+	defer b.calls.leave()
+	if err := b.waitTurn(context.Background(), &b.limits.read, 1); err != nil {
+		return err
+	}
+	if b.cachedLog(idx, log, buf) {
+		b.metrics.record(opGetLog, nil, 17+len(log.Data), 0)
+		return nil
+	}
+	val, err := b.getLogValue(idx)
+	if err == buntdb.ErrNotFound {
+		err = raft.ErrLogNotFound
+	}
+	b.metrics.record(opGetLog, err, len(val), 0)
 	if err != nil {
-		if err == buntdb.ErrNotFound {
-			return raft.ErrLogNotFound
+		return err
+	}
+	if buf == nil && b.opts.ZeroCopy {
+		err = decodeLogZeroCopy(idx, val, log)
+	} else {
+		err = decodeLogBuffer(idx, val, log, buf)
+	}
+	if err != nil {
+		return corruptEntry(idx, val, err)
+	}
+	return nil
+}
+
+// GetFirstLog retrieves the first log in the same transaction that finds
+// it, so a concurrent DeleteRange can't remove it in between. It returns
+// raft.ErrLogNotFound when the log is empty.
+func (b *BuntStore) GetFirstLog(log *raft.Log) error {
+	return b.getBoundaryLog(log, false)
+}
+
+// GetLastLog is like GetFirstLog but retrieves the last log.
+func (b *BuntStore) GetLastLog(log *raft.Log) error {
+	return b.getBoundaryLog(log, true)
+}
+
+func (b *BuntStore) getBoundaryLog(log *raft.Log, last bool) error {
+	var key, val string
+	var cerr error
+	err := b.view(func(tx *buntdb.Tx) error {
+		visit := func(k, v string) bool {
+			key, val = k, v
+			return false
+		}
+		var err error
+		if last {
+			err = b.keys.descendLogs(tx, 1<<64-1, visit)
+		} else {
+			err = b.keys.ascendLogs(tx, 0, visit)
+		}
+		if err == nil && key != "" {
+			val, cerr = b.readLog(tx, key, val)
 		}
 		return err
+	})
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return raft.ErrLogNotFound
+	}
+	if cerr != nil {
+		return &ErrCorruptEntry{Index: logIndex(key), Err: cerr}
 	}
-	return decodeLog(val, log)
+	if err := decodeLog(logIndex(key), val, log); err != nil {
+		return corruptEntry(logIndex(key), val, err)
+	}
+	return nil
 }
 
 // StoreLog is used to store a single raft log
@@ -151,79 +551,330 @@ func (b *BuntStore) StoreLog(log *raft.Log) error {
 
 // StoreLogs is used to store a set of raft logs
 func (b *BuntStore) StoreLogs(logs []*raft.Log) error {
-	err := b.db.Update(func(tx *buntdb.Tx) error {
-		for _, log := range logs {
-			val, err := encodeLog(log)
-			if err != nil {
-				return err
+	if err := b.calls.enter(); err != nil {
+		return err
+	}
+	defer b.calls.leave()
+	return b.traced(traceRecord{op: traceStoreLogs, logs: logs}, func() error {
+		size := logsSize(logs)
+		err := b.waitTurn(context.Background(), &b.limits.write, size)
+		if err == nil {
+			err = b.waitBacklog(context.Background())
+		}
+		if err == nil {
+			if b.opts.GroupCommit != nil {
+				err = b.groupStoreLogs(logs)
+			} else {
+				err = b.storeLogParts(context.Background(), logs)
 			}
-			if _, _, err := tx.Set(dbLogs+uint64ToString(log.Index),
-				string(val), nil); err != nil {
+		}
+		var written int
+		if err == nil {
+			written = size
+		}
+		b.metrics.record(opStoreLogs, err, 0, written)
+		return err
+	})
+}
+
+// logsSize returns the size of logs as counted by Metrics and RateLimit,
+// with 17 bytes of header each.
+func logsSize(logs []*raft.Log) int {
+	var n int
+	for _, log := range logs {
+		n += 17 + len(log.Data)
+	}
+	return n
+}
+
+// encodeLogs returns the values of logs, encoded and sealed before the
+// transaction that stores them so that the write lock isn't held while
+// they're encoded. The value of a log written by storeLarge is left empty.
+func (b *BuntStore) encodeLogs(logs []*raft.Log) []string {
+	vals := make([]string, len(logs))
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for i, log := range logs {
+		if b.isLarge(log) {
+			continue
+		}
+		if b.opts.ZeroCopy {
+			val := appendLog(make([]byte, 0, 17+len(log.Data)+macSize), log)
+			vals[i] = bytesToString(b.seal(val, log))
+			continue
+		}
+		*buf = b.seal(appendLog((*buf)[:0], log), log)
+		vals[i] = string(*buf)
+	}
+	return vals
+}
+
+// storeLogs writes logs in a transaction, with their values from
+// encodeLogs.
+func (b *BuntStore) storeLogs(tx *buntdb.Tx, logs []*raft.Log, vals []string,
+	now time.Time, d *logDelta) error {
+	if b.opts.StrictAppend {
+		if err := b.checkContiguous(tx, logs); err != nil {
+			return err
+		}
+	}
+	if b.opts.Retention != nil && b.opts.Retention.MaxAge > 0 {
+		if err := recordTime(tx, logs, now); err != nil {
+			return err
+		}
+	}
+	for i, log := range logs {
+		key := b.logKey(log.Index)
+		if vals[i] == "" {
+			if err := b.storeLarge(tx, key, log, d); err != nil {
 				return err
 			}
+			continue
 		}
+		if err := setLog(tx, key, vals[i], d); err != nil {
+			return err
+		}
+	}
+	d.keep(&b.cache, logs)
+	return nil
+}
+
+// checkContiguous returns an ErrNonContiguous if storing logs would leave a
+// hole in the log. Batches may overwrite existing entries, which is how
+// raft replaces a conflicting tail.
+func (b *BuntStore) checkContiguous(tx *buntdb.Tx, logs []*raft.Log) error {
+	if len(logs) == 0 {
 		return nil
-	})
-	return err
+	}
+	for i := 1; i < len(logs); i++ {
+		if logs[i].Index != logs[i-1].Index+1 {
+			return &ErrNonContiguous{Index: logs[i].Index,
+				Expected: logs[i-1].Index + 1}
+		}
+	}
+	first, err := b.keys.firstIndex(tx)
+	if err != nil || first == 0 {
+		return err
+	}
+	last, err := b.keys.lastIndex(tx)
+	if err != nil {
+		return err
+	}
+	if logs[0].Index > last+1 {
+		return &ErrNonContiguous{Index: logs[0].Index, Expected: last + 1}
+	}
+	if end := logs[len(logs)-1].Index; end+1 < first {
+		return &ErrNonContiguous{Index: end, Expected: first - 1}
+	}
+	return nil
 }
 
 // DeleteRange is used to delete logs within a given range inclusively.
 func (b *BuntStore) DeleteRange(min, max uint64) error {
-	return b.db.Update(func(tx *buntdb.Tx) error {
-		for i := min; i <= max; i++ {
-			if _, err := tx.Delete(dbLogs + uint64ToString(i)); err != nil {
-				if err != buntdb.ErrNotFound {
+	if err := b.calls.enter(); err != nil {
+		return err
+	}
+	defer b.calls.leave()
+	return b.traced(traceRecord{op: traceDeleteRange, min: min, max: max}, func() error {
+		err := b.deleteRange(min, max)
+		if err == nil {
+			b.onDeleteRange(min, max)
+		}
+		b.metrics.record(opDeleteRange, err, 0, 0)
+		return err
+	})
+}
+
+func (b *BuntStore) deleteRange(min, max uint64) error {
+	return b.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+		if b.opts.Archiver != nil {
+			if err := b.archiveRange(tx, min, max); err != nil {
+				return err
+			}
+		}
+		del := func(i uint64) error {
+			err := deleteLog(tx, b.logKey(i), d)
+			if err == buntdb.ErrNotFound {
+				err = nil
+			}
+			return err
+		}
+
+		// A range that reaches the end of the log is deleted from the end,
+		// so that a torn write leaves the log without a gap
+		last, err := b.keys.lastIndex(tx)
+		if err != nil {
+			return err
+		}
+		if last >= min && last <= max {
+			for i := last; i >= min && i != 0; i-- {
+				if err := del(i); err != nil {
 					return err
 				}
 			}
+			return nil
+		}
+		for i := min; i <= max; i++ {
+			if err := del(i); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
 }
 
+// IsMonotonic reports whether the store rejects appends that aren't
+// contiguous, which it does when opened with Options.StrictAppend. The raft
+// library doesn't ask, but a caller restoring a snapshot can check it to
+// know the log never has a hole, and remove the whole log rather than
+// leave one ahead of the snapshot index.
+func (b *BuntStore) IsMonotonic() bool {
+	return b.opts.StrictAppend
+}
+
 // Set is used to set a key/value set outside of the raft log
 func (b *BuntStore) Set(k, v []byte) error {
-	return b.db.Update(func(tx *buntdb.Tx) error {
-		_, _, err := tx.Set(dbConf+string(k), string(v), nil)
+	if err := b.calls.enter(); err != nil {
+		return err
+	}
+	defer b.calls.leave()
+	return b.traced(traceRecord{op: traceSet, key: k, val: v}, func() error {
+		err := b.waitTurn(context.Background(), &b.limits.write, len(k)+len(v))
+		if err == nil {
+			err = b.updateStable(func(tx *buntdb.Tx) error {
+				return setStable(tx, b.keys.conf, string(k), string(v), b.opts.Audit)
+			})
+		}
+		var written int
+		if err == nil {
+			written = len(v)
+			b.onSet(k, v)
+		}
+		b.metrics.record(opSet, err, 0, written)
+		return err
+	})
+}
+
+// Delete removes a key from the k/v store. It returns ErrKeyNotFound if
+// the key doesn't exist.
+func (b *BuntStore) Delete(k []byte) error {
+	if err := b.calls.enter(); err != nil {
+		return err
+	}
+	defer b.calls.leave()
+	return b.traced(traceRecord{op: traceDelete, key: k}, func() error {
+		err := b.waitTurn(context.Background(), &b.limits.write, len(k))
+		if err == nil {
+			err = b.updateStable(func(tx *buntdb.Tx) error {
+				prev, err := tx.Delete(b.confKey(string(k)))
+				if err != nil {
+					return err
+				}
+				return audit(tx, b.opts.Audit, AuditDelete, string(k),
+					valueHash(prev, true), "")
+			})
+		}
+		if err == buntdb.ErrNotFound {
+			err = ErrKeyNotFound
+		}
+		if err == nil {
+			b.onDelete(k)
+		}
+		b.metrics.record(opDelete, err, 0, 0)
 		return err
 	})
 }
 
 // Get is used to retrieve a value from the k/v store by key
 func (b *BuntStore) Get(k []byte) ([]byte, error) {
+	if err := b.calls.enter(); err != nil {
+		return nil, err
+	}
+	defer b.calls.leave()
 	var val []byte
-	err := b.db.View(func(tx *buntdb.Tx) error {
-		sval, err := tx.Get(dbConf + string(k))
+	err := b.viewStable(func(tx *buntdb.Tx) error {
+		sval, err := tx.Get(b.confKey(string(k)))
 		if err != nil {
 			return err
 		}
 		val = []byte(sval)
 		return nil
 	})
-	if err != nil {
-		if err == buntdb.ErrNotFound {
-			return nil, ErrKeyNotFound
-		}
+	if err == buntdb.ErrNotFound {
+		err = ErrKeyNotFound
 	}
+	b.metrics.record(opGet, err, len(val), 0)
 	if err != nil {
 		return nil, err
 	}
 	return val, nil
 }
 
-// SetUint64 is like Set, but handles uint64 values
+// SetUint64 is like Set, but handles uint64 values. Values are written in
+// plain decimal, which is the canonical format.
 func (b *BuntStore) SetUint64(key []byte, val uint64) error {
-	return b.Set(key, []byte(strconv.FormatUint(val, 10)))
+	return b.Set(key, []byte(formatUint64(val)))
 }
 
-// GetUint64 is like Get, but handles uint64 values
+// GetUint64 is like Get, but handles uint64 values. Both plain decimal and
+// 20-digit zero-padded values are accepted. A value that doesn't parse
+// returns an ErrCorruptValue, unless Options.LenientUint64 is set.
 func (b *BuntStore) GetUint64(key []byte) (uint64, error) {
 	val, err := b.Get(key)
 	if err != nil {
 		return 0, err
 	}
-	return strconv.ParseUint(string(val), 10, 64)
+	u, err := parseUint64(string(val))
+	if err != nil {
+		if b.opts.LenientUint64 {
+			return 0, nil
+		}
+		return 0, &ErrCorruptValue{Key: string(key), Value: string(val), Err: err}
+	}
+	return u, nil
+}
 
+// NormalizeUint64Keys rewrites the values of the given stable keys in the
+// canonical uint64 format, defaulting to the uint64 keys used by raft. It
+// returns the number of values rewritten. Missing keys are skipped.
+func (b *BuntStore) NormalizeUint64Keys(keys ...[]byte) (int, error) {
+	if len(keys) == 0 {
+		for _, key := range stableUint64Keys {
+			keys = append(keys, []byte(key))
+		}
+	}
+	var n int
+	err := b.updateStable(func(tx *buntdb.Tx) error {
+		var err error
+		n, err = normalizeUint64Keys(tx, b.keys.conf, keys, b.opts.Audit)
+		return err
+	})
+	return n, err
+}
+
+func normalizeUint64Keys(tx *buntdb.Tx, conf string, keys [][]byte,
+	policy *AuditPolicy) (int, error) {
+	var n int
+	for _, key := range keys {
+		val, err := tx.Get(conf + string(key))
+		if err != nil {
+			if err == buntdb.ErrNotFound {
+				continue
+			}
+			return n, err
+		}
+		u, err := parseUint64(val)
+		if err != nil {
+			return n, &ErrCorruptValue{Key: string(key), Value: val, Err: err}
+		}
+		if canon := formatUint64(u); canon != val {
+			if err := setStable(tx, conf, string(key), canon, policy); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
 }
 
 // Peers returns raft peers
@@ -242,46 +893,150 @@ func (b *BuntStore) Peers() ([]string, error) {
 	return peers, nil
 }
 
-// SetPeers sets raft peers
+// SetPeers sets raft peers. The servers returned by Servers are updated
+// to match, keeping the IDs of those that remain.
 func (b *BuntStore) SetPeers(peers []string) error {
 	data, err := json.Marshal(peers)
 	if err != nil {
 		return err
 	}
-	return b.Set([]byte("peers"), data)
+	return b.setPeerKeys(data, func(tx *buntdb.Tx) ([]Server, error) {
+		servers, _, err := readServers(tx, b.keys.conf)
+		if err != nil {
+			return nil, err
+		}
+		return mergePeers(servers, peers), nil
+	})
+}
+
+// Decode reverses the encode operation on a byte slice input, read from
+// the key of the log at idx.
+func decodeLog(idx uint64, s string, in *raft.Log) error {
+	return decodeLogBuffer(idx, s, in, nil)
 }
 
-// Decode reverses the encode operation on a byte slice input
-func decodeLog(s string, in *raft.Log) error {
-	buf := []byte(s)
-	if len(buf) < 17 {
-		return errors.New("invalid buffer")
+// decodeLogBuffer is like decodeLog but copies the data into buf when it
+// has the capacity.
+func decodeLogBuffer(idx uint64, s string, in *raft.Log, buf []byte) error {
+	if err := decodeLogHeader(idx, s, in); err != nil {
+		return err
+	}
+	if buf == nil {
+		in.Data = []byte(s[17:])
+	} else {
+		in.Data = append(buf[:0], s[17:]...)
+	}
+	return nil
+}
+
+// decodeLogZeroCopy is like decodeLog but the data shares memory with s.
+func decodeLogZeroCopy(idx uint64, s string, in *raft.Log) error {
+	if err := decodeLogHeader(idx, s, in); err != nil {
+		return err
+	}
+	in.Data = stringToBytes(s[17:])
+	return nil
+}
+
+// maxLogType is the last of the raft.LogType values.
+const maxLogType = raft.LogBarrier
+
+// decodeLogHeader decodes the fields that precede the data, checking that
+// the index is idx, that of the key the log was read from, and that the
+// type is known. A mismatch means the value of another key was written
+// over it.
+func decodeLogHeader(idx uint64, s string, in *raft.Log) error {
+	if len(s) < 17 {
+		return errInvalidBuffer
+	}
+	if leUint64(s[0:8]) != idx {
+		return errIndexMismatch
+	}
+	// The flags are left set in values read raw, such as from a backup
+	typ := raft.LogType(s[16] &^ (chunkedType | blobType | macType))
+	if typ > maxLogType {
+		return errUnknownType
 	}
-	in.Index = binary.LittleEndian.Uint64(buf[0:8])
-	in.Term = binary.LittleEndian.Uint64(buf[8:16])
-	in.Type = raft.LogType(buf[16])
-	in.Data = buf[17:]
+	in.Index = idx
+	in.Term = leUint64(s[8:16])
+	in.Type = typ
 	return nil
 }
 
+// leUint64 reads a little endian uint64 from a string without converting
+// it to a byte slice.
+func leUint64(s string) uint64 {
+	_ = s[7]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 |
+		uint64(s[3])<<24 | uint64(s[4])<<32 | uint64(s[5])<<40 |
+		uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
 // Encode writes an encoded object to a new bytes buffer
 func encodeLog(in *raft.Log) ([]byte, error) {
-	buf := make([]byte, 17+len(in.Data))
-	binary.LittleEndian.PutUint64(buf[0:8], in.Index)
-	binary.LittleEndian.PutUint64(buf[8:16], in.Term)
-	buf[16] = byte(in.Type)
-	copy(buf[17:], in.Data)
-	return buf, nil
+	return appendLog(make([]byte, 0, 17+len(in.Data)), in), nil
+}
+
+// appendLog appends the encoding of a log to dst.
+func appendLog(dst []byte, in *raft.Log) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, in.Index)
+	dst = binary.LittleEndian.AppendUint64(dst, in.Term)
+	dst = append(dst, byte(in.Type))
+	return append(dst, in.Data...)
+}
+
+// bufferPool holds the buffers that StoreLogs encodes into.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
 }
 
-// Converts string to an integer
+// maxPooledBuffer is the largest buffer returned to bufferPool, so that an
+// occasional large entry doesn't pin its memory.
+const maxPooledBuffer = 64 * 1024
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledBuffer {
+		*buf = (*buf)[:0]
+		bufferPool.Put(buf)
+	}
+}
+
+// Converts string to an integer. A string that doesn't parse reads as
+// zero, so it's only for keys written by the store; see parseLogIndex and
+// parseUint64 for those that may be corrupt.
 func stringToUint64(s string) uint64 {
 	n, _ := strconv.ParseUint(s, 10, 64)
 	return n
 }
 
+// formatUint64 encodes a stable uint64 value in the canonical format.
+func formatUint64(u uint64) string {
+	return strconv.FormatUint(u, 10)
+}
+
+// parseUint64 decodes a stable uint64 value. Older databases may hold
+// values zero-padded to 20 digits, like log keys, which parse the same.
+func parseUint64(s string) (uint64, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
+
 // Converts a uint to a string
 func uint64ToString(u uint64) string {
-	s := strings.Repeat("0", 20) + strconv.FormatUint(u, 10)
-	return s[len(s)-20:]
+	var buf [20]byte
+	return string(appendUint64(buf[:0], u))
+}
+
+// appendUint64 appends u zero-padded to 20 digits.
+func appendUint64(dst []byte, u uint64) []byte {
+	n := len(dst)
+	dst = append(dst, "00000000000000000000"...)
+	for i := len(dst) - 1; i >= n && u > 0; i-- {
+		dst[i] = '0' + byte(u%10)
+		u /= 10
+	}
+	return dst
 }
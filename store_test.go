@@ -2,10 +2,13 @@ package raftbuntdb
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,6 +31,20 @@ func testBuntStore(t testing.TB) *BuntStore {
 	return store
 }
 
+// testBuntStoreOpts is like testBuntStore but opens the store with opts.
+func testBuntStoreOpts(t testing.TB, opts *Options) *BuntStore {
+	fh, err := ioutil.TempFile("", "bunt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Remove(fh.Name())
+	store, err := Open(fh.Name(), opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return store
+}
+
 func testRaftLog(idx uint64, data string) *raft.Log {
 	return &raft.Log{
 		Data:  []byte(data),
@@ -48,6 +65,21 @@ func TestBuntStore_Implements(t *testing.T) {
 	}
 }
 
+func TestBuntStore_IsMonotonic(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+	if store.IsMonotonic() {
+		t.Fatalf("expected not monotonic without StrictAppend")
+	}
+	strict := testBuntStoreOpts(t, &Options{StrictAppend: true})
+	defer strict.Close()
+	defer os.Remove(strict.path)
+	if !strict.IsMonotonic() {
+		t.Fatalf("expected monotonic with StrictAppend")
+	}
+}
+
 func TestNewBuntStore(t *testing.T) {
 	fh, err := ioutil.TempFile("", "bunt")
 	if err != nil {
@@ -362,6 +394,173 @@ func TestBuntStore_SetUint64_GetUint64(t *testing.T) {
 	}
 }
 
+func TestBuntStore_GetUint64_Corrupt(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+	if err := store.Set([]byte("CurrentTerm"), []byte("1x")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A value that doesn't parse isn't read as zero
+	_, err := store.GetUint64([]byte("CurrentTerm"))
+	var cerr *ErrCorruptValue
+	if !errors.As(err, &cerr) || cerr.Key != "CurrentTerm" || cerr.Value != "1x" {
+		t.Fatalf("bad: %v", err)
+	}
+	store.Close()
+
+	// Unless the store is lenient
+	store, err = Open(store.path, &Options{LenientUint64: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if term, err := store.GetUint64([]byte("CurrentTerm")); err != nil || term != 0 {
+		t.Fatalf("bad: %v %d", err, term)
+	}
+}
+
+func TestBuntStore_NormalizeUint64Keys(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// Zero-padded values written by older versions are readable
+	store.Set([]byte("CurrentTerm"), []byte(uint64ToString(7)))
+	store.SetUint64([]byte("LastVoteTerm"), 6)
+	val, err := store.GetUint64([]byte("CurrentTerm"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if val != 7 {
+		t.Fatalf("bad: %v", val)
+	}
+
+	n, err := store.NormalizeUint64Keys()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	raw, err := store.Get([]byte("CurrentTerm"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(raw) != "7" {
+		t.Fatalf("bad: %q", raw)
+	}
+
+	// Values that don't parse are an error
+	store.Set([]byte("abc"), []byte("x"))
+	if _, err := store.NormalizeUint64Keys([]byte("abc")); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestBuntStore_GetLogBuffer(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	if err := store.StoreLogs([]*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	buf := make([]byte, 0, 64)
+	log := new(raft.Log)
+	for idx := uint64(1); idx <= 2; idx++ {
+		if err := store.GetLogBuffer(idx, log, buf); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(log.Data) != fmt.Sprintf("log%d", idx) || &log.Data[0] != &buf[:1][0] {
+			t.Fatalf("bad: %#v", log)
+		}
+	}
+	if err := store.GetLogBuffer(3, log, buf); err != raft.ErrLogNotFound {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+}
+
+func TestBuntStore_ReuseLogData(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ReuseLogData: true})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	if err := store.StoreLogs([]*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log22"),
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	log := &raft.Log{Data: make([]byte, 0, 64)}
+	data := &log.Data[:1][0]
+	for idx := uint64(1); idx <= 2; idx++ {
+		if err := store.GetLog(idx, log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if log.Index != idx || &log.Data[0] != data {
+			t.Fatalf("bad: %#v", log)
+		}
+	}
+	if string(log.Data) != "log22" {
+		t.Fatalf("bad: %q", log.Data)
+	}
+	if n := testing.AllocsPerRun(100, func() { store.GetLog(1, log) }); n > 1 {
+		t.Fatalf("bad: %v allocs", n)
+	}
+}
+
+func TestUtilAllocs(t *testing.T) {
+	log := testRaftLog(1, "log")
+	buf := make([]byte, 0, 64)
+	if n := testing.AllocsPerRun(100, func() { buf = appendLog(buf[:0], log) }); n != 0 {
+		t.Fatalf("bad: %v allocs", n)
+	}
+	store := &BuntStore{keys: keyLayout{logs: dbLogs}}
+	if n := testing.AllocsPerRun(100, func() { _ = store.logKey(12345) }); n > 1 {
+		t.Fatalf("bad: %v allocs", n)
+	}
+	if store.logKey(12345) != dbLogs+"00000000000000012345" || uint64ToString(0) != strings.Repeat("0", 20) {
+		t.Fatalf("bad: %s", store.logKey(12345))
+	}
+}
+
+func TestBuntStore_GetFirstLastLog(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	log := new(raft.Log)
+	if err := store.GetFirstLog(log); err != raft.ErrLogNotFound {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if err := store.GetLastLog(log); err != raft.ErrLogNotFound {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if err := store.StoreLogs([]*raft.Log{
+		testRaftLog(3, "first"),
+		testRaftLog(4, "middle"),
+		testRaftLog(5, "last"),
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.GetFirstLog(log); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if log.Index != 3 || string(log.Data) != "first" {
+		t.Fatalf("bad: %#v", log)
+	}
+	if err := store.GetLastLog(log); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if log.Index != 5 || string(log.Data) != "last" {
+		t.Fatalf("bad: %#v", log)
+	}
+}
+
 func TestUtilHex(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 	for i1 := uint64(0); i1 < 1000; i1++ {
@@ -380,3 +579,153 @@ func TestUtilHex(t *testing.T) {
 		}
 	}
 }
+
+func TestBuntStore_Closed(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	// Closing again is a no-op
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := store.FirstIndex(); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if _, err := store.LastIndex(); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if err := store.GetLog(1, new(raft.Log)); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if err := store.DeleteRange(1, 2); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if err := store.Set([]byte("k"), []byte("v")); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if _, err := store.Get([]byte("k")); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if _, err := store.GetUint64([]byte("k")); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if _, err := store.Peers(); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+	if err := store.Shrink(); err != ErrClosed {
+		t.Fatalf("expected closed error, got: %v", err)
+	}
+}
+
+func TestBuntStore_StrictAppend(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+	store.opts.StrictAppend = true
+
+	// Any start is fine on an empty log
+	logs := []*raft.Log{
+		testRaftLog(5, "log5"),
+		testRaftLog(6, "log6"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Batches must be contiguous
+	logs = []*raft.Log{
+		testRaftLog(7, "log7"),
+		testRaftLog(9, "log9"),
+	}
+	err := store.StoreLogs(logs)
+	if e, ok := err.(*ErrNonContiguous); !ok || e.Index != 9 || e.Expected != 8 {
+		t.Fatalf("expected non-contiguous error, got: %v", err)
+	}
+
+	// And may not leave a hole after the tail
+	err = store.StoreLog(testRaftLog(8, "log8"))
+	if e, ok := err.(*ErrNonContiguous); !ok || e.Expected != 7 {
+		t.Fatalf("expected non-contiguous error, got: %v", err)
+	}
+
+	// Or before the head
+	err = store.StoreLog(testRaftLog(3, "log3"))
+	if _, ok := err.(*ErrNonContiguous); !ok {
+		t.Fatalf("expected non-contiguous error, got: %v", err)
+	}
+
+	// Appending and overwriting the tail are allowed
+	if err := store.StoreLog(testRaftLog(7, "log7")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(6, "log6b")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(4, "log4")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestBuntStore_ZeroCopy(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ZeroCopy: true})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The stored value doesn't alias the caller's data
+	logs[0].Data[0] = 'x'
+	for i, data := range []string{"log1", ""} {
+		log := new(raft.Log)
+		if err := store.GetLog(uint64(i+1), log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(log.Data) != data || log.Data == nil {
+			t.Fatalf("bad: %#v", log)
+		}
+	}
+	log := new(raft.Log)
+	if n := testing.AllocsPerRun(100, func() { store.GetLog(1, log) }); n > 1 {
+		t.Fatalf("bad: %v allocs", n)
+	}
+}
+
+func TestBuntStore_EncodeLogs(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{ChunkSize: 16})
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	logs := []*raft.Log{
+		testRaftLog(1, "small"),
+		testRaftLog(2, "over the chunk size"),
+		testRaftLog(3, "small"),
+	}
+	vals := store.encodeLogs(logs)
+	if vals[0] == "" || vals[1] != "" || vals[2] == "" {
+		t.Fatalf("bad: %q", vals)
+	}
+	var log raft.Log
+	if err := decodeLog(3, vals[2], &log); err != nil || log.Index != 3 || string(log.Data) != "small" {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+
+	// The batch is stored with the large log in chunks
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, want := range logs {
+		if err := store.GetLog(want.Index, &log); err != nil || string(log.Data) != string(want.Data) {
+			t.Fatalf("bad: %v %+v", err, log)
+		}
+	}
+}
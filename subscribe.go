@@ -0,0 +1,88 @@
+package raftbuntdb
+
+import (
+	"sync"
+
+	"github.com/tidwall/raft"
+)
+
+// subscribeBatch is the number of logs a subscription reads per read
+// transaction, and the size of its channel's buffer.
+const subscribeBatch = 256
+
+// logNotifier wakes subscriptions when logs are committed.
+type logNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait returns a channel that is closed by the next notify.
+func (n *logNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	return n.ch
+}
+
+func (n *logNotifier) notify() {
+	n.mu.Lock()
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+	n.mu.Unlock()
+}
+
+// Subscribe streams the logs from fromIndex in index order, first those
+// already stored and then each log as it is committed, such as for change
+// data capture. Logs deleted before they're read are skipped, and a log
+// that is replaced after it was sent, such as when raft replaces a
+// conflicting tail, isn't sent again. The channel is closed after the
+// returned function is called, when the store is closed, or when reading
+// the log fails. A subscriber that falls behind only delays itself.
+func (b *BuntStore) Subscribe(fromIndex uint64) (<-chan *raft.Log, func()) {
+	ch := make(chan *raft.Log, subscribeBatch)
+	stop := make(chan struct{})
+	var once sync.Once
+	go b.runSubscription(fromIndex, ch, stop)
+	return ch, func() { once.Do(func() { close(stop) }) }
+}
+
+func (b *BuntStore) runSubscription(next uint64, ch chan<- *raft.Log,
+	stop <-chan struct{}) {
+	defer close(ch)
+	for {
+		// Wait on the commits made from here, so none is missed
+		wait := b.notifier.wait()
+		var logs []*raft.Log
+		err := b.AscendLogGreaterOrEqual(next, func(log *raft.Log) bool {
+			logs = append(logs, log)
+			return len(logs) < subscribeBatch
+		})
+		if err != nil {
+			return
+		}
+		for _, log := range logs {
+			select {
+			case ch <- log:
+			case <-stop:
+				return
+			case <-b.done:
+				return
+			}
+			next = log.Index + 1
+		}
+		if len(logs) == subscribeBatch {
+			continue
+		}
+		select {
+		case <-wait:
+		case <-stop:
+			return
+		case <-b.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package raftbuntdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+func receiveLogs(t *testing.T, ch <-chan *raft.Log, n int) []uint64 {
+	t.Helper()
+	var idxs []uint64
+	for len(idxs) < n {
+		select {
+		case log, ok := <-ch:
+			if !ok {
+				t.Fatalf("closed after %v", idxs)
+			}
+			idxs = append(idxs, log.Index)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %v", idxs)
+		}
+	}
+	return idxs
+}
+
+func checkClosed(t *testing.T, ch <-chan *raft.Log) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("not closed")
+		}
+	}
+}
+
+func TestBuntStore_Subscribe(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 300; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Stored logs are sent first, over more than one batch
+	ch, cancel := store.Subscribe(5)
+	idxs := receiveLogs(t, ch, 296)
+	if idxs[0] != 5 || idxs[295] != 300 {
+		t.Fatalf("bad: %v", idxs)
+	}
+
+	// Then each new log as it's committed
+	for i := uint64(301); i <= 303; i++ {
+		if err := store.StoreLog(testRaftLog(i, "new")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if idxs := receiveLogs(t, ch, 3); idxs[0] != 301 || idxs[2] != 303 {
+		t.Fatalf("bad: %v", idxs)
+	}
+	select {
+	case log := <-ch:
+		t.Fatalf("bad: %d", log.Index)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	cancel()
+	checkClosed(t, ch)
+}
+
+func TestBuntStore_SubscribeClose(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{GroupCommit: &GroupCommit{}})
+	ch, cancel := store.Subscribe(0)
+	defer cancel()
+	if err := store.StoreLog(testRaftLog(1, "log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idxs := receiveLogs(t, ch, 1); idxs[0] != 1 {
+		t.Fatalf("bad: %v", idxs)
+	}
+	store.Close()
+	checkClosed(t, ch)
+}
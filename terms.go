@@ -0,0 +1,92 @@
+package raftbuntdb
+
+import (
+	"encoding/binary"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// termsIndex is the name of the index over the log terms, created when
+// Options.TermIndex is set.
+const termsIndex = "terms"
+
+// lessLogTerm orders log values by the term in their header. Logs with the
+// same term keep the order of their keys.
+func lessLogTerm(a, b string) bool {
+	return valueTerm(a) < valueTerm(b)
+}
+
+func valueTerm(val string) uint64 {
+	if len(val) < 16 {
+		return 0
+	}
+	return leUint64(val[8:16])
+}
+
+// termPivot returns the pivot for scanning termsIndex from term.
+func termPivot(term uint64) string {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[8:], term)
+	return string(buf[:])
+}
+
+// LogsByTerm calls iter with each log of term in index order, until iter
+// returns false. It uses the term index when Options.TermIndex is set and
+// otherwise scans the whole log.
+func (b *BuntStore) LogsByTerm(term uint64, iter func(log *raft.Log) bool) error {
+	return b.view(func(tx *buntdb.Tx) error {
+		var err error
+		visit := func(key, val string) bool {
+			if valueTerm(val) != term {
+				// Past the term in the index, skipped in a scan
+				return !b.opts.TermIndex
+			}
+			if val, err = b.readLog(tx, key, val); err != nil {
+				err = &ErrCorruptEntry{Index: logIndex(key), Err: err}
+				return false
+			}
+			log := new(raft.Log)
+			if err = decodeLog(logIndex(key), val, log); err != nil {
+				err = corruptEntry(logIndex(key), val, err)
+				return false
+			}
+			return iter(log)
+		}
+		var serr error
+		if b.opts.TermIndex {
+			serr = tx.AscendGreaterOrEqual(termsIndex, termPivot(term), visit)
+		} else {
+			serr = b.keys.ascendLogs(tx, 0, visit)
+		}
+		return firstErr(serr, err)
+	})
+}
+
+// LastIndexOfTerm returns the index of the last log of term, or zero if
+// the store has no logs of term.
+func (b *BuntStore) LastIndexOfTerm(term uint64) (uint64, error) {
+	var idx uint64
+	err := b.view(func(tx *buntdb.Tx) error {
+		visit := func(key, val string) bool {
+			switch t := valueTerm(val); {
+			case t > term:
+				return true
+			case t < term:
+				// Past the term in the index, skipped in a scan
+				return !b.opts.TermIndex
+			}
+			idx = logIndex(key)
+			return false
+		}
+		switch {
+		case !b.opts.TermIndex:
+			return b.keys.descendLogs(tx, 1<<64-1, visit)
+		case term == 1<<64-1:
+			return tx.Descend(termsIndex, visit)
+		default:
+			return tx.DescendLessOrEqual(termsIndex, termPivot(term+1), visit)
+		}
+	})
+	return idx, err
+}
@@ -0,0 +1,65 @@
+package raftbuntdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func testTermLogs(t *testing.T, store *BuntStore) {
+	var logs []*raft.Log
+	for i := uint64(1); i <= 12; i++ {
+		log := testRaftLog(i, "log")
+		log.Term = (i + 3) / 4 // four logs per term
+		logs = append(logs, log)
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var got []uint64
+	err := store.LogsByTerm(2, func(log *raft.Log) bool {
+		got = append(got, log.Index)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(got) != 4 || got[0] != 5 || got[3] != 8 {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Stops when iter returns false
+	got = nil
+	store.LogsByTerm(3, func(log *raft.Log) bool {
+		got = append(got, log.Index)
+		return false
+	})
+	if len(got) != 1 || got[0] != 9 {
+		t.Fatalf("bad: %v", got)
+	}
+
+	for term, expect := range map[uint64]uint64{1: 4, 2: 8, 3: 12, 4: 0, 1<<64 - 1: 0} {
+		idx, err := store.LastIndexOfTerm(term)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if idx != expect {
+			t.Fatalf("bad: term %d: %d", term, idx)
+		}
+	}
+}
+
+func TestBuntStore_LogsByTerm(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+	testTermLogs(t, store)
+}
+
+func TestBuntStore_LogsByTermIndex(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{TermIndex: true})
+	defer store.Close()
+	defer os.Remove(store.path)
+	testTermLogs(t, store)
+}
@@ -0,0 +1,37 @@
+package raftbuntdb
+
+import (
+	"io"
+	"time"
+)
+
+// throttledWriter limits the writes to w to rate bytes per second on
+// average since the first write.
+type throttledWriter struct {
+	w       io.Writer
+	rate    int64
+	start   time.Time
+	written int64
+}
+
+// throttle returns w limited to Options.MaintenanceRate, or w when there
+// is no limit.
+func (b *BuntStore) throttle(w io.Writer) io.Writer {
+	if b.opts.MaintenanceRate <= 0 {
+		return w
+	}
+	return &throttledWriter{w: w, rate: b.opts.MaintenanceRate}
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	n, err := t.w.Write(p)
+	t.written += int64(n)
+	due := time.Duration(float64(t.written) / float64(t.rate) * float64(time.Second))
+	if d := due - time.Since(t.start); d > 0 {
+		time.Sleep(d)
+	}
+	return n, err
+}
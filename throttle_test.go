@@ -0,0 +1,83 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+func TestThrottledWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &throttledWriter{w: &buf, rate: 1 << 20}
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write(make([]byte, 10<<10)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	// 100KB at 1MB/s
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatalf("bad: %s", d)
+	}
+	if buf.Len() != 100<<10 {
+		t.Fatalf("bad: %d", buf.Len())
+	}
+}
+
+func TestBuntStore_MaintenanceRate(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{MaintenanceRate: 1 << 20})
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 3000; i++ {
+		logs = append(logs, testRaftLog(i, fmt.Sprintf("log %d", i)))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(1, 2000); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.SetUint64([]byte("CurrentTerm"), 2)
+
+	before := fileSize(t, store.path)
+	if err := store.Shrink(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if after := fileSize(t, store.path); after >= before {
+		t.Fatalf("bad: %d -> %d", before, after)
+	}
+	checkCounter(t, store)
+
+	var buf bytes.Buffer
+	start := time.Now()
+	if err := store.Backup(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if d, min := time.Since(start), time.Duration(buf.Len())*time.Second/(1<<20); d < min*9/10 {
+		t.Fatalf("bad: %s for %d bytes", d, buf.Len())
+	}
+
+	// The backup restores to the same contents
+	path := filepath.Join(t.TempDir(), "raft.db")
+	if err := Restore(path, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	restored, err := NewBuntStore(path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer restored.Close()
+	if n, _ := restored.LogCount(); n != 1000 {
+		t.Fatalf("bad: %d", n)
+	}
+	if idx, _ := restored.FirstIndex(); idx != 2001 {
+		t.Fatalf("bad: %d", idx)
+	}
+	if term, _ := restored.GetUint64([]byte("CurrentTerm")); term != 2 {
+		t.Fatalf("bad: %d", term)
+	}
+}
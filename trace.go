@@ -0,0 +1,296 @@
+package raftbuntdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tidwall/raft"
+)
+
+// traceVersion is the version of the trace format, written each time a
+// store starts a trace.
+const traceVersion = 1
+
+// traceOp is the kind of a trace record.
+type traceOp byte
+
+const (
+	traceOpen traceOp = iota + 1
+	traceStoreLogs
+	traceDeleteRange
+	traceSet
+	traceDelete
+)
+
+func (op traceOp) String() string {
+	switch op {
+	case traceOpen:
+		return "open"
+	case traceStoreLogs:
+		return "StoreLogs"
+	case traceDeleteRange:
+		return "DeleteRange"
+	case traceSet:
+		return "Set"
+	case traceDelete:
+		return "Delete"
+	}
+	return "unknown"
+}
+
+// traceRecord is a call recorded in a trace, with the fields of its op.
+type traceRecord struct {
+	op       traceOp
+	logs     []*raft.Log
+	min, max uint64
+	key, val []byte
+
+	// failed is the error of the call, or empty if it succeeded
+	failed string
+}
+
+// tracer writes the trace of Options.Trace. Its lock is held across each
+// traced call, so the calls are recorded in the order they commit.
+type tracer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+	err error
+}
+
+// write records a call, unless an earlier write failed.
+func (t *tracer) write(rec *traceRecord) {
+	if t.err != nil {
+		return
+	}
+	t.buf = appendTraceRecord(t.buf[:0], rec)
+	_, t.err = t.w.Write(t.buf)
+}
+
+// startTrace writes the start of a trace for a store just opened.
+func (b *BuntStore) startTrace() error {
+	b.tracer = &tracer{w: b.opts.Trace}
+	b.tracer.write(&traceRecord{op: traceOpen})
+	return b.tracer.err
+}
+
+// traced runs a call of the raft interfaces and records it in the trace.
+func (b *BuntStore) traced(rec traceRecord, call func() error) error {
+	t := b.tracer
+	if t == nil {
+		return call()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := call()
+	if err != nil {
+		rec.failed = err.Error()
+		if rec.failed == "" {
+			rec.failed = "error"
+		}
+	}
+	t.write(&rec)
+	return err
+}
+
+// traceErr returns the error that stopped the trace, if any.
+func (b *BuntStore) traceErr() error {
+	if b.tracer == nil {
+		return nil
+	}
+	b.tracer.mu.Lock()
+	defer b.tracer.mu.Unlock()
+	return b.tracer.err
+}
+
+func appendUvarintBytes(buf, p []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(p)))
+	return append(buf, p...)
+}
+
+// appendTraceRecord appends rec to buf: its op, the fields of the op in
+// uvarints and length-prefixed bytes, then the error of the call.
+func appendTraceRecord(buf []byte, rec *traceRecord) []byte {
+	buf = append(buf, byte(rec.op))
+	switch rec.op {
+	case traceOpen:
+		return binary.AppendUvarint(buf, traceVersion)
+	case traceStoreLogs:
+		buf = binary.AppendUvarint(buf, uint64(len(rec.logs)))
+		for _, log := range rec.logs {
+			buf = binary.AppendUvarint(buf, log.Index)
+			buf = binary.AppendUvarint(buf, log.Term)
+			buf = append(buf, byte(log.Type))
+			buf = appendUvarintBytes(buf, log.Data)
+		}
+	case traceDeleteRange:
+		buf = binary.AppendUvarint(buf, rec.min)
+		buf = binary.AppendUvarint(buf, rec.max)
+	case traceSet:
+		buf = appendUvarintBytes(buf, rec.key)
+		buf = appendUvarintBytes(buf, rec.val)
+	case traceDelete:
+		buf = appendUvarintBytes(buf, rec.key)
+	}
+	return appendUvarintBytes(buf, []byte(rec.failed))
+}
+
+// errBadTrace is returned for a trace that doesn't parse.
+var errBadTrace = errors.New("bad trace")
+
+// errNoDelete is returned by ReplayTrace for a Delete call when the store
+// has no Delete method.
+var errNoDelete = errors.New("store has no Delete method")
+
+// traceReader reads the records of a trace.
+type traceReader struct {
+	rd *bufio.Reader
+}
+
+func (r *traceReader) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(r.rd)
+	if err != nil {
+		return 0, errBadTrace
+	}
+	return v, nil
+}
+
+func (r *traceReader) bytes() ([]byte, error) {
+	n, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > 1<<32 {
+		return nil, errBadTrace
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(r.rd, p); err != nil {
+		return nil, errBadTrace
+	}
+	return p, nil
+}
+
+// next reads the next record. It returns io.EOF at the end of the trace.
+func (r *traceReader) next() (*traceRecord, error) {
+	op, err := r.rd.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	rec := &traceRecord{op: traceOp(op)}
+	switch rec.op {
+	case traceOpen:
+		v, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if v != traceVersion {
+			return nil, fmt.Errorf("unsupported trace version %d", v)
+		}
+		return rec, nil
+	case traceStoreLogs:
+		n, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < n; i++ {
+			log := new(raft.Log)
+			if log.Index, err = r.uvarint(); err != nil {
+				return nil, err
+			}
+			if log.Term, err = r.uvarint(); err != nil {
+				return nil, err
+			}
+			typ, err := r.rd.ReadByte()
+			if err != nil {
+				return nil, errBadTrace
+			}
+			log.Type = raft.LogType(typ)
+			if log.Data, err = r.bytes(); err != nil {
+				return nil, err
+			}
+			rec.logs = append(rec.logs, log)
+		}
+	case traceDeleteRange:
+		if rec.min, err = r.uvarint(); err != nil {
+			return nil, err
+		}
+		if rec.max, err = r.uvarint(); err != nil {
+			return nil, err
+		}
+	case traceSet:
+		if rec.key, err = r.bytes(); err != nil {
+			return nil, err
+		}
+		if rec.val, err = r.bytes(); err != nil {
+			return nil, err
+		}
+	case traceDelete:
+		if rec.key, err = r.bytes(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errBadTrace
+	}
+	failed, err := r.bytes()
+	if err != nil {
+		return nil, err
+	}
+	rec.failed = string(failed)
+	return rec, nil
+}
+
+// ReplayTrace runs the calls recorded by Options.Trace against store, in
+// order, and returns the number of calls replayed. A call that fails when
+// it succeeded in the trace, or the other way around, stops the replay
+// with an ErrTraceDiverged.
+//
+// The trace starts from the state of the store when it was opened, so it
+// should be replayed against an empty store if it was recorded from the
+// creation of the store, or else against a copy of the file it was
+// recorded from. The trace of a store opened more than once holds each
+// session in turn.
+func ReplayTrace(r io.Reader, store Store) (int, error) {
+	tr := &traceReader{rd: bufio.NewReader(r)}
+	var records, calls int
+	for {
+		rec, err := tr.next()
+		if err == io.EOF {
+			if records == 0 {
+				return 0, errBadTrace
+			}
+			return calls, nil
+		}
+		if err != nil {
+			return calls, fmt.Errorf("trace record %d: %w", records+1, err)
+		}
+		if records == 0 && rec.op != traceOpen {
+			return 0, errBadTrace
+		}
+		records++
+		switch rec.op {
+		case traceOpen:
+			continue
+		case traceStoreLogs:
+			err = store.StoreLogs(rec.logs)
+		case traceDeleteRange:
+			err = store.DeleteRange(rec.min, rec.max)
+		case traceSet:
+			err = store.Set(rec.key, rec.val)
+		case traceDelete:
+			d, ok := store.(interface{ Delete(k []byte) error })
+			if !ok {
+				return calls, fmt.Errorf("trace record %d: %w", records, errNoDelete)
+			}
+			err = d.Delete(rec.key)
+		}
+		calls++
+		if (err != nil) != (rec.failed != "") {
+			return calls, &ErrTraceDiverged{Record: records, Op: rec.op.String(),
+				Traced: rec.failed, Err: err}
+		}
+	}
+}
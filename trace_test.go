@@ -0,0 +1,121 @@
+package raftbuntdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Trace(t *testing.T) {
+	var trace bytes.Buffer
+	store := testBuntStoreOpts(t, &Options{Trace: &trace})
+	defer os.Remove(store.path)
+
+	// Record a compaction interleaved with appends and a new leader
+	for i := uint64(1); i <= 20; i++ {
+		if err := store.StoreLog(testRaftLog(i, "data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if i == 10 {
+			if err := store.DeleteRange(1, 5); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+	}
+	if err := store.DeleteRange(18, 20); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(&raft.Log{Index: 18, Term: 2, Data: []byte("new")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Delete([]byte("k")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Replaying into an empty store gives the same state
+	replay := testBuntStore(t)
+	defer replay.Close()
+	defer os.Remove(replay.path)
+	n, err := ReplayTrace(bytes.NewReader(trace.Bytes()), replay)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 26 {
+		t.Fatalf("bad: %d calls", n)
+	}
+	first, _ := replay.FirstIndex()
+	last, _ := replay.LastIndex()
+	if first != 6 || last != 18 {
+		t.Fatalf("bad: %d %d", first, last)
+	}
+	var log raft.Log
+	if err := replay.GetLog(18, &log); err != nil || log.Term != 2 || string(log.Data) != "new" {
+		t.Fatalf("bad: %v %+v", err, log)
+	}
+	if term, err := replay.GetUint64([]byte("CurrentTerm")); err != nil || term != 2 {
+		t.Fatalf("bad: %v %d", err, term)
+	}
+	if _, err := replay.Get([]byte("k")); err != ErrKeyNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// A call that succeeds where it failed in the trace stops the replay
+	var failing bytes.Buffer
+	store = testBuntStoreOpts(t, &Options{Trace: &failing, StrictAppend: true})
+	defer os.Remove(store.path)
+	if err := store.StoreLog(testRaftLog(1, "data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(5, "data")); err == nil {
+		t.Fatalf("should fail")
+	}
+	store.Close()
+	replay = testBuntStore(t)
+	defer replay.Close()
+	defer os.Remove(replay.path)
+	_, err = ReplayTrace(bytes.NewReader(failing.Bytes()), replay)
+	var diverged *ErrTraceDiverged
+	if !errors.As(err, &diverged) || diverged.Record != 3 || diverged.Op != "StoreLogs" ||
+		diverged.Err != nil || diverged.Traced == "" {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// A truncated trace fails to parse
+	if _, err := ReplayTrace(bytes.NewReader(trace.Bytes()[:trace.Len()-3]), replay); !errors.Is(err, errBadTrace) {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := ReplayTrace(bytes.NewReader(nil), replay); err != errBadTrace {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("full")
+}
+
+func TestBuntStore_TraceWriteError(t *testing.T) {
+	// A trace that can't be started fails the open
+	fh, err := os.CreateTemp("", "bunt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fh.Close()
+	defer os.Remove(fh.Name())
+	if _, err := Open(fh.Name(), &Options{Trace: failingWriter{}}); err == nil || err.Error() != "full" {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package raftbuntdb
+
+import (
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// FSMPrefix is the key prefix of the state kept by the fsm package.
+const FSMPrefix = "f:"
+
+// reservedPrefixes are the key prefixes used by the store and the fsm
+// package.
+var reservedPrefixes = []string{dbLogs, dbChunks, dbConf, dbMeta, dbSnaps,
+	dbTimes, dbAudit, FSMPrefix}
+
+// IsReservedKey reports whether key has a prefix reserved by the store.
+// Keys passed to View and Update should not, and the prefixes are always
+// two bytes ending in ':', so application keys can be kept apart with a
+// prefix such as "app:". Stores created with Options.LogPrefix or
+// Options.StablePrefix reserve those too; see BuntStore.IsReservedKey.
+func IsReservedKey(key string) bool {
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReservedKey is like the IsReservedKey function, but with the prefixes
+// of the logs and the stable store the database was created with, so that
+// the default ones are free for the application when they were replaced.
+func (b *BuntStore) IsReservedKey(key string) bool {
+	for _, prefix := range reservedPrefixes {
+		if prefix == dbLogs || prefix == dbConf {
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return b.isLogKey(key) || strings.HasPrefix(key, b.keys.conf)
+}
+
+// View runs fn in a read-only transaction of the underlying database, so
+// that an application can keep its own state in the same file. See
+// IsReservedKey for the keys used by the store.
+func (b *BuntStore) View(fn func(tx *buntdb.Tx) error) error {
+	return b.view(fn)
+}
+
+// Update runs fn in a read-write transaction of the underlying database,
+// so that an application can commit its own state atomically, such as an
+// FSM's data along with its applied index. The transaction is committed
+// with the store's durability. fn must not modify keys reserved by the
+// store, see IsReservedKey, and must not call back into the store.
+func (b *BuntStore) Update(fn func(tx *buntdb.Tx) error) error {
+	return b.update(fn)
+}
+
+// DB returns the underlying database, for buntdb features the store doesn't
+// wrap, such as custom indexes. This is dangerous: the store assumes it is
+// the only writer of its reserved keys, see IsReservedKey, and changing them
+// or closing or shrinking the database behind its back can corrupt the log
+// or its counters. Writes through DB don't have the store's recovery or
+// health tracking. The database is replaced when the store reopens its
+// file, such as after RestoreFrom, so DB should be called for each use
+// rather than kept. After Close, it returns the closed database.
+func (b *BuntStore) DB() *buntdb.DB {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.db
+}
@@ -0,0 +1,109 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestIsReservedKey(t *testing.T) {
+	for _, key := range []string{"l:00000000000000000001", "c:CurrentTerm",
+		"m:version", "s:1-2-3", "t:1", "f:key", "k:1:0", "a:1"} {
+		if !IsReservedKey(key) {
+			t.Fatalf("expected %q to be reserved", key)
+		}
+	}
+	for _, key := range []string{"app:applied", "l", "", "x:y"} {
+		if IsReservedKey(key) {
+			t.Fatalf("expected %q not to be reserved", key)
+		}
+	}
+}
+
+func TestBuntStore_ViewUpdate(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+
+	err := store.Update(func(tx *buntdb.Tx) error {
+		if _, _, err := tx.Set("app:state", "data", nil); err != nil {
+			return err
+		}
+		_, _, err := tx.Set("app:applied", "10", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A failed update is rolled back
+	errApp := errors.New("app")
+	err = store.Update(func(tx *buntdb.Tx) error {
+		tx.Set("app:applied", "11", nil)
+		return errApp
+	})
+	if err != errApp {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Application keys survive a reopen, and don't show up as stable keys
+	store.Close()
+	store, err = NewBuntStore(store.path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	err = store.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get("app:applied")
+		if err != nil || val != "10" {
+			t.Fatalf("bad: %q %v", val, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if keys, _ := store.StableKeys(); len(keys) != 0 {
+		t.Fatalf("bad: %q", keys)
+	}
+	if idx, _ := store.LastIndex(); idx != 0 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_DB(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+
+	// Custom indexes can be created on application keys
+	db := store.DB()
+	if err := db.CreateIndex("app", "app:*", buntdb.IndexInt); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err := store.Update(func(tx *buntdb.Tx) error {
+		for _, kv := range [][2]string{{"app:a", "3"}, {"app:b", "1"}, {"app:c", "2"}} {
+			if _, _, err := tx.Set(kv[0], kv[1], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var keys []string
+	err = store.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("app", func(key, val string) bool {
+			keys = append(keys, key)
+			return true
+		})
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.Join(keys, ",") != "app:b,app:c,app:a" {
+		t.Fatalf("bad: %v", keys)
+	}
+}
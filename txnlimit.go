@@ -0,0 +1,70 @@
+package raftbuntdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// TxnLimit caps the size of the transactions that StoreLogs writes a batch
+// in. A larger batch, such as the thousands of entries of a restore
+// pipeline, is split into parts that are committed one after another, so
+// the memory buntdb holds for a transaction stays bounded. Each part is
+// committed with the store's durability. If a part fails the parts before
+// it stay stored, so the log holds a prefix of the batch, without a hole.
+// Batches coalesced by GroupCommit are not split.
+type TxnLimit struct {
+	// MaxEntries is the most logs in one transaction.
+	MaxEntries int
+
+	// MaxBytes is the most bytes of log data in one transaction. A log
+	// larger than it gets a transaction of its own.
+	MaxBytes int64
+}
+
+// split returns the parts of logs that fit the limit.
+func (l *TxnLimit) split(logs []*raft.Log) [][]*raft.Log {
+	var parts [][]*raft.Log
+	var start int
+	var size int64
+	for i, log := range logs {
+		n := int64(len(log.Data))
+		full := l.MaxEntries > 0 && i-start == l.MaxEntries
+		if l.MaxBytes > 0 && i > start && size+n > l.MaxBytes {
+			full = true
+		}
+		if full {
+			parts = append(parts, logs[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	return append(parts, logs[start:])
+}
+
+// storeLogParts stores logs in the transactions allowed by
+// Options.TxnLimit, stopping with the context's error once it is done.
+func (b *BuntStore) storeLogParts(ctx context.Context, logs []*raft.Log) error {
+	parts := [][]*raft.Log{logs}
+	if b.opts.TxnLimit != nil {
+		parts = b.opts.TxnLimit.split(logs)
+	}
+	for _, part := range parts {
+		vals := b.encodeLogs(part)
+		err := b.updateLogs(func(tx *buntdb.Tx, d *logDelta) error {
+			if err := b.storeLogs(tx, part, vals, time.Now(), d); err != nil {
+				return err
+			}
+			// Rolls back the part
+			return ctx.Err()
+		})
+		if err != nil {
+			return err
+		}
+		b.backlog.add(b.opts.Backpressure, logsSize(part))
+		b.onStoreLogs(part)
+	}
+	return nil
+}
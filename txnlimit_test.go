@@ -0,0 +1,98 @@
+package raftbuntdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestTxnLimit_Split(t *testing.T) {
+	var logs []*raft.Log
+	for i, size := range []int{1, 2, 3, 10, 1, 1} {
+		logs = append(logs, &raft.Log{Index: uint64(i + 1), Data: make([]byte, size)})
+	}
+	for _, tc := range []struct {
+		limit TxnLimit
+		want  []int
+	}{
+		{TxnLimit{}, []int{6}},
+		{TxnLimit{MaxEntries: 4}, []int{4, 2}},
+		{TxnLimit{MaxEntries: 2}, []int{2, 2, 2}},
+		{TxnLimit{MaxBytes: 3}, []int{2, 1, 1, 2}},
+		{TxnLimit{MaxEntries: 1, MaxBytes: 100}, []int{1, 1, 1, 1, 1, 1}},
+	} {
+		parts := tc.limit.split(logs)
+		var got []int
+		var next uint64 = 1
+		for _, part := range parts {
+			got = append(got, len(part))
+			for _, log := range part {
+				if log.Index != next {
+					t.Fatalf("bad: %+v out of order", tc.limit)
+				}
+				next++
+			}
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("bad: %+v: %v, want %v", tc.limit, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("bad: %+v: %v, want %v", tc.limit, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestBuntStore_TxnLimit(t *testing.T) {
+	var parts [][2]uint64
+	store := testBuntStoreOpts(t, &Options{
+		TxnLimit: &TxnLimit{MaxEntries: 3},
+		Hooks: &Hooks{OnStoreLogs: func(logs []*raft.Log) {
+			parts = append(parts, [2]uint64{logs[0].Index, logs[len(logs)-1].Index})
+		}},
+	})
+	defer os.Remove(store.path)
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 7; i++ {
+		logs = append(logs, testRaftLog(i, "data"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(parts) != 3 || parts[0] != [2]uint64{1, 3} || parts[2] != [2]uint64{7, 7} {
+		t.Fatalf("bad: %v", parts)
+	}
+	if n, _ := store.LogCount(); n != 7 {
+		t.Fatalf("bad: %d", n)
+	}
+	checkCounter(t, store)
+}
+
+func TestBuntStore_TxnLimitFailure(t *testing.T) {
+	// The blob of the fourth log fails to be written
+	blobs := &failingBlobs{blobs: make(map[string][]byte), failOn: 3}
+	store := testBuntStoreOpts(t, &Options{
+		TxnLimit:      &TxnLimit{MaxEntries: 2},
+		Blobs:         blobs,
+		BlobThreshold: 1,
+	})
+	defer os.Remove(store.path)
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 6; i++ {
+		logs = append(logs, testRaftLog(i, "data"))
+	}
+	if err := store.StoreLogs(logs); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	// The first part is kept, the failed one rolled back
+	first, _ := store.FirstIndex()
+	last, _ := store.LastIndex()
+	if first != 1 || last != 2 || len(blobs.blobs) != 2 {
+		t.Fatalf("bad: %d %d %d", first, last, len(blobs.blobs))
+	}
+}
@@ -0,0 +1,179 @@
+package raftbuntdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// errIndexMismatch is the cause of an ErrCorruptEntry when the index
+// encoded in an entry does not match its key.
+var errIndexMismatch = errors.New("index does not match key")
+
+// stableUint64Keys are the stable keys that raft reads with GetUint64.
+var stableUint64Keys = []string{"CurrentTerm", "LastVoteTerm"}
+
+func isStableUint64Key(key []byte) bool {
+	for _, k := range stableUint64Keys {
+		if string(key) == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Range is an inclusive range of log indexes.
+type Range struct {
+	Min, Max uint64
+}
+
+// VerifyReport is the result of a Verify scan.
+type VerifyReport struct {
+	FirstIndex uint64
+	LastIndex  uint64
+
+	// Entries is the number of log entries scanned.
+	Entries uint64
+
+	// Corrupt holds the log entries that could not be decoded.
+	Corrupt []*ErrCorruptEntry
+
+	// Gaps holds the ranges missing between FirstIndex and LastIndex.
+	Gaps []Range
+
+	// BadStableKeys holds the stable keys with values that do not parse.
+	BadStableKeys []string
+}
+
+// OK returns true if the scan found no problems.
+func (r *VerifyReport) OK() bool {
+	return len(r.Corrupt) == 0 && len(r.Gaps) == 0 &&
+		len(r.BadStableKeys) == 0
+}
+
+func (r *VerifyReport) String() string {
+	return fmt.Sprintf("entries=%d first=%d last=%d corrupt=%d gaps=%d "+
+		"bad_stable_keys=%d", r.Entries, r.FirstIndex, r.LastIndex,
+		len(r.Corrupt), len(r.Gaps), len(r.BadStableKeys))
+}
+
+// Verify scans the entire store, checking that every log entry decodes and
+// is stored under its own index, that the log has no gaps, and that the
+// values of the stable keys used by raft parse. Problems are recorded in
+// the report; the error is only for failures to read the store. Unless
+// Options.HMACKey is set, entries carry no checksum, so a payload altered
+// in place is not detected.
+func (b *BuntStore) Verify() (VerifyReport, error) {
+	var report VerifyReport
+	var gaps gapScanner
+	var log raft.Log
+	err := b.scan("", func(tx *buntdb.Tx, key, val string) bool {
+		switch {
+		case b.isLogKey(key):
+			idx := logIndex(key)
+			gaps.add(idx)
+			if err := b.checkLog(tx, key, val, &log); err != nil {
+				report.Corrupt = append(report.Corrupt, err)
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = b.viewStable(func(tx *buntdb.Tx) error {
+			conf := b.keys.conf
+			return tx.AscendGreaterOrEqual("", conf, func(key, val string) bool {
+				if !strings.HasPrefix(key, conf) {
+					return false
+				}
+				name := key[len(conf):]
+				if !validStableValue(name, val) {
+					report.BadStableKeys = append(report.BadStableKeys, name)
+				}
+				return true
+			})
+		})
+	}
+	report.FirstIndex, report.LastIndex = gaps.first, gaps.last
+	report.Entries, report.Gaps = gaps.count, gaps.gaps
+	return report, err
+}
+
+// checkLog reads back the log with key and the value val into log,
+// returning an ErrCorruptEntry if it's corrupt.
+func (b *BuntStore) checkLog(tx *buntdb.Tx, key, val string,
+	log *raft.Log) *ErrCorruptEntry {
+	idx, err := parseLogIndex(key)
+	if err == nil {
+		val, err = b.readLog(tx, key, val)
+	}
+	if err == nil {
+		err = decodeLog(idx, val, log)
+	}
+	if err != nil {
+		return corruptEntry(idx, val, err)
+	}
+	return nil
+}
+
+// CheckConsistency returns the ranges of indexes that are missing between
+// the first and last index of the log. Unlike Verify it only looks at the
+// keys, so it's cheap enough to run routinely. A hole in the log usually
+// means a partial write or an incorrect DeleteRange.
+func (b *BuntStore) CheckConsistency() ([]Range, error) {
+	var gaps gapScanner
+	err := b.scan(b.logKey(0), func(tx *buntdb.Tx, key, val string) bool {
+		if !b.isLogKey(key) {
+			return false
+		}
+		gaps.add(logIndex(key))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gaps.gaps, nil
+}
+
+// gapScanner records the gaps in an ascending sequence of indexes.
+type gapScanner struct {
+	first, last uint64
+	count       uint64
+	gaps        []Range
+}
+
+func (g *gapScanner) add(idx uint64) {
+	if g.count == 0 {
+		g.first = idx
+	} else if idx > g.last+1 {
+		g.gaps = append(g.gaps, Range{g.last + 1, idx - 1})
+	}
+	g.last = idx
+	g.count++
+}
+
+// validStableValue checks the value of the stable keys with a known format.
+func validStableValue(name, val string) bool {
+	if name == "peers" {
+		var peers []string
+		return json.Unmarshal([]byte(val), &peers) == nil
+	}
+	if name == string(serversKey) {
+		var servers []Server
+		return json.Unmarshal([]byte(val), &servers) == nil
+	}
+	if name == string(configurationKey) {
+		var stored storedConfiguration
+		return json.Unmarshal([]byte(val), &stored) == nil
+	}
+	for _, key := range stableUint64Keys {
+		if name == key {
+			_, err := parseUint64(val)
+			return err == nil
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package raftbuntdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_Verify(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	// An empty store is fine
+	report, err := store.Verify()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !report.OK() || report.Entries != 0 {
+		t.Fatalf("bad: %s", report.String())
+	}
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	report, err = store.Verify()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !report.OK() || report.Entries != 10 || report.FirstIndex != 1 ||
+		report.LastIndex != 10 {
+		t.Fatalf("bad: %s", report.String())
+	}
+
+	// Introduce some damage
+	if err := store.DeleteRange(4, 5); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err = store.db.Update(func(tx *buntdb.Tx) error {
+		tx.Set(store.logKey(7), "bad", nil)
+		val, _ := encodeLog(testRaftLog(9, "log"))
+		tx.Set(store.logKey(8), string(val), nil)
+		tx.Set(dbConf+"CurrentTerm", "x", nil)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	report, err = store.Verify()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if report.OK() {
+		t.Fatalf("expected problems")
+	}
+	if !reflect.DeepEqual(report.Gaps, []Range{{4, 5}}) {
+		t.Fatalf("bad: %v", report.Gaps)
+	}
+	if len(report.Corrupt) != 2 || report.Corrupt[0].Index != 7 ||
+		report.Corrupt[1].Index != 8 {
+		t.Fatalf("bad: %v", report.Corrupt)
+	}
+	if !reflect.DeepEqual(report.BadStableKeys, []string{"CurrentTerm"}) {
+		t.Fatalf("bad: %v", report.BadStableKeys)
+	}
+}
+
+func TestBuntStore_CheckConsistency(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	defer os.Remove(store.path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Set([]byte("peers"), []byte("[]")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	gaps, err := store.CheckConsistency()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(gaps) != 0 {
+		t.Fatalf("bad: %v", gaps)
+	}
+
+	store.DeleteRange(3, 3)
+	store.DeleteRange(6, 8)
+	gaps, err = store.CheckConsistency()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(gaps, []Range{{3, 3}, {6, 8}}) {
+		t.Fatalf("bad: %v", gaps)
+	}
+}
@@ -0,0 +1,184 @@
+package raftbuntdb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const (
+	// Key prefix for store metadata
+	dbMeta = "m:"
+
+	// versionKey holds the format version of the database.
+	versionKey = dbMeta + "version"
+)
+
+// FormatVersion is the version of the format written by this package. New
+// databases are stamped with it. Databases from before versioning have
+// version 0 and can be upgraded with Migrate.
+const FormatVersion = 1
+
+// migrations upgrade a database from the version at their position to the
+// next one.
+var migrations = []func(tx *buntdb.Tx) error{
+	// 0: stable uint64 values may be zero-padded
+	migrateUint64Keys,
+}
+
+// Version returns the format version of the database.
+func (b *BuntStore) Version() (int, error) {
+	var version int
+	err := b.view(func(tx *buntdb.Tx) error {
+		var err error
+		version, err = readVersion(tx)
+		return err
+	})
+	return version, err
+}
+
+func readVersion(tx *buntdb.Tx) (int, error) {
+	val, err := tx.Get(versionKey)
+	if err != nil {
+		if err == buntdb.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	version, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", versionKey, err)
+	}
+	return version, nil
+}
+
+// checkFormat stamps an empty database with FormatVersion, the key layout
+// of opts and its metadata, and refuses a database written by a newer
+// version of this package or for another raft library. It returns the key
+// layout of the database.
+func checkFormat(db *buntdb.DB, opts *Options) (keyLayout, error) {
+	var keys keyLayout
+	err := db.Update(func(tx *buntdb.Tx) error {
+		n, err := tx.Len()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if keys, err = newKeyLayout(opts); err != nil {
+				return err
+			}
+			if _, _, err := tx.Set(versionKey, strconv.Itoa(FormatVersion), nil); err != nil {
+				return err
+			}
+			if err := writeMetadata(tx, time.Now()); err != nil {
+				return err
+			}
+			return writeKeyLayout(tx, keys)
+		}
+		version, err := readVersion(tx)
+		if err != nil {
+			return err
+		}
+		if version > FormatVersion {
+			return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+		}
+		if keys, err = readKeyLayout(tx); err != nil {
+			return err
+		}
+		if err := checkRaftLibrary(tx, keys.logs); err != nil {
+			return err
+		}
+		return checkKeyStyle(tx, keys)
+	})
+	return keys, err
+}
+
+// Migrate upgrades the database at path to FormatVersion in place, and
+// rewrites log keys that hold unpadded decimal indexes (see ErrKeyStyle).
+// The database must not be open. The original file is first copied to
+// path+".bak". A database that is already current is left untouched.
+func Migrate(path string) error {
+	lock, err := acquireLock(path, 0)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := buntdb.Open(path)
+	if err != nil {
+		return err
+	}
+	var version int
+	var keys keyLayout
+	var plain string
+	err = db.View(func(tx *buntdb.Tx) error {
+		if version, err = readVersion(tx); err != nil {
+			return err
+		}
+		if keys, err = readKeyLayout(tx); err != nil {
+			return err
+		}
+		plain, err = findPlainKey(tx, keys)
+		return err
+	})
+	if err == nil && version > FormatVersion {
+		err = fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	if err != nil || (version == FormatVersion && plain == "") {
+		db.Close()
+		return err
+	}
+	if err := copyFile(path+".bak", path); err != nil {
+		db.Close()
+		return err
+	}
+	err = db.Update(func(tx *buntdb.Tx) error {
+		for v := version; v < FormatVersion; v++ {
+			if err := migrations[v](tx); err != nil {
+				return fmt.Errorf("version %d: %w", v, err)
+			}
+		}
+		if plain != "" {
+			if err := rekeyLogs(tx, keys); err != nil {
+				return fmt.Errorf("log keys: %w", err)
+			}
+		}
+		_, _, err := tx.Set(versionKey, strconv.Itoa(FormatVersion), nil)
+		return err
+	})
+	return firstErr(err, db.Close())
+}
+
+// migrateUint64Keys rewrites the stable uint64 values in plain decimal.
+func migrateUint64Keys(tx *buntdb.Tx) error {
+	var keys [][]byte
+	for _, key := range stableUint64Keys {
+		keys = append(keys, []byte(key))
+	}
+	_, err := normalizeUint64Keys(tx, dbConf, keys, nil)
+	return err
+}
+
+// copyFile copies src to dst and syncs it.
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	return firstErr(err, out.Close())
+}
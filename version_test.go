@@ -0,0 +1,102 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestBuntStore_Version(t *testing.T) {
+	store := testBuntStore(t)
+	defer os.Remove(store.path)
+
+	// New databases are stamped
+	version, err := store.Version()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if version != FormatVersion {
+		t.Fatalf("bad: %d", version)
+	}
+	store.Close()
+
+	// Newer databases are refused
+	db, err := buntdb.Open(store.path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(versionKey, "99", nil)
+		return err
+	})
+	db.Close()
+	if _, err := NewBuntStore(store.path, Medium); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected unsupported version error, got: %v", err)
+	}
+	if err := Migrate(store.path); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected unsupported version error, got: %v", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	store := testBuntStore(t)
+	path := store.path
+	store.Close()
+	defer os.Remove(path)
+	defer os.Remove(path + ".bak")
+
+	// Write a database the way older versions did
+	os.Remove(path)
+	db, err := buntdb.Open(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	val, err := encodeLog(testRaftLog(1, "log"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db.Update(func(tx *buntdb.Tx) error {
+		tx.Set(dbConf+"CurrentTerm", uint64ToString(3), nil)
+		_, _, err := tx.Set(dbLogs+uint64ToString(1), string(val), nil)
+		return err
+	})
+	db.Close()
+
+	store, err = NewBuntStore(path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if version, _ := store.Version(); version != 0 {
+		t.Fatalf("bad: %d", version)
+	}
+	store.Close()
+
+	if err := Migrate(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(path + ".bak"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err = NewBuntStore(path, Medium)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if version, _ := store.Version(); version != FormatVersion {
+		t.Fatalf("bad: %d", version)
+	}
+	raw, err := store.Get([]byte("CurrentTerm"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(raw) != "3" {
+		t.Fatalf("bad: %q", raw)
+	}
+
+	// Can't migrate an open database
+	if err := Migrate(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected locked error, got: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package raftbuntdb
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/raft"
+)
+
+// StoreView is a frozen view of the log, returned by SnapshotView. It
+// keeps seeing the logs as they were when it was created, while the store
+// goes on appending, compacting and replacing logs. It is safe for
+// concurrent use.
+type StoreView struct {
+	mu     sync.RWMutex
+	closed bool
+	idxs   []uint64
+	vals   []string // encoded logs, shared with the database
+}
+
+// SnapshotView returns a frozen view of the log for a bulk reader, such as
+// an export that shouldn't see a moving tail. The view is made in a single
+// read transaction without copying the log data: the database never
+// modifies a stored value, so the view shares them, and holding it only
+// keeps deleted logs from being freed until it's closed. Writes carry on
+// while the view is open.
+func (b *BuntStore) SnapshotView() (*StoreView, error) {
+	v := new(StoreView)
+	err := b.view(func(tx *buntdb.Tx) error {
+		count, _ := b.counter.get()
+		v.idxs = make([]uint64, 0, count)
+		v.vals = make([]string, 0, count)
+		var cerr error
+		err := b.keys.ascendLogs(tx, 0, func(key, val string) bool {
+			// Chunked logs are read back into a value of their own
+			if val, cerr = b.readLog(tx, key, val); cerr != nil {
+				cerr = &ErrCorruptEntry{Index: logIndex(key), Err: cerr}
+				return false
+			}
+			v.idxs = append(v.idxs, logIndex(key))
+			v.vals = append(v.vals, val)
+			return true
+		})
+		return firstErr(err, cerr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// read runs fn with the view locked for reading.
+func (v *StoreView) read(fn func() error) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.closed {
+		return ErrClosed
+	}
+	return fn()
+}
+
+// Close releases the view. It is safe to call Close more than once.
+func (v *StoreView) Close() error {
+	v.mu.Lock()
+	v.closed = true
+	v.idxs, v.vals = nil, nil
+	v.mu.Unlock()
+	return nil
+}
+
+// FirstIndex returns the first index of the view, or zero if it's empty.
+func (v *StoreView) FirstIndex() (uint64, error) {
+	var idx uint64
+	err := v.read(func() error {
+		if len(v.idxs) > 0 {
+			idx = v.idxs[0]
+		}
+		return nil
+	})
+	return idx, err
+}
+
+// LastIndex returns the last index of the view, or zero if it's empty.
+func (v *StoreView) LastIndex() (uint64, error) {
+	var idx uint64
+	err := v.read(func() error {
+		if len(v.idxs) > 0 {
+			idx = v.idxs[len(v.idxs)-1]
+		}
+		return nil
+	})
+	return idx, err
+}
+
+// LogCount returns the number of logs in the view.
+func (v *StoreView) LogCount() (uint64, error) {
+	var n uint64
+	err := v.read(func() error {
+		n = uint64(len(v.idxs))
+		return nil
+	})
+	return n, err
+}
+
+// search returns the position of the first index >= idx.
+func (v *StoreView) search(idx uint64) int {
+	return sort.Search(len(v.idxs), func(i int) bool {
+		return v.idxs[i] >= idx
+	})
+}
+
+// GetLog retrieves the log at idx as it was when the view was created.
+func (v *StoreView) GetLog(idx uint64, log *raft.Log) error {
+	return v.read(func() error {
+		i := v.search(idx)
+		if i == len(v.idxs) || v.idxs[i] != idx {
+			return raft.ErrLogNotFound
+		}
+		if err := decodeLog(idx, v.vals[i], log); err != nil {
+			return corruptEntry(idx, v.vals[i], err)
+		}
+		return nil
+	})
+}
+
+// AscendLogRange calls iter with each log of the view from min to max
+// inclusively in index order, until iter returns false. The view isn't
+// locked while iter runs, so it may call back into the view.
+func (v *StoreView) AscendLogRange(min, max uint64,
+	iter func(log *raft.Log) bool) error {
+	var idxs []uint64
+	var vals []string
+	err := v.read(func() error {
+		i := v.search(min)
+		idxs, vals = v.idxs[i:], v.vals[i:]
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(idxs) && idxs[i] <= max; i++ {
+		log := new(raft.Log)
+		if err := decodeLog(idxs[i], vals[i], log); err != nil {
+			return corruptEntry(idxs[i], vals[i], err)
+		}
+		if !iter(log) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package raftbuntdb
+
+import (
+	"testing"
+
+	"github.com/tidwall/raft"
+)
+
+func TestBuntStore_SnapshotView(t *testing.T) {
+	store := testBuntStore(t)
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "old"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	view, err := store.SnapshotView()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer view.Close()
+
+	// The store moves on: compacts, replaces its tail and appends
+	if err := store.CompactTo(3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(9, 10); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(9, "new"),
+		testRaftLog(11, "new")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The view doesn't
+	first, _ := view.FirstIndex()
+	last, _ := view.LastIndex()
+	count, _ := view.LogCount()
+	if first != 1 || last != 10 || count != 10 {
+		t.Fatalf("bad: %d %d %d", first, last, count)
+	}
+	var log raft.Log
+	if err := view.GetLog(9, &log); err != nil || string(log.Data) != "old" {
+		t.Fatalf("bad: %v %q", err, log.Data)
+	}
+	if err := view.GetLog(11, &log); err != raft.ErrLogNotFound {
+		t.Fatalf("bad: %v", err)
+	}
+	var idxs []uint64
+	err = view.AscendLogRange(2, 9, func(log *raft.Log) bool {
+		idxs = append(idxs, log.Index)
+		return len(idxs) < 5
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(idxs) != 5 || idxs[0] != 2 || idxs[4] != 6 {
+		t.Fatalf("bad: %v", idxs)
+	}
+
+	view.Close()
+	if err := view.GetLog(2, &log); err != ErrClosed {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := view.AscendLogRange(0, 10, func(*raft.Log) bool { return true }); err != ErrClosed {
+		t.Fatalf("bad: %v", err)
+	}
+}
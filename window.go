@@ -0,0 +1,138 @@
+package raftbuntdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ShrinkSchedule restricts the shrinks made by OnSnapshot to maintenance
+// windows. A shrink that OnSnapshot decides on outside of the windows is
+// deferred, and a background goroutine runs it once a window opens. The
+// deferred shrink is not remembered across a restart.
+type ShrinkSchedule struct {
+	// Windows are the times at which shrinks are allowed.
+	Windows []ShrinkWindow
+
+	// Interval is how often a deferred shrink checks for an open window.
+	// Defaults to a minute.
+	Interval time.Duration
+
+	// OnError is called when a deferred shrink fails. Optional.
+	OnError func(error)
+}
+
+// ShrinkWindow is a daily range of time, such as from 02:00 to 04:30.
+type ShrinkWindow struct {
+	// Start and End are offsets from midnight. A window with an End
+	// before its Start runs past midnight.
+	Start, End time.Duration
+
+	// Days are the days on which the window starts. Defaults to every
+	// day.
+	Days []time.Weekday
+
+	// Location is the time zone of the window. Defaults to time.Local.
+	Location *time.Location
+}
+
+// Contains reports whether t is within the window.
+func (w ShrinkWindow) Contains(t time.Time) bool {
+	loc := w.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	off := t.Sub(midnight)
+	if w.Start <= w.End {
+		return off >= w.Start && off < w.End && w.onDay(t.Weekday())
+	}
+	return off >= w.Start && w.onDay(t.Weekday()) ||
+		off < w.End && w.onDay((t.Weekday()+6)%7)
+}
+
+func (w ShrinkWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether a shrink is allowed at t. A nil schedule always
+// allows it.
+func (s *ShrinkSchedule) allows(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	for _, w := range s.Windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// deferredShrink records a shrink waiting for a window.
+type deferredShrink struct {
+	mu      sync.Mutex
+	pending bool
+}
+
+func (d *deferredShrink) set(v bool) {
+	d.mu.Lock()
+	d.pending = v
+	d.mu.Unlock()
+}
+
+func (d *deferredShrink) get() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending
+}
+
+// ShrinkPending reports whether a shrink decided on by OnSnapshot is
+// waiting for a window of the ShrinkSchedule.
+func (b *BuntStore) ShrinkPending() bool {
+	return b.deferred.get()
+}
+
+// runShrinkSchedule runs deferred shrinks until the store is closed.
+func (b *BuntStore) runShrinkSchedule() {
+	schedule := b.opts.ShrinkSchedule
+	interval := schedule.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case now := <-t.C:
+			err := b.runDeferredShrink(now)
+			if err != nil && !errors.Is(err, ErrClosed) && schedule.OnError != nil {
+				schedule.OnError(err)
+			}
+		}
+	}
+}
+
+// runDeferredShrink shrinks the file if a shrink is pending and allowed at
+// now. A failed shrink stays pending.
+func (b *BuntStore) runDeferredShrink(now time.Time) error {
+	if !b.deferred.get() || !b.opts.ShrinkSchedule.allows(now) {
+		return nil
+	}
+	if err := b.Shrink(); err != nil {
+		return err
+	}
+	b.deferred.set(false)
+	return nil
+}
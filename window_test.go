@@ -0,0 +1,118 @@
+package raftbuntdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tidwall/raft"
+)
+
+func TestShrinkWindow_Contains(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		// 2024-01-01 is a Monday
+		return time.Date(2024, 1, day, hour, min, 0, 0, time.UTC)
+	}
+	night := ShrinkWindow{Start: 2 * time.Hour, End: 4*time.Hour + 30*time.Minute,
+		Location: time.UTC}
+	weekend := ShrinkWindow{Start: 22 * time.Hour, End: 2 * time.Hour,
+		Days: []time.Weekday{time.Saturday}, Location: time.UTC}
+	for i, tt := range []struct {
+		w    ShrinkWindow
+		t    time.Time
+		want bool
+	}{
+		{night, at(1, 2, 0), true},
+		{night, at(1, 4, 29), true},
+		{night, at(1, 4, 30), false},
+		{night, at(1, 1, 59), false},
+		{weekend, at(6, 23, 0), true},  // Saturday night
+		{weekend, at(7, 1, 0), true},   // into Sunday
+		{weekend, at(7, 2, 0), false},  // closed
+		{weekend, at(7, 23, 0), false}, // Sunday night
+		{weekend, at(6, 1, 0), false},  // Friday's night
+	} {
+		if got := tt.w.Contains(tt.t); got != tt.want {
+			t.Fatalf("%d: got %v, want %v", i, got, tt.want)
+		}
+	}
+
+	// The window is in its own time zone
+	loc := time.FixedZone("UTC+5", 5*60*60)
+	w := ShrinkWindow{Start: 2 * time.Hour, End: 3 * time.Hour, Location: loc}
+	if !w.Contains(at(1, 21, 30)) || w.Contains(at(1, 2, 30)) {
+		t.Fatalf("bad: %+v", w)
+	}
+}
+
+func TestBuntStore_ShrinkSchedule(t *testing.T) {
+	now := time.Now()
+	closed := ShrinkWindow{Start: time.Hour, End: time.Hour}
+	store := testBuntStoreOpts(t, &Options{
+		ShrinkSchedule: &ShrinkSchedule{
+			Windows:  []ShrinkWindow{closed},
+			Interval: time.Hour,
+		},
+	})
+	defer store.Close()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 100; i++ {
+		logs = append(logs, testRaftLog(i, "some log data"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Outside of the windows, the shrink is deferred
+	before := fileSize(t, store.path)
+	reclaimed, err := store.OnSnapshot(raft.SnapshotMeta{Index: 90})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if reclaimed != 0 || !store.ShrinkPending() {
+		t.Fatalf("bad: %d", reclaimed)
+	}
+	if err := store.runDeferredShrink(now); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if size := fileSize(t, store.path); size < before || !store.ShrinkPending() {
+		t.Fatalf("bad: %d -> %d", before, size)
+	}
+
+	// And runs once a window opens
+	store.opts.ShrinkSchedule.Windows = append(store.opts.ShrinkSchedule.Windows,
+		ShrinkWindow{Start: 0, End: 24 * time.Hour})
+	if err := store.runDeferredShrink(now); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if size := fileSize(t, store.path); size >= before || store.ShrinkPending() {
+		t.Fatalf("bad: %d -> %d", before, size)
+	}
+	if idx, _ := store.FirstIndex(); idx != 91 {
+		t.Fatalf("bad: %d", idx)
+	}
+}
+
+func TestBuntStore_ShrinkScheduleBackground(t *testing.T) {
+	errs := make(chan error, 1)
+	store := testBuntStoreOpts(t, &Options{
+		ShrinkSchedule: &ShrinkSchedule{
+			Windows:  []ShrinkWindow{{Start: 0, End: 24 * time.Hour}},
+			Interval: time.Millisecond,
+			OnError:  func(err error) { errs <- err },
+		},
+	})
+	defer store.Close()
+	store.deferred.set(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for store.ShrinkPending() {
+		if time.Now().After(deadline) {
+			t.Fatalf("deferred shrink didn't run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("err: %s", err)
+	default:
+	}
+}
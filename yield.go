@@ -0,0 +1,48 @@
+package raftbuntdb
+
+import (
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// yieldCheck is the number of keys a scan visits between checks of
+// Options.MaxViewDuration, so that it doesn't read the clock for every key.
+const yieldCheck = 256
+
+// scan passes the keys from pivot on to visit, in order, until
+// visit returns false. With Options.MaxViewDuration set, the scan is split
+// over read transactions that each last around that long, and resumes
+// after the last key it visited. Go's RWMutex lets a writer that is
+// waiting for the lock in before the next transaction, so appends only
+// wait for one part of the scan.
+func (b *BuntStore) scan(pivot string,
+	visit func(tx *buntdb.Tx, key, val string) bool) error {
+	max := b.opts.MaxViewDuration
+	var last string
+	for resumed := false; ; resumed = true {
+		var yielded bool
+		err := b.view(func(tx *buntdb.Tx) error {
+			start := time.Now()
+			var n int
+			return tx.AscendGreaterOrEqual("", pivot, func(key, val string) bool {
+				if resumed && key == last {
+					return true
+				}
+				if !visit(tx, key, val) {
+					return false
+				}
+				last, pivot = key, key
+				n++
+				if max > 0 && n%yieldCheck == 0 && time.Since(start) >= max {
+					yielded = true
+					return false
+				}
+				return true
+			})
+		})
+		if err != nil || !yielded {
+			return err
+		}
+	}
+}
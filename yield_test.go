@@ -0,0 +1,56 @@
+package raftbuntdb
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestBuntStore_MaxViewDuration(t *testing.T) {
+	store := testBuntStoreOpts(t, &Options{MaxViewDuration: time.Nanosecond})
+	defer store.Close()
+	defer os.Remove(store.path)
+	for i := uint64(1); i <= 2*yieldCheck+10; i++ {
+		if err := store.StoreLog(testRaftLog(i, "data")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// An append waiting for the lock goes ahead of the rest of the scan,
+	// which sees it
+	var n int
+	var appended bool
+	err := store.scan(store.logKey(0), func(tx *buntdb.Tx, key, val string) bool {
+		if !store.isLogKey(key) {
+			return false
+		}
+		if n == 0 {
+			go store.StoreLog(testRaftLog(1000, "data"))
+			time.Sleep(50 * time.Millisecond)
+		}
+		appended = appended || logIndex(key) == 1000
+		n++
+		return true
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !appended || n != 2*yieldCheck+11 {
+		t.Fatalf("bad: appended=%v n=%d", appended, n)
+	}
+
+	// The scans still see the whole log
+	report, err := store.Verify()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if report.Entries != 2*yieldCheck+11 || len(report.Gaps) != 1 {
+		t.Fatalf("bad: %s", report.String())
+	}
+	gaps, err := store.CheckConsistency()
+	if err != nil || len(gaps) != 1 || gaps[0] != (Range{2*yieldCheck + 11, 999}) {
+		t.Fatalf("bad: %v %v", err, gaps)
+	}
+}
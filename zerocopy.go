@@ -0,0 +1,21 @@
+package raftbuntdb
+
+import "unsafe"
+
+// stringToBytes returns the bytes of s without copying. The bytes must not
+// be modified.
+func stringToBytes(s string) []byte {
+	if len(s) == 0 {
+		return []byte{}
+	}
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// bytesToString returns b as a string without copying. b must not be
+// modified afterwards.
+func bytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}